@@ -13,6 +13,7 @@ import (
 	"go.sia.tech/hostd/host/accounts"
 	"go.sia.tech/hostd/host/contracts"
 	"go.sia.tech/hostd/host/metrics"
+	"go.sia.tech/hostd/host/policy"
 	"go.sia.tech/hostd/host/settings"
 	"go.sia.tech/hostd/host/storage"
 	"go.sia.tech/hostd/rhp"
@@ -30,9 +31,12 @@ type (
 		ScanHeight() uint64
 		Balance() (spendable, confirmed, unconfirmed types.Currency, err error)
 		UnconfirmedTransactions() ([]wallet.Transaction, error)
-		FundTransaction(txn *types.Transaction, amount types.Currency) (toSign []types.Hash256, release func(), err error)
+		FundTransaction(txn *types.Transaction, amount types.Currency, outputs ...types.SiacoinOutputID) (toSign []types.Hash256, release func(), err error)
 		SignTransaction(cs consensus.State, txn *types.Transaction, toSign []types.Hash256, cf types.CoveredFields) error
 		Transactions(limit, offset int) ([]wallet.Transaction, error)
+		RotateKey(newKey types.PrivateKey) (wallet.SweepResult, error)
+		UnspentOutputs() ([]wallet.UnspentOutput, error)
+		Consolidate(maxInputs int, feePerByte types.Currency) (types.Transaction, error)
 	}
 
 	// Settings updates and retrieves the host's settings
@@ -44,6 +48,7 @@ type (
 		LastAnnouncement() (settings.Announcement, error)
 
 		UpdateDDNS(force bool) error
+		BandwidthStatus() settings.BandwidthStatus
 	}
 
 	// Metrics retrieves metrics related to the host
@@ -60,21 +65,55 @@ type (
 		Volumes() ([]storage.VolumeMeta, error)
 		Volume(id int64) (storage.VolumeMeta, error)
 		AddVolume(ctx context.Context, localPath string, maxSectors uint64, result chan<- error) (storage.Volume, error)
+		AddCacheVolume(ctx context.Context, localPath string, maxSectors uint64, result chan<- error) (storage.Volume, error)
+		AddS3Volume(ctx context.Context, cfg storage.S3Config, maxSectors uint64, result chan<- error) (storage.Volume, error)
 		RemoveVolume(ctx context.Context, id int64, force bool, result chan<- error) error
 		ResizeVolume(ctx context.Context, id int64, maxSectors uint64, result chan<- error) error
+		ExportVolume(ctx context.Context, id int64, dir string, result chan<- error) error
+		ImportVolume(ctx context.Context, dir string, result chan<- error) error
 		SetReadOnly(id int64, readOnly bool) error
+		SetPriority(id int64, priority uint64) error
+		Rebalance()
 		RemoveSector(root types.Hash256) error
 		ResizeCache(size uint32)
 		Read(types.Hash256) (*[rhp2.SectorSize]byte, error)
 
+		// SetScrubRate sets the number of sectors per minute the scrubber
+		// will verify
+		SetScrubRate(rate uint64)
+		// SetReplicationFactor sets the number of copies of each sector
+		// stored in distinct volumes
+		SetReplicationFactor(n uint64)
+		// SetEncryptVolumes sets whether new volumes are encrypted at rest
+		SetEncryptVolumes(encrypt bool)
+		// EncryptVolume encrypts the existing sector data of a volume
+		EncryptVolume(ctx context.Context, id int64, result chan<- error) error
+		// ScrubStatus returns the scrub progress and bad sectors of a volume
+		ScrubStatus(id int64, limit, offset int) (storage.ScrubStatus, error)
+		// TierStats returns the cache hit and miss counts of each storage tier
+		TierStats() storage.TierStats
+
 		// SectorReferences returns the references to a sector
 		SectorReferences(root types.Hash256) (storage.SectorReference, error)
+
+		// TempSectors returns the sectors in temporary storage ordered by
+		// expiration height
+		TempSectors(limit, offset int) ([]storage.TempStorageSector, error)
+		// TempStorageSummary returns a summary of the sectors in temporary
+		// storage
+		TempStorageSummary() (storage.TempStorageSummary, error)
+		// RemoveTempSectors immediately expires the given temporary sectors,
+		// or all temporary sectors if roots is empty
+		RemoveTempSectors(roots []types.Hash256) (int, error)
 	}
 
 	// A ContractManager manages the host's contracts
 	ContractManager interface {
 		Contracts(filter contracts.ContractFilter) ([]contracts.Contract, int, error)
 		Contract(id types.FileContractID) (contracts.Contract, error)
+		// UpcomingProofs returns the active contracts whose proof window
+		// opens within horizon blocks.
+		UpcomingProofs(horizon uint64) ([]contracts.UpcomingProof, error)
 
 		// CheckIntegrity checks the integrity of a contract's sector roots on
 		// disk. The result of each sector checked is sent on the returned
@@ -131,6 +170,42 @@ type (
 		Active() []rhp.Session
 	}
 
+	// A ConnLimiter limits connections to the RHP listeners and bans peers
+	// that repeatedly misbehave
+	ConnLimiter interface {
+		Bans() []rhp.Ban
+		Unban(address string) error
+		ClearBans()
+	}
+
+	// A MaintenanceManager drains the RHP servers and rejects new sessions
+	// while the host is in maintenance mode
+	MaintenanceManager interface {
+		Enable(drainTimeout time.Duration)
+		Disable()
+		Status() rhp.MaintenanceStatus
+	}
+
+	// A PolicyManager manages the host's contract acceptance policy
+	PolicyManager interface {
+		Policy() (policy.Policy, error)
+		UpdatePolicy(policy.Policy) error
+
+		RenterAccessList() ([]policy.RenterAccess, error)
+		SetRenterAccess(renterKey types.PublicKey, allowed bool) error
+		RemoveRenterAccess(renterKey types.PublicKey) error
+		RenterUsage(renterKey types.PublicKey) (policy.RenterUsage, error)
+
+		RenterBandwidth(renterKey types.PublicKey, start, end time.Time) ([]policy.RenterBandwidth, error)
+		RenterBandwidthTotals(start, end time.Time, limit, offset int) ([]policy.RenterBandwidth, error)
+	}
+
+	// A SQLite3Store is a SQLite3 database that can be backed up while the
+	// host is running
+	SQLite3Store interface {
+		Backup(ctx context.Context, destPath string) error
+	}
+
 	// An api provides an HTTP API for the host
 	api struct {
 		hostKey types.PublicKey
@@ -138,18 +213,22 @@ type (
 
 		log *zap.Logger
 
-		alerts    Alerts
-		webhooks  WebHooks
-		syncer    Syncer
-		chain     ChainManager
-		tpool     TPool
-		accounts  AccountManager
-		contracts ContractManager
-		volumes   VolumeManager
-		wallet    Wallet
-		metrics   Metrics
-		settings  Settings
-		sessions  RHPSessionReporter
+		alerts      Alerts
+		webhooks    WebHooks
+		syncer      Syncer
+		chain       ChainManager
+		tpool       TPool
+		accounts    AccountManager
+		contracts   ContractManager
+		policies    PolicyManager
+		volumes     VolumeManager
+		wallet      Wallet
+		metrics     Metrics
+		settings    Settings
+		sessions    RHPSessionReporter
+		limiter     ConnLimiter
+		maintenance MaintenanceManager
+		sqlite3     SQLite3Store
 
 		volumeJobs volumeJobs
 		checks     integrityCheckJobs
@@ -157,24 +236,28 @@ type (
 )
 
 // NewServer initializes the API
-func NewServer(name string, hostKey types.PublicKey, a Alerts, wh WebHooks, g Syncer, chain ChainManager, tp TPool, cm ContractManager, am AccountManager, vm VolumeManager, rsr RHPSessionReporter, m Metrics, s Settings, w Wallet, log *zap.Logger) http.Handler {
+func NewServer(name string, hostKey types.PublicKey, a Alerts, wh WebHooks, g Syncer, chain ChainManager, tp TPool, cm ContractManager, am AccountManager, pm PolicyManager, vm VolumeManager, rsr RHPSessionReporter, cl ConnLimiter, mm MaintenanceManager, m Metrics, s Settings, w Wallet, sqlite3 SQLite3Store, log *zap.Logger) http.Handler {
 	api := &api{
 		hostKey: hostKey,
 		name:    name,
 
-		alerts:    a,
-		webhooks:  wh,
-		syncer:    g,
-		chain:     chain,
-		tpool:     tp,
-		contracts: cm,
-		accounts:  am,
-		volumes:   vm,
-		metrics:   m,
-		settings:  s,
-		wallet:    w,
-		sessions:  rsr,
-		log:       log,
+		alerts:      a,
+		webhooks:    wh,
+		syncer:      g,
+		chain:       chain,
+		tpool:       tp,
+		contracts:   cm,
+		accounts:    am,
+		policies:    pm,
+		volumes:     vm,
+		metrics:     m,
+		settings:    s,
+		wallet:      w,
+		sessions:    rsr,
+		limiter:     cl,
+		maintenance: mm,
+		sqlite3:     sqlite3,
+		log:         log,
 
 		checks: integrityCheckJobs{
 			contracts: cm,
@@ -202,6 +285,7 @@ func NewServer(name string, hostKey types.PublicKey, a Alerts, wh WebHooks, g Sy
 		"PATCH /settings":           api.handlePATCHSettings,
 		"POST /settings/announce":   api.handlePOSTAnnounce,
 		"PUT /settings/ddns/update": api.handlePUTDDNSUpdate,
+		"GET /settings/bandwidth":   api.handleGETSettingsBandwidth,
 		// metrics endpoints
 		"GET /metrics":         api.handleGETMetrics,
 		"GET /metrics/:period": api.handleGETPeriodMetrics,
@@ -211,33 +295,67 @@ func NewServer(name string, hostKey types.PublicKey, a Alerts, wh WebHooks, g Sy
 		"GET /contracts/:id/integrity":    api.handleGETContractCheck,
 		"PUT /contracts/:id/integrity":    api.handlePUTContractCheck,
 		"DELETE /contracts/:id/integrity": api.handleDeleteContractCheck,
+		// proof endpoints
+		"GET /proofs/upcoming": api.handleGETUpcomingProofs,
 		// account endpoints
 		"GET /accounts":                  api.handleGETAccounts,
 		"GET /accounts/:account/funding": api.handleGETAccountFunding,
+		// policy endpoints
+		"GET /policies":                        api.handleGETPolicies,
+		"PUT /policies":                        api.handlePUTPolicies,
+		"GET /policies/renters":                api.handleGETPoliciesRenters,
+		"PUT /policies/renters/:key":           api.handlePUTPoliciesRenter,
+		"DELETE /policies/renters/:key":        api.handleDELETEPoliciesRenter,
+		"GET /policies/renters/:key/usage":     api.handleGETPoliciesRenterUsage,
+		"GET /policies/renters/:key/bandwidth": api.handleGETPoliciesRenterBandwidth,
+		"GET /policies/bandwidth":              api.handleGETPoliciesBandwidth,
 		// sector endpoints
 		"DELETE /sectors/:root":     api.handleDeleteSector,
 		"GET /sectors/:root/verify": api.handleGETVerifySector,
+
+		"GET /temp-sectors":         api.handleGETTempSectors,
+		"POST /temp-sectors/expire": api.handlePOSTTempSectorsExpire,
 		// volume endpoints
 		"GET /volumes":               api.handleGETVolumes,
 		"POST /volumes":              api.handlePOSTVolume,
+		"POST /volumes/rebalance":    api.handlePOSTVolumesRebalance,
+		"POST /volumes/export":       api.handlePOSTVolumeExport,
+		"POST /volumes/import":       api.handlePOSTVolumeImport,
 		"GET /volumes/:id":           api.handleGETVolume,
 		"PUT /volumes/:id":           api.handlePUTVolume,
 		"DELETE /volumes/:id":        api.handleDeleteVolume,
 		"DELETE /volumes/:id/cancel": api.handleDELETEVolumeCancelOp,
+		"GET /volumes/:id/scrub":     api.handleGETVolumeScrub,
 		"PUT /volumes/:id/resize":    api.handlePUTVolumeResize,
+		"PUT /volumes/:id/priority":  api.handlePUTVolumePriority,
+		"PUT /volumes/:id/encrypt":   api.handlePUTVolumeEncrypt,
+		// storage endpoints
+		"GET /storage/tiers": api.handleGETStorageTiers,
 		// session endpoints
 		"GET /sessions":           api.handleGETSessions,
 		"GET /sessions/subscribe": api.handleGETSessionsSubscribe,
+		// ban endpoints
+		"GET /bans":             api.handleGETBans,
+		"DELETE /bans":          api.handleDELETEBans,
+		"DELETE /bans/:address": api.handleDELETEBan,
+		// maintenance endpoints
+		"GET /maintenance": api.handleGETMaintenance,
+		"PUT /maintenance": api.handlePUTMaintenance,
 		// tpool endpoints
 		"GET /tpool/fee": api.handleGETTPoolFee,
 		// wallet endpoints
 		"GET /wallet":              api.handleGETWallet,
 		"GET /wallet/transactions": api.handleGETWalletTransactions,
 		"GET /wallet/pending":      api.handleGETWalletPending,
+		"GET /wallet/outputs":      api.handleGETWalletOutputs,
+		"POST /wallet/consolidate": api.handlePOSTWalletConsolidate,
 		"POST /wallet/send":        api.handlePOSTWalletSend,
+		"POST /wallet/send/batch":  api.handlePOSTWalletSendBatch,
+		"POST /wallet/rotate":      api.handlePOSTWalletRotate,
 		// system endpoints
-		"GET /system/dir": api.handleGETSystemDir,
-		"PUT /system/dir": api.handlePUTSystemDir,
+		"GET /system/dir":     api.handleGETSystemDir,
+		"PUT /system/dir":     api.handlePUTSystemDir,
+		"POST /system/backup": api.handlePOSTSystemBackup,
 		// webhook endpoints
 		"GET /webhooks":           api.handleGETWebhooks,
 		"POST /webhooks":          api.handlePOSTWebhooks,
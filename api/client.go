@@ -9,8 +9,10 @@ import (
 	"go.sia.tech/core/types"
 	"go.sia.tech/hostd/host/contracts"
 	"go.sia.tech/hostd/host/metrics"
+	"go.sia.tech/hostd/host/policy"
 	"go.sia.tech/hostd/host/settings"
 	"go.sia.tech/hostd/host/storage"
+	"go.sia.tech/hostd/rhp"
 	"go.sia.tech/hostd/wallet"
 	"go.sia.tech/hostd/webhooks"
 	"go.sia.tech/jape"
@@ -67,6 +69,13 @@ func (c *Client) Settings() (settings settings.Settings, err error) {
 	return
 }
 
+// BandwidthStatus returns the host's current bandwidth limits and the time
+// they will next change.
+func (c *Client) BandwidthStatus() (status settings.BandwidthStatus, err error) {
+	err = c.c.GET("/settings/bandwidth", &status)
+	return
+}
+
 // UpdateSettings updates the host's settings.
 func (c *Client) UpdateSettings(updated ...Setting) (settings settings.Settings, err error) {
 	values := make(map[string]any)
@@ -114,6 +123,13 @@ func (c *Client) Contract(id types.FileContractID) (contract contracts.Contract,
 	return
 }
 
+// UpcomingProofs returns the active contracts whose proof window opens within
+// horizon blocks.
+func (c *Client) UpcomingProofs(horizon uint64) (proofs []contracts.UpcomingProof, err error) {
+	err = c.c.GET(fmt.Sprintf("/proofs/upcoming?horizon=%d", horizon), &proofs)
+	return
+}
+
 // StartIntegrityCheck scans the volume with the specified ID for consistency errors.
 func (c *Client) StartIntegrityCheck(id types.FileContractID) error {
 	return c.c.PUT(fmt.Sprintf("/contracts/%v/integrity", id), nil)
@@ -138,6 +154,30 @@ func (c *Client) DeleteSector(root types.Hash256) error {
 	return c.c.DELETE(fmt.Sprintf("/sectors/%s", root))
 }
 
+// TempSectors returns a page of the sectors in temporary storage and a
+// summary of temporary storage usage.
+func (c *Client) TempSectors(limit, offset int) (resp TempSectorsResponse, err error) {
+	err = c.c.GET(fmt.Sprintf("/temp-sectors?limit=%d&offset=%d", limit, offset), &resp)
+	return
+}
+
+// ExpireTempSectors immediately expires the temporary storage references of
+// the given sectors. Sectors not referenced by a contract are removed. The
+// number of references removed is returned.
+func (c *Client) ExpireTempSectors(roots []types.Hash256) (int, error) {
+	var resp ExpireTempSectorsResponse
+	err := c.c.POST("/temp-sectors/expire", ExpireTempSectorsRequest{Roots: roots}, &resp)
+	return resp.Removed, err
+}
+
+// ExpireAllTempSectors immediately expires all temporary sectors. The number
+// of references removed is returned.
+func (c *Client) ExpireAllTempSectors() (int, error) {
+	var resp ExpireTempSectorsResponse
+	err := c.c.POST("/temp-sectors/expire", ExpireTempSectorsRequest{All: true}, &resp)
+	return resp.Removed, err
+}
+
 // Volumes returns the volumes of the host.
 func (c *Client) Volumes() (volumes []VolumeMeta, err error) {
 	err = c.c.GET("/volumes", &volumes)
@@ -150,6 +190,18 @@ func (c *Client) Volume(id int) (volume VolumeMeta, err error) {
 	return
 }
 
+// StorageTierStats returns the cache hit and miss counts of each storage tier
+func (c *Client) StorageTierStats() (stats storage.TierStats, err error) {
+	err = c.c.GET("/storage/tiers", &stats)
+	return
+}
+
+// VolumeScrubStatus returns the scrub progress and bad sectors of a volume
+func (c *Client) VolumeScrubStatus(id int, limit, offset int) (status storage.ScrubStatus, err error) {
+	err = c.c.GET(fmt.Sprintf("/volumes/%d/scrub?limit=%d&offset=%d", id, limit, offset), &status)
+	return
+}
+
 // AddVolume adds a new volume to the host
 func (c *Client) AddVolume(localPath string, sectors uint64) (vol storage.Volume, err error) {
 	req := AddVolumeRequest{
@@ -160,6 +212,28 @@ func (c *Client) AddVolume(localPath string, sectors uint64) (vol storage.Volume
 	return
 }
 
+// AddCacheVolume adds a new cache tier volume to the host
+func (c *Client) AddCacheVolume(localPath string, sectors uint64) (vol storage.Volume, err error) {
+	req := AddVolumeRequest{
+		LocalPath:  localPath,
+		MaxSectors: sectors,
+		CacheTier:  true,
+	}
+	err = c.c.POST("/volumes", req, &vol)
+	return
+}
+
+// AddS3Volume adds a new volume to the host that stores its sector data in an
+// S3-compatible bucket
+func (c *Client) AddS3Volume(cfg storage.S3Config, sectors uint64) (vol storage.Volume, err error) {
+	req := AddVolumeRequest{
+		MaxSectors: sectors,
+		S3:         &cfg,
+	}
+	err = c.c.POST("/volumes", req, &vol)
+	return
+}
+
 // UpdateVolume updates the volume with the specified ID.
 func (c *Client) UpdateVolume(id int, req UpdateVolumeRequest) error {
 	return c.c.PUT(fmt.Sprintf("/volumes/%v", id), req)
@@ -178,6 +252,46 @@ func (c *Client) ResizeVolume(id int, sectors uint64) error {
 	return c.c.PUT(fmt.Sprintf("/volumes/%v/resize", id), req)
 }
 
+// SetVolumePriority sets the placement priority of the volume with the
+// specified ID.
+func (c *Client) SetVolumePriority(id int, priority uint64) error {
+	req := UpdateVolumePriorityRequest{
+		Priority: priority,
+	}
+	return c.c.PUT(fmt.Sprintf("/volumes/%v/priority", id), req)
+}
+
+// EncryptVolume encrypts the existing sector data of the volume with the
+// specified ID in the background.
+func (c *Client) EncryptVolume(id int) error {
+	return c.c.PUT(fmt.Sprintf("/volumes/%v/encrypt", id), nil)
+}
+
+// RebalanceVolumes moves sectors between the host's volumes in the
+// background to even out their utilization.
+func (c *Client) RebalanceVolumes() error {
+	return c.c.POST("/volumes/rebalance", nil, nil)
+}
+
+// ExportVolume exports the sectors stored in the volume with the specified ID
+// to a directory on the host. The export runs in the background.
+func (c *Client) ExportVolume(id int, path string) error {
+	req := ExportVolumeRequest{
+		ID:   int64(id),
+		Path: path,
+	}
+	return c.c.POST("/volumes/export", req, nil)
+}
+
+// ImportVolume imports a volume export from a directory on the host. The
+// import runs in the background.
+func (c *Client) ImportVolume(path string) error {
+	req := ImportVolumeRequest{
+		Path: path,
+	}
+	return c.c.POST("/volumes/import", req, nil)
+}
+
 // Wallet returns the state of the host's wallet.
 func (c *Client) Wallet() (resp WalletResponse, err error) {
 	err = c.c.GET("/wallet", &resp)
@@ -208,6 +322,38 @@ func (c *Client) SendSiacoins(address types.Address, amount types.Currency, subt
 	return
 }
 
+// SendSiacoinsBatch sends siacoins to multiple outputs in a single
+// transaction. If req.DryRun is set, the funded transaction is returned
+// unsigned and is not broadcast.
+func (c *Client) SendSiacoinsBatch(req WalletSendBatchRequest) (resp WalletSendBatchResponse, err error) {
+	err = c.c.POST("/wallet/send/batch", req, &resp)
+	return
+}
+
+// WalletOutputs returns the wallet's confirmed unspent outputs, ordered by
+// value descending.
+func (c *Client) WalletOutputs(limit, offset int) (outputs []wallet.UnspentOutput, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallet/outputs?limit=%d&offset=%d", limit, offset), &outputs)
+	return
+}
+
+// ConsolidateWalletOutputs merges the wallet's smallest outputs into a single
+// output.
+func (c *Client) ConsolidateWalletOutputs(req WalletConsolidateRequest) (txn types.Transaction, err error) {
+	err = c.c.POST("/wallet/consolidate", req, &txn)
+	return
+}
+
+// RotateWalletKey replaces the host's wallet key with the key derived from the
+// recovery phrase and sweeps the wallet's funds to the new address.
+func (c *Client) RotateWalletKey(recoveryPhrase string) (resp WalletRotateResponse, err error) {
+	req := WalletRotateRequest{
+		RecoveryPhrase: recoveryPhrase,
+	}
+	err = c.c.POST("/wallet/rotate", req, &resp)
+	return
+}
+
 // LocalDir returns the contents of the specified directory on the host.
 func (c *Client) LocalDir(path string) (resp SystemDirResponse, err error) {
 	v := url.Values{
@@ -225,6 +371,75 @@ func (c *Client) MkDir(path string) error {
 	return c.c.PUT("/system/dir", req)
 }
 
+// Backup writes a consistent copy of the host's database to the specified path
+// on the host. The destination file must not already exist.
+func (c *Client) Backup(path string) error {
+	req := BackupRequest{
+		Path: path,
+	}
+	return c.c.POST("/system/backup", req, nil)
+}
+
+// ContractPolicy returns the host's contract acceptance policy.
+func (c *Client) ContractPolicy() (p policy.Policy, err error) {
+	err = c.c.GET("/policies", &p)
+	return
+}
+
+// UpdateContractPolicy updates the host's contract acceptance policy.
+func (c *Client) UpdateContractPolicy(p policy.Policy) error {
+	return c.c.PUT("/policies", p)
+}
+
+// RenterAccessList returns the renters on the host's allow and block lists.
+func (c *Client) RenterAccessList() (list []policy.RenterAccess, err error) {
+	err = c.c.GET("/policies/renters", &list)
+	return
+}
+
+// SetRenterAccess adds a renter to the host's allow or block list.
+func (c *Client) SetRenterAccess(renterKey types.PublicKey, allowed bool) error {
+	req := UpdateRenterAccessRequest{
+		Allowed: allowed,
+	}
+	return c.c.PUT(fmt.Sprintf("/policies/renters/%v", renterKey), req)
+}
+
+// RemoveRenterAccess removes a renter from the host's allow and block lists.
+func (c *Client) RemoveRenterAccess(renterKey types.PublicKey) error {
+	return c.c.DELETE(fmt.Sprintf("/policies/renters/%v", renterKey))
+}
+
+// RenterUsage returns the data and collateral in a renter's active contracts.
+func (c *Client) RenterUsage(renterKey types.PublicKey) (usage policy.RenterUsage, err error) {
+	err = c.c.GET(fmt.Sprintf("/policies/renters/%v/usage", renterKey), &usage)
+	return
+}
+
+// RenterBandwidth returns the daily bandwidth usage of a renter between start
+// and end.
+func (c *Client) RenterBandwidth(renterKey types.PublicKey, start, end time.Time) (usage []policy.RenterBandwidth, err error) {
+	v := url.Values{
+		"start": []string{start.Format(time.RFC3339)},
+		"end":   []string{end.Format(time.RFC3339)},
+	}
+	err = c.c.GET(fmt.Sprintf("/policies/renters/%v/bandwidth?%s", renterKey, v.Encode()), &usage)
+	return
+}
+
+// RenterBandwidthTotals returns the total bandwidth usage of each renter
+// between start and end, ordered by egress.
+func (c *Client) RenterBandwidthTotals(start, end time.Time, limit, offset int) (totals []policy.RenterBandwidth, err error) {
+	v := url.Values{
+		"start":  []string{start.Format(time.RFC3339)},
+		"end":    []string{end.Format(time.RFC3339)},
+		"limit":  []string{strconv.Itoa(limit)},
+		"offset": []string{strconv.Itoa(offset)},
+	}
+	err = c.c.GET("/policies/bandwidth?"+v.Encode(), &totals)
+	return
+}
+
 // RegisterWebHook registers a new WebHook.
 func (c *Client) RegisterWebHook(callbackURL string, scopes []string) (hook webhooks.WebHook, err error) {
 	req := RegisterWebHookRequest{
@@ -256,6 +471,41 @@ func (c *Client) WebHooks() (hooks []webhooks.WebHook, err error) {
 	return
 }
 
+// Bans returns the peers that are temporarily banned from connecting to the
+// host.
+func (c *Client) Bans() (bans []rhp.Ban, err error) {
+	err = c.c.GET("/bans", &bans)
+	return
+}
+
+// Unban removes the ban of a peer.
+func (c *Client) Unban(address string) error {
+	return c.c.DELETE(fmt.Sprintf("/bans/%s", address))
+}
+
+// ClearBans removes all bans.
+func (c *Client) ClearBans() error {
+	return c.c.DELETE("/bans")
+}
+
+// Maintenance returns the state of maintenance mode.
+func (c *Client) Maintenance() (status rhp.MaintenanceStatus, err error) {
+	err = c.c.GET("/maintenance", &status)
+	return
+}
+
+// EnableMaintenance puts the host into maintenance mode. New sessions and
+// contract formations are rejected and existing sessions are closed once
+// their in-flight RPCs complete or the drain timeout passes.
+func (c *Client) EnableMaintenance(drainTimeout time.Duration) error {
+	return c.c.PUT("/maintenance", UpdateMaintenanceRequest{Enabled: true, DrainTimeout: drainTimeout})
+}
+
+// DisableMaintenance takes the host out of maintenance mode.
+func (c *Client) DisableMaintenance() error {
+	return c.c.PUT("/maintenance", UpdateMaintenanceRequest{Enabled: false})
+}
+
 // NewClient creates a new hostd API client.
 func NewClient(baseURL, password string) *Client {
 	return &Client{
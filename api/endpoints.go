@@ -1,6 +1,7 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,19 +13,30 @@ import (
 
 	rhp3 "go.sia.tech/core/rhp/v3"
 	"go.sia.tech/core/types"
+	cwallet "go.sia.tech/core/wallet"
 	"go.sia.tech/hostd/build"
 	"go.sia.tech/hostd/host/contracts"
 	"go.sia.tech/hostd/host/metrics"
+	"go.sia.tech/hostd/host/policy"
 	"go.sia.tech/hostd/host/settings"
 	"go.sia.tech/hostd/host/storage"
 	"go.sia.tech/hostd/internal/disk"
+	"go.sia.tech/hostd/wallet"
 	"go.sia.tech/hostd/webhooks"
 	"go.sia.tech/jape"
 	"go.sia.tech/siad/modules"
 	"go.uber.org/zap"
 )
 
-const stdTxnSize = 1200 // bytes
+const (
+	stdTxnSize = 1200 // bytes
+	// defaultProofHorizon is the default number of blocks to look ahead for
+	// upcoming proof windows.
+	defaultProofHorizon = 144 * 7 // 1 week
+	// maxProofHorizon is the maximum number of blocks to look ahead for
+	// upcoming proof windows.
+	maxProofHorizon = 144 * 365 // 1 year
+)
 
 var startTime = time.Now()
 
@@ -165,6 +177,9 @@ func (a *api) handlePATCHSettings(c jape.Context) {
 
 	// Resize the cache based on the updated settings
 	a.volumes.ResizeCache(settings.SectorCacheSize)
+	a.volumes.SetScrubRate(settings.ScrubRate)
+	a.volumes.SetReplicationFactor(settings.ReplicationFactor)
+	a.volumes.SetEncryptVolumes(settings.EncryptVolumes)
 
 	c.Encode(a.settings.Settings())
 }
@@ -174,6 +189,10 @@ func (a *api) handlePUTDDNSUpdate(c jape.Context) {
 	a.checkServerError(c, "failed to update dynamic DNS", err)
 }
 
+func (a *api) handleGETSettingsBandwidth(c jape.Context) {
+	c.Encode(a.settings.BandwidthStatus())
+}
+
 func (a *api) handleGETMetrics(c jape.Context) {
 	var timestamp time.Time
 	if err := c.DecodeForm("timestamp", &timestamp); err != nil {
@@ -284,6 +303,21 @@ func (a *api) handleGETContract(c jape.Context) {
 	c.Encode(contract)
 }
 
+func (a *api) handleGETUpcomingProofs(c jape.Context) {
+	horizon := defaultProofHorizon
+	if err := c.DecodeForm("horizon", &horizon); err != nil {
+		return
+	} else if horizon < 0 || horizon > maxProofHorizon {
+		c.Error(fmt.Errorf("horizon must be between 0 and %d blocks", maxProofHorizon), http.StatusBadRequest)
+		return
+	}
+	proofs, err := a.contracts.UpcomingProofs(uint64(horizon))
+	if !a.checkServerError(c, "failed to get upcoming proofs", err) {
+		return
+	}
+	c.Encode(proofs)
+}
+
 func (a *api) handleGETVolume(c jape.Context) {
 	var id int64
 	if err := c.DecodeParam("id", &id); err != nil {
@@ -303,6 +337,30 @@ func (a *api) handleGETVolume(c jape.Context) {
 	c.Encode(toJSONVolume(volume))
 }
 
+func (a *api) handleGETStorageTiers(c jape.Context) {
+	c.Encode(a.volumes.TierStats())
+}
+
+func (a *api) handleGETVolumeScrub(c jape.Context) {
+	var id int64
+	if err := c.DecodeParam("id", &id); err != nil {
+		return
+	} else if id < 0 {
+		c.Error(errors.New("invalid volume id"), http.StatusBadRequest)
+		return
+	}
+	limit, offset := parseLimitParams(c, 100, 500)
+
+	status, err := a.volumes.ScrubStatus(id, limit, offset)
+	if errors.Is(err, storage.ErrVolumeNotFound) {
+		c.Error(err, http.StatusNotFound)
+		return
+	} else if !a.checkServerError(c, "failed to get scrub status", err) {
+		return
+	}
+	c.Encode(status)
+}
+
 func (a *api) handlePUTVolume(c jape.Context) {
 	var id int64
 	if err := c.DecodeParam("id", &id); err != nil {
@@ -325,6 +383,98 @@ func (a *api) handlePUTVolume(c jape.Context) {
 	a.checkServerError(c, "failed to update volume", err)
 }
 
+func (a *api) handleGETPolicies(c jape.Context) {
+	p, err := a.policies.Policy()
+	if !a.checkServerError(c, "failed to get contract policy", err) {
+		return
+	}
+	c.Encode(p)
+}
+
+func (a *api) handlePUTPolicies(c jape.Context) {
+	var p policy.Policy
+	if err := c.Decode(&p); err != nil {
+		return
+	}
+	err := a.policies.UpdatePolicy(p)
+	a.checkServerError(c, "failed to update contract policy", err)
+}
+
+func (a *api) handleGETPoliciesRenters(c jape.Context) {
+	list, err := a.policies.RenterAccessList()
+	if !a.checkServerError(c, "failed to get renter access list", err) {
+		return
+	}
+	c.Encode(list)
+}
+
+func (a *api) handlePUTPoliciesRenter(c jape.Context) {
+	var renterKey types.PublicKey
+	if err := c.DecodeParam("key", &renterKey); err != nil {
+		return
+	}
+	var req UpdateRenterAccessRequest
+	if err := c.Decode(&req); err != nil {
+		return
+	}
+	err := a.policies.SetRenterAccess(renterKey, req.Allowed)
+	a.checkServerError(c, "failed to update renter access", err)
+}
+
+func (a *api) handleDELETEPoliciesRenter(c jape.Context) {
+	var renterKey types.PublicKey
+	if err := c.DecodeParam("key", &renterKey); err != nil {
+		return
+	}
+	err := a.policies.RemoveRenterAccess(renterKey)
+	if errors.Is(err, policy.ErrNotFound) {
+		c.Error(err, http.StatusNotFound)
+		return
+	}
+	a.checkServerError(c, "failed to remove renter access", err)
+}
+
+func (a *api) handleGETPoliciesRenterUsage(c jape.Context) {
+	var renterKey types.PublicKey
+	if err := c.DecodeParam("key", &renterKey); err != nil {
+		return
+	}
+	usage, err := a.policies.RenterUsage(renterKey)
+	if !a.checkServerError(c, "failed to get renter usage", err) {
+		return
+	}
+	c.Encode(usage)
+}
+
+func (a *api) handleGETPoliciesRenterBandwidth(c jape.Context) {
+	var renterKey types.PublicKey
+	if err := c.DecodeParam("key", &renterKey); err != nil {
+		return
+	}
+	start, end, ok := parseBandwidthRange(c)
+	if !ok {
+		return
+	}
+	usage, err := a.policies.RenterBandwidth(renterKey, start, end)
+	if !a.checkServerError(c, "failed to get renter bandwidth", err) {
+		return
+	}
+	c.Encode(usage)
+}
+
+func (a *api) handleGETPoliciesBandwidth(c jape.Context) {
+	start, end, ok := parseBandwidthRange(c)
+	if !ok {
+		return
+	}
+	limit, offset := parseLimitParams(c, 100, 500)
+	totals, err := a.policies.RenterBandwidthTotals(start, end, limit, offset)
+	if !a.checkServerError(c, "failed to get renter bandwidth totals", err) {
+		return
+	}
+	c.Encode(totals)
+}
+
 func (a *api) handleDeleteSector(c jape.Context) {
 	var root types.Hash256
 	if err := c.DecodeParam("root", &root); err != nil {
@@ -334,6 +484,44 @@ func (a *api) handleDeleteSector(c jape.Context) {
 	a.checkServerError(c, "failed to remove sector", err)
 }
 
+func (a *api) handleGETTempSectors(c jape.Context) {
+	limit, offset := parseLimitParams(c, 100, 500)
+
+	summary, err := a.volumes.TempStorageSummary()
+	if !a.checkServerError(c, "failed to get temp storage summary", err) {
+		return
+	}
+	sectors, err := a.volumes.TempSectors(limit, offset)
+	if !a.checkServerError(c, "failed to get temp sectors", err) {
+		return
+	} else if sectors == nil {
+		sectors = []storage.TempStorageSector{}
+	}
+	c.Encode(TempSectorsResponse{
+		TempStorageSummary: summary,
+		Sectors:            sectors,
+	})
+}
+
+func (a *api) handlePOSTTempSectorsExpire(c jape.Context) {
+	var req ExpireTempSectorsRequest
+	if err := c.Decode(&req); err != nil {
+		return
+	} else if req.All && len(req.Roots) != 0 {
+		c.Error(errors.New("roots must be empty when expiring all temp sectors"), http.StatusBadRequest)
+		return
+	} else if !req.All && len(req.Roots) == 0 {
+		c.Error(errors.New("no roots specified"), http.StatusBadRequest)
+		return
+	}
+
+	removed, err := a.volumes.RemoveTempSectors(req.Roots)
+	if !a.checkServerError(c, "failed to expire temp sectors", err) {
+		return
+	}
+	c.Encode(ExpireTempSectorsResponse{Removed: removed})
+}
+
 func (a *api) handleGETWallet(c jape.Context) {
 	spendable, confirmed, unconfirmed, err := a.wallet.Balance()
 	if !a.checkServerError(c, "failed to get wallet", err) {
@@ -358,6 +546,55 @@ func (a *api) handleGETWalletTransactions(c jape.Context) {
 	c.Encode(transactions)
 }
 
+func (a *api) handleGETWalletOutputs(c jape.Context) {
+	limit, offset := parseLimitParams(c, 100, 500)
+
+	outputs, err := a.wallet.UnspentOutputs()
+	if !a.checkServerError(c, "failed to get wallet outputs", err) {
+		return
+	}
+	if offset > len(outputs) {
+		offset = len(outputs)
+	}
+	outputs = outputs[offset:]
+	if len(outputs) > limit {
+		outputs = outputs[:limit]
+	}
+	c.Encode(outputs)
+}
+
+func (a *api) handlePOSTWalletConsolidate(c jape.Context) {
+	var req WalletConsolidateRequest
+	if err := c.Decode(&req); err != nil {
+		return
+	} else if req.MaxInputs < 0 {
+		c.Error(errors.New("max inputs must be positive"), http.StatusBadRequest)
+		return
+	} else if !req.FeePerByte.IsZero() && req.FeePriority != "" {
+		c.Error(errors.New("only one of fee per byte or fee priority can be set"), http.StatusBadRequest)
+		return
+	}
+
+	feePerByte := req.FeePerByte
+	if feePerByte.IsZero() {
+		var err error
+		feePerByte, err = a.feePerByte(req.FeePriority)
+		if err != nil {
+			c.Error(err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	txn, err := a.wallet.Consolidate(req.MaxInputs, feePerByte)
+	if errors.Is(err, wallet.ErrNothingToConsolidate) {
+		c.Error(err, http.StatusBadRequest)
+		return
+	} else if !a.checkServerError(c, "failed to consolidate outputs", err) {
+		return
+	}
+	c.Encode(txn)
+}
+
 func (a *api) handleGETWalletPending(c jape.Context) {
 	pending, err := a.wallet.UnconfirmedTransactions()
 	if !a.checkServerError(c, "failed to get wallet pending", err) {
@@ -412,6 +649,161 @@ func (a *api) handlePOSTWalletSend(c jape.Context) {
 	c.Encode(txn.ID())
 }
 
+// feePerByte returns the miner fee per byte for the given priority.
+func (a *api) feePerByte(priority FeePriority) (types.Currency, error) {
+	recommended := a.tpool.RecommendedFee()
+	switch priority {
+	case FeePriorityLow:
+		return recommended.Div64(2), nil
+	case FeePriorityMedium, "":
+		return recommended, nil
+	case FeePriorityHigh:
+		return recommended.Mul64(2), nil
+	}
+	return types.ZeroCurrency, fmt.Errorf("unknown fee priority %q", priority)
+}
+
+// estimateTxnSize returns the estimated size of the transaction after each of
+// its siacoin inputs has been signed.
+func estimateTxnSize(txn types.Transaction) uint64 {
+	sig := types.TransactionSignature{
+		CoveredFields: types.CoveredFields{WholeTransaction: true},
+		Signature:     make([]byte, 64),
+	}
+	var buf bytes.Buffer
+	e := types.NewEncoder(&buf)
+	txn.EncodeTo(e)
+	e.Flush()
+	size := uint64(buf.Len())
+
+	buf.Reset()
+	sig.EncodeTo(e)
+	e.Flush()
+	return size + uint64(buf.Len()*len(txn.SiacoinInputs))
+}
+
+func (a *api) handlePOSTWalletSendBatch(c jape.Context) {
+	var req WalletSendBatchRequest
+	if err := c.Decode(&req); err != nil {
+		return
+	} else if len(req.Outputs) == 0 {
+		c.Error(errors.New("no outputs"), http.StatusBadRequest)
+		return
+	} else if !req.FeePerByte.IsZero() && req.FeePriority != "" {
+		c.Error(errors.New("only one of fee per byte or fee priority can be set"), http.StatusBadRequest)
+		return
+	}
+
+	var amount types.Currency
+	for i, sco := range req.Outputs {
+		if sco.Address == types.VoidAddress {
+			c.Error(fmt.Errorf("output %d: cannot send to void address", i), http.StatusBadRequest)
+			return
+		} else if sco.Value.IsZero() {
+			c.Error(fmt.Errorf("output %d: value must be greater than zero", i), http.StatusBadRequest)
+			return
+		}
+		var overflow bool
+		amount, overflow = amount.AddWithOverflow(sco.Value)
+		if overflow {
+			c.Error(errors.New("total output value overflows"), http.StatusBadRequest)
+			return
+		}
+	}
+
+	feePerByte := req.FeePerByte
+	if feePerByte.IsZero() {
+		var err error
+		feePerByte, err = a.feePerByte(req.FeePriority)
+		if err != nil {
+			c.Error(err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// fund the transaction, increasing the fee until it covers the size of
+	// the selected inputs
+	var txn types.Transaction
+	var toSign []types.Hash256
+	var release func()
+	minerFee := feePerByte.Mul64(estimateTxnSize(types.Transaction{SiacoinOutputs: req.Outputs}))
+	for i := 0; ; i++ {
+		txn = types.Transaction{
+			MinerFees:      []types.Currency{minerFee},
+			SiacoinOutputs: append([]types.SiacoinOutput(nil), req.Outputs...),
+		}
+		var err error
+		toSign, release, err = a.wallet.FundTransaction(&txn, amount.Add(minerFee), req.Inputs...)
+		if errors.Is(err, wallet.ErrOutputUnavailable) || (len(req.Inputs) > 0 && errors.Is(err, wallet.ErrNotEnoughFunds)) {
+			c.Error(err, http.StatusBadRequest)
+			return
+		} else if !a.checkServerError(c, "failed to fund transaction", err) {
+			return
+		}
+		required := feePerByte.Mul64(estimateTxnSize(txn))
+		if required.Cmp(minerFee) <= 0 {
+			break
+		}
+		release()
+		if i >= 2 {
+			c.Error(errors.New("failed to estimate miner fee"), http.StatusInternalServerError)
+			return
+		}
+		minerFee = required
+	}
+	defer release()
+
+	resp := WalletSendBatchResponse{
+		MinerFee:      minerFee,
+		FeePerByte:    feePerByte,
+		EstimatedSize: estimateTxnSize(txn),
+	}
+	if req.DryRun {
+		resp.ID = txn.ID()
+		resp.Transaction = txn
+		c.Encode(resp)
+		return
+	}
+
+	err := a.wallet.SignTransaction(a.chain.TipState(), &txn, toSign, types.CoveredFields{WholeTransaction: true})
+	if !a.checkServerError(c, "failed to sign transaction", err) {
+		return
+	}
+	err = a.tpool.AcceptTransactionSet([]types.Transaction{txn})
+	if !a.checkServerError(c, "failed to broadcast transaction", err) {
+		return
+	}
+	resp.ID = txn.ID()
+	resp.Transaction = txn
+	c.Encode(resp)
+}
+
+func (a *api) handlePOSTWalletRotate(c jape.Context) {
+	var req WalletRotateRequest
+	if err := c.Decode(&req); err != nil {
+		return
+	}
+
+	var seed [32]byte
+	if err := cwallet.SeedFromPhrase(&seed, req.RecoveryPhrase); err != nil {
+		c.Error(fmt.Errorf("invalid recovery phrase: %w", err), http.StatusBadRequest)
+		return
+	}
+	key := cwallet.KeyFromSeed(&seed, 0)
+
+	result, err := a.wallet.RotateKey(key)
+	if errors.Is(err, wallet.ErrKeyInUse) {
+		c.Error(err, http.StatusBadRequest)
+		return
+	} else if !a.checkServerError(c, "failed to rotate wallet key", err) {
+		return
+	}
+	c.Encode(WalletRotateResponse{
+		Address:     types.StandardUnlockHash(key.PublicKey()),
+		SweepResult: result,
+	})
+}
+
 func (a *api) handleGETSystemDir(c jape.Context) {
 	var path string
 	if err := c.DecodeForm("path", &path); err != nil {
@@ -501,6 +893,18 @@ func (a *api) handlePUTSystemDir(c jape.Context) {
 	a.checkServerError(c, "failed to create dir", os.MkdirAll(req.Path, 0775))
 }
 
+func (a *api) handlePOSTSystemBackup(c jape.Context) {
+	var req BackupRequest
+	if err := c.Decode(&req); err != nil {
+		return
+	} else if len(req.Path) == 0 {
+		c.Error(errors.New("path is required"), http.StatusBadRequest)
+		return
+	}
+	err := a.sqlite3.Backup(c.Request.Context(), req.Path)
+	a.checkServerError(c, "failed to backup database", err)
+}
+
 func (a *api) handleGETTPoolFee(c jape.Context) {
 	c.Encode(a.tpool.RecommendedFee())
 }
@@ -609,6 +1013,27 @@ func parseLimitParams(c jape.Context, defaultLimit, maxLimit int) (limit, offset
 	return
 }
 
+// parseBandwidthRange parses the start and end of a renter bandwidth query.
+// If not specified, the range defaults to the last 30 days.
+func parseBandwidthRange(c jape.Context) (start, end time.Time, ok bool) {
+	if err := c.DecodeForm("start", &start); err != nil {
+		return
+	} else if err := c.DecodeForm("end", &end); err != nil {
+		return
+	}
+	if end.IsZero() {
+		end = time.Now()
+	}
+	if start.IsZero() {
+		start = end.AddDate(0, 0, -30)
+	}
+	if !start.Before(end) {
+		c.Error(errors.New("start must be before end"), http.StatusBadRequest)
+		return
+	}
+	return start, end, true
+}
+
 func toJSONVolume(vol storage.VolumeMeta) VolumeMeta {
 	jvm := VolumeMeta{
 		VolumeMeta: vol,
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/hostd/internal/test"
+	"go.sia.tech/hostd/wallet"
+	"go.sia.tech/jape"
+	stypes "go.sia.tech/siad/types"
+	"go.uber.org/zap/zaptest"
+)
+
+// startWalletAPI serves the wallet send endpoints backed by w and returns a
+// client for them.
+func startWalletAPI(t *testing.T, w *test.Wallet) *Client {
+	a := &api{
+		chain:  w.ChainManager(),
+		tpool:  w.TPool(),
+		wallet: w.SingleAddressWallet,
+		log:    zaptest.NewLogger(t).Named("api"),
+	}
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{
+		Handler: jape.Mux(map[string]jape.Handler{
+			"POST /wallet/send/batch": a.handlePOSTWalletSendBatch,
+		}),
+	}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+	return NewClient("http://"+l.Addr().String(), "")
+}
+
+func TestWalletSendBatch(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	w, err := test.NewWallet(types.GeneratePrivateKey(), t.TempDir(), log.Named("wallet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	client := startWalletAPI(t, w)
+
+	// fund the wallet and wait for the payout to mature
+	if err := w.MineBlocks(w.Address(), 1+int(stypes.MaturityDelay)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second) // sleep for consensus sync
+
+	spendable, _, _, err := w.Balance()
+	if err != nil {
+		t.Fatal(err)
+	} else if spendable.IsZero() {
+		t.Fatal("expected wallet to be funded")
+	}
+
+	// an empty batch should be rejected
+	if _, err := client.SendSiacoinsBatch(WalletSendBatchRequest{}); err == nil || !strings.Contains(err.Error(), "no outputs") {
+		t.Fatalf("expected no outputs error, got %v", err)
+	}
+
+	// a batch exceeding the wallet's balance should be rejected
+	_, err = client.SendSiacoinsBatch(WalletSendBatchRequest{
+		Outputs: []types.SiacoinOutput{
+			{Address: types.Address{1}, Value: spendable},
+			{Address: types.Address{2}, Value: types.Siacoins(1)},
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), wallet.ErrNotEnoughFunds.Error()) {
+		t.Fatalf("expected not enough funds error, got %v", err)
+	}
+
+	// a valid batch should pay each output and be added to the pool
+	outputs := []types.SiacoinOutput{
+		{Address: types.Address{1}, Value: types.Siacoins(1)},
+		{Address: types.Address{2}, Value: types.Siacoins(2)},
+		{Address: types.Address{3}, Value: types.Siacoins(3)},
+	}
+	resp, err := client.SendSiacoinsBatch(WalletSendBatchRequest{Outputs: outputs})
+	if err != nil {
+		t.Fatal(err)
+	} else if resp.ID != resp.Transaction.ID() {
+		t.Fatalf("expected transaction ID %v, got %v", resp.Transaction.ID(), resp.ID)
+	} else if len(resp.Transaction.MinerFees) != 1 || !resp.Transaction.MinerFees[0].Equals(resp.MinerFee) {
+		t.Fatalf("expected miner fee %v, got %v", resp.MinerFee, resp.Transaction.MinerFees)
+	} else if len(resp.Transaction.Signatures) != len(resp.Transaction.SiacoinInputs) {
+		t.Fatalf("expected %v signatures, got %v", len(resp.Transaction.SiacoinInputs), len(resp.Transaction.Signatures))
+	}
+	for i, sco := range outputs {
+		if resp.Transaction.SiacoinOutputs[i] != sco {
+			t.Fatalf("output %v: expected %v, got %v", i, sco, resp.Transaction.SiacoinOutputs[i])
+		}
+	}
+
+	pending, err := w.UnconfirmedTransactions()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(pending) != 1 || pending[0].ID != resp.ID {
+		t.Fatalf("expected transaction %v to be pending, got %v", resp.ID, pending)
+	}
+}
+
+func TestUpcomingProofsHorizon(t *testing.T) {
+	a := &api{log: zaptest.NewLogger(t).Named("api")}
+	srv := httptest.NewServer(jape.Mux(map[string]jape.Handler{
+		"GET /proofs/upcoming": a.handleGETUpcomingProofs,
+	}))
+	defer srv.Close()
+	client := NewClient(srv.URL, "")
+
+	// horizons that could overflow the proof height should be rejected
+	// before the contract manager is queried
+	if _, err := client.UpcomingProofs(maxProofHorizon + 1); err == nil || !strings.Contains(err.Error(), "horizon must be between") {
+		t.Fatalf("expected horizon error, got %v", err)
+	} else if _, err := client.UpcomingProofs(math.MaxUint64); err == nil || !strings.Contains(err.Error(), "invalid form value") {
+		t.Fatalf("expected invalid form value, got %v", err)
+	}
+}
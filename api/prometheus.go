@@ -0,0 +1,245 @@
+package api
+
+import (
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/hostd/host/metrics"
+	"go.sia.tech/hostd/host/storage"
+	"go.sia.tech/hostd/internal/prometheus"
+	"go.sia.tech/jape"
+	"go.uber.org/zap"
+)
+
+type (
+	// A RegistryStats reports the number of registry reads and writes since
+	// startup
+	RegistryStats interface {
+		Stats() (reads, writes uint64)
+	}
+
+	// A PrometheusVolumeManager reports the live stats of the host's storage
+	// volumes
+	PrometheusVolumeManager interface {
+		Volumes() ([]storage.VolumeMeta, error)
+		// CacheStats returns the number of sector cache hits and misses since
+		// startup
+		CacheStats() (hits, misses uint64)
+	}
+
+	prometheusServer struct {
+		log *zap.Logger
+
+		metrics  Metrics
+		volumes  PrometheusVolumeManager
+		sessions RHPSessionReporter
+		registry RegistryStats
+	}
+
+	// prometheusMetrics is a helper for building a slice of metrics
+	prometheusMetrics []prometheus.Metric
+)
+
+var siacoinPrecision = new(big.Float).SetInt(types.Siacoins(1).Big())
+
+// siacoins converts a currency value to a floating point number of siacoins.
+func siacoins(c types.Currency) float64 {
+	f, _ := new(big.Float).Quo(new(big.Float).SetInt(c.Big()), siacoinPrecision).Float64()
+	return f
+}
+
+// PrometheusMetric implements prometheus.Marshaller.
+func (pm prometheusMetrics) PrometheusMetric() []prometheus.Metric {
+	return pm
+}
+
+func (pm *prometheusMetrics) add(name string, t prometheus.Type, help string, value float64, labels ...string) {
+	var lm map[string]string
+	if len(labels) != 0 {
+		lm = make(map[string]string, len(labels)/2)
+		for i := 0; i+1 < len(labels); i += 2 {
+			lm[labels[i]] = labels[i+1]
+		}
+	}
+	*pm = append(*pm, prometheus.Metric{
+		Name:   name,
+		Type:   t,
+		Help:   help,
+		Labels: lm,
+		Value:  value,
+	})
+}
+
+func (pm *prometheusMetrics) gauge(name, help string, value float64, labels ...string) {
+	pm.add(name, prometheus.TypeGauge, help, value, labels...)
+}
+
+func (pm *prometheusMetrics) counter(name, help string, value float64, labels ...string) {
+	pm.add(name, prometheus.TypeCounter, help, value, labels...)
+}
+
+func (pm *prometheusMetrics) revenue(name, help string, r metrics.Revenue, labels ...string) {
+	sources := []struct {
+		source string
+		value  types.Currency
+	}{
+		{"rpc", r.RPC},
+		{"storage", r.Storage},
+		{"ingress", r.Ingress},
+		{"egress", r.Egress},
+		{"registryRead", r.RegistryRead},
+		{"registryWrite", r.RegistryWrite},
+	}
+	for _, s := range sources {
+		pm.gauge(name, help, siacoins(s.value), append([]string{"source", s.source}, labels...)...)
+	}
+}
+
+// hostMetrics converts the host's persisted metrics to prometheus metrics.
+func hostMetrics(m metrics.Metrics) prometheusMetrics {
+	var pm prometheusMetrics
+
+	// accounts
+	pm.gauge("hostd_accounts_active", "number of active ephemeral accounts", float64(m.Accounts.Active))
+	pm.gauge("hostd_accounts_balance_sc", "total balance of all ephemeral accounts in siacoins", siacoins(m.Accounts.Balance))
+
+	// revenue
+	pm.revenue("hostd_revenue_potential_sc", "potential revenue in siacoins", m.Revenue.Potential)
+	pm.revenue("hostd_revenue_earned_sc", "earned revenue in siacoins", m.Revenue.Earned)
+
+	// pricing
+	pm.gauge("hostd_pricing_contract_price_sc", "contract formation price in siacoins", siacoins(m.Pricing.ContractPrice))
+	pm.gauge("hostd_pricing_ingress_price_sc", "ingress price in siacoins per byte", siacoins(m.Pricing.IngressPrice))
+	pm.gauge("hostd_pricing_egress_price_sc", "egress price in siacoins per byte", siacoins(m.Pricing.EgressPrice))
+	pm.gauge("hostd_pricing_base_rpc_price_sc", "base RPC price in siacoins", siacoins(m.Pricing.BaseRPCPrice))
+	pm.gauge("hostd_pricing_sector_access_price_sc", "sector access price in siacoins", siacoins(m.Pricing.SectorAccessPrice))
+	pm.gauge("hostd_pricing_storage_price_sc", "storage price in siacoins per byte per block", siacoins(m.Pricing.StoragePrice))
+	pm.gauge("hostd_pricing_collateral_multiplier", "collateral multiplier", m.Pricing.CollateralMultiplier)
+	pm.gauge("hostd_pricing_storage_price_multiplier", "multiplier applied to the base storage price by utilization pricing", m.Pricing.StoragePriceMultiplier)
+
+	// contracts
+	pm.gauge("hostd_contracts", "number of contracts by status", float64(m.Contracts.Pending), "status", "pending")
+	pm.gauge("hostd_contracts", "number of contracts by status", float64(m.Contracts.Active), "status", "active")
+	pm.gauge("hostd_contracts", "number of contracts by status", float64(m.Contracts.Rejected), "status", "rejected")
+	pm.gauge("hostd_contracts", "number of contracts by status", float64(m.Contracts.Failed), "status", "failed")
+	pm.gauge("hostd_contracts", "number of contracts by status", float64(m.Contracts.Successful), "status", "successful")
+	pm.gauge("hostd_contracts_locked_collateral_sc", "collateral locked in active contracts in siacoins", siacoins(m.Contracts.LockedCollateral))
+	pm.gauge("hostd_contracts_risked_collateral_sc", "collateral at risk in active contracts in siacoins", siacoins(m.Contracts.RiskedCollateral))
+
+	// storage
+	pm.gauge("hostd_storage_total_sectors", "total number of sectors the host can store", float64(m.Storage.TotalSectors))
+	pm.gauge("hostd_storage_physical_sectors", "number of sectors physically stored", float64(m.Storage.PhysicalSectors))
+	pm.gauge("hostd_storage_contract_sectors", "number of sectors referenced by contracts", float64(m.Storage.ContractSectors))
+	pm.gauge("hostd_storage_temp_sectors", "number of temporary sectors", float64(m.Storage.TempSectors))
+	pm.gauge("hostd_storage_ephemeral_sectors", "number of sectors only referenced by temp storage", float64(m.Storage.EphemeralSectors))
+	pm.counter("hostd_storage_sector_reads", "number of sectors read", float64(m.Storage.Reads))
+	pm.counter("hostd_storage_sector_writes", "number of sectors written", float64(m.Storage.Writes))
+
+	// registry
+	pm.gauge("hostd_registry_entries", "number of registry entries", float64(m.Registry.Entries))
+	pm.gauge("hostd_registry_max_entries", "maximum number of registry entries", float64(m.Registry.MaxEntries))
+	pm.counter("hostd_registry_reads", "number of registry reads", float64(m.Registry.Reads))
+	pm.counter("hostd_registry_writes", "number of registry writes", float64(m.Registry.Writes))
+
+	// data
+	pm.counter("hostd_data_rhp_ingress_bytes", "number of bytes received over RHP", float64(m.Data.RHP.Ingress))
+	pm.counter("hostd_data_rhp_egress_bytes", "number of bytes sent over RHP", float64(m.Data.RHP.Egress))
+
+	// wallet
+	pm.gauge("hostd_wallet_balance_sc", "wallet balance in siacoins", siacoins(m.Balance))
+	return pm
+}
+
+// liveMetrics returns the in-memory counters that are not persisted to the
+// database.
+func (ps *prometheusServer) liveMetrics() (prometheusMetrics, error) {
+	var pm prometheusMetrics
+
+	hits, misses := ps.volumes.CacheStats()
+	pm.counter("hostd_live_sector_cache_hits", "number of sector cache hits since startup", float64(hits))
+	pm.counter("hostd_live_sector_cache_misses", "number of sector cache misses since startup", float64(misses))
+
+	volumes, err := ps.volumes.Volumes()
+	if err != nil {
+		return nil, err
+	}
+	// samples of the same family must be written together
+	families := []struct {
+		name, help string
+		value      func(storage.VolumeStats) uint64
+	}{
+		{"hostd_live_volume_failed_reads", "number of failed reads since startup", func(v storage.VolumeStats) uint64 { return v.FailedReads }},
+		{"hostd_live_volume_failed_writes", "number of failed writes since startup", func(v storage.VolumeStats) uint64 { return v.FailedWrites }},
+		{"hostd_live_volume_successful_reads", "number of successful reads since startup", func(v storage.VolumeStats) uint64 { return v.SuccessfulReads }},
+		{"hostd_live_volume_successful_writes", "number of successful writes since startup", func(v storage.VolumeStats) uint64 { return v.SuccessfulWrites }},
+	}
+	for _, f := range families {
+		for _, vol := range volumes {
+			pm.counter(f.name, f.help, float64(f.value(vol.VolumeStats)), "volume", strconv.FormatInt(vol.ID, 10), "path", vol.LocalPath)
+		}
+	}
+
+	// group active sessions by protocol and version
+	type sessionKey struct {
+		protocol string
+		version  int
+	}
+	counts := make(map[sessionKey]int)
+	for _, s := range ps.sessions.Active() {
+		counts[sessionKey{s.Protocol, s.RHPVersion}]++
+	}
+	for k, n := range counts {
+		pm.gauge("hostd_live_rhp_sessions", "number of active RHP sessions", float64(n), "protocol", k.protocol, "version", strconv.Itoa(k.version))
+	}
+
+	reads, writes := ps.registry.Stats()
+	pm.counter("hostd_live_registry_reads", "number of registry reads since startup", float64(reads))
+	pm.counter("hostd_live_registry_writes", "number of registry writes since startup", float64(writes))
+	return pm, nil
+}
+
+func (ps *prometheusServer) handleGETMetrics(c jape.Context) {
+	m, err := ps.metrics.Metrics(time.Now())
+	if err != nil {
+		ps.log.Warn("failed to get metrics", zap.Error(err))
+		c.Error(err, http.StatusInternalServerError)
+		return
+	}
+	live, err := ps.liveMetrics()
+	if err != nil {
+		ps.log.Warn("failed to get live metrics", zap.Error(err))
+		c.Error(err, http.StatusInternalServerError)
+		return
+	}
+
+	c.ResponseWriter.Header().Set("Content-Type", prometheus.ContentType)
+	enc := prometheus.NewEncoder(c.ResponseWriter)
+	if err := enc.Append(hostMetrics(m)); err != nil {
+		ps.log.Warn("failed to encode metrics", zap.Error(err))
+		return
+	} else if err := enc.Append(live); err != nil {
+		ps.log.Warn("failed to encode live metrics", zap.Error(err))
+		return
+	} else if err := enc.Close(); err != nil {
+		ps.log.Warn("failed to encode metrics", zap.Error(err))
+	}
+}
+
+// NewPrometheusServer initializes a handler that exposes the host's metrics
+// in the OpenMetrics text format at /metrics.
+func NewPrometheusServer(m Metrics, vm PrometheusVolumeManager, rsr RHPSessionReporter, rs RegistryStats, log *zap.Logger) http.Handler {
+	ps := &prometheusServer{
+		log: log,
+
+		metrics:  m,
+		volumes:  vm,
+		sessions: rsr,
+		registry: rs,
+	}
+	return jape.Mux(map[string]jape.Handler{
+		"GET /metrics": ps.handleGETMetrics,
+	})
+}
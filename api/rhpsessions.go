@@ -3,6 +3,8 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"net/http"
 
 	"go.sia.tech/hostd/rhp"
 	"go.sia.tech/jape"
@@ -26,6 +28,47 @@ func (a *api) handleGETSessions(c jape.Context) {
 	c.Encode(a.sessions.Active())
 }
 
+func (a *api) handleGETBans(c jape.Context) {
+	c.Encode(a.limiter.Bans())
+}
+
+func (a *api) handleDELETEBan(c jape.Context) {
+	var address string
+	if err := c.DecodeParam("address", &address); err != nil {
+		return
+	}
+	err := a.limiter.Unban(address)
+	if errors.Is(err, rhp.ErrPeerNotBanned) {
+		c.Error(err, http.StatusNotFound)
+		return
+	}
+	a.checkServerError(c, "failed to unban peer", err)
+}
+
+func (a *api) handleDELETEBans(c jape.Context) {
+	a.limiter.ClearBans()
+}
+
+func (a *api) handleGETMaintenance(c jape.Context) {
+	c.Encode(a.maintenance.Status())
+}
+
+func (a *api) handlePUTMaintenance(c jape.Context) {
+	var req UpdateMaintenanceRequest
+	if err := c.Decode(&req); err != nil {
+		return
+	}
+
+	if !req.Enabled {
+		a.maintenance.Disable()
+	} else if req.DrainTimeout <= 0 {
+		c.Error(errors.New("drain timeout must be positive"), http.StatusBadRequest)
+		return
+	} else {
+		a.maintenance.Enable(req.DrainTimeout)
+	}
+}
+
 func (a *api) handleGETSessionsSubscribe(c jape.Context) {
 	wsc, err := websocket.Accept(c.ResponseWriter, c.Request, &websocket.AcceptOptions{
 		OriginPatterns: []string{"*"},
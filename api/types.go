@@ -11,6 +11,7 @@ import (
 	"go.sia.tech/hostd/host/contracts"
 	"go.sia.tech/hostd/host/settings"
 	"go.sia.tech/hostd/host/storage"
+	"go.sia.tech/hostd/wallet"
 )
 
 // JSON keys for host setting fields
@@ -32,9 +33,22 @@ const (
 	settingMaxRegistryEntries  = "maxRegistryEntries"
 	settingAccountExpiry       = "accountExpiry"
 	settingPriceTableValidity  = "priceTableValidity"
+	settingAutoPricing         = "autoPricing"
+	settingBandwidthSchedule   = "bandwidthSchedule"
+)
+
+// fee priorities for wallet transactions
+const (
+	FeePriorityLow    FeePriority = "low"
+	FeePriorityMedium FeePriority = "medium"
+	FeePriorityHigh   FeePriority = "high"
 )
 
 type (
+	// FeePriority determines the miner fee of a transaction relative to the
+	// transaction pool's recommended fee.
+	FeePriority string
+
 	// SyncerConnectRequest is the request body for the [PUT] /syncer/peers endpoint.
 	SyncerConnectRequest struct {
 		Address string `json:"address"`
@@ -75,6 +89,12 @@ type (
 	AddVolumeRequest struct {
 		LocalPath  string `json:"localPath"`
 		MaxSectors uint64 `json:"maxSectors"`
+		// CacheTier adds the volume as a cache tier for frequently read
+		// sectors instead of as storage capacity
+		CacheTier bool `json:"cacheTier"`
+		// S3 stores the volume's sector data in an S3-compatible bucket
+		// instead of a local file. LocalPath is ignored if S3 is set.
+		S3 *storage.S3Config `json:"s3,omitempty"`
 	}
 
 	// JSONErrors is a slice of errors that can be marshaled to and unmarshaled
@@ -98,6 +118,25 @@ type (
 		MaxSectors uint64 `json:"maxSectors"`
 	}
 
+	// UpdateVolumePriorityRequest is the request body for the [PUT]
+	// /volume/:id/priority endpoint.
+	UpdateVolumePriorityRequest struct {
+		Priority uint64 `json:"priority"`
+	}
+
+	// ExportVolumeRequest is the request body for the [POST] /volumes/export
+	// endpoint.
+	ExportVolumeRequest struct {
+		ID   int64  `json:"id"`
+		Path string `json:"path"`
+	}
+
+	// ImportVolumeRequest is the request body for the [POST] /volumes/import
+	// endpoint.
+	ImportVolumeRequest struct {
+		Path string `json:"path"`
+	}
+
 	// ContractsResponse is the response body for the [POST] /contracts endpoint.
 	ContractsResponse struct {
 		Count     int                  `json:"count"`
@@ -120,6 +159,54 @@ type (
 		SubtractMinerFee bool           `json:"subtractMinerFee"`
 	}
 
+	// WalletSendBatchRequest is the request body for the [POST] /wallet/send/batch endpoint.
+	WalletSendBatchRequest struct {
+		Outputs []types.SiacoinOutput `json:"outputs"`
+		// FeePerByte is an explicit miner fee per byte. If zero, the fee is
+		// determined by FeePriority.
+		FeePerByte  types.Currency `json:"feePerByte"`
+		FeePriority FeePriority    `json:"feePriority"`
+		// Inputs are the IDs of the wallet outputs that fund the
+		// transaction. If empty, the wallet selects the outputs.
+		Inputs []types.SiacoinOutputID `json:"inputs,omitempty"`
+		// DryRun returns the funded, unsigned transaction without
+		// broadcasting it.
+		DryRun bool `json:"dryRun"`
+	}
+
+	// WalletSendBatchResponse is the response body for the [POST] /wallet/send/batch endpoint.
+	WalletSendBatchResponse struct {
+		ID          types.TransactionID `json:"id"`
+		Transaction types.Transaction   `json:"transaction"`
+		MinerFee    types.Currency      `json:"minerFee"`
+		FeePerByte  types.Currency      `json:"feePerByte"`
+		// EstimatedSize is the estimated size of the signed transaction in
+		// bytes.
+		EstimatedSize uint64 `json:"estimatedSize"`
+	}
+
+	// WalletConsolidateRequest is the request body for the [POST] /wallet/consolidate endpoint.
+	WalletConsolidateRequest struct {
+		// MaxInputs is the maximum number of outputs to consolidate. If
+		// zero, the wallet's default is used.
+		MaxInputs int `json:"maxInputs"`
+		// FeePerByte is an explicit miner fee per byte. If zero, the fee is
+		// determined by FeePriority.
+		FeePerByte  types.Currency `json:"feePerByte"`
+		FeePriority FeePriority    `json:"feePriority"`
+	}
+
+	// WalletRotateRequest is the request body for the [POST] /wallet/rotate endpoint.
+	WalletRotateRequest struct {
+		RecoveryPhrase string `json:"recoveryPhrase"`
+	}
+
+	// WalletRotateResponse is the response body for the [POST] /wallet/rotate endpoint.
+	WalletRotateResponse struct {
+		Address types.Address `json:"address"`
+		wallet.SweepResult
+	}
+
 	// A Peer is a peer in the network.
 	Peer struct {
 		Address string `json:"address"`
@@ -143,17 +230,57 @@ type (
 		Path string `json:"path"`
 	}
 
+	// BackupRequest is the request body for the [POST] /system/backup endpoint.
+	BackupRequest struct {
+		Path string `json:"path"`
+	}
+
 	// VerifySectorResponse is the response body for the [GET] /sectors/:root/verify endpoint.
 	VerifySectorResponse struct {
 		storage.SectorReference
 		Error string `json:"error,omitempty"`
 	}
 
+	// TempSectorsResponse is the response body for the [GET] /temp-sectors
+	// endpoint.
+	TempSectorsResponse struct {
+		storage.TempStorageSummary
+		Sectors []storage.TempStorageSector `json:"sectors"`
+	}
+
+	// ExpireTempSectorsRequest is the request body for the [POST]
+	// /temp-sectors/expire endpoint. Either All must be set or Roots must
+	// be non-empty.
+	ExpireTempSectorsRequest struct {
+		All   bool            `json:"all"`
+		Roots []types.Hash256 `json:"roots"`
+	}
+
+	// ExpireTempSectorsResponse is the response body for the [POST]
+	// /temp-sectors/expire endpoint.
+	ExpireTempSectorsResponse struct {
+		Removed int `json:"removed"`
+	}
+
+	// UpdateMaintenanceRequest is the request body for the [PUT]
+	// /maintenance endpoint. When enabling maintenance mode, in-flight RPCs
+	// are given until DrainTimeout to complete.
+	UpdateMaintenanceRequest struct {
+		Enabled      bool          `json:"enabled"`
+		DrainTimeout time.Duration `json:"drainTimeout"`
+	}
+
 	// RegisterWebHookRequest is the request body for the [POST] /webhooks endpoint.
 	RegisterWebHookRequest struct {
 		CallbackURL string   `json:"callbackURL"`
 		Scopes      []string `json:"scopes"`
 	}
+
+	// UpdateRenterAccessRequest is the request body for the [PUT]
+	// /policies/renters/:key endpoint.
+	UpdateRenterAccessRequest struct {
+		Allowed bool `json:"allowed"`
+	}
 )
 
 // MarshalJSON implements json.Marshaler
@@ -306,6 +433,20 @@ func SetPriceTableValidity(value time.Duration) Setting {
 	}
 }
 
+// SetAutoPricing sets the AutoPricing field of the request
+func SetAutoPricing(value settings.AutoPricingSettings) Setting {
+	return func(v map[string]any) {
+		v[settingAutoPricing] = value
+	}
+}
+
+// SetBandwidthSchedule sets the BandwidthSchedule field of the request
+func SetBandwidthSchedule(value settings.BandwidthScheduleSettings) Setting {
+	return func(v map[string]any) {
+		v[settingBandwidthSchedule] = value
+	}
+}
+
 // patchSettings merges two settings maps. returns an error if the two maps are
 // not compatible.
 func patchSettings(a, b map[string]any) error {
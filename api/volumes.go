@@ -22,10 +22,26 @@ type (
 	}
 )
 
-func (vj *volumeJobs) AddVolume(path string, maxSectors uint64) (storage.Volume, error) {
+func (vj *volumeJobs) AddVolume(path string, maxSectors uint64, cacheTier bool) (storage.Volume, error) {
+	add := vj.volumes.AddVolume
+	if cacheTier {
+		add = vj.volumes.AddCacheVolume
+	}
+	return vj.addVolume(func(ctx context.Context, complete chan<- error) (storage.Volume, error) {
+		return add(ctx, path, maxSectors, complete)
+	})
+}
+
+func (vj *volumeJobs) AddS3Volume(cfg storage.S3Config, maxSectors uint64) (storage.Volume, error) {
+	return vj.addVolume(func(ctx context.Context, complete chan<- error) (storage.Volume, error) {
+		return vj.volumes.AddS3Volume(ctx, cfg, maxSectors, complete)
+	})
+}
+
+func (vj *volumeJobs) addVolume(add func(context.Context, chan<- error) (storage.Volume, error)) (storage.Volume, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 	complete := make(chan error, 1)
-	volume, err := vj.volumes.AddVolume(ctx, path, maxSectors, complete)
+	volume, err := add(ctx, complete)
 	if err != nil {
 		cancel()
 		return storage.Volume{}, err
@@ -112,6 +128,68 @@ func (vj *volumeJobs) ResizeVolume(id int64, newSize uint64) error {
 	return nil
 }
 
+func (vj *volumeJobs) ExportVolume(id int64, dir string) error {
+	vj.mu.Lock()
+	defer vj.mu.Unlock()
+	if _, exists := vj.jobs[id]; exists {
+		return errors.New("volume is busy")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	complete := make(chan error, 1)
+	err := vj.volumes.ExportVolume(ctx, id, dir, complete)
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	vj.jobs[id] = cancel
+	go func() {
+		defer cancel()
+
+		select {
+		case <-ctx.Done():
+		case <-complete:
+		}
+
+		vj.mu.Lock()
+		defer vj.mu.Unlock()
+		delete(vj.jobs, id)
+	}()
+	return nil
+}
+
+func (vj *volumeJobs) EncryptVolume(id int64) error {
+	vj.mu.Lock()
+	defer vj.mu.Unlock()
+	if _, exists := vj.jobs[id]; exists {
+		return errors.New("volume is busy")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	complete := make(chan error, 1)
+	err := vj.volumes.EncryptVolume(ctx, id, complete)
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	vj.jobs[id] = cancel
+	go func() {
+		defer cancel()
+
+		select {
+		case <-ctx.Done():
+		case <-complete:
+		}
+
+		vj.mu.Lock()
+		defer vj.mu.Unlock()
+		delete(vj.jobs, id)
+	}()
+	return nil
+}
+
 func (vj *volumeJobs) Cancel(id int64) error {
 	vj.mu.Lock()
 	defer vj.mu.Unlock()
@@ -140,14 +218,30 @@ func (a *api) handlePOSTVolume(c jape.Context) {
 	var req AddVolumeRequest
 	if err := c.Decode(&req); err != nil {
 		return
-	} else if len(req.LocalPath) == 0 {
-		c.Error(errors.New("local path is required"), http.StatusBadRequest)
-		return
 	} else if req.MaxSectors == 0 {
 		c.Error(errors.New("max sectors is required"), http.StatusBadRequest)
 		return
 	}
-	volume, err := a.volumeJobs.AddVolume(req.LocalPath, req.MaxSectors)
+
+	if req.S3 != nil {
+		if req.CacheTier {
+			c.Error(errors.New("cache tier volumes must be stored locally"), http.StatusBadRequest)
+			return
+		} else if err := req.S3.Validate(); err != nil {
+			c.Error(fmt.Errorf("invalid s3 config: %w", err), http.StatusBadRequest)
+			return
+		}
+		volume, err := a.volumeJobs.AddS3Volume(*req.S3, req.MaxSectors)
+		if !a.checkServerError(c, "failed to add volume", err) {
+			return
+		}
+		c.Encode(volume)
+		return
+	} else if len(req.LocalPath) == 0 {
+		c.Error(errors.New("local path is required"), http.StatusBadRequest)
+		return
+	}
+	volume, err := a.volumeJobs.AddVolume(req.LocalPath, req.MaxSectors, req.CacheTier)
 	if !a.checkServerError(c, "failed to add volume", err) {
 		return
 	}
@@ -187,6 +281,72 @@ func (a *api) handlePUTVolumeResize(c jape.Context) {
 	a.checkServerError(c, "failed to resize volume", err)
 }
 
+func (a *api) handlePUTVolumePriority(c jape.Context) {
+	var id int64
+	if err := c.DecodeParam("id", &id); err != nil {
+		return
+	} else if id < 0 {
+		c.Error(errors.New("invalid volume id"), http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateVolumePriorityRequest
+	if err := c.Decode(&req); err != nil {
+		return
+	}
+
+	err := a.volumes.SetPriority(id, req.Priority)
+	if errors.Is(err, storage.ErrVolumeNotFound) {
+		c.Error(err, http.StatusNotFound)
+		return
+	}
+	a.checkServerError(c, "failed to set volume priority", err)
+}
+
+func (a *api) handlePUTVolumeEncrypt(c jape.Context) {
+	var id int64
+	if err := c.DecodeParam("id", &id); err != nil {
+		return
+	} else if id < 0 {
+		c.Error(errors.New("invalid volume id"), http.StatusBadRequest)
+		return
+	}
+
+	err := a.volumeJobs.EncryptVolume(id)
+	a.checkServerError(c, "failed to encrypt volume", err)
+}
+
+func (a *api) handlePOSTVolumesRebalance(c jape.Context) {
+	a.volumes.Rebalance()
+}
+
+func (a *api) handlePOSTVolumeExport(c jape.Context) {
+	var req ExportVolumeRequest
+	if err := c.Decode(&req); err != nil {
+		return
+	} else if req.ID < 0 {
+		c.Error(errors.New("invalid volume id"), http.StatusBadRequest)
+		return
+	} else if len(req.Path) == 0 {
+		c.Error(errors.New("path is required"), http.StatusBadRequest)
+		return
+	}
+	err := a.volumeJobs.ExportVolume(req.ID, req.Path)
+	a.checkServerError(c, "failed to export volume", err)
+}
+
+func (a *api) handlePOSTVolumeImport(c jape.Context) {
+	var req ImportVolumeRequest
+	if err := c.Decode(&req); err != nil {
+		return
+	} else if len(req.Path) == 0 {
+		c.Error(errors.New("path is required"), http.StatusBadRequest)
+		return
+	}
+	err := a.volumes.ImportVolume(context.Background(), req.Path, nil)
+	a.checkServerError(c, "failed to import volume", err)
+}
+
 func (a *api) handleDELETEVolumeCancelOp(c jape.Context) {
 	var id int64
 	if err := c.DecodeParam("id", &id); err != nil {
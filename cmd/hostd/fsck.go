@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"go.sia.tech/hostd/persist/sqlite"
+	"go.uber.org/zap"
+)
+
+// fsckPrintLimit is the number of sector roots printed for each issue in the
+// human-readable report.
+const fsckPrintLimit = 10
+
+func printFsckRoots[T fmt.Stringer](label string, roots []T) {
+	if len(roots) == 0 {
+		return
+	}
+	fmt.Printf("%s: %d\n", label, len(roots))
+	for i, root := range roots {
+		if i == fsckPrintLimit {
+			fmt.Printf("  ... and %d more\n", len(roots)-fsckPrintLimit)
+			break
+		}
+		fmt.Println("  " + root.String())
+	}
+}
+
+func printFsckReport(report sqlite.FsckReport) {
+	printFsckRoots("Orphaned sectors", report.OrphanedSectors)
+	printFsckRoots("Lost sectors", report.LostSectors)
+	if len(report.DanglingReferences) > 0 {
+		fmt.Printf("Dangling references: %d\n", len(report.DanglingReferences))
+		for _, ref := range report.DanglingReferences {
+			fmt.Printf("  %s row %d references missing %s (repaired: %t)\n", ref.Table, ref.RowID, ref.Parent, ref.Repaired)
+		}
+	}
+	for _, c := range report.UsedSectors {
+		fmt.Printf("Volume %d used sectors: stored %d, actual %d\n", c.VolumeID, c.Stored, c.Actual)
+	}
+	for _, c := range report.TotalSectors {
+		fmt.Printf("Volume %d total sectors: stored %d, actual %d\n", c.VolumeID, c.Stored, c.Actual)
+	}
+	if report.LockedSectors > 0 || report.LockedLocations > 0 {
+		fmt.Printf("Leftover locks: %d sectors, %d locations\n", report.LockedSectors, report.LockedLocations)
+	}
+	for _, v := range report.UnreadableVolumes {
+		fmt.Printf("Volume %d (%s) could not be read: %s\n", v.VolumeID, v.Path, v.Error)
+	}
+	if len(report.CorruptSectors) > 0 {
+		fmt.Printf("Corrupt sectors: %d\n", len(report.CorruptSectors))
+		for i, cs := range report.CorruptSectors {
+			if i == fsckPrintLimit {
+				fmt.Printf("  ... and %d more\n", len(report.CorruptSectors)-fsckPrintLimit)
+				break
+			}
+			fmt.Printf("  volume %d index %d (%s): %s\n", cs.VolumeID, cs.Index, cs.Root, cs.Error)
+		}
+	}
+
+	switch {
+	case report.Issues() == 0:
+		fmt.Println("No issues found")
+	case report.Repaired:
+		fmt.Printf("Found %d issues, %d could not be repaired\n", report.Issues(), report.Unrepaired())
+	default:
+		fmt.Printf("Found %d issues, run with --repair to fix them\n", report.Issues())
+	}
+}
+
+// runFsck checks the consistency of the host's database. hostd must not be
+// running. The process exits with a non-zero code if any issues remain.
+func runFsck(args []string) {
+	var opts sqlite.FsckOptions
+	var jsonOutput bool
+	fs := flag.NewFlagSet("fsck", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Println("Usage: hostd fsck [--repair] [--data] [--json]")
+		fs.PrintDefaults()
+	}
+	fs.BoolVar(&opts.Repair, "repair", false, "repair the issues that can be fixed safely")
+	fs.BoolVar(&opts.CheckData, "data", false, "read every stored sector and verify its root")
+	fs.BoolVar(&jsonOutput, "json", false, "print the report as JSON")
+	fs.Parse(args)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	dbPath := filepath.Join(cfg.Directory, "hostd.db")
+	if _, err := os.Stat(dbPath); err != nil {
+		stdoutError("Failed to open database: " + err.Error())
+	}
+	report, err := sqlite.Fsck(ctx, dbPath, opts, zap.NewNop())
+	if errors.Is(err, sqlite.ErrDatabaseInUse) {
+		stdoutError("Failed to check database: " + err.Error() + ". Stop hostd before running fsck.")
+	} else if err != nil {
+		stdoutError("Failed to check database: " + err.Error())
+	}
+
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			stdoutError("Failed to encode report: " + err.Error())
+		}
+	} else {
+		printFsckReport(report)
+	}
+
+	if report.Unrepaired() > 0 {
+		os.Exit(1)
+	}
+}
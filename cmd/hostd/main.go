@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -22,6 +23,7 @@ import (
 	"go.sia.tech/hostd/api"
 	"go.sia.tech/hostd/build"
 	"go.sia.tech/hostd/config"
+	"go.sia.tech/hostd/persist/sqlite"
 	"go.sia.tech/jape"
 	"go.sia.tech/web/hostd"
 	"go.uber.org/zap"
@@ -51,6 +53,10 @@ var (
 			TCPAddress:       defaultRHP3TCPAddr,
 			WebSocketAddress: defaultRHP3WSAddr,
 		},
+		RHPLimits: config.RHPLimits{
+			HandshakeTimeout: 30 * time.Second,
+			BanDuration:      time.Hour,
+		},
 		Log: config.Log{
 			Path:  os.Getenv(logPathEnvVariable), // deprecated. included for compatibility.
 			Level: "info",
@@ -322,6 +328,9 @@ func main() {
 	flag.StringVar(&cfg.RHP3.WebSocketAddress, "rhp3.ws", cfg.RHP3.WebSocketAddress, "address to listen on for WebSocket RHP3 connections")
 	// http
 	flag.StringVar(&cfg.HTTP.Address, "http", cfg.HTTP.Address, "address to serve API on")
+	// prometheus
+	flag.StringVar(&cfg.Prometheus.Address, "prometheus", cfg.Prometheus.Address, "address to serve Prometheus metrics on, disabled if empty")
+	flag.BoolVar(&cfg.Storage.DirectIO, "storage.directio", cfg.Storage.DirectIO, "bypass the page cache when reading and writing volume data")
 	// log
 	flag.StringVar(&cfg.Log.Level, "log.level", cfg.Log.Level, "log level (debug, info, warn, error)")
 	flag.Parse()
@@ -344,6 +353,55 @@ func main() {
 		fmt.Println("Recovery Phrase:", phrase)
 		fmt.Println("Address", types.StandardUnlockHash(key.PublicKey()))
 		return
+	case "backup":
+		if flag.NArg() != 2 {
+			stdoutError("Usage: hostd backup <destination>")
+		}
+		dbPath := filepath.Join(cfg.Directory, "hostd.db")
+		if err := sqlite.Backup(context.Background(), dbPath, flag.Arg(1)); err != nil {
+			stdoutError("Failed to backup database: " + err.Error())
+		}
+		fmt.Println("Backup written to", flag.Arg(1))
+		return
+	case "restore":
+		if flag.NArg() != 2 {
+			stdoutError("Usage: hostd restore <backup>")
+		}
+		dbPath := filepath.Join(cfg.Directory, "hostd.db")
+		if err := sqlite.Restore(context.Background(), flag.Arg(1), dbPath); err != nil {
+			stdoutError("Failed to restore database: " + err.Error())
+		}
+		fmt.Println("Database restored from", flag.Arg(1))
+		return
+	case "fsck":
+		runFsck(flag.Args()[1:])
+		return
+	case "rotate":
+		if len(cfg.HTTP.Password) == 0 {
+			password, err := readPasswordInput("Enter API password")
+			if err != nil {
+				stdoutError("Could not read password: " + err.Error())
+			}
+			cfg.HTTP.Password = password
+		}
+		fmt.Println("The wallet's funds will be swept to the address of the new seed phrase.")
+		phrase := mustGetSeedPhrase()
+
+		client := api.NewClient("http://"+cfg.HTTP.Address+"/api", cfg.HTTP.Password)
+		resp, err := client.RotateWalletKey(phrase)
+		if err != nil {
+			stdoutError("Failed to rotate wallet key: " + err.Error())
+		}
+		fmt.Println("New Address:", resp.Address)
+		fmt.Println("Swept:", resp.Swept)
+		for _, id := range resp.Transactions {
+			fmt.Println("Sweep Transaction:", id)
+		}
+		if len(resp.Stuck) > 0 {
+			fmt.Println(wrapANSI("\033[33m", fmt.Sprintf("%d outputs could not be swept and will be retried.", len(resp.Stuck)), "\033[0m"))
+		}
+		fmt.Println(wrapANSI("\033[1m", "Replace the recovery phrase in your config file or "+walletSeedEnvVariable+" with the new seed phrase before restarting hostd.", "\033[0m"))
+		return
 	}
 
 	// check that the API password and wallet seed are set
@@ -453,7 +511,7 @@ func main() {
 	}
 	defer apiListener.Close()
 
-	rhp3WSListener, err := net.Listen("tcp", cfg.RHP3.WebSocketAddress)
+	rhp3WSListener, err := listenRHP(cfg.RHP3.WebSocketAddress)
 	if err != nil {
 		log.Fatal("failed to listen on RHP3 WebSocket address", zap.Error(err), zap.String("address", cfg.RHP3.WebSocketAddress))
 	}
@@ -468,7 +526,7 @@ func main() {
 	auth := jape.BasicAuth(cfg.HTTP.Password)
 	web := http.Server{
 		Handler: webRouter{
-			api: auth(api.NewServer(cfg.Name, hostKey.PublicKey(), node.a, node.wh, node.g, node.cm, node.tp, node.contracts, node.accounts, node.storage, node.sessions, node.metrics, node.settings, node.w, log.Named("api"))),
+			api: auth(api.NewServer(cfg.Name, hostKey.PublicKey(), node.a, node.wh, node.g, node.cm, node.tp, node.contracts, node.accounts, node.policies, node.storage, node.sessions, node.limiter, node.maintenance, node.metrics, node.settings, node.w, node.store, log.Named("api"))),
 			ui:  hostd.Handler(),
 		},
 		ReadTimeout: 30 * time.Second,
@@ -490,6 +548,28 @@ func main() {
 		}
 	}()
 
+	if cfg.Prometheus.Address != "" {
+		prometheusListener, err := net.Listen("tcp", cfg.Prometheus.Address)
+		if err != nil {
+			log.Fatal("failed to listen on Prometheus address", zap.Error(err), zap.String("address", cfg.Prometheus.Address))
+		}
+		defer prometheusListener.Close()
+
+		prometheusServer := http.Server{
+			Handler:     api.NewPrometheusServer(node.metrics, node.storage, node.sessions, node.registry, log.Named("prometheus")),
+			ReadTimeout: 30 * time.Second,
+		}
+		defer prometheusServer.Close()
+
+		go func() {
+			err := prometheusServer.Serve(prometheusListener)
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error("failed to serve prometheus metrics", zap.Error(err))
+			}
+		}()
+		log.Info("serving prometheus metrics", zap.String("address", prometheusListener.Addr().String()))
+	}
+
 	log.Info("hostd started", zap.String("hostKey", hostKey.PublicKey().String()), zap.String("api", apiListener.Addr().String()), zap.String("p2p", string(node.g.Address())), zap.String("rhp2", node.rhp2.LocalAddr()), zap.String("rhp3", node.rhp3.LocalAddr()))
 
 	go func() {
@@ -512,6 +592,14 @@ func main() {
 	signalCh := make(chan os.Signal, 1)
 	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM)
 	<-signalCh
+	if cfg.Maintenance.DrainTimeout > 0 {
+		log.Info("draining RHP sessions, interrupt again to shut down immediately", zap.Duration("timeout", cfg.Maintenance.DrainTimeout))
+		node.maintenance.Enable(cfg.Maintenance.DrainTimeout)
+		select {
+		case <-node.maintenance.Drained():
+		case <-signalCh:
+		}
+	}
 	log.Info("shutting down...")
 	time.AfterFunc(5*time.Minute, func() {
 		log.Fatal("failed to shut down within 5 minutes")
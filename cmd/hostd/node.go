@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"os"
@@ -12,6 +13,7 @@ import (
 	"go.sia.tech/hostd/host/accounts"
 	"go.sia.tech/hostd/host/contracts"
 	"go.sia.tech/hostd/host/metrics"
+	"go.sia.tech/hostd/host/policy"
 	"go.sia.tech/hostd/host/registry"
 	"go.sia.tech/hostd/host/settings"
 	"go.sia.tech/hostd/host/storage"
@@ -42,19 +44,24 @@ type node struct {
 	settings  *settings.ConfigManager
 	accounts  *accounts.AccountManager
 	contracts *contracts.ContractManager
+	policies  *policy.Manager
 	registry  *registry.Manager
 	storage   *storage.VolumeManager
 
-	sessions *rhp.SessionReporter
-	data     *rhp.DataRecorder
-	rhp2     *rhp2.SessionHandler
-	rhp3     *rhp3.SessionHandler
+	sessions    *rhp.SessionReporter
+	limiter     *rhp.ConnLimiter
+	maintenance *rhp.MaintenanceManager
+	data        *rhp.DataRecorder
+	renters     *rhp.RenterRecorder
+	rhp2        *rhp2.SessionHandler
+	rhp3        *rhp3.SessionHandler
 }
 
 func (n *node) Close() error {
 	n.rhp3.Close()
 	n.rhp2.Close()
 	n.data.Close()
+	n.renters.Close()
 	n.storage.Close()
 	n.contracts.Close()
 	n.w.Close()
@@ -66,8 +73,29 @@ func (n *node) Close() error {
 	return nil
 }
 
-func startRHP2(l net.Listener, hostKey types.PrivateKey, rhp3Addr string, cs rhp2.ChainManager, tp rhp2.TransactionPool, w rhp2.Wallet, cm rhp2.ContractManager, sr rhp2.SettingsReporter, sm rhp2.StorageManager, monitor rhp.DataMonitor, sessions *rhp.SessionReporter, log *zap.Logger) (*rhp2.SessionHandler, error) {
-	rhp2, err := rhp2.NewSessionHandler(l, hostKey, rhp3Addr, cs, tp, w, cm, sr, sm, monitor, sessions, log)
+// listenRHP listens for RHP connections on addr. If the PROXY protocol is
+// enabled, the listener parses headers sent by trusted proxies.
+func listenRHP(addr string) (net.Listener, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	} else if !cfg.ProxyProtocol.Enabled {
+		return l, nil
+	}
+
+	trusted, err := rhp.ParseTrustedProxies(cfg.ProxyProtocol.TrustedProxies)
+	if err != nil {
+		l.Close()
+		return nil, fmt.Errorf("failed to parse trusted proxies: %w", err)
+	} else if len(trusted) == 0 {
+		l.Close()
+		return nil, errors.New("PROXY protocol is enabled but no trusted proxies are configured")
+	}
+	return rhp.NewProxyListener(l, trusted), nil
+}
+
+func startRHP2(l net.Listener, hostKey types.PrivateKey, rhp3Addr string, cs rhp2.ChainManager, tp rhp2.TransactionPool, w rhp2.Wallet, cm rhp2.ContractManager, sr rhp2.SettingsReporter, sm rhp2.StorageManager, pm rhp2.PolicyManager, monitor rhp.DataMonitor, sessions *rhp.SessionReporter, limiter *rhp.ConnLimiter, maintenance *rhp.MaintenanceManager, renters *rhp.RenterRecorder, log *zap.Logger) (*rhp2.SessionHandler, error) {
+	rhp2, err := rhp2.NewSessionHandler(l, hostKey, rhp3Addr, cs, tp, w, cm, sr, sm, pm, monitor, sessions, limiter, maintenance, renters, log)
 	if err != nil {
 		return nil, err
 	}
@@ -75,8 +103,8 @@ func startRHP2(l net.Listener, hostKey types.PrivateKey, rhp3Addr string, cs rhp
 	return rhp2, nil
 }
 
-func startRHP3(l net.Listener, hostKey types.PrivateKey, cs rhp3.ChainManager, tp rhp3.TransactionPool, w rhp3.Wallet, am rhp3.AccountManager, cm rhp3.ContractManager, rm rhp3.RegistryManager, sr rhp3.SettingsReporter, sm rhp3.StorageManager, monitor rhp.DataMonitor, sessions *rhp.SessionReporter, log *zap.Logger) (*rhp3.SessionHandler, error) {
-	rhp3, err := rhp3.NewSessionHandler(l, hostKey, cs, tp, w, am, cm, rm, sm, sr, monitor, sessions, log)
+func startRHP3(l net.Listener, hostKey types.PrivateKey, cs rhp3.ChainManager, tp rhp3.TransactionPool, w rhp3.Wallet, am rhp3.AccountManager, cm rhp3.ContractManager, rm rhp3.RegistryManager, sr rhp3.SettingsReporter, sm rhp3.StorageManager, pm rhp3.PolicyManager, monitor rhp.DataMonitor, sessions *rhp.SessionReporter, limiter *rhp.ConnLimiter, maintenance *rhp.MaintenanceManager, renters *rhp.RenterRecorder, log *zap.Logger) (*rhp3.SessionHandler, error) {
+	rhp3, err := rhp3.NewSessionHandler(l, hostKey, cs, tp, w, am, cm, rm, sm, sr, pm, monitor, sessions, limiter, maintenance, renters, log)
 	if err != nil {
 		return nil, err
 	}
@@ -141,22 +169,23 @@ func newNode(walletKey types.PrivateKey, logger *zap.Logger) (*node, types.Priva
 		return nil, types.PrivateKey{}, fmt.Errorf("failed to create chain manager: %w", err)
 	}
 
-	w, err := wallet.NewSingleAddressWallet(walletKey, cm, tp, db, logger.Named("wallet"))
+	webhookReporter, err := webhooks.NewManager(db, logger.Named("webhooks"))
 	if err != nil {
-		return nil, types.PrivateKey{}, fmt.Errorf("failed to create wallet: %w", err)
+		return nil, types.PrivateKey{}, fmt.Errorf("failed to create webhook reporter: %w", err)
 	}
+	am := alerts.NewManager(webhookReporter, logger.Named("alerts"))
 
-	webhookReporter, err := webhooks.NewManager(db, logger.Named("webhooks"))
+	w, err := wallet.NewSingleAddressWallet(walletKey, cm, tp, db, am, logger.Named("wallet"))
 	if err != nil {
-		return nil, types.PrivateKey{}, fmt.Errorf("failed to create webhook reporter: %w", err)
+		return nil, types.PrivateKey{}, fmt.Errorf("failed to create wallet: %w", err)
 	}
 
-	rhp2Listener, err := net.Listen("tcp", cfg.RHP2.Address)
+	rhp2Listener, err := listenRHP(cfg.RHP2.Address)
 	if err != nil {
 		return nil, types.PrivateKey{}, fmt.Errorf("failed to listen on rhp2 addr: %w", err)
 	}
 
-	rhp3Listener, err := net.Listen("tcp", cfg.RHP3.TCPAddress)
+	rhp3Listener, err := listenRHP(cfg.RHP3.TCPAddress)
 	if err != nil {
 		return nil, types.PrivateKey{}, fmt.Errorf("failed to listen on rhp3 addr: %w", err)
 	}
@@ -168,34 +197,61 @@ func newNode(walletKey types.PrivateKey, logger *zap.Logger) (*node, types.Priva
 	discoveredAddr := net.JoinHostPort(g.Address().Host(), rhp2Port)
 	logger.Debug("discovered address", zap.String("addr", discoveredAddr))
 
-	am := alerts.NewManager(webhookReporter, logger.Named("alerts"))
-	sr, err := settings.NewConfigManager(cfg.Directory, hostKey, discoveredAddr, db, cm, tp, w, am, logger.Named("settings"))
+	var rates settings.ExchangeRateProvider
+	if cfg.Pricing.ExchangeRateFile != "" {
+		rates = settings.NewFileRateProvider(cfg.Pricing.ExchangeRateFile)
+	}
+	// the sector cache is resized once the settings are loaded
+	sm, err := storage.NewVolumeManager(db, am, cm, logger.Named("volumes"), 0)
 	if err != nil {
-		return nil, types.PrivateKey{}, fmt.Errorf("failed to create settings manager: %w", err)
+		return nil, types.PrivateKey{}, fmt.Errorf("failed to create storage manager: %w", err)
 	}
 
-	accountManager := accounts.NewManager(db, sr)
-
-	sm, err := storage.NewVolumeManager(db, am, cm, logger.Named("volumes"), sr.Settings().SectorCacheSize)
+	sr, err := settings.NewConfigManager(cfg.Directory, hostKey, discoveredAddr, db, cm, tp, w, sm, am, rates, logger.Named("settings"))
 	if err != nil {
-		return nil, types.PrivateKey{}, fmt.Errorf("failed to create storage manager: %w", err)
+		return nil, types.PrivateKey{}, fmt.Errorf("failed to create settings manager: %w", err)
+	}
+	sm.ResizeCache(sr.Settings().SectorCacheSize)
+	sm.SetScrubRate(sr.Settings().ScrubRate)
+	sm.SetReplicationFactor(sr.Settings().ReplicationFactor)
+	sm.SetEncryptVolumes(sr.Settings().EncryptVolumes)
+	if cfg.Storage.DirectIO {
+		if err := sm.SetDirectIO(true); err != nil {
+			return nil, types.PrivateKey{}, fmt.Errorf("failed to enable direct I/O: %w", err)
+		}
 	}
 
+	accountManager := accounts.NewManager(db, sr)
+
 	contractManager, err := contracts.NewManager(db, am, sm, cm, tp, w, logger.Named("contracts"))
 	if err != nil {
 		return nil, types.PrivateKey{}, fmt.Errorf("failed to create contract manager: %w", err)
 	}
 	registryManager := registry.NewManager(hostKey, db, logger.Named("registry"))
+	policyManager := policy.NewManager(db, logger.Named("policy"))
 
 	sessions := rhp.NewSessionReporter()
+	limiter := rhp.NewConnLimiter(rhp.ConnLimits{
+		MaxSessionsPerIP:     cfg.RHPLimits.MaxSessionsPerIP,
+		MaxSessionsPerSubnet: cfg.RHPLimits.MaxSessionsPerSubnet,
+		ConnectionsPerSecond: cfg.RHPLimits.ConnectionsPerSecond,
+		HandshakeTimeout:     cfg.RHPLimits.HandshakeTimeout,
+		BanThreshold:         cfg.RHPLimits.BanThreshold,
+		BanDuration:          cfg.RHPLimits.BanDuration,
+	})
+	maintenance := rhp.NewMaintenanceManager(sessions, logger.Named("maintenance"))
 
 	dm := rhp.NewDataRecorder(db, logger.Named("data"))
-	rhp2, err := startRHP2(rhp2Listener, hostKey, rhp3Listener.Addr().String(), cm, tp, w, contractManager, sr, sm, dm, sessions, logger.Named("rhp2"))
+	rr, err := rhp.NewRenterRecorder(db, logger.Named("renters"))
+	if err != nil {
+		return nil, types.PrivateKey{}, fmt.Errorf("failed to create renter recorder: %w", err)
+	}
+	rhp2, err := startRHP2(rhp2Listener, hostKey, rhp3Listener.Addr().String(), cm, tp, w, contractManager, sr, sm, policyManager, dm, sessions, limiter, maintenance, rr, logger.Named("rhp2"))
 	if err != nil {
 		return nil, types.PrivateKey{}, fmt.Errorf("failed to start rhp2: %w", err)
 	}
 
-	rhp3, err := startRHP3(rhp3Listener, hostKey, cm, tp, w, accountManager, contractManager, registryManager, sr, sm, dm, sessions, logger.Named("rhp3"))
+	rhp3, err := startRHP3(rhp3Listener, hostKey, cm, tp, w, accountManager, contractManager, registryManager, sr, sm, policyManager, dm, sessions, limiter, maintenance, rr, logger.Named("rhp3"))
 	if err != nil {
 		return nil, types.PrivateKey{}, fmt.Errorf("failed to start rhp3: %w", err)
 	}
@@ -213,12 +269,16 @@ func newNode(walletKey types.PrivateKey, logger *zap.Logger) (*node, types.Priva
 		settings:  sr,
 		accounts:  accountManager,
 		contracts: contractManager,
+		policies:  policyManager,
 		storage:   sm,
 		registry:  registryManager,
 
-		sessions: sessions,
-		data:     dm,
-		rhp2:     rhp2,
-		rhp3:     rhp3,
+		sessions:    sessions,
+		limiter:     limiter,
+		maintenance: maintenance,
+		data:        dm,
+		renters:     rr,
+		rhp2:        rhp2,
+		rhp3:        rhp3,
 	}, hostKey, nil
 }
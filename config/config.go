@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 type (
 	// HTTP contains the configuration for the HTTP server.
 	HTTP struct {
@@ -27,6 +29,62 @@ type (
 		KeyPath          string `yaml:"keyPath"`
 	}
 
+	// RHPLimits contains the connection limits applied to the RHP2 and RHP3
+	// listeners. A zero value disables the corresponding limit.
+	RHPLimits struct {
+		MaxSessionsPerIP     int     `yaml:"maxSessionsPerIP"`
+		MaxSessionsPerSubnet int     `yaml:"maxSessionsPerSubnet"`
+		ConnectionsPerSecond float64 `yaml:"connectionsPerSecond"`
+		// HandshakeTimeout is the maximum duration of the transport
+		// handshake.
+		HandshakeTimeout time.Duration `yaml:"handshakeTimeout"`
+		// BanThreshold is the number of failed handshakes or unpaid RPCs
+		// after which a peer is temporarily banned.
+		BanThreshold int           `yaml:"banThreshold"`
+		BanDuration  time.Duration `yaml:"banDuration"`
+	}
+
+	// Maintenance contains the configuration for draining RHP sessions
+	// before shutting down.
+	Maintenance struct {
+		// DrainTimeout is the maximum duration to wait for in-flight RPCs to
+		// complete when shutting down. If zero, the default, hostd shuts
+		// down without draining.
+		DrainTimeout time.Duration `yaml:"drainTimeout"`
+	}
+
+	// ProxyProtocol contains the configuration for parsing PROXY protocol
+	// headers on the RHP2, RHP3, and RHP3 WebSocket listeners.
+	ProxyProtocol struct {
+		Enabled bool `yaml:"enabled"`
+		// TrustedProxies are the CIDRs or IP addresses of the proxies
+		// allowed to send PROXY headers. Headers from other addresses are
+		// not parsed.
+		TrustedProxies []string `yaml:"trustedProxies"`
+	}
+
+	// Pricing contains the configuration for automatic pricing.
+	Pricing struct {
+		// ExchangeRateFile is the path of a JSON file containing Siacoin
+		// exchange rates. Automatic pricing cannot be enabled without it.
+		ExchangeRateFile string `yaml:"exchangeRateFile"`
+	}
+
+	// Prometheus contains the configuration for the Prometheus metrics
+	// exporter.
+	Prometheus struct {
+		// Address is the address to serve metrics on. If empty, the exporter
+		// is disabled.
+		Address string `yaml:"address"`
+	}
+
+	// Storage contains the configuration for the volume manager.
+	Storage struct {
+		// DirectIO bypasses the page cache when reading and writing sector
+		// data in local volumes.
+		DirectIO bool `yaml:"directIO"`
+	}
+
 	// LogFile configures the file output of the logger.
 	LogFile struct {
 		Enabled bool   `yaml:"enabled"`
@@ -61,10 +119,16 @@ type (
 		RecoveryPhrase string `yaml:"recoveryPhrase"`
 		AutoOpenWebUI  bool   `yaml:"autoOpenWebUI"`
 
-		HTTP      HTTP      `yaml:"http"`
-		Consensus Consensus `yaml:"consensus"`
-		RHP2      RHP2      `yaml:"rhp2"`
-		RHP3      RHP3      `yaml:"rhp3"`
-		Log       Log       `yaml:"log"`
+		HTTP          HTTP          `yaml:"http"`
+		Consensus     Consensus     `yaml:"consensus"`
+		RHP2          RHP2          `yaml:"rhp2"`
+		RHP3          RHP3          `yaml:"rhp3"`
+		RHPLimits     RHPLimits     `yaml:"rhpLimits"`
+		ProxyProtocol ProxyProtocol `yaml:"proxyProtocol"`
+		Maintenance   Maintenance   `yaml:"maintenance"`
+		Pricing       Pricing       `yaml:"pricing"`
+		Prometheus    Prometheus    `yaml:"prometheus"`
+		Storage       Storage       `yaml:"storage"`
+		Log           Log           `yaml:"log"`
 	}
 )
@@ -103,18 +103,18 @@ func TestBudget(t *testing.T) {
 	}
 	defer cm.Close()
 
-	w, err := wallet.NewSingleAddressWallet(types.NewPrivateKeyFromSeed(frand.Bytes(32)), cm, tp, db, log.Named("wallet"))
+	webhookReporter, err := webhooks.NewManager(db, log.Named("webhooks"))
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer w.Close()
 
-	webhookReporter, err := webhooks.NewManager(db, log.Named("webhooks"))
+	a := alerts.NewManager(webhookReporter, log.Named("alerts"))
+	w, err := wallet.NewSingleAddressWallet(types.NewPrivateKeyFromSeed(frand.Bytes(32)), cm, tp, db, a, log.Named("wallet"))
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer w.Close()
 
-	a := alerts.NewManager(webhookReporter, log.Named("alerts"))
 	sm, err := storage.NewVolumeManager(db, a, cm, log.Named("storage"), 0)
 	if err != nil {
 		t.Fatal(err)
@@ -54,6 +54,10 @@ func (cm *ContractManager) buildStorageProof(id types.FileContractID, filesize u
 // processActions performs lifecycle actions on contracts. Triggered by a
 // consensus change, changes are processed in the order they were received.
 func (cm *ContractManager) processActions() {
+	// heights are only queued once consensus is caught up, so the tracked
+	// lifecycle transactions are rebuilt when the first height is processed
+	// instead of at startup.
+	var rebuilt bool
 	for {
 		select {
 		case height := <-cm.processQueue:
@@ -64,7 +68,11 @@ func (cm *ContractManager) processActions() {
 				}
 				defer done()
 
-				err = cm.store.ContractAction(height, cm.handleContractAction)
+				handler := cm.handleContractAction
+				if !rebuilt {
+					handler = cm.rebuildContractAction
+				}
+				err = cm.store.ContractAction(height, handler)
 				if err != nil {
 					return fmt.Errorf("failed to process contract actions: %w", err)
 				} else if err = cm.store.ExpireContractSectors(height); err != nil {
@@ -75,6 +83,7 @@ func (cm *ContractManager) processActions() {
 			if err != nil {
 				cm.log.Panic("failed to process contract actions", zap.Error(err), zap.Stack("stack"))
 			}
+			rebuilt = true
 			atomic.StoreUint64(&cm.blockHeight, height)
 		case <-cm.tg.Done():
 			return
@@ -84,6 +93,27 @@ func (cm *ContractManager) processActions() {
 
 // handleContractAction performs a lifecycle action on a contract.
 func (cm *ContractManager) handleContractAction(id types.FileContractID, height uint64, action string) {
+	cm.performContractAction(id, height, action, true)
+}
+
+// rebuildContractAction performs a lifecycle action on a contract for the
+// first height processed after startup. Unconfirmed formations, final
+// revisions and storage proofs are broadcast without debouncing so they are
+// tracked, rebroadcast, and their fees bumped without waiting for the next
+// debounced action.
+func (cm *ContractManager) rebuildContractAction(id types.FileContractID, height uint64, action string) {
+	switch action {
+	case ActionBroadcastFormation, ActionBroadcastFinalRevision, ActionBroadcastResolution:
+		cm.performContractAction(id, height, action, false)
+	default:
+		cm.performContractAction(id, height, action, true)
+	}
+}
+
+// performContractAction performs a lifecycle action on a contract. If debounce
+// is true, broadcasts are skipped at heights where they were recently
+// performed.
+func (cm *ContractManager) performContractAction(id types.FileContractID, height uint64, action string, debounce bool) {
 	log := cm.log.Named("lifecycle").With(zap.String("contractID", id.String()), zap.Uint64("height", height), zap.String("action", action))
 	contract, err := cm.store.Contract(id)
 	if err != nil {
@@ -96,7 +126,7 @@ func (cm *ContractManager) handleContractAction(id types.FileContractID, height
 
 	switch action {
 	case ActionBroadcastFormation:
-		if (height-contract.NegotiationHeight)%3 != 0 {
+		if debounce && (height-contract.NegotiationHeight)%3 != 0 {
 			// debounce formation broadcasts to prevent spamming
 			log.Debug("skipping rebroadcast", zap.Uint64("negotiationHeight", contract.NegotiationHeight))
 			return
@@ -109,9 +139,10 @@ func (cm *ContractManager) handleContractAction(id types.FileContractID, height
 			log.Error("failed to broadcast formation transaction", zap.Error(err))
 			return
 		}
+		cm.trackLifecycleTxn(id, action, formationSet)
 		log.Info("rebroadcast formation transaction", zap.String("transactionID", formationSet[len(formationSet)-1].ID().String()))
 	case ActionBroadcastFinalRevision:
-		if (contract.Revision.WindowStart-height)%3 != 0 {
+		if debounce && (contract.Revision.WindowStart-height)%3 != 0 {
 			// debounce final revision broadcasts to prevent spamming
 			log.Debug("skipping revision", zap.Uint64("windowStart", contract.Revision.WindowStart))
 			return
@@ -148,13 +179,20 @@ func (cm *ContractManager) handleContractAction(id types.FileContractID, height
 			log.Error("failed to broadcast revision transaction", zap.Error(err))
 			return
 		}
+		cm.trackLifecycleTxn(id, action, []types.Transaction{revisionTxn})
 		log.Info("broadcast final revision", zap.Uint64("revisionNumber", contract.Revision.RevisionNumber), zap.String("transactionID", revisionTxn.ID().String()))
 	case ActionBroadcastResolution:
-		if (height-contract.Revision.WindowStart)%3 != 0 {
+		if debounce && (height-contract.Revision.WindowStart)%3 != 0 {
 			// debounce resolution broadcasts to prevent spamming
 			log.Debug("skipping resolution", zap.Uint64("windowStart", contract.Revision.WindowStart))
 			return
 		}
+		if cm.lifecycleTxnPending(id, action) {
+			// the broadcast proof is rebroadcast and its fee bumped until it
+			// is confirmed
+			log.Debug("skipping resolution, storage proof pending")
+			return
+		}
 		validPayout, missedPayout := contract.Revision.ValidHostPayout(), contract.Revision.MissedHostPayout()
 		if missedPayout.Cmp(validPayout) >= 0 {
 			log.Info("skipping storage proof, no benefit to host", zap.String("validPayout", validPayout.ExactString()), zap.String("missedPayout", missedPayout.ExactString()))
@@ -176,8 +214,7 @@ func (cm *ContractManager) handleContractAction(id types.FileContractID, height
 			return
 		}
 
-		// TODO: consider cost of broadcasting the proof
-		fee := cm.tpool.RecommendedFee().Mul64(1000)
+		fee := cm.estimatedProofFee()
 		resolutionTxnSet := []types.Transaction{
 			{
 				// intermediate funding transaction is required by siad because
@@ -216,6 +253,7 @@ func (cm *ContractManager) handleContractAction(id types.FileContractID, height
 			log.Error("failed to broadcast resolution transaction set", zap.Error(err), zap.ByteString("transactionSet", buf))
 			return
 		}
+		cm.trackLifecycleTxn(id, action, resolutionTxnSet)
 		log.Info("broadcast storage proof", zap.String("transactionID", resolutionTxnSet[1].ID().String()), zap.Duration("elapsed", time.Since(start)))
 	case ActionReject:
 		if err := cm.store.ExpireContract(id, ContractStatusRejected); err != nil {
@@ -2,6 +2,8 @@
 
 package contracts
 
+import "time"
+
 const (
 	// RebroadcastBuffer is the number of blocks after the negotiation height to
 	// attempt to rebroadcast the contract.
@@ -9,4 +11,11 @@ const (
 	// RevisionSubmissionBuffer number of blocks before the proof window to
 	// submit a revision and prevent modification of the contract.
 	RevisionSubmissionBuffer = 24
+	// ProofBumpBuffer is the number of blocks before the end of the proof
+	// window at which the fee of an unconfirmed storage proof is bumped.
+	ProofBumpBuffer = 10
+
+	// lifecycleRebroadcastInterval is the interval at which unconfirmed
+	// lifecycle transactions are rebroadcast.
+	lifecycleRebroadcastInterval = 100 * time.Millisecond
 )
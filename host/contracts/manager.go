@@ -49,7 +49,11 @@ type (
 	Wallet interface {
 		Address() types.Address
 		UnlockConditions() types.UnlockConditions
-		FundTransaction(txn *types.Transaction, amount types.Currency) (toSign []types.Hash256, release func(), err error)
+		// AddressUnlockConditions returns the unlock conditions of an
+		// address belonging to the wallet's current or retired keys.
+		AddressUnlockConditions(types.Address) (types.UnlockConditions, bool)
+		Balance() (spendable, confirmed, unconfirmed types.Currency, err error)
+		FundTransaction(txn *types.Transaction, amount types.Currency, outputs ...types.SiacoinOutputID) (toSign []types.Hash256, release func(), err error)
 		SignTransaction(cs consensus.State, txn *types.Transaction, toSign []types.Hash256, cf types.CoveredFields) error
 	}
 
@@ -99,6 +103,9 @@ type (
 
 		mu    sync.Mutex                       // guards the following fields
 		locks map[types.FileContractID]*locker // contracts must be locked while they are being modified
+		// lifecycleTxns are the unconfirmed lifecycle transaction sets
+		// broadcast by the contract manager, keyed by contract ID and action.
+		lifecycleTxns map[string]*lifecycleTxn
 	}
 )
 
@@ -527,6 +534,8 @@ func NewManager(store ContractStore, alerts Alerts, storage StorageManager, c Ch
 
 		processQueue: make(chan uint64, 100),
 		locks:        make(map[types.FileContractID]*locker),
+
+		lifecycleTxns: make(map[string]*lifecycleTxn),
 	}
 
 	changeID, err := store.LastContractChange()
@@ -537,6 +546,7 @@ func NewManager(store ContractStore, alerts Alerts, storage StorageManager, c Ch
 	// start the actions queue. Required to avoid a deadlock in the tpool, but
 	// still process consensus changes serially.
 	go cm.processActions()
+	go cm.runRebroadcaster()
 
 	// subscribe to the consensus set in a separate goroutine to prevent
 	// blocking startup
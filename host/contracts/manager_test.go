@@ -1079,3 +1079,133 @@ func TestSectorRoots(t *testing.T) {
 		}
 	}
 }
+
+func TestUpcomingProofs(t *testing.T) {
+	hostKey, renterKey := types.NewPrivateKeyFromSeed(frand.Bytes(32)), types.NewPrivateKeyFromSeed(frand.Bytes(32))
+
+	dir := t.TempDir()
+	log := zaptest.NewLogger(t)
+	node, err := test.NewWallet(hostKey, dir, log.Named("wallet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+
+	webhookReporter, err := webhooks.NewManager(node.Store(), log.Named("webhooks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	am := alerts.NewManager(webhookReporter, log.Named("alerts"))
+	s, err := storage.NewVolumeManager(node.Store(), am, node.ChainManager(), log.Named("storage"), sectorCacheSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	result := make(chan error, 1)
+	volume, err := s.AddVolume(context.Background(), filepath.Join(dir, "data.dat"), 10, result)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := contracts.NewManager(node.Store(), am, s, node.ChainManager(), node.TPool(), node, log.Named("contracts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := node.MineBlocks(node.Address(), int(stypes.MaturityDelay*4)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond) // sync time
+
+	start := node.TipState().Index.Height + 20
+	rev, err := formContract(renterKey, hostKey, start, start+10, types.Siacoins(500), types.Siacoins(1000), c, node, node.ChainManager(), node.TPool())
+	if err != nil {
+		t.Fatal(err)
+	} else if err := node.MineBlocks(types.VoidAddress, 1); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond) // sync time
+
+	// add sectors to the contract
+	var roots []types.Hash256
+	for i := 0; i < 5; i++ {
+		var sector [rhp2.SectorSize]byte
+		frand.Read(sector[:256])
+		root := rhp2.SectorRoot(&sector)
+		release, err := s.Write(root, &sector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer release()
+		roots = append(roots, root)
+	}
+	// risk collateral so that a storage proof is required
+	collateral := types.Siacoins(100)
+	rev.Revision.RevisionNumber++
+	rev.Revision.Filesize = rhp2.SectorSize * uint64(len(roots))
+	rev.Revision.FileMerkleRoot = rhp2.MetaRoot(roots)
+	rev.Revision.MissedProofOutputs[1].Value = rev.Revision.MissedProofOutputs[1].Value.Sub(collateral)
+	rev.Revision.MissedProofOutputs[2].Value = rev.Revision.MissedProofOutputs[2].Value.Add(collateral)
+	sigHash := hashRevision(rev.Revision)
+	rev.HostSignature = hostKey.SignHash(sigHash)
+	rev.RenterSignature = renterKey.SignHash(sigHash)
+
+	updater, err := c.ReviseContract(rev.Revision.ParentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer updater.Close()
+	for _, root := range roots {
+		updater.AppendSector(root)
+	}
+	if err := updater.Commit(rev, contracts.Usage{RiskedCollateral: collateral}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the proof window does not open within the horizon
+	if proofs, err := c.UpcomingProofs(10); err != nil {
+		t.Fatal(err)
+	} else if len(proofs) != 0 {
+		t.Fatalf("expected no upcoming proofs, got %v", len(proofs))
+	}
+
+	proofs, err := c.UpcomingProofs(30)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(proofs) != 1 {
+		t.Fatalf("expected 1 upcoming proof, got %v", len(proofs))
+	}
+	proof := proofs[0]
+	switch {
+	case proof.ContractID != rev.Revision.ParentID:
+		t.Fatalf("expected contract %v, got %v", rev.Revision.ParentID, proof.ContractID)
+	case proof.WindowStart != start || proof.WindowEnd != start+10:
+		t.Fatalf("expected window [%v, %v], got [%v, %v]", start, start+10, proof.WindowStart, proof.WindowEnd)
+	case !proof.ProofRequired:
+		t.Fatal("expected proof to be required")
+	case !proof.RiskedCollateral.Equals(collateral):
+		t.Fatalf("expected %v risked collateral, got %v", collateral, proof.RiskedCollateral)
+	case proof.Sectors != 5 || proof.MissingSectors != 0 || !proof.SectorsAvailable:
+		t.Fatalf("expected 5 available sectors, got %v with %v missing", proof.Sectors, proof.MissingSectors)
+	case !proof.FeeAffordable:
+		t.Fatal("expected proof fee to be affordable")
+	}
+
+	// sectors on a read-only volume are not considered available
+	if err := s.SetReadOnly(volume.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	proofs, err = c.UpcomingProofs(30)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(proofs) != 1 {
+		t.Fatalf("expected 1 upcoming proof, got %v", len(proofs))
+	} else if proofs[0].MissingSectors != 5 || proofs[0].SectorsAvailable {
+		t.Fatalf("expected 5 missing sectors, got %v", proofs[0].MissingSectors)
+	}
+}
@@ -43,6 +43,10 @@ type (
 		// SectorRoots returns the sector roots for a contract. If limit is 0, all roots
 		// are returned.
 		SectorRoots(id types.FileContractID) ([]types.Hash256, error)
+		// ContractSectorAvailability returns the number of sectors in a
+		// contract and the number of those sectors that are not stored on
+		// an available, writable volume.
+		ContractSectorAvailability(id types.FileContractID) (sectors, missing uint64, err error)
 		// ContractAction calls contractFn on every contract in the store that
 		// needs a lifecycle action performed.
 		ContractAction(height uint64, contractFn func(types.FileContractID, uint64, string)) error
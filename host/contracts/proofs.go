@@ -0,0 +1,121 @@
+package contracts
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync/atomic"
+
+	"go.sia.tech/core/types"
+)
+
+// An UpcomingProof is an active contract whose proof window opens within a
+// horizon, along with the host's readiness to submit its storage proof.
+type UpcomingProof struct {
+	ContractID  types.FileContractID `json:"contractID"`
+	WindowStart uint64               `json:"windowStart"`
+	WindowEnd   uint64               `json:"windowEnd"`
+	// RiskedCollateral is the collateral that will be lost if the storage
+	// proof is not submitted.
+	RiskedCollateral types.Currency `json:"riskedCollateral"`
+	// ProofRequired is false if the host's missed payout is at least its
+	// valid payout, in which case no storage proof will be submitted.
+	ProofRequired bool `json:"proofRequired"`
+
+	Sectors uint64 `json:"sectors"`
+	// MissingSectors is the number of the contract's sectors that are not
+	// stored on an available, writable volume.
+	MissingSectors   uint64 `json:"missingSectors"`
+	SectorsAvailable bool   `json:"sectorsAvailable"`
+
+	// EstimatedFee is the estimated fee to submit the storage proof.
+	EstimatedFee types.Currency `json:"estimatedFee"`
+	// FeeAffordable is true if the wallet's spendable balance covers the
+	// estimated fee of this proof and every proof due before it.
+	FeeAffordable bool `json:"feeAffordable"`
+}
+
+// estimatedProofFee returns the miner fee used for storage proof transactions.
+func (cm *ContractManager) estimatedProofFee() types.Currency {
+	// TODO: consider cost of broadcasting the proof
+	return cm.tpool.RecommendedFee().Mul64(1000)
+}
+
+// UpcomingProofs returns the active contracts whose proof window opens within
+// horizon blocks of the current height, including contracts whose proof window
+// is currently open, ordered by window start.
+func (cm *ContractManager) UpcomingProofs(horizon uint64) ([]UpcomingProof, error) {
+	done, err := cm.tg.Add()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	height := atomic.LoadUint64(&cm.blockHeight)
+	maxHeight := height + horizon
+	if maxHeight < height {
+		// overflow
+		maxHeight = math.MaxUint64
+	}
+	filter := ContractFilter{
+		Statuses:            []ContractStatus{ContractStatusActive},
+		MaxExpirationHeight: maxHeight,
+		SortField:           ContractSortExpirationHeight,
+		Limit:               1000,
+	}
+	var active []Contract
+	for {
+		contracts, _, err := cm.store.Contracts(filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get contracts: %w", err)
+		}
+		active = append(active, contracts...)
+		if len(contracts) < filter.Limit {
+			break
+		}
+		filter.Offset += len(contracts)
+	}
+	sort.SliceStable(active, func(i, j int) bool {
+		return active[i].Revision.WindowStart < active[j].Revision.WindowStart
+	})
+
+	spendable, _, _, err := cm.wallet.Balance()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wallet balance: %w", err)
+	}
+	fee := cm.estimatedProofFee()
+
+	// fees are cumulative since the proofs are funded from the same wallet
+	var requiredFees types.Currency
+	proofs := make([]UpcomingProof, 0, len(active))
+	for _, c := range active {
+		if c.ResolutionHeight != 0 || c.Revision.WindowEnd <= height {
+			continue
+		}
+
+		validPayout, missedPayout := c.Revision.ValidHostPayout(), c.Revision.MissedHostPayout()
+		proof := UpcomingProof{
+			ContractID:       c.Revision.ParentID,
+			WindowStart:      c.Revision.WindowStart,
+			WindowEnd:        c.Revision.WindowEnd,
+			RiskedCollateral: c.Usage.RiskedCollateral,
+			ProofRequired:    validPayout.Cmp(missedPayout) > 0,
+		}
+
+		proof.Sectors, proof.MissingSectors, err = cm.store.ContractSectorAvailability(c.Revision.ParentID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check sector availability of contract %v: %w", c.Revision.ParentID, err)
+		}
+		proof.SectorsAvailable = proof.MissingSectors == 0
+
+		if proof.ProofRequired {
+			proof.EstimatedFee = fee
+			requiredFees = requiredFees.Add(fee)
+			proof.FeeAffordable = spendable.Cmp(requiredFees) >= 0
+		} else {
+			proof.FeeAffordable = true
+		}
+		proofs = append(proofs, proof)
+	}
+	return proofs, nil
+}
@@ -0,0 +1,318 @@
+package contracts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/hostd/alerts"
+	"go.sia.tech/siad/modules"
+	"go.uber.org/zap"
+	"lukechampine.com/frand"
+)
+
+const (
+	// maxProofBumps is the maximum number of times the fee of a storage
+	// proof transaction set will be bumped.
+	maxProofBumps = 5
+	// cpfpChildSize is the estimated size of a fee bumping child transaction
+	// with two inputs and a change output.
+	cpfpChildSize = 1000
+)
+
+// A lifecycleTxn is a contract lifecycle transaction set broadcast by the
+// contract manager that has not yet been confirmed.
+type lifecycleTxn struct {
+	contractID types.FileContractID
+	action     string
+	set        []types.Transaction
+
+	// bumps is the number of times the fee of the set has been bumped. The
+	// fee is bumped at most once per block.
+	bumps          int
+	lastBumpHeight uint64
+	alertID        types.Hash256
+}
+
+// setSize returns the encoded size of a transaction set.
+func setSize(set []types.Transaction) (n uint64) {
+	for _, txn := range set {
+		var buf strings.Builder
+		e := types.NewEncoder(&buf)
+		txn.EncodeTo(e)
+		e.Flush()
+		n += uint64(buf.Len())
+	}
+	return
+}
+
+// setFees returns the sum of the miner fees of a transaction set.
+func setFees(set []types.Transaction) (fees types.Currency) {
+	for _, txn := range set {
+		for _, fee := range txn.MinerFees {
+			fees = fees.Add(fee)
+		}
+	}
+	return
+}
+
+// cpfpOutput returns an output in the transaction set sent to an address
+// owned by the wallet that is not spent by another transaction in the set. The
+// output can be spent by a child transaction to increase the fee of the set.
+func cpfpOutput(set []types.Transaction, owned func(types.Address) bool) (types.SiacoinOutputID, types.SiacoinOutput, bool) {
+	spent := make(map[types.SiacoinOutputID]bool)
+	for _, txn := range set {
+		for _, sci := range txn.SiacoinInputs {
+			spent[sci.ParentID] = true
+		}
+	}
+	// prefer the most recent transaction's outputs
+	for i := len(set) - 1; i >= 0; i-- {
+		for j, sco := range set[i].SiacoinOutputs {
+			id := set[i].SiacoinOutputID(j)
+			if !owned(sco.Address) || spent[id] {
+				continue
+			}
+			return id, sco, true
+		}
+	}
+	return types.SiacoinOutputID{}, types.SiacoinOutput{}, false
+}
+
+// trackLifecycleTxn records a broadcast lifecycle transaction set so that it
+// will be rebroadcast until it is confirmed.
+func (cm *ContractManager) trackLifecycleTxn(id types.FileContractID, action string, set []types.Transaction) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	key := lifecycleKey(id, action)
+	if existing, ok := cm.lifecycleTxns[key]; ok {
+		existing.set = set
+		return
+	}
+	cm.lifecycleTxns[key] = &lifecycleTxn{
+		contractID: id,
+		action:     action,
+		set:        set,
+		alertID:    frand.Entropy256(),
+	}
+}
+
+// updateLifecycleTxn updates the fee bumping state of a tracked lifecycle
+// transaction set.
+func (cm *ContractManager) updateLifecycleTxn(lt lifecycleTxn) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if existing, ok := cm.lifecycleTxns[lifecycleKey(lt.contractID, lt.action)]; ok {
+		existing.set = lt.set
+		existing.bumps = lt.bumps
+		existing.lastBumpHeight = lt.lastBumpHeight
+	}
+}
+
+// lifecycleTxnPending returns true if a lifecycle transaction set for the
+// contract and action is waiting to be confirmed.
+func (cm *ContractManager) lifecycleTxnPending(id types.FileContractID, action string) bool {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	_, ok := cm.lifecycleTxns[lifecycleKey(id, action)]
+	return ok
+}
+
+// untrackLifecycleTxn stops rebroadcasting a lifecycle transaction set and
+// dismisses its alert.
+func (cm *ContractManager) untrackLifecycleTxn(lt lifecycleTxn) {
+	cm.mu.Lock()
+	delete(cm.lifecycleTxns, lifecycleKey(lt.contractID, lt.action))
+	cm.mu.Unlock()
+	cm.alerts.Dismiss(lt.alertID)
+}
+
+// lifecycleTxnConfirmed returns true if the lifecycle transaction set no
+// longer needs to be rebroadcast, either because it has been confirmed or
+// because the contract can no longer be changed.
+func lifecycleTxnConfirmed(lt lifecycleTxn, contract Contract, height uint64) bool {
+	switch lt.action {
+	case ActionBroadcastFormation:
+		return contract.FormationConfirmed || height >= contract.Revision.WindowStart
+	case ActionBroadcastFinalRevision:
+		return contract.RevisionConfirmed || height >= contract.Revision.WindowStart
+	case ActionBroadcastResolution:
+		return contract.ResolutionHeight != 0 || height >= contract.Revision.WindowEnd
+	}
+	return true
+}
+
+// bumpProofFee adds a child transaction to the storage proof set that spends
+// one of the set's wallet outputs, increasing the fee rate of the whole set.
+// The fee rate doubles with each bump.
+func (cm *ContractManager) bumpProofFee(lt lifecycleTxn) ([]types.Transaction, error) {
+	// sets built before a key rotation have their outputs at a retired
+	// address
+	owned := func(addr types.Address) bool {
+		_, ok := cm.wallet.AddressUnlockConditions(addr)
+		return ok
+	}
+	parentID, parent, ok := cpfpOutput(lt.set, owned)
+	if !ok {
+		return nil, errors.New("transaction set has no wallet output to spend")
+	}
+	parentValue := parent.Value
+	uc, _ := cm.wallet.AddressUnlockConditions(parent.Address)
+
+	feeRate := cm.tpool.RecommendedFee().Mul64(1 << (lt.bumps + 1))
+	required := feeRate.Mul64(setSize(lt.set) + cpfpChildSize)
+	existing := setFees(lt.set)
+	childFee := feeRate.Mul64(cpfpChildSize)
+	if required.Cmp(existing) > 0 && required.Sub(existing).Cmp(childFee) > 0 {
+		childFee = required.Sub(existing)
+	}
+
+	child := types.Transaction{
+		MinerFees: []types.Currency{childFee},
+		SiacoinInputs: []types.SiacoinInput{{
+			ParentID:         parentID,
+			UnlockConditions: uc,
+		}},
+	}
+	toSign := []types.Hash256{types.Hash256(parentID)}
+	if parentValue.Cmp(childFee) > 0 {
+		child.SiacoinOutputs = []types.SiacoinOutput{{Address: cm.wallet.Address(), Value: parentValue.Sub(childFee)}}
+	} else if parentValue.Cmp(childFee) < 0 {
+		// fund the remainder of the fee from the wallet
+		fundToSign, release, err := cm.wallet.FundTransaction(&child, childFee.Sub(parentValue))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fund child transaction: %w", err)
+		}
+		defer release()
+		toSign = append(toSign, fundToSign...)
+	}
+
+	if err := cm.wallet.SignTransaction(cm.chain.TipState(), &child, toSign, types.CoveredFields{WholeTransaction: true}); err != nil {
+		return nil, fmt.Errorf("failed to sign child transaction: %w", err)
+	}
+	set := append(append([]types.Transaction(nil), lt.set...), child)
+	if err := cm.tpool.AcceptTransactionSet(set); err != nil {
+		return nil, fmt.Errorf("failed to broadcast child transaction: %w", err)
+	}
+	return set, nil
+}
+
+// registerProofAlert registers an alert for a storage proof that has not been
+// confirmed as the end of the proof window approaches.
+func (cm *ContractManager) registerProofAlert(lt lifecycleTxn, contract Contract, height uint64, bumpErr error) {
+	severity := alerts.SeverityWarning
+	message := "Storage proof has not confirmed, fee bumped"
+	if bumpErr != nil || lt.bumps >= maxProofBumps {
+		severity = alerts.SeverityCritical
+		message = "Storage proof has not confirmed, collateral at risk"
+	}
+	data := map[string]any{
+		"contractID":    lt.contractID,
+		"blockHeight":   height,
+		"windowEnd":     contract.Revision.WindowEnd,
+		"bumps":         lt.bumps,
+		"transactionID": lt.set[len(lt.set)-1].ID(),
+		"collateral":    contract.LockedCollateral,
+	}
+	if bumpErr != nil {
+		data["error"] = bumpErr.Error()
+	}
+	cm.alerts.Register(alerts.Alert{
+		ID:        lt.alertID,
+		Severity:  severity,
+		Message:   message,
+		Data:      data,
+		Timestamp: time.Now(),
+	})
+}
+
+// rebroadcastLifecycleTxns rebroadcasts the unconfirmed lifecycle transaction
+// sets and bumps the fee of storage proofs nearing the end of their proof
+// window.
+func (cm *ContractManager) rebroadcastLifecycleTxns() {
+	height := atomic.LoadUint64(&cm.blockHeight)
+
+	cm.mu.Lock()
+	pending := make([]lifecycleTxn, 0, len(cm.lifecycleTxns))
+	for _, lt := range cm.lifecycleTxns {
+		pending = append(pending, *lt)
+	}
+	cm.mu.Unlock()
+
+	for _, lt := range pending {
+		log := cm.log.Named("lifecycle").With(zap.Stringer("contractID", lt.contractID), zap.String("action", lt.action), zap.Uint64("height", height))
+		contract, err := cm.store.Contract(lt.contractID)
+		if errors.Is(err, ErrNotFound) {
+			cm.untrackLifecycleTxn(lt)
+			continue
+		} else if err != nil {
+			log.Error("failed to get contract", zap.Error(err))
+			continue
+		} else if lifecycleTxnConfirmed(lt, contract, height) {
+			cm.untrackLifecycleTxn(lt)
+			continue
+		}
+
+		if lt.action == ActionBroadcastResolution && height+ProofBumpBuffer >= contract.Revision.WindowEnd && height > lt.lastBumpHeight {
+			lt.lastBumpHeight = height
+			if lt.bumps < maxProofBumps {
+				set, err := cm.bumpProofFee(lt)
+				if err != nil {
+					cm.updateLifecycleTxn(lt)
+					log.Error("failed to bump storage proof fee", zap.Error(err))
+					cm.registerProofAlert(lt, contract, height, err)
+					continue
+				}
+				lt.bumps++
+				lt.set = set
+				cm.updateLifecycleTxn(lt)
+				cm.registerProofAlert(lt, contract, height, nil)
+				log.Warn("bumped storage proof fee", zap.Int("bumps", lt.bumps), zap.Stringer("transactionID", set[len(set)-1].ID()), zap.Uint64("windowEnd", contract.Revision.WindowEnd))
+				continue
+			}
+			// the fee can no longer be bumped, continue rebroadcasting
+			cm.updateLifecycleTxn(lt)
+			cm.registerProofAlert(lt, contract, height, nil)
+		}
+
+		if err := cm.tpool.AcceptTransactionSet(lt.set); err != nil && !errors.Is(err, modules.ErrDuplicateTransactionSet) {
+			// the set is no longer valid. Stop tracking it so that the next
+			// contract action creates a new one.
+			log.Warn("failed to rebroadcast lifecycle transaction set", zap.Error(err))
+			cm.untrackLifecycleTxn(lt)
+			continue
+		}
+		log.Debug("rebroadcast lifecycle transaction set", zap.Stringer("transactionID", lt.set[len(lt.set)-1].ID()))
+	}
+}
+
+// runRebroadcaster periodically rebroadcasts unconfirmed lifecycle
+// transactions until the contract manager is closed.
+func (cm *ContractManager) runRebroadcaster() {
+	ctx, cancel, err := cm.tg.AddContext(context.Background())
+	if err != nil {
+		return
+	}
+	defer cancel()
+
+	t := time.NewTicker(lifecycleRebroadcastInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		cm.rebroadcastLifecycleTxns()
+	}
+}
+
+// lifecycleKey returns the key of a lifecycle transaction set in the contract
+// manager's lifecycleTxns map.
+func lifecycleKey(id types.FileContractID, action string) string {
+	return id.String() + "/" + action
+}
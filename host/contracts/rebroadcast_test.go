@@ -0,0 +1,76 @@
+package contracts
+
+import (
+	"testing"
+
+	"go.sia.tech/core/types"
+)
+
+func TestCPFPOutput(t *testing.T) {
+	addr := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	retired := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	isAddr := func(a types.Address) func(types.Address) bool {
+		return func(b types.Address) bool { return a == b }
+	}
+	owned := func(b types.Address) bool { return b == addr || b == retired }
+	parent := types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{
+			{Address: addr, Value: types.Siacoins(1)},
+			{Address: types.VoidAddress, Value: types.Siacoins(2)},
+			{Address: addr, Value: types.Siacoins(3)},
+		},
+	}
+	proof := types.Transaction{
+		MinerFees: []types.Currency{types.Siacoins(1)},
+		SiacoinInputs: []types.SiacoinInput{
+			{ParentID: parent.SiacoinOutputID(0)},
+		},
+		StorageProofs: []types.StorageProof{{ParentID: types.FileContractID{1}}},
+	}
+
+	// the first output is spent by the proof, so the third output should be
+	// used
+	id, sco, ok := cpfpOutput([]types.Transaction{parent, proof}, isAddr(addr))
+	if !ok {
+		t.Fatal("expected an output")
+	} else if id != parent.SiacoinOutputID(2) {
+		t.Fatalf("expected output %v, got %v", parent.SiacoinOutputID(2), id)
+	} else if !sco.Value.Equals(types.Siacoins(3)) {
+		t.Fatalf("expected value %v, got %v", types.Siacoins(3), sco.Value)
+	}
+
+	// a child's change output should be preferred over the parent's
+	child := types.Transaction{
+		MinerFees:      []types.Currency{types.Siacoins(1)},
+		SiacoinInputs:  []types.SiacoinInput{{ParentID: id}},
+		SiacoinOutputs: []types.SiacoinOutput{{Address: addr, Value: types.Siacoins(2)}},
+	}
+	set := []types.Transaction{parent, proof, child}
+	id, _, ok = cpfpOutput(set, isAddr(addr))
+	if !ok {
+		t.Fatal("expected an output")
+	} else if id != child.SiacoinOutputID(0) {
+		t.Fatalf("expected output %v, got %v", child.SiacoinOutputID(0), id)
+	} else if fees := setFees(set); !fees.Equals(types.Siacoins(2)) {
+		t.Fatalf("expected fees %v, got %v", types.Siacoins(2), fees)
+	}
+
+	// no wallet outputs remain if all are spent
+	if _, _, ok := cpfpOutput([]types.Transaction{parent, proof}, isAddr(types.VoidAddress)); !ok {
+		t.Fatal("expected the void output")
+	} else if _, _, ok := cpfpOutput([]types.Transaction{proof}, isAddr(addr)); ok {
+		t.Fatal("expected no output")
+	}
+
+	// outputs at a retired address can be spent after a key rotation
+	rotated := types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{Address: retired, Value: types.Siacoins(4)}},
+	}
+	if _, _, ok := cpfpOutput([]types.Transaction{rotated}, isAddr(addr)); ok {
+		t.Fatal("expected no output at the current address")
+	} else if id, sco, ok := cpfpOutput([]types.Transaction{rotated}, owned); !ok {
+		t.Fatal("expected the retired output")
+	} else if id != rotated.SiacoinOutputID(0) || sco.Address != retired {
+		t.Fatalf("expected retired output %v, got %v", rotated.SiacoinOutputID(0), id)
+	}
+}
@@ -69,6 +69,9 @@ type (
 		SectorAccessPrice    types.Currency `json:"sectorAccessPrice"`
 		StoragePrice         types.Currency `json:"storagePrice"`
 		CollateralMultiplier float64        `json:"collateralMultiplier"`
+		// StoragePriceMultiplier is the multiplier applied to the base
+		// storage price by utilization pricing
+		StoragePriceMultiplier float64 `json:"storagePriceMultiplier"`
 	}
 
 	// Registry is a collection of metrics related to the host's registry.
@@ -86,6 +89,9 @@ type (
 		PhysicalSectors uint64 `json:"physicalSectors"`
 		ContractSectors uint64 `json:"contractSectors"`
 		TempSectors     uint64 `json:"tempSectors"`
+		// EphemeralSectors is the number of physical sectors only referenced
+		// by temp storage. They are removed when the references expire.
+		EphemeralSectors uint64 `json:"ephemeralSectors"`
 
 		Reads  uint64 `json:"reads"`
 		Writes uint64 `json:"writes"`
@@ -0,0 +1,232 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrRenterBlocked is returned when a renter is on the block list.
+	ErrRenterBlocked = errors.New("renter is blocked")
+	// ErrRenterNotAllowed is returned when the host only accepts contracts
+	// from allowed renters and the renter is not on the allow list.
+	ErrRenterNotAllowed = errors.New("renter is not on the allow list")
+	// ErrContractTooShort is returned when a contract's duration is less
+	// than the minimum contract duration.
+	ErrContractTooShort = errors.New("contract duration is less than the minimum")
+	// ErrMaxDataExceeded is returned when a contract would exceed the
+	// maximum data stored for a renter.
+	ErrMaxDataExceeded = errors.New("contract would exceed the maximum data per renter")
+	// ErrMaxCollateralExceeded is returned when a contract would exceed the
+	// maximum collateral locked for a renter.
+	ErrMaxCollateralExceeded = errors.New("contract would exceed the maximum collateral per renter")
+
+	// ErrNotFound is returned when a renter is not on the allow or block
+	// list.
+	ErrNotFound = errors.New("renter not found")
+)
+
+type (
+	// A Policy contains the host's contract acceptance policy. Zero values
+	// disable the corresponding limit.
+	Policy struct {
+		// AllowlistOnly only accepts contracts from renters on the allow
+		// list.
+		AllowlistOnly bool `json:"allowlistOnly"`
+		// MinContractDuration is the minimum number of blocks until the
+		// contract's proof window starts.
+		MinContractDuration uint64 `json:"minContractDuration"`
+		// MaxRenterData is the maximum number of bytes stored in a renter's
+		// active contracts.
+		MaxRenterData uint64 `json:"maxRenterData"`
+		// MaxRenterCollateral is the maximum collateral locked in a renter's
+		// active contracts.
+		MaxRenterCollateral types.Currency `json:"maxRenterCollateral"`
+
+		// RenterIngressLimit and RenterEgressLimit are the maximum bandwidth
+		// in bytes per second used by each renter across all of its
+		// sessions.
+		RenterIngressLimit uint64 `json:"renterIngressLimit"`
+		RenterEgressLimit  uint64 `json:"renterEgressLimit"`
+		// MaxRenterDailyEgress is the maximum number of bytes sent to each
+		// renter per UTC day. Once reached, the renter's read RPCs are
+		// rejected until the next day.
+		MaxRenterDailyEgress uint64 `json:"maxRenterDailyEgress"`
+	}
+
+	// A RenterAccess is an entry in the host's renter allow or block list.
+	RenterAccess struct {
+		PublicKey types.PublicKey `json:"publicKey"`
+		Allowed   bool            `json:"allowed"`
+		Timestamp time.Time       `json:"timestamp"`
+	}
+
+	// RenterUsage is the data and collateral in a renter's active contracts.
+	RenterUsage struct {
+		Contracts  uint64         `json:"contracts"`
+		Data       uint64         `json:"data"`
+		Collateral types.Currency `json:"collateral"`
+	}
+
+	// RenterBandwidth is the data sent to and received from a renter in a
+	// period.
+	RenterBandwidth struct {
+		RenterKey types.PublicKey `json:"renterKey"`
+		Period    time.Time       `json:"period"`
+		Ingress   uint64          `json:"ingress"`
+		Egress    uint64          `json:"egress"`
+	}
+
+	// A ContractRequest contains the fields of a contract formation or
+	// renewal that are evaluated against the host's policy.
+	ContractRequest struct {
+		RenterKey types.PublicKey
+		// Duration is the number of blocks until the contract's proof window
+		// starts.
+		Duration uint64
+		// Filesize is the size of the contract's data.
+		Filesize uint64
+		// Collateral is the collateral locked by the host.
+		Collateral types.Currency
+		// RenewedFrom is the ID of the contract being renewed, if any. It is
+		// excluded from the renter's existing usage.
+		RenewedFrom types.FileContractID
+	}
+
+	// A Store persists the host's contract policy.
+	Store interface {
+		// ContractPolicy returns the host's contract policy.
+		ContractPolicy() (Policy, error)
+		// UpdateContractPolicy updates the host's contract policy.
+		UpdateContractPolicy(Policy) error
+
+		// RenterAccessList returns the renters on the host's allow and block
+		// lists.
+		RenterAccessList() ([]RenterAccess, error)
+		// RenterAccess returns the access list entry of a renter. If the
+		// renter is not on either list, ErrNotFound should be returned.
+		RenterAccess(types.PublicKey) (RenterAccess, error)
+		// SetRenterAccess adds a renter to the allow or block list.
+		SetRenterAccess(renterKey types.PublicKey, allowed bool) error
+		// RemoveRenterAccess removes a renter from the allow and block lists.
+		// If the renter is not on either list, ErrNotFound should be
+		// returned.
+		RemoveRenterAccess(types.PublicKey) error
+
+		// RenterUsage returns the data and collateral in a renter's pending
+		// and active contracts, excluding the contract with the given ID.
+		RenterUsage(renterKey types.PublicKey, exclude types.FileContractID) (RenterUsage, error)
+
+		// RenterBandwidth returns the daily bandwidth usage of a renter
+		// between start and end.
+		RenterBandwidth(renterKey types.PublicKey, start, end time.Time) ([]RenterBandwidth, error)
+		// RenterBandwidthTotals returns the total bandwidth usage of each
+		// renter between start and end, ordered by egress.
+		RenterBandwidthTotals(start, end time.Time, limit, offset int) ([]RenterBandwidth, error)
+	}
+
+	// A Manager evaluates contracts against the host's policy.
+	Manager struct {
+		store Store
+		log   *zap.Logger
+	}
+)
+
+// Policy returns the host's contract policy.
+func (m *Manager) Policy() (Policy, error) {
+	return m.store.ContractPolicy()
+}
+
+// UpdatePolicy updates the host's contract policy.
+func (m *Manager) UpdatePolicy(p Policy) error {
+	return m.store.UpdateContractPolicy(p)
+}
+
+// RenterAccessList returns the renters on the host's allow and block lists.
+func (m *Manager) RenterAccessList() ([]RenterAccess, error) {
+	return m.store.RenterAccessList()
+}
+
+// SetRenterAccess adds a renter to the allow or block list.
+func (m *Manager) SetRenterAccess(renterKey types.PublicKey, allowed bool) error {
+	return m.store.SetRenterAccess(renterKey, allowed)
+}
+
+// RemoveRenterAccess removes a renter from the allow and block lists.
+func (m *Manager) RemoveRenterAccess(renterKey types.PublicKey) error {
+	return m.store.RemoveRenterAccess(renterKey)
+}
+
+// RenterUsage returns the data and collateral in a renter's active contracts.
+func (m *Manager) RenterUsage(renterKey types.PublicKey) (RenterUsage, error) {
+	return m.store.RenterUsage(renterKey, types.FileContractID{})
+}
+
+// RenterBandwidth returns the daily bandwidth usage of a renter between start
+// and end.
+func (m *Manager) RenterBandwidth(renterKey types.PublicKey, start, end time.Time) ([]RenterBandwidth, error) {
+	return m.store.RenterBandwidth(renterKey, start, end)
+}
+
+// RenterBandwidthTotals returns the total bandwidth usage of each renter
+// between start and end, ordered by egress.
+func (m *Manager) RenterBandwidthTotals(start, end time.Time, limit, offset int) ([]RenterBandwidth, error) {
+	return m.store.RenterBandwidthTotals(start, end, limit, offset)
+}
+
+// EvaluateContract checks a contract formation or renewal against the host's
+// policy. A nil error means the contract is accepted.
+func (m *Manager) EvaluateContract(req ContractRequest) error {
+	p, err := m.store.ContractPolicy()
+	if err != nil {
+		return fmt.Errorf("failed to get contract policy: %w", err)
+	}
+
+	access, err := m.store.RenterAccess(req.RenterKey)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		if p.AllowlistOnly {
+			return ErrRenterNotAllowed
+		}
+	case err != nil:
+		return fmt.Errorf("failed to get renter access: %w", err)
+	case !access.Allowed:
+		return ErrRenterBlocked
+	}
+
+	if req.Duration < p.MinContractDuration {
+		return fmt.Errorf("%w: %d < %d blocks", ErrContractTooShort, req.Duration, p.MinContractDuration)
+	} else if p.MaxRenterData == 0 && p.MaxRenterCollateral.IsZero() {
+		return nil
+	}
+
+	usage, err := m.store.RenterUsage(req.RenterKey, req.RenewedFrom)
+	if err != nil {
+		return fmt.Errorf("failed to get renter usage: %w", err)
+	}
+
+	if p.MaxRenterData > 0 {
+		if data := usage.Data + req.Filesize; data < usage.Data || data > p.MaxRenterData {
+			return fmt.Errorf("%w: %d > %d bytes", ErrMaxDataExceeded, data, p.MaxRenterData)
+		}
+	}
+	if !p.MaxRenterCollateral.IsZero() {
+		collateral, overflow := usage.Collateral.AddWithOverflow(req.Collateral)
+		if overflow || collateral.Cmp(p.MaxRenterCollateral) > 0 {
+			return fmt.Errorf("%w: %v > %v", ErrMaxCollateralExceeded, collateral, p.MaxRenterCollateral)
+		}
+	}
+	return nil
+}
+
+// NewManager initializes a new policy manager.
+func NewManager(store Store, log *zap.Logger) *Manager {
+	return &Manager{
+		store: store,
+		log:   log,
+	}
+}
@@ -2,6 +2,7 @@ package registry
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
@@ -14,6 +15,10 @@ type (
 		store Store
 		log   *zap.Logger
 
+		// total reads and writes since startup
+		totalReads  uint64 // atomic
+		totalWrites uint64 // atomic
+
 		mu sync.Mutex
 		r  uint64
 		w  uint64
@@ -40,6 +45,7 @@ func (rr *registryAccessRecorder) Flush() {
 
 // AddRead increments the number of sectors read by 1.
 func (rr *registryAccessRecorder) AddRead() {
+	atomic.AddUint64(&rr.totalReads, 1)
 	rr.mu.Lock()
 	defer rr.mu.Unlock()
 	rr.r++
@@ -47,11 +53,17 @@ func (rr *registryAccessRecorder) AddRead() {
 
 // AddWrite increments the number of sectors written by 1.
 func (rr *registryAccessRecorder) AddWrite() {
+	atomic.AddUint64(&rr.totalWrites, 1)
 	rr.mu.Lock()
 	defer rr.mu.Unlock()
 	rr.w++
 }
 
+// Stats returns the number of registry reads and writes since startup.
+func (rr *registryAccessRecorder) Stats() (reads, writes uint64) {
+	return atomic.LoadUint64(&rr.totalReads), atomic.LoadUint64(&rr.totalWrites)
+}
+
 // Run starts the recorder, flushing data at regular intervals.
 func (rr *registryAccessRecorder) Run(stop <-chan struct{}) {
 	t := time.NewTicker(flushInterval)
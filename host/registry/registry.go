@@ -66,6 +66,12 @@ func (r *Manager) Entries() (count uint64, total uint64, err error) {
 	return r.store.RegistryEntries()
 }
 
+// Stats returns the number of registry reads and writes since the manager
+// was started.
+func (r *Manager) Stats() (reads, writes uint64) {
+	return r.recorder.Stats()
+}
+
 // Get returns the registry value for the provided key.
 func (r *Manager) Get(key rhp3.RegistryKey) (value rhp3.RegistryValue, err error) {
 	r.mu.Lock()
@@ -119,7 +125,8 @@ func NewManager(privkey types.PrivateKey, store Store, log *zap.Logger) *Manager
 		tg:     threadgroup.New(),
 		store:  store,
 		recorder: &registryAccessRecorder{
-			log: log.Named("recorder"),
+			store: store,
+			log:   log.Named("recorder"),
 		},
 	}
 	go m.recorder.Run(m.tg.Done())
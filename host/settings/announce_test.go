@@ -42,7 +42,7 @@ func TestAutoAnnounce(t *testing.T) {
 	}
 
 	am := alerts.NewManager(webhookReporter, log.Named("alerts"))
-	manager, err := settings.NewConfigManager(dir, hostKey, "localhost:9882", db, node.ChainManager(), node.TPool(), node, am, log.Named("settings"))
+	manager, err := settings.NewConfigManager(dir, hostKey, "localhost:9882", db, node.ChainManager(), node.TPool(), node, nil, am, nil, log.Named("settings"))
 	if err != nil {
 		t.Fatal(err)
 	}
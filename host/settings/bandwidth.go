@@ -0,0 +1,280 @@
+package settings
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// bandwidthTimeFormat is the format of the start and end times of a
+	// bandwidth window.
+	bandwidthTimeFormat = "15:04"
+
+	// maxBandwidthTimerInterval is the maximum interval between checks of the
+	// bandwidth schedule. The schedule is checked periodically even if no
+	// change is due to correct for clock adjustments.
+	maxBandwidthTimerInterval = time.Hour
+)
+
+type (
+	// A BandwidthWindow overrides the host's bandwidth limits during a
+	// recurring period of the day.
+	BandwidthWindow struct {
+		Name string `json:"name"`
+		// Days are the days of the week on which the window starts, with
+		// Sunday as 0. If empty, the window starts every day.
+		Days []time.Weekday `json:"days"`
+		// Start and End are the times of day in "15:04" format. If End is
+		// not after Start, the window ends on the following day.
+		Start string `json:"start"`
+		End   string `json:"end"`
+
+		// IngressLimit and EgressLimit are the bandwidth limits in bytes
+		// per second while the window is active. 0 is unlimited.
+		IngressLimit uint64 `json:"ingressLimit"`
+		EgressLimit  uint64 `json:"egressLimit"`
+	}
+
+	// BandwidthScheduleSettings contains a schedule of bandwidth windows.
+	// Outside of all windows, the host's IngressLimit and EgressLimit apply.
+	// If windows overlap, the first one in the list takes precedence.
+	BandwidthScheduleSettings struct {
+		Enabled bool `json:"enabled"`
+		// Timezone is the IANA time zone the windows are evaluated in. If
+		// empty, the host's local time zone is used.
+		Timezone string            `json:"timezone"`
+		Windows  []BandwidthWindow `json:"windows"`
+	}
+
+	// BandwidthStatus is the host's current bandwidth limits.
+	BandwidthStatus struct {
+		// Window is the active bandwidth window, nil if the default limits
+		// apply.
+		Window       *BandwidthWindow `json:"window,omitempty"`
+		IngressLimit uint64           `json:"ingressLimit"`
+		EgressLimit  uint64           `json:"egressLimit"`
+		// NextChange is the time the limits will next change. It is zero if
+		// the schedule is disabled.
+		NextChange time.Time `json:"nextChange"`
+	}
+)
+
+// parseTimeOfDay parses a time of day in "15:04" format.
+func parseTimeOfDay(s string) (hour, minute int, err error) {
+	t, err := time.Parse(bandwidthTimeFormat, s)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid time of day %q: %w", s, err)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+func validateBandwidthSchedule(bs BandwidthScheduleSettings) error {
+	if !bs.Enabled {
+		return nil
+	} else if _, err := time.LoadLocation(bs.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone %q: %w", bs.Timezone, err)
+	}
+
+	for i, w := range bs.Windows {
+		startHour, startMinute, err := parseTimeOfDay(w.Start)
+		if err != nil {
+			return fmt.Errorf("window %d: %w", i, err)
+		}
+		endHour, endMinute, err := parseTimeOfDay(w.End)
+		if err != nil {
+			return fmt.Errorf("window %d: %w", i, err)
+		} else if startHour == endHour && startMinute == endMinute {
+			return fmt.Errorf("window %d: start and end must be different", i)
+		}
+		for _, day := range w.Days {
+			if day < time.Sunday || day > time.Saturday {
+				return fmt.Errorf("window %d: invalid day %d", i, day)
+			}
+		}
+	}
+	return nil
+}
+
+// location returns the time zone of the schedule.
+func (bs BandwidthScheduleSettings) location() *time.Location {
+	// time.LoadLocation returns UTC for an empty name
+	if bs.Timezone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(bs.Timezone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// startsOn returns true if the window starts on the given day.
+func (w BandwidthWindow) startsOn(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// occurrence returns the start and end of the window if it starts on the
+// same day as t.
+func (w BandwidthWindow) occurrence(t time.Time) (start, end time.Time, ok bool) {
+	if !w.startsOn(t.Weekday()) {
+		return time.Time{}, time.Time{}, false
+	}
+	startHour, startMinute, err := parseTimeOfDay(w.Start)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	endHour, endMinute, err := parseTimeOfDay(w.End)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+
+	y, m, d := t.Date()
+	start = time.Date(y, m, d, startHour, startMinute, 0, 0, t.Location())
+	end = time.Date(y, m, d, endHour, endMinute, 0, 0, t.Location())
+	if !end.After(start) {
+		// the window ends on the following day
+		end = time.Date(y, m, d+1, endHour, endMinute, 0, 0, t.Location())
+	}
+	return start, end, true
+}
+
+// activeIndex returns the index of the window active at t, or -1 if no
+// window is active.
+func (bs BandwidthScheduleSettings) activeIndex(t time.Time) int {
+	if !bs.Enabled {
+		return -1
+	}
+	t = t.In(bs.location())
+	for i, w := range bs.Windows {
+		// a window that started the previous day may still be active
+		for _, day := range []time.Time{t, t.AddDate(0, 0, -1)} {
+			start, end, ok := w.occurrence(day)
+			if ok && !t.Before(start) && t.Before(end) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// ActiveWindow returns the window active at t. If no window is active, false
+// is returned.
+func (bs BandwidthScheduleSettings) ActiveWindow(t time.Time) (BandwidthWindow, bool) {
+	i := bs.activeIndex(t)
+	if i < 0 {
+		return BandwidthWindow{}, false
+	}
+	return bs.Windows[i], true
+}
+
+// NextChange returns the first time after t at which the active window
+// changes. If the schedule is disabled or never changes, the zero time is
+// returned.
+func (bs BandwidthScheduleSettings) NextChange(t time.Time) time.Time {
+	if !bs.Enabled || len(bs.Windows) == 0 {
+		return time.Time{}
+	}
+
+	// collect the boundaries of every window over the next week
+	loc := bs.location()
+	t = t.In(loc)
+	var boundaries []time.Time
+	for i := -1; i <= 7; i++ {
+		day := t.AddDate(0, 0, i)
+		for _, w := range bs.Windows {
+			start, end, ok := w.occurrence(day)
+			if !ok {
+				continue
+			}
+			for _, b := range []time.Time{start, end} {
+				if b.After(t) {
+					boundaries = append(boundaries, b)
+				}
+			}
+		}
+	}
+	sort.Slice(boundaries, func(i, j int) bool {
+		return boundaries[i].Before(boundaries[j])
+	})
+
+	current := bs.activeIndex(t)
+	for _, b := range boundaries {
+		if bs.activeIndex(b) != current {
+			return b
+		}
+	}
+	return time.Time{}
+}
+
+// bandwidthStatus returns the bandwidth limits that apply at t.
+func bandwidthStatus(s Settings, t time.Time) BandwidthStatus {
+	status := BandwidthStatus{
+		IngressLimit: s.IngressLimit,
+		EgressLimit:  s.EgressLimit,
+		NextChange:   s.BandwidthSchedule.NextChange(t),
+	}
+	if w, ok := s.BandwidthSchedule.ActiveWindow(t); ok {
+		status.Window = &w
+		status.IngressLimit, status.EgressLimit = w.IngressLimit, w.EgressLimit
+	}
+	return status
+}
+
+// applyBandwidthSchedule sets the rate limiters to the limits that currently
+// apply and schedules the next change. m.mu must be held.
+func (m *ConfigManager) applyBandwidthSchedule() {
+	if m.bandwidthTimer != nil {
+		m.bandwidthTimer.Stop()
+	}
+
+	now := time.Now()
+	status := bandwidthStatus(m.settings, now)
+	m.setRateLimit(status.IngressLimit, status.EgressLimit)
+
+	if i := m.settings.BandwidthSchedule.activeIndex(now); i != m.bandwidthWindow {
+		var name string
+		if status.Window != nil {
+			name = status.Window.Name
+		}
+		m.log.Info("bandwidth window changed", zap.String("window", name), zap.Uint64("ingressLimit", status.IngressLimit), zap.Uint64("egressLimit", status.EgressLimit), zap.Time("nextChange", status.NextChange))
+		m.bandwidthWindow = i
+	}
+
+	if status.NextChange.IsZero() {
+		return
+	}
+	wait := time.Until(status.NextChange)
+	if wait > maxBandwidthTimerInterval {
+		wait = maxBandwidthTimerInterval
+	}
+	m.bandwidthTimer = time.AfterFunc(wait, func() {
+		done, err := m.tg.Add()
+		if err != nil {
+			return
+		}
+		defer done()
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.applyBandwidthSchedule()
+	})
+}
+
+// BandwidthStatus returns the host's current bandwidth limits and the time
+// they will next change.
+func (m *ConfigManager) BandwidthStatus() BandwidthStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return bandwidthStatus(m.settings, time.Now())
+}
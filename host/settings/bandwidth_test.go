@@ -0,0 +1,191 @@
+package settings_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/hostd/alerts"
+	"go.sia.tech/hostd/host/settings"
+	"go.sia.tech/hostd/internal/test"
+	"go.sia.tech/hostd/persist/sqlite"
+	"go.sia.tech/hostd/webhooks"
+	"go.uber.org/zap/zaptest"
+	"golang.org/x/time/rate"
+	"lukechampine.com/frand"
+)
+
+func TestBandwidthScheduleWindows(t *testing.T) {
+	bs := settings.BandwidthScheduleSettings{
+		Enabled:  true,
+		Timezone: "UTC",
+		Windows: []settings.BandwidthWindow{
+			{
+				Name:        "business",
+				Days:        []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+				Start:       "09:00",
+				End:         "17:00",
+				EgressLimit: 1 << 20,
+			},
+			{
+				Name:  "night",
+				Start: "22:00",
+				End:   "06:00",
+			},
+		},
+	}
+
+	// 2024-01-01 is a Monday
+	date := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 1, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		t          time.Time
+		window     string
+		nextChange time.Time
+	}{
+		{date(1, 10, 0), "business", date(1, 17, 0)},
+		{date(1, 9, 0), "business", date(1, 17, 0)},
+		{date(1, 17, 30), "", date(1, 22, 0)},
+		{date(1, 23, 0), "night", date(2, 6, 0)},
+		{date(2, 3, 0), "night", date(2, 6, 0)},
+		{date(2, 6, 0), "", date(2, 9, 0)},
+		// no business hours on the weekend
+		{date(6, 10, 0), "", date(6, 22, 0)},
+		{date(7, 23, 0), "night", date(8, 6, 0)},
+		// times in other time zones are converted
+		{date(1, 10, 0).In(time.FixedZone("UTC-5", -5*60*60)), "business", date(1, 17, 0)},
+	}
+	for _, test := range tests {
+		w, ok := bs.ActiveWindow(test.t)
+		if test.window == "" && ok {
+			t.Fatalf("expected no window at %v, got %q", test.t, w.Name)
+		} else if test.window != "" && (!ok || w.Name != test.window) {
+			t.Fatalf("expected window %q at %v, got %q", test.window, test.t, w.Name)
+		} else if next := bs.NextChange(test.t); !next.Equal(test.nextChange) {
+			t.Fatalf("expected next change at %v after %v, got %v", test.nextChange, test.t, next)
+		}
+	}
+
+	// a disabled schedule never changes
+	bs.Enabled = false
+	if _, ok := bs.ActiveWindow(date(1, 10, 0)); ok {
+		t.Fatal("expected no window when disabled")
+	} else if next := bs.NextChange(date(1, 10, 0)); !next.IsZero() {
+		t.Fatalf("expected no next change when disabled, got %v", next)
+	}
+}
+
+func TestBandwidthScheduleLocalTimezone(t *testing.T) {
+	// an empty timezone uses the host's local time zone
+	local := time.Local
+	time.Local = time.FixedZone("UTC+10", 10*60*60)
+	t.Cleanup(func() { time.Local = local })
+
+	bs := settings.BandwidthScheduleSettings{
+		Enabled: true,
+		Windows: []settings.BandwidthWindow{
+			{
+				Name:  "business",
+				Start: "09:00",
+				End:   "17:00",
+			},
+		},
+	}
+
+	// 00:00 UTC is 10:00 in the local time zone
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if w, ok := bs.ActiveWindow(now); !ok || w.Name != "business" {
+		t.Fatalf("expected business window at %v", now)
+	} else if next := bs.NextChange(now); !next.Equal(time.Date(2024, 1, 1, 7, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected next change at 07:00 UTC, got %v", next.UTC())
+	}
+}
+
+func TestBandwidthScheduleLimits(t *testing.T) {
+	hostKey := types.NewPrivateKeyFromSeed(frand.Bytes(32))
+	dir := t.TempDir()
+	log := zaptest.NewLogger(t)
+	node, err := test.NewWallet(hostKey, dir, log.Named("wallet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+
+	db, err := sqlite.OpenDatabase(filepath.Join(dir, "hostd.db"), log.Named("sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	webhookReporter, err := webhooks.NewManager(db, log.Named("webhooks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	am := alerts.NewManager(webhookReporter, log.Named("alerts"))
+	manager, err := settings.NewConfigManager(dir, hostKey, "localhost:9882", db, node.ChainManager(), node.TPool(), node, nil, am, nil, log.Named("settings"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+
+	// invalid windows should be rejected
+	updated := manager.Settings()
+	updated.BandwidthSchedule = settings.BandwidthScheduleSettings{
+		Enabled: true,
+		Windows: []settings.BandwidthWindow{{Start: "25:00", End: "06:00"}},
+	}
+	if err := manager.UpdateSettings(updated); err == nil {
+		t.Fatal("expected invalid start time to be rejected")
+	}
+
+	// cover the whole day so a window is always active
+	const ingress, egress = 1 << 20, 2 << 20
+	updated.IngressLimit, updated.EgressLimit = 4<<20, 4<<20
+	updated.BandwidthSchedule = settings.BandwidthScheduleSettings{
+		Enabled:  true,
+		Timezone: "UTC",
+		Windows: []settings.BandwidthWindow{
+			{Name: "morning", Start: "00:00", End: "12:00", IngressLimit: ingress, EgressLimit: egress},
+			{Name: "evening", Start: "12:00", End: "00:00", IngressLimit: ingress, EgressLimit: egress},
+		},
+	}
+	if err := manager.UpdateSettings(updated); err != nil {
+		t.Fatal(err)
+	}
+
+	status := manager.BandwidthStatus()
+	if status.Window == nil {
+		t.Fatal("expected an active window")
+	} else if status.IngressLimit != ingress || status.EgressLimit != egress {
+		t.Fatalf("expected limits %v/%v, got %v/%v", ingress, egress, status.IngressLimit, status.EgressLimit)
+	} else if status.NextChange.IsZero() || status.NextChange.Sub(time.Now()) > 12*time.Hour {
+		t.Fatalf("unexpected next change %v", status.NextChange)
+	}
+
+	ingressLimiter, egressLimiter := manager.BandwidthLimiters()
+	if ingressLimiter.Limit() != rate.Limit(ingress) || egressLimiter.Limit() != rate.Limit(egress) {
+		t.Fatalf("expected limiters %v/%v, got %v/%v", ingress, egress, ingressLimiter.Limit(), egressLimiter.Limit())
+	}
+
+	// the schedule should be persisted
+	if stored, err := db.Settings(); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(stored.BandwidthSchedule, updated.BandwidthSchedule) {
+		t.Fatalf("expected stored schedule %v, got %v", updated.BandwidthSchedule, stored.BandwidthSchedule)
+	}
+
+	// disabling the schedule restores the default limits
+	updated.BandwidthSchedule.Enabled = false
+	if err := manager.UpdateSettings(updated); err != nil {
+		t.Fatal(err)
+	} else if status := manager.BandwidthStatus(); status.Window != nil || status.IngressLimit != 4<<20 {
+		t.Fatalf("expected default limits, got %+v", status)
+	} else if ingressLimiter.Limit() != rate.Limit(4<<20) {
+		t.Fatalf("expected default ingress limiter, got %v", ingressLimiter.Limit())
+	}
+}
@@ -2,6 +2,13 @@
 
 package settings
 
+import "time"
+
 const (
 	autoAnnounceInterval = (144 * 180) // reannounce every 180 days
+
+	pricingUpdateInterval = 10 * time.Minute
+	exchangeRateMaxAge    = time.Hour // rates older than this are considered stale
+
+	utilizationUpdateInterval = 10 * time.Minute
 )
@@ -2,6 +2,13 @@
 
 package settings
 
+import "time"
+
 const (
 	autoAnnounceInterval = 100 // reannounce every 100 blocks
+
+	pricingUpdateInterval = 100 * time.Millisecond
+	exchangeRateMaxAge    = time.Minute
+
+	utilizationUpdateInterval = 100 * time.Millisecond
 )
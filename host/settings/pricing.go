@@ -0,0 +1,294 @@
+package settings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/hostd/alerts"
+	"go.uber.org/zap"
+)
+
+const bytesPerTB = 1 << 40
+
+type (
+	// An ExchangeRateProvider provides the exchange rate of Siacoin
+	ExchangeRateProvider interface {
+		// SiacoinExchangeRate returns the value of one Siacoin in the
+		// specified currency and the time the rate was last updated.
+		SiacoinExchangeRate(ctx context.Context, currency string) (rate float64, timestamp time.Time, err error)
+	}
+
+	// A PriceTarget is a fiat-denominated price target with bounds on the
+	// resulting Siacoin price. The bounds are in the same unit as the
+	// corresponding host setting. A zero Target disables automatic pricing
+	// for the setting and a zero Max disables the upper bound.
+	PriceTarget struct {
+		Target float64        `json:"target"`
+		Min    types.Currency `json:"min"`
+		Max    types.Currency `json:"max"`
+	}
+
+	// AutoPricingSettings contains the settings for automatically adjusting
+	// the host's prices to track a fiat target.
+	AutoPricingSettings struct {
+		Enabled bool `json:"enabled"`
+		// Currency is the fiat currency the targets are denominated in,
+		// e.g. "usd".
+		Currency string `json:"currency"`
+		// MaxChange is the maximum relative change of a price in a single
+		// adjustment, e.g. 0.1 for 10%. Zero disables the limit.
+		MaxChange float64 `json:"maxChange"`
+
+		// ContractPrice is the target price per contract formation.
+		ContractPrice PriceTarget `json:"contractPrice"`
+		// StoragePrice is the target price per TB per month.
+		StoragePrice PriceTarget `json:"storagePrice"`
+		// EgressPrice is the target price per TB of egress.
+		EgressPrice PriceTarget `json:"egressPrice"`
+		// IngressPrice is the target price per TB of ingress.
+		IngressPrice PriceTarget `json:"ingressPrice"`
+	}
+
+	// A FileRateProvider reads exchange rates from a JSON file. The file is
+	// read on every request so that it can be updated externally.
+	FileRateProvider struct {
+		path string
+	}
+
+	// fileRates is the format of the exchange rate file.
+	fileRates struct {
+		Rates     map[string]float64 `json:"rates"`
+		Timestamp time.Time          `json:"timestamp"`
+	}
+)
+
+var (
+	// ErrNoExchangeRateProvider is returned when automatic pricing is
+	// enabled without an exchange rate provider.
+	ErrNoExchangeRateProvider = errors.New("no exchange rate provider configured")
+
+	alertPricingID = types.HashBytes([]byte("autoPricing"))
+
+	hastingsPerSiacoin = new(big.Float).SetInt(types.Siacoins(1).Big())
+)
+
+// SiacoinExchangeRate implements ExchangeRateProvider. If the file does not
+// contain a timestamp, the file's modification time is used instead.
+func (fp *FileRateProvider) SiacoinExchangeRate(_ context.Context, currency string) (float64, time.Time, error) {
+	f, err := os.Open(fp.path)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to open exchange rate file: %w", err)
+	}
+	defer f.Close()
+
+	var fr fileRates
+	if err := json.NewDecoder(f).Decode(&fr); err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to decode exchange rate file: %w", err)
+	}
+
+	rate, ok := fr.Rates[strings.ToLower(currency)]
+	if !ok {
+		return 0, time.Time{}, fmt.Errorf("no exchange rate for %q", currency)
+	} else if rate <= 0 || math.IsNaN(rate) || math.IsInf(rate, 0) {
+		return 0, time.Time{}, fmt.Errorf("invalid exchange rate for %q: %v", currency, rate)
+	}
+
+	timestamp := fr.Timestamp
+	if timestamp.IsZero() {
+		fi, err := f.Stat()
+		if err != nil {
+			return 0, time.Time{}, fmt.Errorf("failed to stat exchange rate file: %w", err)
+		}
+		timestamp = fi.ModTime()
+	}
+	return rate, timestamp, nil
+}
+
+// NewFileRateProvider returns a new exchange rate provider that reads
+// rates from the JSON file at path.
+func NewFileRateProvider(path string) *FileRateProvider {
+	return &FileRateProvider{path: path}
+}
+
+func validateAutoPricing(ap AutoPricingSettings) error {
+	if !ap.Enabled {
+		return nil
+	} else if strings.TrimSpace(ap.Currency) == "" {
+		return errors.New("currency must be set")
+	} else if ap.MaxChange < 0 || math.IsNaN(ap.MaxChange) {
+		return errors.New("max change must be non-negative")
+	}
+
+	targets := map[string]PriceTarget{
+		"contract": ap.ContractPrice,
+		"storage":  ap.StoragePrice,
+		"egress":   ap.EgressPrice,
+		"ingress":  ap.IngressPrice,
+	}
+	for name, pt := range targets {
+		if pt.Target < 0 || math.IsNaN(pt.Target) || math.IsInf(pt.Target, 0) {
+			return fmt.Errorf("%s price target must be a non-negative number", name)
+		} else if !pt.Max.IsZero() && pt.Min.Cmp(pt.Max) > 0 {
+			return fmt.Errorf("%s price min must be less than or equal to max", name)
+		}
+	}
+	return nil
+}
+
+// floatToCurrency converts a non-negative number of hastings to a Currency.
+// Values that overflow are capped at the maximum currency value.
+func floatToCurrency(f *big.Float) types.Currency {
+	if f.Sign() <= 0 {
+		return types.ZeroCurrency
+	}
+	i, _ := f.Int(nil)
+	if i.BitLen() > 128 {
+		return types.MaxCurrency
+	}
+	lo := new(big.Int).And(i, new(big.Int).SetUint64(math.MaxUint64)).Uint64()
+	hi := new(big.Int).Rsh(i, 64).Uint64()
+	return types.NewCurrency(lo, hi)
+}
+
+// adjustPrice calculates the new Siacoin price for a fiat target. unitDivisor
+// converts the target's unit to the unit of the host setting. The result is
+// limited to maxChange relative to the current price and then clamped to the
+// target's bounds.
+func adjustPrice(current types.Currency, pt PriceTarget, rate, unitDivisor, maxChange float64) types.Currency {
+	if pt.Target == 0 {
+		return current
+	}
+
+	// target / rate = siacoins per unit
+	hastings := new(big.Float).Mul(big.NewFloat(pt.Target/rate/unitDivisor), hastingsPerSiacoin)
+	price := floatToCurrency(hastings)
+
+	if maxChange > 0 && !current.IsZero() {
+		cf := new(big.Float).SetInt(current.Big())
+		lower := floatToCurrency(new(big.Float).Mul(cf, big.NewFloat(1-math.Min(maxChange, 1))))
+		upper := floatToCurrency(new(big.Float).Mul(cf, big.NewFloat(1+maxChange)))
+		if price.Cmp(lower) < 0 {
+			price = lower
+		} else if price.Cmp(upper) > 0 {
+			price = upper
+		}
+	}
+
+	if price.Cmp(pt.Min) < 0 {
+		price = pt.Min
+	} else if !pt.Max.IsZero() && price.Cmp(pt.Max) > 0 {
+		price = pt.Max
+	}
+	return price
+}
+
+// applyPricing sets the host's Siacoin prices using the exchange rate. If
+// utilization pricing is enabled, the base storage price is adjusted instead
+// and the pricing curve is reapplied.
+func applyPricing(s Settings, rate, utilization float64) Settings {
+	ap := s.AutoPricing
+	s.ContractPrice = adjustPrice(s.ContractPrice, ap.ContractPrice, rate, 1, ap.MaxChange)
+	if up := &s.UtilizationPricing; up.Enabled {
+		up.BaseStoragePrice = adjustPrice(up.BaseStoragePrice, ap.StoragePrice, rate, bytesPerTB*blocksPerMonth, ap.MaxChange)
+		s = applyUtilization(s, utilization)
+	} else {
+		s.StoragePrice = adjustPrice(s.StoragePrice, ap.StoragePrice, rate, bytesPerTB*blocksPerMonth, ap.MaxChange)
+	}
+	s.EgressPrice = adjustPrice(s.EgressPrice, ap.EgressPrice, rate, bytesPerTB, ap.MaxChange)
+	s.IngressPrice = adjustPrice(s.IngressPrice, ap.IngressPrice, rate, bytesPerTB, ap.MaxChange)
+	return s
+}
+
+// updatePrices fetches the current exchange rate and updates the host's
+// prices. The net address is not modified, so no announcement is triggered.
+func (m *ConfigManager) updatePrices(ctx context.Context) error {
+	m.mu.Lock()
+	ap := m.settings.AutoPricing
+	m.mu.Unlock()
+
+	if !ap.Enabled {
+		return nil
+	} else if m.rates == nil {
+		return ErrNoExchangeRateProvider
+	}
+
+	rate, timestamp, err := m.rates.SiacoinExchangeRate(ctx, ap.Currency)
+	if err != nil {
+		m.a.Register(alerts.Alert{
+			ID:       alertPricingID,
+			Severity: alerts.SeverityWarning,
+			Message:  "Failed to get exchange rate",
+			Data: map[string]any{
+				"currency": ap.Currency,
+				"error":    err.Error(),
+			},
+			Timestamp: time.Now(),
+		})
+		return fmt.Errorf("failed to get exchange rate: %w", err)
+	} else if age := time.Since(timestamp); age > exchangeRateMaxAge {
+		m.a.Register(alerts.Alert{
+			ID:       alertPricingID,
+			Severity: alerts.SeverityWarning,
+			Message:  "Exchange rate is stale, prices were not updated",
+			Data: map[string]any{
+				"currency":  ap.Currency,
+				"rate":      rate,
+				"timestamp": timestamp,
+			},
+			Timestamp: time.Now(),
+		})
+		return fmt.Errorf("exchange rate is stale: last updated %v ago", age.Round(time.Second))
+	}
+	m.a.Dismiss(alertPricingID)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// settings may have changed while fetching the rate
+	if !m.settings.AutoPricing.Enabled || m.settings.AutoPricing.Currency != ap.Currency {
+		return nil
+	}
+	updated := applyPricing(m.settings, rate, m.utilization)
+	if updated.ContractPrice.Equals(m.settings.ContractPrice) &&
+		updated.StoragePrice.Equals(m.settings.StoragePrice) &&
+		updated.EgressPrice.Equals(m.settings.EgressPrice) &&
+		updated.IngressPrice.Equals(m.settings.IngressPrice) {
+		return nil
+	} else if err := m.store.UpdateSettings(updated); err != nil {
+		return fmt.Errorf("failed to update settings: %w", err)
+	}
+	m.settings = updated
+	m.log.Info("updated prices", zap.String("currency", ap.Currency), zap.Float64("rate", rate), zap.Stringer("contractPrice", updated.ContractPrice), zap.Stringer("storagePrice", updated.StoragePrice), zap.Stringer("egressPrice", updated.EgressPrice), zap.Stringer("ingressPrice", updated.IngressPrice))
+	return nil
+}
+
+// runPricing periodically updates the host's prices until the config manager
+// is closed.
+func (m *ConfigManager) runPricing() {
+	ctx, cancel, err := m.tg.AddContext(context.Background())
+	if err != nil {
+		return
+	}
+	defer cancel()
+
+	t := time.NewTicker(pricingUpdateInterval)
+	defer t.Stop()
+	for {
+		if err := m.updatePrices(ctx); err != nil && !errors.Is(err, ErrNoExchangeRateProvider) {
+			m.log.Warn("failed to update prices", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
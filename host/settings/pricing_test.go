@@ -0,0 +1,164 @@
+package settings_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/hostd/alerts"
+	"go.sia.tech/hostd/host/settings"
+	"go.sia.tech/hostd/internal/test"
+	"go.sia.tech/hostd/persist/sqlite"
+	"go.sia.tech/hostd/webhooks"
+	"go.uber.org/zap/zaptest"
+	"lukechampine.com/frand"
+)
+
+func writeRates(t *testing.T, path string, rate float64, timestamp time.Time) {
+	t.Helper()
+	buf, err := json.Marshal(map[string]any{
+		"rates":     map[string]float64{"usd": rate},
+		"timestamp": timestamp,
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if err := os.WriteFile(path, buf, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// approxEqual returns true if a and b are within 0.01% of each other
+func approxEqual(a, b types.Currency) bool {
+	if a.Cmp(b) < 0 {
+		a, b = b, a
+	}
+	return a.Sub(b).Mul64(10000).Cmp(b) <= 0
+}
+
+func TestAutoPricing(t *testing.T) {
+	hostKey := types.NewPrivateKeyFromSeed(frand.Bytes(32))
+	dir := t.TempDir()
+	log := zaptest.NewLogger(t)
+	node, err := test.NewWallet(hostKey, dir, log.Named("wallet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+
+	db, err := sqlite.OpenDatabase(filepath.Join(dir, "hostd.db"), log.Named("sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	webhookReporter, err := webhooks.NewManager(db, log.Named("webhooks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ratesPath := filepath.Join(dir, "rates.json")
+	writeRates(t, ratesPath, 0.004, time.Now())
+
+	am := alerts.NewManager(webhookReporter, log.Named("alerts"))
+	manager, err := settings.NewConfigManager(dir, hostKey, "localhost:9882", db, node.ChainManager(), node.TPool(), node, nil, am, settings.NewFileRateProvider(ratesPath), log.Named("settings"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+
+	// $1/TB/month at $0.004/SC = 250 SC/TB/month
+	expectedStorage := types.Siacoins(250).Div64(1 << 40).Div64(144 * 30)
+	// $2/TB at $0.004/SC = 500 SC/TB
+	expectedEgress := types.Siacoins(500).Div64(1 << 40)
+
+	s := manager.Settings()
+	s.NetAddress = "foo.bar:9982"
+	s.AutoPricing = settings.AutoPricingSettings{
+		Enabled:      true,
+		Currency:     "usd",
+		StoragePrice: settings.PriceTarget{Target: 1},
+		EgressPrice:  settings.PriceTarget{Target: 2},
+	}
+	if err := manager.UpdateSettings(s); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	updated := manager.Settings()
+	switch {
+	case !approxEqual(updated.StoragePrice, expectedStorage):
+		t.Fatalf("expected storage price %v, got %v", expectedStorage, updated.StoragePrice)
+	case !approxEqual(updated.EgressPrice, expectedEgress):
+		t.Fatalf("expected egress price %v, got %v", expectedEgress, updated.EgressPrice)
+	case !updated.IngressPrice.Equals(s.IngressPrice):
+		t.Fatal("ingress price should not have changed")
+	case updated.NetAddress != s.NetAddress:
+		t.Fatal("net address should not have changed")
+	}
+
+	// check that the prices were persisted
+	stored, err := db.Settings()
+	if err != nil {
+		t.Fatal(err)
+	} else if !stored.StoragePrice.Equals(updated.StoragePrice) {
+		t.Fatalf("expected stored storage price %v, got %v", updated.StoragePrice, stored.StoragePrice)
+	} else if stored.AutoPricing != updated.AutoPricing {
+		t.Fatal("auto pricing settings not persisted")
+	}
+
+	// halve the exchange rate and limit the change to 10% per adjustment
+	s = manager.Settings()
+	s.AutoPricing.MaxChange = 0.1
+	s.AutoPricing.EgressPrice.Max = expectedEgress.Mul64(105).Div64(100)
+	if err := manager.UpdateSettings(s); err != nil {
+		t.Fatal(err)
+	}
+	writeRates(t, ratesPath, 0.002, time.Now())
+	time.Sleep(150 * time.Millisecond)
+
+	// the price should move towards the new target over several adjustments
+	var prices []types.Currency
+	for i := 0; i < 3; i++ {
+		prices = append(prices, manager.Settings().StoragePrice)
+		time.Sleep(100 * time.Millisecond)
+	}
+	for i, price := range prices {
+		if price.Cmp(expectedStorage) <= 0 {
+			t.Fatalf("storage price %v should have increased", price)
+		} else if price.Cmp(expectedStorage.Mul64(2)) > 0 {
+			t.Fatalf("storage price %v exceeded the target", price)
+		} else if i > 0 && price.Cmp(prices[i-1].Mul64(111).Div64(100)) > 0 {
+			t.Fatalf("storage price %v increased more than 10%% from %v", price, prices[i-1])
+		}
+	}
+
+	if egress := manager.Settings().EgressPrice; !egress.Equals(s.AutoPricing.EgressPrice.Max) {
+		t.Fatalf("expected egress price to be capped at %v, got %v", s.AutoPricing.EgressPrice.Max, egress)
+	}
+
+	// a stale exchange rate should register an alert and leave the prices
+	// unchanged
+	writeRates(t, ratesPath, 0.001, time.Now().Add(-2*time.Hour))
+	time.Sleep(200 * time.Millisecond)
+	updated = manager.Settings()
+	time.Sleep(300 * time.Millisecond)
+
+	if stale := manager.Settings(); !stale.StoragePrice.Equals(updated.StoragePrice) {
+		t.Fatal("storage price should not have changed with a stale rate")
+	} else if len(am.Active()) == 0 {
+		t.Fatal("expected stale rate alert")
+	}
+
+	// enabling auto pricing without a provider should fail
+	noRates, err := settings.NewConfigManager(t.TempDir(), hostKey, "localhost:9882", db, node.ChainManager(), node.TPool(), node, nil, am, nil, log.Named("settings"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer noRates.Close()
+	if err := noRates.UpdateSettings(s); err == nil {
+		t.Fatal("expected error enabling auto pricing without a provider")
+	}
+}
@@ -2,6 +2,7 @@ package settings
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -79,11 +80,33 @@ type (
 		// Bandwidth limiter settings
 		IngressLimit uint64 `json:"ingressLimit"`
 		EgressLimit  uint64 `json:"egressLimit"`
+		// BandwidthSchedule overrides the bandwidth limits during recurring
+		// windows
+		BandwidthSchedule BandwidthScheduleSettings `json:"bandwidthSchedule"`
 
 		// DNS settings
 		DDNS DNSSettings `json:"ddns"`
 
+		// AutoPricing adjusts the host's prices to track a fiat target
+		AutoPricing AutoPricingSettings `json:"autoPricing"`
+		// UtilizationPricing scales the host's storage price with its
+		// storage utilization
+		UtilizationPricing UtilizationPricingSettings `json:"utilizationPricing"`
+
 		SectorCacheSize uint32 `json:"sectorCacheSize"`
+		// ScrubRate is the number of sectors per minute the volume scrubber
+		// will verify. 0 disables scrubbing.
+		ScrubRate uint64 `json:"scrubRate"`
+		// ReplicationFactor is the number of copies of each sector stored
+		// in distinct volumes. 1 disables mirroring.
+		ReplicationFactor uint64 `json:"replicationFactor"`
+		// PlacementPolicy is the strategy used to choose the volume new
+		// sectors are written to. An empty policy uses the storage
+		// manager's default.
+		PlacementPolicy string `json:"placementPolicy"`
+		// EncryptVolumes encrypts the sector data of new volumes at rest.
+		// Existing volumes must be encrypted separately.
+		EncryptVolumes bool `json:"encryptVolumes"`
 
 		Revision uint64 `json:"revision"`
 	}
@@ -97,6 +120,7 @@ type (
 	// Alerts registers global alerts.
 	Alerts interface {
 		Register(alerts.Alert)
+		Dismiss(...types.Hash256)
 	}
 
 	// A ChainManager manages the current consensus state
@@ -107,7 +131,7 @@ type (
 
 	// A Wallet manages funds and signs transactions
 	Wallet interface {
-		FundTransaction(txn *types.Transaction, amount types.Currency) ([]types.Hash256, func(), error)
+		FundTransaction(txn *types.Transaction, amount types.Currency, outputs ...types.SiacoinOutputID) ([]types.Hash256, func(), error)
 		SignTransaction(cs consensus.State, txn *types.Transaction, toSign []types.Hash256, cf types.CoveredFields) error
 	}
 
@@ -121,17 +145,22 @@ type (
 		a     Alerts
 		log   *zap.Logger
 
-		cm     ChainManager
-		tp     TransactionPool
-		wallet Wallet
+		cm      ChainManager
+		tp      TransactionPool
+		wallet  Wallet
+		storage Storage
+		rates   ExchangeRateProvider
 
 		mu                  sync.Mutex // guards the following fields
 		settings            Settings   // in-memory cache of the host's settings
 		scanHeight          uint64     // track the last block height that was scanned for announcements
 		lastAnnounceAttempt uint64     // debounce announcement transactions
+		utilization         float64    // the host's last known storage utilization
 
-		ingressLimit *rate.Limiter
-		egressLimit  *rate.Limiter
+		ingressLimit    *rate.Limiter
+		egressLimit     *rate.Limiter
+		bandwidthTimer  *time.Timer
+		bandwidthWindow int // index of the active bandwidth window, -1 if none
 
 		ddnsUpdateTimer *time.Timer
 		lastIPv4        net.IP
@@ -168,6 +197,9 @@ var (
 		WindowSize:        144,                 // 144 blocks
 
 		MaxRegistryEntries: 100000,
+
+		ScrubRate:         60, // 4 MiB/s
+		ReplicationFactor: 1,
 	}
 	// ErrNoSettings must be returned by the store if the host has no settings yet
 	ErrNoSettings = errors.New("no settings found")
@@ -220,6 +252,34 @@ func (m *ConfigManager) UpdateSettings(s Settings) error {
 		return fmt.Errorf("failed to validate DNS settings: %w", err)
 	}
 
+	// validate automatic pricing settings
+	if err := validateAutoPricing(s.AutoPricing); err != nil {
+		return fmt.Errorf("failed to validate auto pricing settings: %w", err)
+	} else if s.AutoPricing.Enabled && m.rates == nil {
+		return ErrNoExchangeRateProvider
+	}
+
+	// validate utilization pricing settings
+	if err := validateUtilizationPricing(s.UtilizationPricing); err != nil {
+		return fmt.Errorf("failed to validate utilization pricing settings: %w", err)
+	} else if s.UtilizationPricing.Enabled {
+		if err := m.refreshUtilization(); err != nil {
+			return fmt.Errorf("failed to get storage utilization: %w", err)
+		}
+	}
+
+	if err := validateBandwidthSchedule(s.BandwidthSchedule); err != nil {
+		return fmt.Errorf("failed to validate bandwidth schedule: %w", err)
+	}
+
+	if s.PlacementPolicy != "" {
+		if m.storage == nil {
+			return ErrNoStorage
+		} else if err := m.storage.ValidatePlacementPolicy(s.PlacementPolicy); err != nil {
+			return fmt.Errorf("failed to validate placement policy: %w", err)
+		}
+	}
+
 	// if a netaddress is set, validate it
 	if strings.TrimSpace(s.NetAddress) != "" {
 		if err := validateNetAddress(s.NetAddress); err != nil {
@@ -228,11 +288,32 @@ func (m *ConfigManager) UpdateSettings(s Settings) error {
 	}
 
 	m.mu.Lock()
+	s = m.prepareUtilizationPricing(s)
+	// persist the settings while holding the lock so that a concurrent price
+	// update cannot be overwritten by stale prices
+	if err := m.store.UpdateSettings(s); err != nil {
+		m.mu.Unlock()
+		return err
+	}
 	m.settings = s
-	m.setRateLimit(s.IngressLimit, s.EgressLimit)
+	m.applyBandwidthSchedule()
 	m.resetDDNS()
 	m.mu.Unlock()
-	return m.store.UpdateSettings(s)
+
+	// apply the new price targets immediately
+	if s.AutoPricing.Enabled {
+		go func() {
+			ctx, cancel, err := m.tg.AddContext(context.Background())
+			if err != nil {
+				return
+			}
+			defer cancel()
+			if err := m.updatePrices(ctx); err != nil {
+				m.log.Warn("failed to update prices", zap.Error(err))
+			}
+		}()
+	}
+	return nil
 }
 
 // Settings returns the host's current settings.
@@ -274,24 +355,29 @@ func createAnnouncement(priv types.PrivateKey, netaddress string) []byte {
 	return buf.Bytes()
 }
 
-// NewConfigManager initializes a new config manager
-func NewConfigManager(dir string, hostKey types.PrivateKey, rhp2Addr string, store Store, cm ChainManager, tp TransactionPool, w Wallet, a Alerts, log *zap.Logger) (*ConfigManager, error) {
+// NewConfigManager initializes a new config manager. If sm is nil,
+// utilization pricing cannot be enabled and the placement policy cannot be
+// changed. If rates is nil, automatic pricing cannot be enabled.
+func NewConfigManager(dir string, hostKey types.PrivateKey, rhp2Addr string, store Store, cm ChainManager, tp TransactionPool, w Wallet, sm Storage, a Alerts, rates ExchangeRateProvider, log *zap.Logger) (*ConfigManager, error) {
 	m := &ConfigManager{
 		dir:               dir,
 		hostKey:           hostKey,
 		discoveredRHPAddr: rhp2Addr,
 
-		store:  store,
-		a:      a,
-		log:    log,
-		cm:     cm,
-		tp:     tp,
-		wallet: w,
-		tg:     threadgroup.New(),
+		store:   store,
+		a:       a,
+		log:     log,
+		cm:      cm,
+		tp:      tp,
+		wallet:  w,
+		storage: sm,
+		rates:   rates,
+		tg:      threadgroup.New(),
 
 		// initialize the rate limiters
-		ingressLimit: rate.NewLimiter(rate.Inf, defaultBurstSize),
-		egressLimit:  rate.NewLimiter(rate.Inf, defaultBurstSize),
+		ingressLimit:    rate.NewLimiter(rate.Inf, defaultBurstSize),
+		egressLimit:     rate.NewLimiter(rate.Inf, defaultBurstSize),
+		bandwidthWindow: -1,
 
 		// rhp3 WebSocket TLS
 		rhp3WSTLS: &tls.Config{},
@@ -335,8 +421,11 @@ func NewConfigManager(dir string, hostKey types.PrivateKey, rhp2Addr string, sto
 
 	m.settings = settings
 	// update the global rate limiters from settings
-	m.setRateLimit(settings.IngressLimit, settings.EgressLimit)
+	m.applyBandwidthSchedule()
 	// initialize the DDNS update timer
 	m.resetDDNS()
+	// start the automatic pricing loops
+	go m.runPricing()
+	go m.runUtilizationPricing()
 	return m, nil
 }
@@ -0,0 +1,200 @@
+package settings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.uber.org/zap"
+)
+
+type (
+	// Storage reports the host's storage utilization and validates its
+	// storage settings
+	Storage interface {
+		Usage() (usedSectors uint64, totalSectors uint64, err error)
+		// ValidatePlacementPolicy returns an error if the sector placement
+		// policy is not supported.
+		ValidatePlacementPolicy(policy string) error
+	}
+
+	// UtilizationPricingSettings contains the settings for scaling the
+	// host's storage price with its storage utilization. Below
+	// StartUtilization the base price applies. Between StartUtilization and
+	// EndUtilization the price rises linearly to MaxMultiplier times the base
+	// price.
+	UtilizationPricingSettings struct {
+		Enabled          bool    `json:"enabled"`
+		StartUtilization float64 `json:"startUtilization"`
+		EndUtilization   float64 `json:"endUtilization"`
+		MaxMultiplier    float64 `json:"maxMultiplier"`
+		// ScaleCollateral determines whether collateral scales with the
+		// storage price. If false, the collateral multiplier is adjusted so
+		// that the collateral per byte stays at its base value.
+		ScaleCollateral bool `json:"scaleCollateral"`
+
+		// BaseStoragePrice and BaseCollateralMultiplier are the values that
+		// apply below StartUtilization. They are set from StoragePrice and
+		// CollateralMultiplier when the curve is enabled or those settings
+		// are changed.
+		BaseStoragePrice         types.Currency `json:"baseStoragePrice"`
+		BaseCollateralMultiplier float64        `json:"baseCollateralMultiplier"`
+
+		// Multiplier is the multiplier currently applied to the base price.
+		// It is set by the host.
+		Multiplier float64 `json:"multiplier"`
+	}
+)
+
+// ErrNoStorage is returned when utilization pricing is enabled without a
+// storage manager.
+var ErrNoStorage = errors.New("no storage manager configured")
+
+func validateUtilizationPricing(up UtilizationPricingSettings) error {
+	switch {
+	case !up.Enabled:
+		return nil
+	case up.StartUtilization < 0 || up.StartUtilization >= 1:
+		return errors.New("start utilization must be between 0 and 1")
+	case up.EndUtilization <= up.StartUtilization || up.EndUtilization > 1:
+		return errors.New("end utilization must be greater than start utilization and at most 1")
+	case up.MaxMultiplier < 1 || math.IsInf(up.MaxMultiplier, 0) || math.IsNaN(up.MaxMultiplier):
+		return errors.New("max multiplier must be at least 1")
+	}
+	return nil
+}
+
+// multiplier returns the price multiplier for the given utilization.
+func (up UtilizationPricingSettings) multiplier(utilization float64) float64 {
+	switch {
+	case utilization <= up.StartUtilization:
+		return 1
+	case utilization >= up.EndUtilization:
+		return up.MaxMultiplier
+	}
+	progress := (utilization - up.StartUtilization) / (up.EndUtilization - up.StartUtilization)
+	return 1 + progress*(up.MaxMultiplier-1)
+}
+
+// applyUtilization sets the host's storage price and collateral multiplier
+// from the base values and the current utilization.
+func applyUtilization(s Settings, utilization float64) Settings {
+	up := &s.UtilizationPricing
+	if !up.Enabled {
+		return s
+	}
+	up.Multiplier = up.multiplier(utilization)
+
+	base := new(big.Float).SetInt(up.BaseStoragePrice.Big())
+	s.StoragePrice = floatToCurrency(base.Mul(base, big.NewFloat(up.Multiplier)))
+	if up.ScaleCollateral {
+		s.CollateralMultiplier = up.BaseCollateralMultiplier
+	} else {
+		s.CollateralMultiplier = up.BaseCollateralMultiplier / up.Multiplier
+	}
+	return s
+}
+
+// prepareUtilizationPricing updates the base values of the pricing curve when
+// it is enabled, disabled, or the configured prices change. m.mu must be held.
+func (m *ConfigManager) prepareUtilizationPricing(s Settings) Settings {
+	prev := m.settings
+	up := &s.UtilizationPricing
+	switch {
+	case up.Enabled:
+		// when the curve is enabled or the price is changed, the configured
+		// price becomes the base price
+		if !prev.UtilizationPricing.Enabled || !s.StoragePrice.Equals(prev.StoragePrice) {
+			up.BaseStoragePrice = s.StoragePrice
+		}
+		if !prev.UtilizationPricing.Enabled || s.CollateralMultiplier != prev.CollateralMultiplier {
+			up.BaseCollateralMultiplier = s.CollateralMultiplier
+		}
+		return applyUtilization(s, m.utilization)
+	case prev.UtilizationPricing.Enabled:
+		// restore the base values when the curve is disabled, unless they
+		// were changed at the same time
+		if s.StoragePrice.Equals(prev.StoragePrice) {
+			s.StoragePrice = prev.UtilizationPricing.BaseStoragePrice
+		}
+		if s.CollateralMultiplier == prev.CollateralMultiplier {
+			s.CollateralMultiplier = prev.UtilizationPricing.BaseCollateralMultiplier
+		}
+	}
+	up.Multiplier = 0
+	return s
+}
+
+// refreshUtilization updates the host's storage utilization.
+func (m *ConfigManager) refreshUtilization() error {
+	if m.storage == nil {
+		return ErrNoStorage
+	}
+	used, total, err := m.storage.Usage()
+	if err != nil {
+		return fmt.Errorf("failed to get storage usage: %w", err)
+	}
+
+	var utilization float64
+	if total > 0 {
+		utilization = float64(used) / float64(total)
+	}
+	m.mu.Lock()
+	m.utilization = utilization
+	m.mu.Unlock()
+	return nil
+}
+
+// updateUtilizationPricing applies the pricing curve using the current
+// storage utilization. The settings are only persisted if the prices change.
+func (m *ConfigManager) updateUtilizationPricing() error {
+	m.mu.Lock()
+	enabled := m.settings.UtilizationPricing.Enabled
+	m.mu.Unlock()
+	if !enabled {
+		return nil
+	} else if err := m.refreshUtilization(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	updated := applyUtilization(m.settings, m.utilization)
+	if updated.UtilizationPricing.Multiplier == m.settings.UtilizationPricing.Multiplier &&
+		updated.StoragePrice.Equals(m.settings.StoragePrice) {
+		return nil
+	} else if err := m.store.UpdateSettings(updated); err != nil {
+		return fmt.Errorf("failed to update settings: %w", err)
+	}
+	m.settings = updated
+	m.log.Info("updated utilization pricing", zap.Float64("utilization", m.utilization), zap.Float64("multiplier", updated.UtilizationPricing.Multiplier), zap.Stringer("storagePrice", updated.StoragePrice), zap.Float64("collateralMultiplier", updated.CollateralMultiplier))
+	return nil
+}
+
+// runUtilizationPricing periodically applies the pricing curve until the
+// config manager is closed.
+func (m *ConfigManager) runUtilizationPricing() {
+	ctx, cancel, err := m.tg.AddContext(context.Background())
+	if err != nil {
+		return
+	}
+	defer cancel()
+
+	t := time.NewTicker(utilizationUpdateInterval)
+	defer t.Stop()
+	for {
+		if err := m.updateUtilizationPricing(); err != nil {
+			m.log.Warn("failed to update utilization pricing", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package settings_test
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/hostd/alerts"
+	"go.sia.tech/hostd/host/settings"
+	"go.sia.tech/hostd/internal/test"
+	"go.sia.tech/hostd/persist/sqlite"
+	"go.sia.tech/hostd/webhooks"
+	"go.uber.org/zap/zaptest"
+	"lukechampine.com/frand"
+)
+
+type stubStorage struct {
+	mu          sync.Mutex
+	used, total uint64
+}
+
+func (ss *stubStorage) Usage() (uint64, uint64, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return ss.used, ss.total, nil
+}
+
+func (ss *stubStorage) ValidatePlacementPolicy(string) error {
+	return nil
+}
+
+func (ss *stubStorage) setUsage(used, total uint64) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.used, ss.total = used, total
+}
+
+func TestUtilizationPricing(t *testing.T) {
+	hostKey := types.NewPrivateKeyFromSeed(frand.Bytes(32))
+	dir := t.TempDir()
+	log := zaptest.NewLogger(t)
+	node, err := test.NewWallet(hostKey, dir, log.Named("wallet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+
+	db, err := sqlite.OpenDatabase(filepath.Join(dir, "hostd.db"), log.Named("sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	webhookReporter, err := webhooks.NewManager(db, log.Named("webhooks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage := &stubStorage{used: 25, total: 100}
+	am := alerts.NewManager(webhookReporter, log.Named("alerts"))
+	manager, err := settings.NewConfigManager(dir, hostKey, "localhost:9882", db, node.ChainManager(), node.TPool(), node, storage, am, nil, log.Named("settings"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+
+	base := manager.Settings()
+	s := base
+	s.UtilizationPricing = settings.UtilizationPricingSettings{
+		Enabled:          true,
+		StartUtilization: 0.5,
+		EndUtilization:   0.95,
+		MaxMultiplier:    3,
+	}
+	if err := manager.UpdateSettings(s); err != nil {
+		t.Fatal(err)
+	}
+
+	// below the start of the curve the base price applies
+	updated := manager.Settings()
+	switch {
+	case !updated.StoragePrice.Equals(base.StoragePrice):
+		t.Fatalf("expected storage price %v, got %v", base.StoragePrice, updated.StoragePrice)
+	case !updated.UtilizationPricing.BaseStoragePrice.Equals(base.StoragePrice):
+		t.Fatalf("expected base storage price %v, got %v", base.StoragePrice, updated.UtilizationPricing.BaseStoragePrice)
+	case updated.UtilizationPricing.Multiplier != 1:
+		t.Fatalf("expected multiplier 1, got %v", updated.UtilizationPricing.Multiplier)
+	}
+
+	// at the end of the curve the price should be capped
+	storage.setUsage(95, 100)
+	time.Sleep(300 * time.Millisecond)
+
+	updated = manager.Settings()
+	switch {
+	case !approxEqual(updated.StoragePrice, base.StoragePrice.Mul64(3)):
+		t.Fatalf("expected storage price %v, got %v", base.StoragePrice.Mul64(3), updated.StoragePrice)
+	case updated.UtilizationPricing.Multiplier != 3:
+		t.Fatalf("expected multiplier 3, got %v", updated.UtilizationPricing.Multiplier)
+	case updated.CollateralMultiplier != base.CollateralMultiplier/3:
+		t.Fatalf("expected collateral multiplier %v, got %v", base.CollateralMultiplier/3, updated.CollateralMultiplier)
+	}
+
+	// halfway through the curve the multiplier should be 2
+	storage.setUsage(725, 1000)
+	time.Sleep(300 * time.Millisecond)
+	if m := manager.Settings().UtilizationPricing.Multiplier; m < 1.99 || m > 2.01 {
+		t.Fatalf("expected multiplier 2, got %v", m)
+	}
+
+	// the curve change should be recorded
+	m, err := db.Metrics(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	} else if m.Pricing.StoragePriceMultiplier < 1.99 || m.Pricing.StoragePriceMultiplier > 2.01 {
+		t.Fatalf("expected recorded multiplier 2, got %v", m.Pricing.StoragePriceMultiplier)
+	}
+
+	// disabling the curve should restore the base values
+	s = manager.Settings()
+	s.UtilizationPricing.Enabled = false
+	if err := manager.UpdateSettings(s); err != nil {
+		t.Fatal(err)
+	}
+	updated = manager.Settings()
+	if !updated.StoragePrice.Equals(base.StoragePrice) {
+		t.Fatalf("expected storage price %v, got %v", base.StoragePrice, updated.StoragePrice)
+	} else if updated.CollateralMultiplier != base.CollateralMultiplier {
+		t.Fatalf("expected collateral multiplier %v, got %v", base.CollateralMultiplier, updated.CollateralMultiplier)
+	}
+}
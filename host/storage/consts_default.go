@@ -8,4 +8,21 @@ const (
 	resizeBatchSize = 64 // 256 MiB
 
 	cleanupInterval = 15 * time.Minute
+
+	scrubBatchSize    = 64 // 256 MiB
+	scrubIdleInterval = time.Minute
+
+	rebalanceBatchSize = 64 // 256 MiB
+
+	// readAheadSectors is the number of prefetched sectors kept in memory
+	readAheadSectors = 16 // 64 MiB
+
+	encryptBatchSize = 64 // 256 MiB
+
+	cachePromoteReads  = 3 // reads before a sector is copied to the cache tier
+	cacheDecayInterval = time.Hour
+	cacheEvictInterval = 10 * time.Minute
+	cacheEvictAfter    = 24 * time.Hour
+	cacheEvictBatch    = 1000
+	maxTrackedAccesses = 100000
 )
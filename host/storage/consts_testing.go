@@ -2,8 +2,27 @@
 
 package storage
 
+import "time"
+
 const (
 	cleanupInterval = 0
 
 	resizeBatchSize = 4 // 16 MiB
+
+	scrubBatchSize    = 4 // 16 MiB
+	scrubIdleInterval = 100 * time.Millisecond
+
+	rebalanceBatchSize = 4 // 16 MiB
+
+	// readAheadSectors is the number of prefetched sectors kept in memory
+	readAheadSectors = 4 // 16 MiB
+
+	encryptBatchSize = 4 // 16 MiB
+
+	cachePromoteReads  = 2
+	cacheDecayInterval = time.Hour
+	cacheEvictInterval = 100 * time.Millisecond
+	cacheEvictAfter    = 3 * time.Second
+	cacheEvictBatch    = 10
+	maxTrackedAccesses = 100
 )
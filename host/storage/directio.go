@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"unsafe"
+
+	rhp2 "go.sia.tech/core/rhp/v2"
+)
+
+// directIOAlignment is the alignment of buffers, offsets, and lengths
+// required by direct I/O.
+const directIOAlignment = 4096
+
+type (
+	// A directFile is a volume file opened for direct I/O. Reads and writes
+	// bypass the page cache, so buffers, offsets, and lengths must be aligned.
+	// Unaligned buffers are copied through an aligned buffer.
+	directFile struct {
+		*os.File
+	}
+)
+
+// errUnalignedWrite is returned when a direct I/O write does not start and
+// end on an aligned offset.
+var errUnalignedWrite = errors.New("direct I/O writes must be aligned")
+
+// directBuffers pools aligned buffers used to copy unaligned reads and
+// writes.
+var directBuffers = sync.Pool{
+	New: func() any {
+		buf := alignedBuffer(rhp2.SectorSize)
+		return &buf
+	},
+}
+
+// alignedBuffer returns a buffer of length n aligned to directIOAlignment.
+func alignedBuffer(n int) []byte {
+	buf := make([]byte, n+directIOAlignment)
+	offset := int(uintptr(unsafe.Pointer(&buf[0])) & (directIOAlignment - 1))
+	if offset != 0 {
+		offset = directIOAlignment - offset
+	}
+	return buf[offset : offset+n]
+}
+
+func isAligned(p []byte, off int64) bool {
+	return len(p) != 0 &&
+		uintptr(unsafe.Pointer(&p[0]))&(directIOAlignment-1) == 0 &&
+		len(p)%directIOAlignment == 0 &&
+		off%directIOAlignment == 0
+}
+
+// ReadAt implements io.ReaderAt. Unaligned reads are served from aligned
+// reads of the surrounding blocks.
+func (df *directFile) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 || isAligned(p, off) {
+		return df.File.ReadAt(p, off)
+	}
+
+	bufp := directBuffers.Get().(*[]byte)
+	defer directBuffers.Put(bufp)
+	buf := *bufp
+
+	var n int
+	for n < len(p) {
+		pos := off + int64(n)
+		start := pos &^ (directIOAlignment - 1)
+		end := (off + int64(len(p)) + directIOAlignment - 1) &^ (directIOAlignment - 1)
+		if end-start > int64(len(buf)) {
+			end = start + int64(len(buf))
+		}
+
+		m, err := df.File.ReadAt(buf[:end-start], start)
+		if int64(m) > pos-start {
+			n += copy(p[n:], buf[pos-start:m])
+		}
+		if err != nil && n < len(p) {
+			return n, err
+		} else if int64(m) < end-start && n < len(p) {
+			return n, io.ErrUnexpectedEOF
+		}
+	}
+	return n, nil
+}
+
+// WriteAt implements io.WriterAt. The offset and length must be aligned.
+// Buffers that are not aligned in memory are copied to an aligned buffer.
+func (df *directFile) WriteAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 || isAligned(p, off) {
+		return df.File.WriteAt(p, off)
+	} else if off%directIOAlignment != 0 || len(p)%directIOAlignment != 0 {
+		return 0, errUnalignedWrite
+	}
+
+	bufp := directBuffers.Get().(*[]byte)
+	defer directBuffers.Put(bufp)
+	buf := *bufp
+
+	var n int
+	for n < len(p) {
+		m := copy(buf, p[n:])
+		if _, err := df.File.WriteAt(buf[:m], off+int64(n)); err != nil {
+			return n, err
+		}
+		n += m
+	}
+	return n, nil
+}
+
+// openVolumeFile opens a volume's local file for reading and writing. If
+// directIO is true, the file is opened for direct I/O.
+func openVolumeFile(localPath string, directIO bool) (volumeData, error) {
+	if !directIO {
+		return os.OpenFile(localPath, os.O_RDWR, 0700)
+	}
+	f, err := openDirect(localPath)
+	if err != nil {
+		return nil, err
+	}
+	return &directFile{f}, nil
+}
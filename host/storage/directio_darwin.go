@@ -0,0 +1,21 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// openDirect opens a file and disables caching with F_NOCACHE. macOS does not
+// support O_DIRECT.
+func openDirect(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0700)
+	if err != nil {
+		return nil, err
+	} else if _, err := unix.FcntlInt(f.Fd(), unix.F_NOCACHE, 1); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to disable caching: %w", err)
+	}
+	return f, nil
+}
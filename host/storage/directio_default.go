@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package storage
+
+import (
+	"errors"
+	"os"
+)
+
+// openDirect returns an error, direct I/O is not supported on this platform.
+func openDirect(string) (*os.File, error) {
+	return nil, errors.New("direct I/O is not supported on this platform")
+}
@@ -0,0 +1,11 @@
+package storage
+
+import (
+	"os"
+	"syscall"
+)
+
+// openDirect opens a file with O_DIRECT to bypass the page cache.
+func openDirect(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDWR|syscall.O_DIRECT, 0700)
+}
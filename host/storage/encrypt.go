@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"context"
+	"crypto/aes"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/hostd/alerts"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/xts"
+	"lukechampine.com/frand"
+)
+
+// volumeKeySpecifier distinguishes volume encryption keys from other keys
+// derived from the host key.
+const volumeKeySpecifier = "hostd/volume-encryption"
+
+// VolumeCipher returns the cipher used to encrypt a volume's sector data at
+// rest. The AES-256-XTS key is derived from the host key and the volume's
+// salt. Each sector is tweaked by its index in the volume so sectors can be
+// read and written independently.
+func VolumeCipher(hostKey types.PrivateKey, salt types.Hash256) (*xts.Cipher, error) {
+	deriveKey := func(i byte) types.Hash256 {
+		buf := make([]byte, 0, len(volumeKeySpecifier)+1+len(hostKey)+len(salt))
+		buf = append(buf, volumeKeySpecifier...)
+		buf = append(buf, i)
+		buf = append(buf, hostKey...)
+		buf = append(buf, salt[:]...)
+		return types.HashBytes(buf)
+	}
+	k1, k2 := deriveKey(0), deriveKey(1)
+	key := append(k1[:], k2[:]...)
+	return xts.NewCipher(aes.NewCipher, key)
+}
+
+// encryptVolume encrypts the sectors of an existing volume in place, starting
+// at index start. The encryption cursor is persisted after each batch so the
+// migration can resume after a restart.
+func (vm *VolumeManager) encryptVolume(ctx context.Context, id int64, vol *volume, start, totalSectors uint64, log *zap.Logger) error {
+	for cursor := start; cursor < totalSectors; {
+		end := cursor + encryptBatchSize
+		if end > totalSectors {
+			end = totalSectors
+		}
+
+		// the roots are used to detect sectors that were encrypted before
+		// the cursor was persisted
+		locations, err := vm.vs.OccupiedSectors(id, cursor, int(end-cursor))
+		if err != nil {
+			return fmt.Errorf("failed to get occupied sectors: %w", err)
+		}
+		roots := make(map[uint64]types.Hash256, len(locations))
+		for _, loc := range locations {
+			roots[loc.Index] = loc.Root
+		}
+
+		for i := cursor; i < end; i++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			var root *types.Hash256
+			if r, ok := roots[i]; ok {
+				root = &r
+			}
+			if err := vol.EncryptSector(i, root); err != nil {
+				return fmt.Errorf("failed to encrypt sector %v: %w", i, err)
+			}
+		}
+
+		if err := vol.Sync(); err != nil {
+			return fmt.Errorf("failed to sync volume: %w", err)
+		} else if err := vm.vs.SetVolumeEncryptionCursor(id, end); err != nil {
+			return fmt.Errorf("failed to update encryption cursor: %w", err)
+		}
+		log.Debug("encrypted sectors", zap.Uint64("start", cursor), zap.Uint64("end", end))
+		cursor = end
+	}
+
+	if err := vm.vs.CompleteVolumeEncryption(id); err != nil {
+		return fmt.Errorf("failed to complete encryption: %w", err)
+	}
+	vol.CompleteEncryption()
+	return nil
+}
+
+// resumeEncryption resumes encrypting volumes that were being encrypted when
+// the volume manager was last closed.
+func (vm *VolumeManager) resumeEncryption() {
+	volumes, err := vm.vs.Volumes()
+	if err != nil {
+		vm.log.Error("failed to get volumes", zap.Error(err))
+		return
+	}
+	for _, vol := range volumes {
+		if vol.EncryptionCursor == nil || !vol.Available {
+			continue
+		} else if err := vm.EncryptVolume(context.Background(), vol.ID, nil); err != nil {
+			vm.log.Error("failed to resume volume encryption", zap.Int64("volumeID", vol.ID), zap.Error(err))
+		}
+	}
+}
+
+// SetEncryptVolumes sets whether new volumes are encrypted at rest.
+// Existing volumes are not affected.
+func (vm *VolumeManager) SetEncryptVolumes(encrypt bool) {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	vm.encryptVolumes = encrypt
+}
+
+// EncryptVolume encrypts the existing sector data of a volume in place. The
+// volume remains usable during the migration. If the volume is partially
+// encrypted, the migration is resumed.
+func (vm *VolumeManager) EncryptVolume(ctx context.Context, id int64, result chan<- error) error {
+	log := vm.log.Named("encrypt").With(zap.Int64("volumeID", id))
+	done, err := vm.tg.Add()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	vm.mu.Lock()
+	vol, ok := vm.volumes[id]
+	vm.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("volume %v not found", id)
+	}
+
+	meta, err := vm.vs.Volume(id)
+	if err != nil {
+		return fmt.Errorf("failed to get volume: %w", err)
+	} else if meta.Encrypted && meta.EncryptionCursor == nil {
+		return errors.New("volume is already encrypted")
+	} else if err := vol.SetStatus(VolumeStatusEncrypting); err != nil {
+		return fmt.Errorf("failed to set volume status: %w", err)
+	}
+
+	var cursor uint64
+	if meta.Encrypted {
+		cursor = *meta.EncryptionCursor
+	} else {
+		salt := frand.Entropy256()
+		cipher, err := VolumeCipher(vm.vs.HostKey(), salt)
+		if err != nil {
+			vol.SetStatus(VolumeStatusReady)
+			return fmt.Errorf("failed to initialize cipher: %w", err)
+		} else if err := vm.vs.InitVolumeEncryption(id, salt, true); err != nil {
+			vol.SetStatus(VolumeStatusReady)
+			return fmt.Errorf("failed to initialize volume encryption: %w", err)
+		}
+		vol.SetEncryption(cipher, 0, 0)
+	}
+
+	go func() {
+		start := time.Now()
+		defer vol.SetStatus(VolumeStatusReady)
+
+		err := vm.encryptVolume(ctx, id, vol, cursor, meta.TotalSectors, log)
+		alert := alerts.Alert{
+			ID: frand.Entropy256(),
+			Data: map[string]any{
+				"volumeID": id,
+				"elapsed":  time.Since(start),
+			},
+			Timestamp: time.Now(),
+		}
+		if err != nil {
+			log.Error("failed to encrypt volume", zap.Error(err))
+			alert.Message = "Volume encryption failed"
+			alert.Severity = alerts.SeverityError
+			alert.Data["error"] = err.Error()
+		} else {
+			log.Info("encrypted volume", zap.Duration("elapsed", time.Since(start)))
+			alert.Message = "Volume encrypted"
+			alert.Severity = alerts.SeverityInfo
+		}
+		vm.a.Register(alert)
+
+		select {
+		case result <- err:
+		default:
+		}
+	}()
+	return nil
+}
+
+// loadVolumeCipher sets the cipher of an encrypted volume when it is loaded.
+// The cipher of a volume that is already loaded is not changed since its
+// in-memory encryption cursor may be ahead of the persisted cursor.
+func (vm *VolumeManager) loadVolumeCipher(v *volume, vol Volume) error {
+	v.mu.RLock()
+	loaded := v.cipher != nil
+	v.mu.RUnlock()
+	if !vol.Encrypted || loaded {
+		return nil
+	}
+	cipher, err := VolumeCipher(vm.vs.HostKey(), vol.EncryptionSalt)
+	if err != nil {
+		return fmt.Errorf("failed to initialize cipher: %w", err)
+	}
+	encryptedBelow, unverifiedBelow := uint64(math.MaxUint64), uint64(0)
+	if vol.EncryptionCursor != nil {
+		// the batch after the persisted cursor may have been partially
+		// encrypted before the host was stopped
+		encryptedBelow = *vol.EncryptionCursor
+		unverifiedBelow = encryptedBelow + encryptBatchSize
+	}
+	v.SetEncryption(cipher, encryptedBelow, unverifiedBelow)
+	return nil
+}
@@ -0,0 +1,515 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	rhp2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+	"go.sia.tech/hostd/alerts"
+	"go.uber.org/zap"
+	"lukechampine.com/frand"
+)
+
+const (
+	// exportVersion is the version of the volume export format.
+	exportVersion = 1
+
+	// ExportManifestFile is the name of the manifest in a volume export. The
+	// manifest is a stream of JSON values: an ExportHeader followed by an
+	// ExportSector for each exported sector.
+	ExportManifestFile = "manifest.jsonl"
+	// ExportDataFile is the name of the sector data file in a volume export.
+	// The data of the nth sector in the manifest is stored at offset
+	// n*rhp2.SectorSize.
+	ExportDataFile = "sectors.dat"
+	// ExportContractsFile is the name of the contracts file in a volume
+	// export. The file is a stream of JSON values: an ExportContract for each
+	// contract referenced by the exported sectors.
+	ExportContractsFile = "contracts.jsonl"
+
+	// exportBatchSize is the number of sectors loaded from the database at
+	// a time during an export.
+	exportBatchSize = 256
+)
+
+type (
+	// A ContractSectorRef is a contract's reference to a sector.
+	ContractSectorRef struct {
+		ContractID types.FileContractID `json:"contractID"`
+		RootIndex  uint64               `json:"rootIndex"`
+		// WindowEnd is the end of the contract's proof window.
+		WindowEnd uint64 `json:"windowEnd"`
+	}
+
+	// An ExportSector is a sector in a volume export.
+	ExportSector struct {
+		// Index is the sector's index in the exported volume. It is not
+		// included in the manifest.
+		Index uint64 `json:"-"`
+
+		Root           types.Hash256       `json:"root"`
+		Contracts      []ContractSectorRef `json:"contracts,omitempty"`
+		TempExpiration uint64              `json:"tempExpiration,omitempty"`
+	}
+
+	// ExportContractUsage tracks the usage of an exported contract's funds.
+	ExportContractUsage struct {
+		RPCRevenue       types.Currency `json:"rpc"`
+		StorageRevenue   types.Currency `json:"storage"`
+		EgressRevenue    types.Currency `json:"egress"`
+		IngressRevenue   types.Currency `json:"ingress"`
+		RegistryRead     types.Currency `json:"registryRead"`
+		RegistryWrite    types.Currency `json:"registryWrite"`
+		AccountFunding   types.Currency `json:"accountFunding"`
+		RiskedCollateral types.Currency `json:"riskedCollateral"`
+	}
+
+	// An ExportContract is a contract referenced by the sectors in a volume
+	// export. It is added to the importing host if the host does not
+	// already have it and the contract was formed with the importing host's
+	// key.
+	ExportContract struct {
+		Revision        types.FileContractRevision `json:"revision"`
+		HostSignature   types.Signature            `json:"hostSignature"`
+		RenterSignature types.Signature            `json:"renterSignature"`
+
+		// Status is the contract's status, e.g. "active".
+		Status            string              `json:"status"`
+		LockedCollateral  types.Currency      `json:"lockedCollateral"`
+		Usage             ExportContractUsage `json:"usage"`
+		NegotiationHeight uint64              `json:"negotiationHeight"`
+
+		FormationConfirmed bool   `json:"formationConfirmed"`
+		RevisionConfirmed  bool   `json:"revisionConfirmed"`
+		ResolutionHeight   uint64 `json:"resolutionHeight"`
+
+		FormationSet []types.Transaction `json:"formationSet"`
+	}
+
+	// An ExportHeader is the first value in a volume export's manifest.
+	ExportHeader struct {
+		Version   int       `json:"version"`
+		VolumeID  int64     `json:"volumeID"`
+		Timestamp time.Time `json:"timestamp"`
+	}
+
+	// ImportResult is the result of importing a volume export.
+	ImportResult struct {
+		// Contracts is the number of contracts added to the host.
+		Contracts int `json:"contracts"`
+		// RejectedContracts is the number of contracts that were not added
+		// because they were formed with a different host key. Their sectors
+		// are kept in temp storage.
+		RejectedContracts int `json:"rejectedContracts"`
+		// Imported is the number of sectors written to the host's volumes.
+		Imported int `json:"imported"`
+		// ContractRoots is the number of imported sectors registered as
+		// contract roots. Sectors whose root index is already used or outside
+		// the contract's current revision are kept in temp storage.
+		ContractRoots int `json:"contractRoots"`
+		// Skipped is the number of sectors that were not imported because
+		// they were unreferenced or their references have expired.
+		Skipped int `json:"skipped"`
+		// Corrupt is the number of sectors that were not imported because
+		// their data did not match their root.
+		Corrupt int `json:"corrupt"`
+	}
+)
+
+// sectorExpiration returns the height after which none of the sector's
+// references are valid.
+func (es ExportSector) sectorExpiration() uint64 {
+	expiration := es.TempExpiration
+	for _, ref := range es.Contracts {
+		if ref.WindowEnd > expiration {
+			expiration = ref.WindowEnd
+		}
+	}
+	return expiration
+}
+
+// exportContracts writes the contracts referenced by the exported sectors to
+// the contracts file.
+func (vm *VolumeManager) exportContracts(ids []types.FileContractID, f *os.File) error {
+	bw := bufio.NewWriter(f)
+	enc := json.NewEncoder(bw)
+	for _, id := range ids {
+		contract, err := vm.vs.ExportContract(id)
+		if err != nil {
+			return fmt.Errorf("failed to get contract %v: %w", id, err)
+		} else if err := enc.Encode(contract); err != nil {
+			return fmt.Errorf("failed to write contract %v: %w", id, err)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write contracts file: %w", err)
+	} else if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync contracts file: %w", err)
+	}
+	return nil
+}
+
+// exportVolume writes the sectors stored in a volume and the contracts
+// referencing them to dir. Sectors that are moved or removed during the
+// export are skipped.
+func (vm *VolumeManager) exportVolume(ctx context.Context, id int64, vol *volume, dir string, log *zap.Logger) (exported, skipped int, err error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return 0, 0, fmt.Errorf("failed to create export directory: %w", err)
+	}
+	manifestPath, dataPath, contractsPath := filepath.Join(dir, ExportManifestFile), filepath.Join(dir, ExportDataFile), filepath.Join(dir, ExportContractsFile)
+	manifestFile, err := os.OpenFile(manifestPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to create manifest: %w", err)
+	}
+	defer manifestFile.Close()
+	dataFile, err := os.OpenFile(dataPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		os.Remove(manifestPath)
+		return 0, 0, fmt.Errorf("failed to create data file: %w", err)
+	}
+	defer dataFile.Close()
+	contractsFile, err := os.OpenFile(contractsPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		os.Remove(manifestPath)
+		os.Remove(dataPath)
+		return 0, 0, fmt.Errorf("failed to create contracts file: %w", err)
+	}
+	defer contractsFile.Close()
+	defer func() {
+		if err != nil {
+			// remove the partial export
+			os.Remove(manifestPath)
+			os.Remove(dataPath)
+			os.Remove(contractsPath)
+		}
+	}()
+
+	bw := bufio.NewWriter(manifestFile)
+	enc := json.NewEncoder(bw)
+	if err := enc.Encode(ExportHeader{Version: exportVersion, VolumeID: id, Timestamp: time.Now()}); err != nil {
+		return 0, 0, fmt.Errorf("failed to write manifest header: %w", err)
+	}
+
+	var contractIDs []types.FileContractID
+	seen := make(map[types.FileContractID]bool)
+	var min uint64
+	for {
+		sectors, err := vm.vs.ExportSectors(id, min, exportBatchSize)
+		if err != nil {
+			return exported, skipped, fmt.Errorf("failed to get volume sectors: %w", err)
+		} else if len(sectors) == 0 {
+			break
+		}
+
+		for _, sector := range sectors {
+			if err := ctx.Err(); err != nil {
+				return exported, skipped, err
+			}
+
+			buf, err := vol.ReadSector(sector.Index, sector.Root)
+			if err != nil {
+				log.Warn("failed to read sector", zap.Stringer("root", sector.Root), zap.Uint64("index", sector.Index), zap.Error(err))
+				skipped++
+				continue
+			} else if rhp2.SectorRoot(buf) != sector.Root {
+				// the sector was moved, removed, or is corrupt
+				log.Debug("skipping sector", zap.Stringer("root", sector.Root), zap.Uint64("index", sector.Index))
+				skipped++
+				continue
+			}
+
+			if _, err := dataFile.Write(buf[:]); err != nil {
+				return exported, skipped, fmt.Errorf("failed to write sector data: %w", err)
+			} else if err := enc.Encode(sector); err != nil {
+				return exported, skipped, fmt.Errorf("failed to write manifest: %w", err)
+			}
+			for _, ref := range sector.Contracts {
+				if !seen[ref.ContractID] {
+					seen[ref.ContractID] = true
+					contractIDs = append(contractIDs, ref.ContractID)
+				}
+			}
+			exported++
+		}
+		min = sectors[len(sectors)-1].Index + 1
+	}
+
+	if err := bw.Flush(); err != nil {
+		return exported, skipped, fmt.Errorf("failed to write manifest: %w", err)
+	} else if err := manifestFile.Sync(); err != nil {
+		return exported, skipped, fmt.Errorf("failed to sync manifest: %w", err)
+	} else if err := dataFile.Sync(); err != nil {
+		return exported, skipped, fmt.Errorf("failed to sync data file: %w", err)
+	} else if err := vm.exportContracts(contractIDs, contractsFile); err != nil {
+		return exported, skipped, fmt.Errorf("failed to export contracts: %w", err)
+	}
+	return exported, skipped, nil
+}
+
+// importContracts adds the contracts in a volume export that do not already
+// exist on the host. Contracts formed with a different host key are not added
+// and are returned as rejected.
+func (vm *VolumeManager) importContracts(ctx context.Context, dec *json.Decoder, log *zap.Logger) (imported int, rejected map[types.FileContractID]bool, err error) {
+	rejected = make(map[types.FileContractID]bool)
+	for {
+		if err := ctx.Err(); err != nil {
+			return imported, rejected, err
+		}
+
+		var contract ExportContract
+		if err := dec.Decode(&contract); errors.Is(err, io.EOF) {
+			return imported, rejected, nil
+		} else if err != nil {
+			return imported, rejected, fmt.Errorf("failed to read contract: %w", err)
+		}
+
+		ok, err := vm.vs.ImportContract(contract)
+		if errors.Is(err, ErrContractHostKeyMismatch) {
+			log.Warn("skipping contract formed with a different host key", zap.Stringer("contractID", contract.Revision.ParentID))
+			rejected[contract.Revision.ParentID] = true
+			continue
+		} else if err != nil {
+			return imported, rejected, fmt.Errorf("failed to import contract %v: %w", contract.Revision.ParentID, err)
+		} else if ok {
+			imported++
+		}
+	}
+}
+
+// importSectors writes the sectors in a volume export to the host's volumes
+// and registers their references. Each sector's data is verified against its
+// root before it is written. References to rejected contracts keep the sector
+// in temp storage until the contract's proof window ends.
+func (vm *VolumeManager) importSectors(ctx context.Context, dec *json.Decoder, dataFile *os.File, rejected map[types.FileContractID]bool, log *zap.Logger) (result ImportResult, err error) {
+	height := vm.cm.TipState().Index.Height
+	for i := int64(0); ; i++ {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		// a new buffer is needed for each sector since written sectors may
+		// be added to the cache
+		buf := new([rhp2.SectorSize]byte)
+		var sector ExportSector
+		if err := dec.Decode(&sector); errors.Is(err, io.EOF) {
+			return result, nil
+		} else if err != nil {
+			return result, fmt.Errorf("failed to read manifest entry %v: %w", i, err)
+		} else if _, err := dataFile.ReadAt(buf[:], i*rhp2.SectorSize); err != nil {
+			return result, fmt.Errorf("failed to read sector %v: %w", sector.Root, err)
+		}
+
+		refs := sector.Contracts[:0]
+		for _, ref := range sector.Contracts {
+			if !rejected[ref.ContractID] {
+				refs = append(refs, ref)
+			} else if ref.WindowEnd > sector.TempExpiration {
+				sector.TempExpiration = ref.WindowEnd
+			}
+		}
+		sector.Contracts = refs
+
+		if rhp2.SectorRoot(buf) != sector.Root {
+			log.Warn("sector data does not match root", zap.Stringer("root", sector.Root), zap.Int64("offset", i))
+			result.Corrupt++
+			continue
+		} else if sector.sectorExpiration() <= height {
+			result.Skipped++
+			continue
+		}
+
+		release, err := vm.Write(sector.Root, buf)
+		if err != nil {
+			return result, fmt.Errorf("failed to write sector %v: %w", sector.Root, err)
+		}
+		n, err := vm.vs.ImportSectorReferences(sector.Root, sector.Contracts, sector.TempExpiration)
+		if err := release(); err != nil {
+			log.Error("failed to release sector", zap.Stringer("root", sector.Root), zap.Error(err))
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to import sector %v references: %w", sector.Root, err)
+		}
+		result.Imported++
+		result.ContractRoots += n
+	}
+}
+
+// ExportVolume writes the sectors stored in a volume, along with a manifest of
+// their contract and temp storage references and the referenced contracts, to
+// dir. The export can be
+// imported by another host with ImportVolume. Sectors written to the volume
+// during the export are not included. The exported sector data is not
+// encrypted, even if the volume is.
+func (vm *VolumeManager) ExportVolume(ctx context.Context, id int64, dir string, result chan<- error) error {
+	log := vm.log.Named("export").With(zap.Int64("volumeID", id), zap.String("path", dir))
+	done, err := vm.tg.Add()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	vm.mu.Lock()
+	vol, ok := vm.volumes[id]
+	vm.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("volume %v not found", id)
+	} else if err := vol.SetStatus(VolumeStatusExporting); err != nil {
+		return fmt.Errorf("failed to set volume status: %w", err)
+	}
+
+	go func() {
+		start := time.Now()
+		defer vol.SetStatus(VolumeStatusReady)
+
+		ctx, cancel, err := vm.tg.AddContext(ctx)
+		if err != nil {
+			select {
+			case result <- err:
+			default:
+			}
+			return
+		}
+		defer cancel()
+
+		exported, skipped, err := vm.exportVolume(ctx, id, vol, dir, log)
+		alert := alerts.Alert{
+			ID: frand.Entropy256(),
+			Data: map[string]any{
+				"volumeID":        id,
+				"path":            dir,
+				"elapsed":         time.Since(start),
+				"exportedSectors": exported,
+				"skippedSectors":  skipped,
+			},
+			Timestamp: time.Now(),
+		}
+		if err != nil {
+			log.Error("failed to export volume", zap.Error(err))
+			alert.Message = "Volume export failed"
+			alert.Severity = alerts.SeverityError
+			alert.Data["error"] = err.Error()
+		} else {
+			log.Info("exported volume", zap.Int("exported", exported), zap.Int("skipped", skipped), zap.Duration("elapsed", time.Since(start)))
+			alert.Message = "Volume exported"
+			alert.Severity = alerts.SeverityInfo
+		}
+		vm.a.Register(alert)
+
+		select {
+		case result <- err:
+		default:
+		}
+	}()
+	return nil
+}
+
+// ImportVolume imports a volume export created by ExportVolume. Contracts in
+// the export that do not exist on the host are added first. The sectors are
+// then verified, written to the host's volumes, and registered as contract
+// roots.
+func (vm *VolumeManager) ImportVolume(ctx context.Context, dir string, result chan<- error) error {
+	log := vm.log.Named("import").With(zap.String("path", dir))
+	done, err := vm.tg.Add()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	manifestFile, err := os.Open(filepath.Join(dir, ExportManifestFile))
+	if err != nil {
+		return fmt.Errorf("failed to open manifest: %w", err)
+	}
+	dataFile, err := os.Open(filepath.Join(dir, ExportDataFile))
+	if err != nil {
+		manifestFile.Close()
+		return fmt.Errorf("failed to open data file: %w", err)
+	}
+	contractsFile, err := os.Open(filepath.Join(dir, ExportContractsFile))
+	if err != nil {
+		manifestFile.Close()
+		dataFile.Close()
+		return fmt.Errorf("failed to open contracts file: %w", err)
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(manifestFile))
+	var header ExportHeader
+	if err := dec.Decode(&header); err != nil {
+		manifestFile.Close()
+		dataFile.Close()
+		contractsFile.Close()
+		return fmt.Errorf("failed to read manifest header: %w", err)
+	} else if header.Version != exportVersion {
+		manifestFile.Close()
+		dataFile.Close()
+		contractsFile.Close()
+		return fmt.Errorf("unsupported export version %v", header.Version)
+	}
+
+	go func() {
+		defer manifestFile.Close()
+		defer dataFile.Close()
+		defer contractsFile.Close()
+
+		ctx, cancel, err := vm.tg.AddContext(ctx)
+		if err != nil {
+			select {
+			case result <- err:
+			default:
+			}
+			return
+		}
+		defer cancel()
+
+		start := time.Now()
+		// contracts must be added before their sector roots
+		var res ImportResult
+		imported, rejected, err := vm.importContracts(ctx, json.NewDecoder(bufio.NewReader(contractsFile)), log)
+		if err == nil {
+			res, err = vm.importSectors(ctx, dec, dataFile, rejected, log)
+		}
+		res.Contracts = imported
+		res.RejectedContracts = len(rejected)
+		alert := alerts.Alert{
+			ID: frand.Entropy256(),
+			Data: map[string]any{
+				"path":          dir,
+				"elapsed":       time.Since(start),
+				"contracts":     res.Contracts,
+				"rejected":      res.RejectedContracts,
+				"imported":      res.Imported,
+				"contractRoots": res.ContractRoots,
+				"skipped":       res.Skipped,
+				"corrupt":       res.Corrupt,
+			},
+			Timestamp: time.Now(),
+		}
+		if err != nil {
+			log.Error("failed to import volume", zap.Error(err))
+			alert.Message = "Volume import failed"
+			alert.Severity = alerts.SeverityError
+			alert.Data["error"] = err.Error()
+		} else {
+			log.Info("imported volume", zap.Int("contracts", res.Contracts), zap.Int("rejectedContracts", res.RejectedContracts), zap.Int("imported", res.Imported), zap.Int("contractRoots", res.ContractRoots), zap.Int("skipped", res.Skipped), zap.Int("corrupt", res.Corrupt), zap.Duration("elapsed", time.Since(start)))
+			alert.Message = "Volume imported"
+			alert.Severity = alerts.SeverityInfo
+			if res.Corrupt > 0 {
+				alert.Severity = alerts.SeverityWarning
+			}
+		}
+		vm.a.Register(alert)
+
+		select {
+		case result <- err:
+		default:
+		}
+	}()
+	return nil
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"errors"
+	"time"
 
 	"go.sia.tech/core/types"
 )
@@ -20,6 +21,11 @@ type (
 		// store. GrowVolume must be called afterwards to initialize the volume
 		// to its desired size.
 		AddVolume(localPath string, readOnly bool) (int64, error)
+		// AddS3Volume initializes a new storage volume backed by an
+		// S3-compatible bucket and adds it to the volume store. GrowVolume
+		// must be called afterwards to initialize the volume to its desired
+		// size.
+		AddS3Volume(cfg S3Config, readOnly bool) (int64, error)
 		// RemoveVolume removes a storage volume from the volume store. If there
 		// are used sectors in the volume, ErrVolumeNotEmpty is returned. If
 		// force is true, the volume is removed even if it is not empty.
@@ -36,12 +42,18 @@ type (
 		SetReadOnly(volumeID int64, readOnly bool) error
 		// SetAvailable sets the available flag on a volume.
 		SetAvailable(volumeID int64, available bool) error
+		// SetPriority sets the placement priority of a volume.
+		SetPriority(volumeID int64, priority uint64) error
 
 		// MigrateSectors returns a new location for each occupied sector of a
 		// volume starting at min. The sector data should be copied to the new
 		// location and synced to disk during migrateFn. Iteration is stopped if
 		// migrateFn returns an error.
 		MigrateSectors(volumeID int64, min uint64, migrateFn func(SectorLocation) error) error
+		// RebalanceSectors moves up to n sectors from one volume to another.
+		// The sector data should be copied to the new location and synced to
+		// disk during migrateFn. The number of sectors moved is returned.
+		RebalanceSectors(fromVolumeID, toVolumeID int64, n int, migrateFn func(SectorLocation) error) (int, error)
 		// StoreSector calls fn with an empty location in a writable volume. If
 		// the sector root already exists, fn is called with the existing
 		// location and exists is true. Unless exists is true, The sector must
@@ -66,10 +78,108 @@ type (
 		// ExpireTempSectors removes all temporary sectors that expired before
 		// the given height.
 		ExpireTempSectors(height uint64) error
+		// RemoveTempSectors removes the temporary storage references of the
+		// given sectors regardless of their expiration height. If roots is
+		// empty, all temporary sectors are removed. The number of references
+		// removed is returned.
+		RemoveTempSectors(roots []types.Hash256) (int, error)
+		// TempSectors returns the sectors in temporary storage ordered by
+		// expiration height.
+		TempSectors(limit, offset int) ([]TempStorageSector, error)
+		// TempStorageSummary returns a summary of the sectors in temporary
+		// storage.
+		TempStorageSummary() (TempStorageSummary, error)
 		// IncrementSectorStats increments sector stats
 		IncrementSectorStats(reads, writes, cacheHit, cacheMiss uint64) error
 		// SectorReferences returns the references to a sector
 		SectorReferences(types.Hash256) (SectorReference, error)
+
+		// StoreSectorReplica calls fn with an empty location in a writable
+		// volume that does not already contain a copy of the sector. The
+		// sector data must be written to disk within fn. If no space is
+		// available, ErrNotEnoughStorage is returned. The location is locked
+		// until release is called.
+		StoreSectorReplica(root types.Hash256, fn func(loc SectorLocation) error) (release func() error, err error)
+		// SectorReplicas returns the locations of the replicas of a sector,
+		// excluding its primary location.
+		SectorReplicas(root types.Hash256) ([]SectorLocation, error)
+		// UnderReplicatedSectors returns up to limit sectors, ordered by
+		// root, with fewer than copies copies in available volumes. Only
+		// sectors with a root greater than after are returned.
+		UnderReplicatedSectors(after types.Hash256, copies, limit int) ([]UnderReplicatedSector, error)
+
+		// ScrubSectors returns up to limit occupied sector locations in a
+		// volume, including replicas, starting at volume index min, ordered
+		// by index.
+		ScrubSectors(volumeID int64, min uint64, limit int) ([]SectorLocation, error)
+		// RecordScrubBatch records the results of scrubbing the volume
+		// indices between start and end, inclusive, replacing any previous
+		// errors in the range.
+		RecordScrubBatch(volumeID int64, start, end, checked uint64, bad []ScrubError) error
+		// CompleteScrubPass marks the current scrub pass of a volume as
+		// complete and resets the scrub cursor.
+		CompleteScrubPass(volumeID int64) error
+		// ScrubProgress returns the scrub progress of a volume.
+		ScrubProgress(volumeID int64) (ScrubProgress, error)
+		// ScrubErrors returns the bad sectors found in a volume.
+		ScrubErrors(volumeID int64, limit, offset int) ([]ScrubError, error)
+
+		// SetCacheTier sets the cache tier flag on a volume.
+		SetCacheTier(volumeID int64, cacheTier bool) error
+		// CacheSector calls fn with a location in a cache tier volume for a
+		// copy of the sector, evicting the least recently accessed copy if
+		// the tier is full. The sector data must be written to disk within
+		// fn. If there is no cache tier space available, ErrNotEnoughStorage
+		// is returned. The location is locked until release is called.
+		CacheSector(root types.Hash256, fn func(loc SectorLocation) error) (release func() error, err error)
+		// CachedSectorLocation returns the location of the cached copy of a
+		// sector and updates its last access time. If the sector is not
+		// cached, ErrSectorNotFound is returned.
+		CachedSectorLocation(root types.Hash256) (SectorLocation, error)
+		// RemoveCachedSector removes the cached copy of a sector.
+		RemoveCachedSector(root types.Hash256) error
+		// EvictCachedSectors removes up to limit cached copies that have not
+		// been accessed since before. The number of evicted sectors is
+		// returned.
+		EvictCachedSectors(before time.Time, limit int) (int, error)
+
+		// ExportSectors returns up to limit sectors stored in a volume,
+		// including replicas, with their contract and temp storage
+		// references, starting at volume index min, ordered by index.
+		ExportSectors(volumeID int64, min uint64, limit int) ([]ExportSector, error)
+		// ExportContract returns a contract referenced by exported sectors
+		// along with its formation transaction set.
+		ExportContract(id types.FileContractID) (ExportContract, error)
+		// ImportContract adds a contract from a volume export. If the
+		// contract already exists, it is not modified and false is returned.
+		// If the contract was formed with a different host key,
+		// ErrContractHostKeyMismatch is returned.
+		ImportContract(ExportContract) (bool, error)
+		// ImportSectorReferences adds the contract and temp storage
+		// references of an imported sector. The referenced contracts must
+		// exist. A contract reference is only added if the root index is
+		// empty and within the contract's current revision. Other references
+		// keep the sector in temp storage until the contract's proof window
+		// ends. The number of contract roots registered is returned.
+		ImportSectorReferences(root types.Hash256, contracts []ContractSectorRef, tempExpiration uint64) (int, error)
+
+		// HostKey returns the host's private key. It is used to derive the
+		// encryption keys of encrypted volumes.
+		HostKey() types.PrivateKey
+		// InitVolumeEncryption sets the encryption salt of a volume. If
+		// migrate is true, the volume's existing sectors are not yet
+		// encrypted and its encryption cursor is set to 0.
+		InitVolumeEncryption(volumeID int64, salt types.Hash256, migrate bool) error
+		// SetVolumeEncryptionCursor sets the number of leading sectors of a
+		// volume that have been encrypted.
+		SetVolumeEncryptionCursor(volumeID int64, cursor uint64) error
+		// CompleteVolumeEncryption clears the encryption cursor of a volume
+		// after all of its sectors have been encrypted.
+		CompleteVolumeEncryption(volumeID int64) error
+		// OccupiedSectors returns up to limit occupied sector locations in a
+		// volume, including replicas and cached copies, starting at volume
+		// index min, ordered by index.
+		OccupiedSectors(volumeID int64, min uint64, limit int) ([]SectorLocation, error)
 	}
 )
 
@@ -84,4 +194,7 @@ var (
 	ErrVolumeNotEmpty = errors.New("volume is not empty")
 	// ErrVolumeNotFound is returned when a volume is not found.
 	ErrVolumeNotFound = errors.New("volume not found")
+	// ErrContractHostKeyMismatch is returned when importing a contract that
+	// was formed with a different host key.
+	ErrContractHostKeyMismatch = errors.New("contract host key does not match")
 )
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"fmt"
+
+	"lukechampine.com/frand"
+)
+
+// PlacementPolicy is the strategy used to choose the volume a new sector is
+// written to.
+const (
+	// PlacementLeastUsed writes to the volume with the fewest used sectors.
+	PlacementLeastUsed = "leastUsed"
+	// PlacementFillInOrder writes to the oldest volume with free space.
+	PlacementFillInOrder = "fillInOrder"
+	// PlacementProportional writes to a random volume weighted by its free
+	// space.
+	PlacementProportional = "proportional"
+	// PlacementPriority writes to a random volume weighted by its priority.
+	PlacementPriority = "priority"
+)
+
+// A PlacementStrategy chooses the volume a new sector is written to. The
+// volumes are writable, have free space, and are ordered by ID.
+type PlacementStrategy func(volumes []Volume) Volume
+
+var placementStrategies = map[string]PlacementStrategy{
+	PlacementLeastUsed:    placeLeastUsed,
+	PlacementFillInOrder:  placeInOrder,
+	PlacementProportional: placeProportional,
+	PlacementPriority:     placeByPriority,
+}
+
+func placeLeastUsed(volumes []Volume) Volume {
+	best := volumes[0]
+	for _, v := range volumes[1:] {
+		if v.UsedSectors < best.UsedSectors {
+			best = v
+		}
+	}
+	return best
+}
+
+func placeInOrder(volumes []Volume) Volume {
+	return volumes[0]
+}
+
+// placeWeighted chooses a random volume with probability proportional to its
+// weight. If all weights are zero, the least used volume is chosen.
+func placeWeighted(volumes []Volume, weight func(Volume) uint64) Volume {
+	var total uint64
+	for _, v := range volumes {
+		total += weight(v)
+	}
+	if total == 0 {
+		return placeLeastUsed(volumes)
+	}
+
+	n := frand.Uint64n(total)
+	for _, v := range volumes {
+		w := weight(v)
+		if n < w {
+			return v
+		}
+		n -= w
+	}
+	panic("unreachable") // developer error
+}
+
+func placeProportional(volumes []Volume) Volume {
+	return placeWeighted(volumes, func(v Volume) uint64 {
+		return v.TotalSectors - v.UsedSectors
+	})
+}
+
+func placeByPriority(volumes []Volume) Volume {
+	return placeWeighted(volumes, func(v Volume) uint64 {
+		return v.Priority
+	})
+}
+
+// ValidatePlacementPolicy returns an error if the placement policy is not
+// supported. An empty policy is treated as PlacementLeastUsed.
+func ValidatePlacementPolicy(policy string) error {
+	if policy == "" {
+		return nil
+	} else if _, ok := placementStrategies[policy]; !ok {
+		return fmt.Errorf("unknown placement policy %q", policy)
+	}
+	return nil
+}
+
+// ValidatePlacementPolicy returns an error if the placement policy is not
+// supported.
+func (vm *VolumeManager) ValidatePlacementPolicy(policy string) error {
+	return ValidatePlacementPolicy(policy)
+}
+
+// PlacementStrategyForPolicy returns the placement strategy for a policy.
+// Unknown policies fall back to PlacementLeastUsed.
+func PlacementStrategyForPolicy(policy string) PlacementStrategy {
+	if fn, ok := placementStrategies[policy]; ok {
+		return fn
+	}
+	return placeLeastUsed
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"go.sia.tech/hostd/alerts"
+	"go.uber.org/zap"
+	"lukechampine.com/frand"
+)
+
+// rebalancePair returns the most and least utilized of the writable volumes
+// and the number of sectors that should be moved between them to bring both
+// closer to the average utilization. If there is nothing to move, n is 0.
+func rebalancePair(volumes []Volume) (from, to Volume, n int) {
+	if len(volumes) < 2 {
+		return Volume{}, Volume{}, 0
+	}
+
+	var used, total uint64
+	for _, v := range volumes {
+		used += v.UsedSectors
+		total += v.TotalSectors
+	}
+	target := float64(used) / float64(total)
+
+	utilization := func(v Volume) float64 {
+		return float64(v.UsedSectors) / float64(v.TotalSectors)
+	}
+	from, to = volumes[0], volumes[0]
+	for _, v := range volumes[1:] {
+		if utilization(v) > utilization(from) {
+			from = v
+		}
+		if utilization(v) < utilization(to) {
+			to = v
+		}
+	}
+
+	excess := int(from.UsedSectors) - int(math.Ceil(target*float64(from.TotalSectors)))
+	deficit := int(math.Floor(target*float64(to.TotalSectors))) - int(to.UsedSectors)
+	n = excess
+	if deficit < n {
+		n = deficit
+	}
+	if n > rebalanceBatchSize {
+		n = rebalanceBatchSize
+	}
+	if n < 0 {
+		n = 0
+	}
+	return from, to, n
+}
+
+// rebalanceVolumes moves sectors from the most utilized writable volumes to
+// the least utilized until the utilization of each volume is close to the
+// average. The number of sectors moved is returned.
+func (vm *VolumeManager) rebalanceVolumes(ctx context.Context, log *zap.Logger) (moved int, err error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return moved, err
+		}
+
+		volumes, err := vm.vs.Volumes()
+		if err != nil {
+			return moved, fmt.Errorf("failed to get volumes: %w", err)
+		}
+
+		// only consider writable volumes that are not busy
+		candidates := volumes[:0]
+		vm.mu.Lock()
+		for _, vol := range volumes {
+			v, ok := vm.volumes[vol.ID]
+			if !ok || !vol.Available || vol.ReadOnly || vol.CacheTier || vol.TotalSectors == 0 || v.Status() != VolumeStatusReady {
+				continue
+			}
+			candidates = append(candidates, vol)
+		}
+		vm.mu.Unlock()
+
+		from, to, n := rebalancePair(candidates)
+		if n == 0 {
+			return moved, nil
+		}
+
+		m, err := vm.vs.RebalanceSectors(from.ID, to.ID, n, func(loc SectorLocation) error {
+			return vm.migrateSector(loc, log)
+		})
+		moved += m
+		if err != nil {
+			return moved, fmt.Errorf("failed to move sectors from volume %v to volume %v: %w", from.ID, to.ID, err)
+		} else if m == 0 {
+			// the remaining sectors cannot be moved
+			return moved, nil
+		}
+		log.Debug("moved sectors", zap.Int64("from", from.ID), zap.Int64("to", to.ID), zap.Int("sectors", m))
+	}
+}
+
+// triggerRebalance schedules a rebalance of the volumes.
+func (vm *VolumeManager) triggerRebalance() {
+	select {
+	case vm.rebalanceCh <- struct{}{}:
+	default:
+	}
+}
+
+// runRebalancer rebalances the volumes when triggered until the volume
+// manager is closed.
+func (vm *VolumeManager) runRebalancer() {
+	ctx, cancel, err := vm.tg.AddContext(context.Background())
+	if err != nil {
+		return
+	}
+	defer cancel()
+
+	log := vm.log.Named("rebalance")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-vm.rebalanceCh:
+		}
+
+		start := time.Now()
+		moved, err := vm.rebalanceVolumes(ctx, log)
+		if errors.Is(err, context.Canceled) {
+			return
+		} else if err == nil && moved == 0 {
+			continue
+		}
+
+		alert := alerts.Alert{
+			ID: frand.Entropy256(),
+			Data: map[string]any{
+				"elapsed":      time.Since(start),
+				"movedSectors": moved,
+			},
+			Timestamp: time.Now(),
+		}
+		if err != nil {
+			log.Error("failed to rebalance volumes", zap.Error(err))
+			alert.Message = "Volume rebalance failed"
+			alert.Severity = alerts.SeverityError
+			alert.Data["error"] = err.Error()
+		} else {
+			log.Info("rebalanced volumes", zap.Int("moved", moved), zap.Duration("elapsed", time.Since(start)))
+			alert.Message = "Volumes rebalanced"
+			alert.Severity = alerts.SeverityInfo
+		}
+		vm.a.Register(alert)
+	}
+}
+
+// Rebalance moves sectors between the writable volumes in the background to
+// even out their utilization.
+func (vm *VolumeManager) Rebalance() {
+	vm.triggerRebalance()
+}
+
+// SetPriority sets the placement priority of a volume. The priority is only
+// used by the priority placement policy.
+func (vm *VolumeManager) SetPriority(id int64, priority uint64) error {
+	done, err := vm.tg.Add()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if err := vm.vs.SetPriority(id, priority); err != nil {
+		return fmt.Errorf("failed to set volume %v priority: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	rhp2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+	"go.sia.tech/hostd/alerts"
+	"go.uber.org/zap"
+)
+
+// replicationBatchSize is the number of under-replicated sectors loaded from
+// the store at a time.
+const replicationBatchSize = 100
+
+// replicationAlertID is the ID of the alert registered when sectors cannot be
+// replicated.
+var replicationAlertID = types.HashBytes([]byte("storage/replication"))
+
+// errNoValidCopy is returned by readCopy when none of the locations contain
+// valid sector data.
+var errNoValidCopy = errors.New("no valid copy of sector")
+
+// An UnderReplicatedSector is a sector with fewer copies in available volumes
+// than the replication factor.
+type UnderReplicatedSector struct {
+	Root   types.Hash256
+	Copies int
+}
+
+// readCopy reads the sector from the first location with data matching the
+// sector's root. The cache is bypassed.
+func (vm *VolumeManager) readCopy(root types.Hash256, locations []SectorLocation) (*[rhp2.SectorSize]byte, error) {
+	for _, loc := range locations {
+		vm.mu.Lock()
+		v, ok := vm.volumes[loc.Volume]
+		vm.mu.Unlock()
+		if !ok {
+			continue
+		}
+
+		sector, err := v.ReadSector(loc.Index, root)
+		if err != nil {
+			vm.log.Debug("failed to read sector copy", zap.Stringer("root", root), zap.Int64("volume", loc.Volume), zap.Uint64("index", loc.Index), zap.Error(err))
+			continue
+		} else if rhp2.SectorRoot(sector) != root {
+			vm.log.Debug("sector copy is corrupt", zap.Stringer("root", root), zap.Int64("volume", loc.Volume), zap.Uint64("index", loc.Index))
+			continue
+		}
+		return sector, nil
+	}
+	return nil, errNoValidCopy
+}
+
+// writeReplicas writes n additional copies of a sector to volumes that do not
+// already contain a copy. The number of replicas written is returned.
+func (vm *VolumeManager) writeReplicas(root types.Hash256, data *[rhp2.SectorSize]byte, n int) (written int, err error) {
+	for i := 0; i < n; i++ {
+		release, err := vm.vs.StoreSectorReplica(root, func(loc SectorLocation) error {
+			vm.mu.Lock()
+			vol, ok := vm.volumes[loc.Volume]
+			vm.mu.Unlock()
+			if !ok {
+				return fmt.Errorf("volume %v not found", loc.Volume)
+			} else if err := vol.WriteSector(data, loc.Index); err != nil {
+				return fmt.Errorf("failed to write sector data: %w", err)
+			}
+			vm.log.Debug("wrote replica", zap.Stringer("root", root), zap.Int64("volume", loc.Volume), zap.Uint64("index", loc.Index))
+
+			// mark the volume as changed
+			vm.mu.Lock()
+			vm.changedVolumes[loc.Volume] = true
+			vm.mu.Unlock()
+			return nil
+		})
+		if err != nil {
+			return written, err
+		}
+		written++
+		if err := release(); err != nil {
+			return written, fmt.Errorf("failed to release replica: %w", err)
+		}
+	}
+	return written, nil
+}
+
+// replicateSector writes n additional copies of a stored sector using the
+// data from any valid copy.
+func (vm *VolumeManager) replicateSector(root types.Hash256, n int) (int, error) {
+	loc, release, err := vm.vs.SectorLocation(root)
+	if err != nil {
+		return 0, fmt.Errorf("failed to locate sector: %w", err)
+	}
+	defer release()
+
+	replicas, err := vm.vs.SectorReplicas(root)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get replicas: %w", err)
+	}
+	data, err := vm.readCopy(root, append([]SectorLocation{loc}, replicas...))
+	if err != nil {
+		return 0, err
+	}
+	return vm.writeReplicas(root, data, n)
+}
+
+// replicateSectors adds copies of every sector with fewer copies in available
+// volumes than the replication factor. Replication stops when there is not
+// enough storage to place a copy.
+func (vm *VolumeManager) replicateSectors(ctx context.Context, log *zap.Logger) error {
+	factor := int(atomic.LoadUint64(&vm.replicationFactor))
+	if factor <= 1 {
+		vm.a.Dismiss(replicationAlertID)
+		return nil
+	}
+
+	var after types.Hash256
+	var replicated, failed int
+	var lastErr error
+	for {
+		sectors, err := vm.vs.UnderReplicatedSectors(after, factor, replicationBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to get under-replicated sectors: %w", err)
+		} else if len(sectors) == 0 {
+			break
+		}
+
+		for _, sector := range sectors {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			after = sector.Root
+
+			n, err := vm.replicateSector(sector.Root, factor-sector.Copies)
+			replicated += n
+			if errors.Is(err, ErrSectorNotFound) {
+				continue
+			} else if err != nil {
+				failed++
+				lastErr = err
+				log.Warn("failed to replicate sector", zap.Stringer("root", sector.Root), zap.Error(err))
+				if errors.Is(err, ErrNotEnoughStorage) {
+					break
+				}
+			}
+		}
+		if errors.Is(lastErr, ErrNotEnoughStorage) {
+			break
+		}
+	}
+
+	if failed == 0 {
+		vm.a.Dismiss(replicationAlertID)
+	} else {
+		vm.a.Register(alerts.Alert{
+			ID:       replicationAlertID,
+			Severity: alerts.SeverityWarning,
+			Message:  "Sectors are under-replicated",
+			Data: map[string]any{
+				"replicationFactor": factor,
+				"failed":            failed,
+				"error":             lastErr.Error(),
+			},
+			Timestamp: time.Now(),
+		})
+	}
+	if replicated > 0 {
+		log.Info("replicated sectors", zap.Int("replicas", replicated), zap.Int("failed", failed))
+	}
+	return nil
+}
+
+// queueReplication queues a newly written sector to be replicated by the
+// background replicator.
+func (vm *VolumeManager) queueReplication(root types.Hash256) {
+	vm.mu.Lock()
+	vm.pendingReplicas[root] = true
+	vm.mu.Unlock()
+
+	select {
+	case vm.pendingReplicaCh <- struct{}{}:
+	default:
+	}
+}
+
+// replicatePending replicates the sectors queued by Write. If a sector cannot
+// be replicated, a full replication pass is scheduled to retry it and report
+// the failure.
+func (vm *VolumeManager) replicatePending(ctx context.Context, log *zap.Logger) {
+	vm.mu.Lock()
+	pending := vm.pendingReplicas
+	vm.pendingReplicas = make(map[types.Hash256]bool)
+	vm.mu.Unlock()
+
+	factor := int(atomic.LoadUint64(&vm.replicationFactor))
+	if factor <= 1 {
+		return
+	}
+	for root := range pending {
+		if ctx.Err() != nil {
+			return
+		}
+
+		replicas, err := vm.vs.SectorReplicas(root)
+		if err != nil {
+			log.Warn("failed to get sector replicas", zap.Stringer("root", root), zap.Error(err))
+			vm.triggerReplication()
+			continue
+		}
+		n := factor - 1 - len(replicas)
+		if n <= 0 {
+			continue
+		}
+		if _, err := vm.replicateSector(root, n); errors.Is(err, ErrSectorNotFound) {
+			continue
+		} else if err != nil {
+			log.Warn("failed to replicate sector", zap.Stringer("root", root), zap.Error(err))
+			vm.triggerReplication()
+		}
+	}
+}
+
+// triggerReplication schedules a replication pass.
+func (vm *VolumeManager) triggerReplication() {
+	select {
+	case vm.replicateCh <- struct{}{}:
+	default:
+	}
+}
+
+// runReplicator replicates newly written sectors and under-replicated sectors
+// when triggered until the volume manager is closed.
+func (vm *VolumeManager) runReplicator() {
+	ctx, cancel, err := vm.tg.AddContext(context.Background())
+	if err != nil {
+		return
+	}
+	defer cancel()
+
+	log := vm.log.Named("replicator")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-vm.pendingReplicaCh:
+			vm.replicatePending(ctx, log)
+			continue
+		case <-vm.replicateCh:
+		}
+
+		if err := vm.replicateSectors(ctx, log); errors.Is(err, context.Canceled) {
+			return
+		} else if err != nil {
+			log.Error("failed to replicate sectors", zap.Error(err))
+		}
+	}
+}
+
+// SetReplicationFactor sets the number of copies of each sector stored in
+// distinct volumes. Existing sectors are replicated in the background.
+func (vm *VolumeManager) SetReplicationFactor(n uint64) {
+	if n == 0 {
+		n = 1
+	}
+	if old := atomic.SwapUint64(&vm.replicationFactor, n); old != n {
+		vm.triggerReplication()
+	}
+}
@@ -0,0 +1,291 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	rhp2 "go.sia.tech/core/rhp/v2"
+)
+
+// s3RequestTimeout is the maximum duration of a single request to an
+// S3-compatible service.
+const s3RequestTimeout = 2 * time.Minute
+
+type (
+	// An S3Config configures a volume that stores its sector data in an
+	// S3-compatible bucket instead of a local file.
+	S3Config struct {
+		// Endpoint is the URL of the S3-compatible service, e.g.
+		// http://localhost:9000 for a local MinIO server. If empty, AWS S3
+		// is used.
+		Endpoint string `json:"endpoint"`
+		Region   string `json:"region"`
+		Bucket   string `json:"bucket"`
+		// Prefix is prepended to the key of each sector object. Multiple
+		// volumes can share a bucket by using different prefixes.
+		Prefix          string `json:"prefix"`
+		AccessKeyID     string `json:"accessKeyID"`
+		SecretAccessKey string `json:"secretAccessKey,omitempty"`
+	}
+
+	// A VolumeDataReader reads the sector data of a volume.
+	VolumeDataReader interface {
+		io.ReaderAt
+		io.Closer
+	}
+
+	// sparseData is implemented by volume backends that do not need space
+	// to be allocated when a volume grows.
+	sparseData interface {
+		sparse()
+	}
+
+	// An s3Volume stores each sector of a volume as a separate object in an
+	// S3-compatible bucket. Sectors that have not been written read as
+	// zeros.
+	s3Volume struct {
+		client *s3.S3
+		bucket string
+		prefix string
+	}
+)
+
+// Validate returns an error if the config is missing required fields.
+func (cfg S3Config) Validate() error {
+	switch {
+	case cfg.Bucket == "":
+		return errors.New("bucket is required")
+	case cfg.AccessKeyID == "" || cfg.SecretAccessKey == "":
+		return errors.New("access key ID and secret access key are required")
+	case cfg.Endpoint != "":
+		if _, err := url.Parse(cfg.Endpoint); err != nil {
+			return fmt.Errorf("invalid endpoint: %w", err)
+		}
+	}
+	return nil
+}
+
+// Location returns a URI identifying the volume's objects. It is stored as
+// the volume's local path.
+func (cfg S3Config) Location() string {
+	host := "s3.amazonaws.com"
+	if u, err := url.Parse(cfg.Endpoint); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	return "s3://" + host + "/" + cfg.Bucket + "/" + strings.Trim(cfg.Prefix, "/")
+}
+
+func (s3Volume) sparse() {}
+
+// key returns the object key of the sector at index. Indices are zero
+// padded so keys are listed in index order.
+func (sv *s3Volume) key(index uint64) string {
+	return fmt.Sprintf("%s%016x", sv.prefix, index)
+}
+
+// getSector reads length bytes of the sector at index starting at offset
+// into p.
+func (sv *s3Volume) getSector(p []byte, index, offset uint64) error {
+	resp, err := sv.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(sv.bucket),
+		Key:    aws.String(sv.key(index)),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+uint64(len(p))-1)),
+	})
+	if isS3NotFound(err) {
+		// the sector has not been written
+		for i := range p {
+			p[i] = 0
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.ReadFull(resp.Body, p)
+	return err
+}
+
+// putSector writes a full sector to the object at index.
+func (sv *s3Volume) putSector(p []byte, index uint64) error {
+	_, err := sv.client.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(sv.bucket),
+		Key:    aws.String(sv.key(index)),
+		Body:   bytes.NewReader(p),
+	})
+	return err
+}
+
+// ReadAt implements io.ReaderAt
+func (sv *s3Volume) ReadAt(p []byte, off int64) (int, error) {
+	var n int
+	for n < len(p) {
+		pos := uint64(off) + uint64(n)
+		index, offset := pos/rhp2.SectorSize, pos%rhp2.SectorSize
+		length := rhp2.SectorSize - offset
+		if rem := uint64(len(p) - n); rem < length {
+			length = rem
+		}
+		if err := sv.getSector(p[n:n+int(length)], index, offset); err != nil {
+			return n, fmt.Errorf("failed to get sector object %v: %w", index, err)
+		}
+		n += int(length)
+	}
+	return n, nil
+}
+
+// WriteAt implements io.WriterAt. Partial sector writes read the existing
+// object before overwriting it.
+func (sv *s3Volume) WriteAt(p []byte, off int64) (int, error) {
+	var n int
+	for n < len(p) {
+		pos := uint64(off) + uint64(n)
+		index, offset := pos/rhp2.SectorSize, pos%rhp2.SectorSize
+		length := rhp2.SectorSize - offset
+		if rem := uint64(len(p) - n); rem < length {
+			length = rem
+		}
+
+		data := p[n : n+int(length)]
+		if length != rhp2.SectorSize {
+			buf := make([]byte, rhp2.SectorSize)
+			if err := sv.getSector(buf, index, 0); err != nil {
+				return n, fmt.Errorf("failed to get sector object %v: %w", index, err)
+			}
+			copy(buf[offset:], data)
+			data = buf
+		}
+		if err := sv.putSector(data, index); err != nil {
+			return n, fmt.Errorf("failed to put sector object %v: %w", index, err)
+		}
+		n += int(length)
+	}
+	return n, nil
+}
+
+// Sync implements volumeData. Objects are durable once they are written.
+func (sv *s3Volume) Sync() error { return nil }
+
+// Close implements volumeData
+func (sv *s3Volume) Close() error { return nil }
+
+// Truncate deletes the objects of all sectors at or beyond size. Growing the
+// volume is a no-op.
+func (sv *s3Volume) Truncate(size int64) error {
+	sectors := (uint64(size) + rhp2.SectorSize - 1) / rhp2.SectorSize
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(sv.bucket),
+		Prefix: aws.String(sv.prefix),
+	}
+	if sectors > 0 {
+		input.StartAfter = aws.String(sv.key(sectors - 1))
+	}
+
+	var deleteErr error
+	err := sv.client.ListObjectsV2Pages(input, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		var objects []*s3.ObjectIdentifier
+		for _, obj := range page.Contents {
+			index, err := strconv.ParseUint(strings.TrimPrefix(aws.StringValue(obj.Key), sv.prefix), 16, 64)
+			if err != nil || index < sectors {
+				continue // not a sector object
+			}
+			objects = append(objects, &s3.ObjectIdentifier{Key: obj.Key})
+		}
+		if len(objects) == 0 {
+			return true
+		}
+		_, deleteErr = sv.client.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: aws.String(sv.bucket),
+			Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		return deleteErr == nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list sector objects: %w", err)
+	} else if deleteErr != nil {
+		return fmt.Errorf("failed to delete sector objects: %w", deleteErr)
+	}
+	return nil
+}
+
+// empty returns true if there are no objects under the volume's prefix.
+func (sv *s3Volume) empty() (bool, error) {
+	resp, err := sv.client.ListObjectsV2(&s3.ListObjectsV2Input{
+		Bucket:  aws.String(sv.bucket),
+		Prefix:  aws.String(sv.prefix),
+		MaxKeys: aws.Int64(1),
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(resp.Contents) == 0, nil
+}
+
+// isS3NotFound returns true if err indicates that an object does not exist.
+func isS3NotFound(err error) bool {
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusNotFound {
+		return true
+	}
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && awsErr.Code() == s3.ErrCodeNoSuchKey
+}
+
+// openS3Volume connects to the bucket in cfg and checks that it is
+// accessible.
+func openS3Volume(cfg S3Config) (*s3Volume, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	region := cfg.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	awsCfg := &aws.Config{
+		Credentials: credentials.NewStaticCredentials(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
+		Region:      aws.String(region),
+		HTTPClient:  &http.Client{Timeout: s3RequestTimeout},
+	}
+	if cfg.Endpoint != "" {
+		// most S3-compatible services do not support virtual-hosted buckets
+		awsCfg.Endpoint = aws.String(cfg.Endpoint)
+		awsCfg.S3ForcePathStyle = aws.Bool(true)
+	}
+	sess, err := session.NewSession(awsCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	sv := &s3Volume{
+		client: s3.New(sess),
+		bucket: cfg.Bucket,
+	}
+	if prefix := strings.Trim(cfg.Prefix, "/"); prefix != "" {
+		sv.prefix = prefix + "/"
+	}
+	if _, err := sv.client.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(cfg.Bucket)}); err != nil {
+		return nil, fmt.Errorf("failed to access bucket %q: %w", cfg.Bucket, err)
+	}
+	return sv, nil
+}
+
+// OpenVolumeData opens the sector data of a volume for reading. It is used by
+// tools that do not load the volume into a VolumeManager.
+func OpenVolumeData(vol Volume) (VolumeDataReader, error) {
+	if vol.S3 != nil {
+		return openS3Volume(*vol.S3)
+	}
+	return os.Open(vol.LocalPath)
+}
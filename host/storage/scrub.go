@@ -0,0 +1,339 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	rhp2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+	"go.sia.tech/hostd/alerts"
+	"go.uber.org/zap"
+)
+
+// ScrubErrorType is the type of a bad sector found by the scrubber.
+const (
+	ScrubErrorCorrupt = "corrupt"
+	ScrubErrorMissing = "missing"
+)
+
+// maxScrubAlertSectors is the maximum number of bad sectors included in a
+// scrub alert.
+const maxScrubAlertSectors = 100
+
+type (
+	// A ScrubError is a bad sector found by the scrubber.
+	ScrubError struct {
+		Index     uint64        `json:"index"`
+		Root      types.Hash256 `json:"root"`
+		Type      string        `json:"type"`
+		Error     string        `json:"error"`
+		Timestamp time.Time     `json:"timestamp"`
+	}
+
+	// ScrubProgress is the progress of the scrubber through a volume.
+	ScrubProgress struct {
+		// NextIndex is the next volume index that will be checked
+		NextIndex uint64 `json:"nextIndex"`
+		// Checked is the number of sectors checked in the current pass
+		Checked uint64 `json:"checked"`
+		// Passes is the number of completed passes over the volume
+		Passes            uint64    `json:"passes"`
+		PassStarted       time.Time `json:"passStarted"`
+		LastPassCompleted time.Time `json:"lastPassCompleted"`
+
+		Corrupt uint64 `json:"corrupt"`
+		Missing uint64 `json:"missing"`
+	}
+
+	// ScrubStatus is the scrub progress and bad sectors of a volume.
+	ScrubStatus struct {
+		ScrubProgress
+		Errors []ScrubError `json:"errors"`
+	}
+)
+
+// errScrubSkipped is returned by scrubSector when a sector was removed or
+// moved since it was selected for scrubbing.
+var errScrubSkipped = errors.New("sector skipped")
+
+// scrubSector reads a sector from disk, bypassing the cache, and verifies its
+// Merkle root. If the sector is bad and another valid copy exists, the sector
+// is rewritten from the copy. A non-nil ScrubError is returned if the sector
+// is bad and could not be repaired.
+func (vm *VolumeManager) scrubSector(loc SectorLocation) (*ScrubError, error) {
+	current, release, err := vm.vs.SectorLocation(loc.Root)
+	if errors.Is(err, ErrSectorNotFound) {
+		return nil, errScrubSkipped
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to locate sector: %w", err)
+	}
+	defer release()
+
+	replicas, err := vm.vs.SectorReplicas(loc.Root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get replicas: %w", err)
+	}
+	// other copies of the sector that can be used to repair the location
+	copies := make([]SectorLocation, 0, len(replicas))
+	var found bool
+	for _, c := range append([]SectorLocation{current}, replicas...) {
+		if c.ID == loc.ID {
+			found = true
+			continue
+		}
+		copies = append(copies, c)
+	}
+	if !found {
+		// the sector was migrated, it will be checked in its new location
+		return nil, errScrubSkipped
+	}
+
+	vm.mu.Lock()
+	v, ok := vm.volumes[loc.Volume]
+	vm.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("volume %v not found", loc.Volume)
+	}
+
+	var se *ScrubError
+	sector, err := v.ReadSector(loc.Index, loc.Root)
+	if errors.Is(err, ErrVolumeNotAvailable) {
+		return nil, err
+	} else if err != nil {
+		se = &ScrubError{
+			Index:     loc.Index,
+			Root:      loc.Root,
+			Type:      ScrubErrorMissing,
+			Error:     err.Error(),
+			Timestamp: time.Now(),
+		}
+	} else if root := rhp2.SectorRoot(sector); root != loc.Root {
+		se = &ScrubError{
+			Index:     loc.Index,
+			Root:      loc.Root,
+			Type:      ScrubErrorCorrupt,
+			Error:     fmt.Sprintf("expected root %v, got %v", loc.Root, root),
+			Timestamp: time.Now(),
+		}
+	}
+	if se == nil || len(copies) == 0 {
+		return se, nil
+	}
+
+	// repair the location using a valid copy of the sector
+	data, err := vm.readCopy(loc.Root, copies)
+	if err != nil {
+		return se, nil
+	} else if err := v.WriteSector(data, loc.Index); err != nil {
+		return se, nil
+	} else if err := v.Sync(); err != nil {
+		return se, nil
+	}
+	vm.log.Info("repaired sector from copy", zap.Stringer("root", loc.Root), zap.Int64("volume", loc.Volume), zap.Uint64("index", loc.Index), zap.String("error", se.Error))
+	return nil, nil
+}
+
+// updateScrubAlert registers an alert listing the bad sectors of a volume and
+// the contracts affected by them. If the volume has no bad sectors, the alert
+// is dismissed.
+func (vm *VolumeManager) updateScrubAlert(volumeID int64) error {
+	vm.mu.Lock()
+	v, ok := vm.volumes[volumeID]
+	vm.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("volume %v not found", volumeID)
+	}
+
+	progress, err := vm.vs.ScrubProgress(volumeID)
+	if err != nil {
+		return fmt.Errorf("failed to get scrub progress: %w", err)
+	} else if progress.Corrupt+progress.Missing == 0 {
+		vm.a.Dismiss(v.alertID("scrub"))
+		return nil
+	}
+
+	bad, err := vm.vs.ScrubErrors(volumeID, maxScrubAlertSectors, 0)
+	if err != nil {
+		return fmt.Errorf("failed to get scrub errors: %w", err)
+	}
+
+	sectors := make([]types.Hash256, 0, len(bad))
+	contracts := make([]types.FileContractID, 0)
+	seen := make(map[types.FileContractID]bool)
+	for _, se := range bad {
+		sectors = append(sectors, se.Root)
+		refs, err := vm.vs.SectorReferences(se.Root)
+		if errors.Is(err, ErrSectorNotFound) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to get references for sector %v: %w", se.Root, err)
+		}
+		for _, id := range refs.Contracts {
+			if !seen[id] {
+				seen[id] = true
+				contracts = append(contracts, id)
+			}
+		}
+	}
+
+	vm.a.Register(alerts.Alert{
+		ID:       v.alertID("scrub"),
+		Severity: alerts.SeverityError,
+		Message:  "Scrubber found bad sectors",
+		Data: map[string]interface{}{
+			"volume":    v.Location(),
+			"corrupt":   progress.Corrupt,
+			"missing":   progress.Missing,
+			"sectors":   sectors,
+			"contracts": contracts,
+		},
+		Timestamp: time.Now(),
+	})
+	return nil
+}
+
+// scrubVolume checks the next batch of sectors in a volume. Reads are paced
+// to the current scrub rate. The number of sectors checked is returned.
+func (vm *VolumeManager) scrubVolume(ctx context.Context, volumeID int64, log *zap.Logger) (int, error) {
+	progress, err := vm.vs.ScrubProgress(volumeID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get scrub progress: %w", err)
+	}
+
+	locations, err := vm.vs.ScrubSectors(volumeID, progress.NextIndex, scrubBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get sectors: %w", err)
+	} else if len(locations) == 0 {
+		if progress.NextIndex == 0 {
+			// the volume is empty
+			return 0, nil
+		}
+		if err := vm.vs.CompleteScrubPass(volumeID); err != nil {
+			return 0, fmt.Errorf("failed to complete scrub pass: %w", err)
+		} else if err := vm.updateScrubAlert(volumeID); err != nil {
+			return 0, fmt.Errorf("failed to update scrub alert: %w", err)
+		}
+		log.Info("completed scrub pass", zap.Uint64("checked", progress.Checked), zap.Uint64("corrupt", progress.Corrupt), zap.Uint64("missing", progress.Missing))
+		// restore any copies lost since the last pass
+		vm.triggerReplication()
+		return 0, nil
+	}
+
+	var checked uint64
+	var bad []ScrubError
+	var processed bool
+	end := progress.NextIndex
+	for _, loc := range locations {
+		rate := atomic.LoadUint64(&vm.scrubRate)
+		if rate == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return int(checked), ctx.Err()
+		case <-time.After(time.Minute / time.Duration(rate)):
+		}
+
+		se, err := vm.scrubSector(loc)
+		if errors.Is(err, errScrubSkipped) {
+			processed, end = true, loc.Index
+			continue
+		} else if err != nil {
+			return int(checked), fmt.Errorf("failed to scrub sector %v: %w", loc.Root, err)
+		}
+		processed, end = true, loc.Index
+		checked++
+		if se != nil {
+			log.Warn("bad sector", zap.Uint64("index", se.Index), zap.Stringer("root", se.Root), zap.String("type", se.Type), zap.String("error", se.Error))
+			bad = append(bad, *se)
+		}
+	}
+	if !processed {
+		return 0, nil
+	}
+
+	if err := vm.vs.RecordScrubBatch(volumeID, progress.NextIndex, end, checked, bad); err != nil {
+		return int(checked), fmt.Errorf("failed to record scrub results: %w", err)
+	} else if len(bad) > 0 {
+		if err := vm.updateScrubAlert(volumeID); err != nil {
+			return int(checked), fmt.Errorf("failed to update scrub alert: %w", err)
+		}
+	}
+	return int(checked), nil
+}
+
+// runScrubber continuously verifies the sectors of each available volume at
+// the configured scrub rate until the volume manager is closed.
+func (vm *VolumeManager) runScrubber() {
+	ctx, cancel, err := vm.tg.AddContext(context.Background())
+	if err != nil {
+		return
+	}
+	defer cancel()
+
+	log := vm.log.Named("scrubber")
+	for {
+		var checked int
+		if atomic.LoadUint64(&vm.scrubRate) != 0 {
+			volumes, err := vm.vs.Volumes()
+			if err != nil {
+				log.Error("failed to get volumes", zap.Error(err))
+			}
+			for _, vol := range volumes {
+				if !vol.Available {
+					continue
+				}
+				n, err := vm.scrubVolume(ctx, vol.ID, log.With(zap.Int64("volume", vol.ID)))
+				if errors.Is(err, context.Canceled) {
+					return
+				} else if err != nil {
+					log.Error("failed to scrub volume", zap.Int64("volume", vol.ID), zap.Error(err))
+				}
+				checked += n
+			}
+		}
+
+		if checked == 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(scrubIdleInterval):
+			}
+		}
+	}
+}
+
+// SetScrubRate sets the number of sectors per minute the scrubber will
+// verify. A rate of 0 disables scrubbing.
+func (vm *VolumeManager) SetScrubRate(rate uint64) {
+	atomic.StoreUint64(&vm.scrubRate, rate)
+}
+
+// ScrubStatus returns the scrub progress and bad sectors of a volume.
+func (vm *VolumeManager) ScrubStatus(id int64, limit, offset int) (ScrubStatus, error) {
+	done, err := vm.tg.Add()
+	if err != nil {
+		return ScrubStatus{}, err
+	}
+	defer done()
+
+	if _, err := vm.vs.Volume(id); err != nil {
+		return ScrubStatus{}, fmt.Errorf("failed to get volume: %w", err)
+	}
+
+	progress, err := vm.vs.ScrubProgress(id)
+	if err != nil {
+		return ScrubStatus{}, fmt.Errorf("failed to get scrub progress: %w", err)
+	}
+	errs, err := vm.vs.ScrubErrors(id, limit, offset)
+	if err != nil {
+		return ScrubStatus{}, fmt.Errorf("failed to get scrub errors: %w", err)
+	}
+	return ScrubStatus{
+		ScrubProgress: progress,
+		Errors:        errs,
+	}, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"os"
 	"sync"
 	"sync/atomic"
@@ -32,6 +33,8 @@ const (
 	VolumeStatusCreating    = "creating"
 	VolumeStatusResizing    = "resizing"
 	VolumeStatusRemoving    = "removing"
+	VolumeStatusExporting   = "exporting"
+	VolumeStatusEncrypting  = "encrypting"
 	VolumeStatusReady       = "ready"
 )
 
@@ -71,10 +74,45 @@ type (
 		Locks       int                    `json:"locks"`
 	}
 
+	// A TempStorageSector is a reference to a sector in temporary storage.
+	TempStorageSector struct {
+		Root       types.Hash256 `json:"root"`
+		Expiration uint64        `json:"expiration"`
+		// Contracts is the number of contract roots referencing the sector.
+		// Sectors referenced by a contract are not removed when their
+		// temporary storage expires.
+		Contracts int `json:"contracts"`
+	}
+
+	// A TempStorageExpiration is the number of temporary sector references
+	// that expire at a height.
+	TempStorageExpiration struct {
+		Height  uint64 `json:"height"`
+		Sectors uint64 `json:"sectors"`
+	}
+
+	// TempStorageSummary summarizes the sectors in temporary storage.
+	TempStorageSummary struct {
+		// Sectors is the total number of temporary sector references.
+		Sectors uint64 `json:"sectors"`
+		// EphemeralSectors is the number of stored sectors that are only
+		// referenced by temporary storage. They will be removed when their
+		// references expire.
+		EphemeralSectors uint64 `json:"ephemeralSectors"`
+		// Size is the number of bytes used by ephemeral sectors.
+		Size        uint64                  `json:"size"`
+		Expirations []TempStorageExpiration `json:"expirations"`
+	}
+
 	// A VolumeManager manages storage using local volumes.
 	VolumeManager struct {
 		cacheHits   uint64 // ensure 64-bit alignment on 32-bit systems
 		cacheMisses uint64
+		scrubRate   uint64 // sectors per minute, 0 disables scrubbing
+		// replicationFactor is the number of copies of each sector
+		replicationFactor uint64
+		tierHits          uint64 // reads served by the cache tier volumes
+		tierMisses        uint64
 
 		a        Alerts
 		vs       VolumeStore
@@ -90,6 +128,32 @@ type (
 		// changedVolumes tracks volumes that need to be fsynced
 		changedVolumes map[int64]bool
 		cache          *lru.Cache[types.Hash256, *[rhp2.SectorSize]byte] // Added cache
+		// cacheVolumes tracks the cache tier volumes
+		cacheVolumes map[int64]bool
+		// accesses tracks the number of cold storage reads of each sector
+		accesses map[types.Hash256]int
+		// promoting tracks sectors being copied to the cache tier
+		promoting map[types.Hash256]bool
+		// encryptVolumes is true if new volumes should be encrypted
+		encryptVolumes bool
+		// directIO is true if local volume files bypass the page cache
+		directIO bool
+		// readAhead holds sectors read by Prefetch until they are read
+		readAhead *lru.Cache[types.Hash256, *[rhp2.SectorSize]byte]
+		// prefetching tracks sectors being read by Prefetch. The channel is
+		// closed when the read completes.
+		prefetching map[types.Hash256]chan struct{}
+
+		// pendingReplicas tracks newly written sectors that have not been
+		// replicated yet
+		pendingReplicas map[types.Hash256]bool
+
+		// replicateCh triggers a replication pass
+		replicateCh chan struct{}
+		// pendingReplicaCh triggers replication of the pending sectors
+		pendingReplicaCh chan struct{}
+		// rebalanceCh triggers a rebalance of the volumes
+		rebalanceCh chan struct{}
 	}
 )
 
@@ -119,8 +183,13 @@ func (vm *VolumeManager) loadVolumes() error {
 			}
 			vm.volumes[vol.ID] = v
 		}
+		if vol.CacheTier {
+			vm.cacheVolumes[vol.ID] = true
+		}
 
-		if err := v.OpenVolume(vol.LocalPath, false); err != nil {
+		if err := vm.loadVolumeCipher(v, vol); err != nil {
+			return fmt.Errorf("failed to load volume %v cipher: %w", vol.ID, err)
+		} else if err := openVolume(v, vol, vm.directIO); err != nil {
 			v.appendError(fmt.Errorf("failed to open volume: %w", err))
 			vm.log.Error("unable to open volume", zap.Error(err), zap.Int64("id", vol.ID), zap.String("path", vol.LocalPath))
 			// mark the volume as unavailable
@@ -153,6 +222,15 @@ func (vm *VolumeManager) loadVolumes() error {
 	return nil
 }
 
+// openVolume opens the data of a volume from its local file or bucket. If
+// the volume is already open, it is not reopened.
+func openVolume(v *volume, vol Volume, directIO bool) error {
+	if vol.S3 != nil {
+		return v.OpenS3Volume(*vol.S3, false)
+	}
+	return v.OpenVolume(vol.LocalPath, directIO, false)
+}
+
 // migrateSector migrates a sector to a new location. The sector is read from
 // its current location and written to its new location. The volume is
 // immediately synced after the sector is written.
@@ -337,7 +415,8 @@ func (vm *VolumeManager) volumeStats(id int64) VolumeStats {
 	return v.Stats()
 }
 
-func (vm *VolumeManager) migrateForRemoval(ctx context.Context, id int64, localPath string, force bool, log *zap.Logger) (int, error) {
+func (vm *VolumeManager) migrateForRemoval(ctx context.Context, vol Volume, force bool, log *zap.Logger) (int, error) {
+	id := vol.ID
 	ctx, cancel, err := vm.tg.AddContext(ctx)
 	if err != nil {
 		return 0, err
@@ -393,12 +472,23 @@ func (vm *VolumeManager) migrateForRemoval(ctx context.Context, id int64, localP
 
 	vm.mu.Lock()
 	defer vm.mu.Unlock()
+	v := vm.volumes[id]
+	if vol.S3 != nil {
+		// remove the sector objects from the bucket
+		if err := v.Resize(vol.TotalSectors, 0); err != nil {
+			return migrated, fmt.Errorf("failed to remove volume objects: %w", err)
+		}
+	}
 	// close the volume
-	vm.volumes[id].Close()
+	v.Close()
 	// delete the volume from memory
 	delete(vm.volumes, id)
+	delete(vm.cacheVolumes, id)
+	if vol.S3 != nil {
+		return migrated, nil
+	}
 	// remove the volume file, ignore error if the file does not exist
-	if err := os.Remove(localPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+	if err := os.Remove(vol.LocalPath); err != nil && !errors.Is(err, os.ErrNotExist) {
 		return migrated, fmt.Errorf("failed to remove volume file: %w", err)
 	}
 	return migrated, nil
@@ -458,7 +548,7 @@ func (vm *VolumeManager) Volumes() ([]VolumeMeta, error) {
 	var results []VolumeMeta
 	for _, vol := range volumes {
 		meta := VolumeMeta{
-			Volume:      vol,
+			Volume:      vol.redacted(),
 			VolumeStats: vm.volumeStats(vol.ID),
 		}
 		results = append(results, meta)
@@ -484,13 +574,15 @@ func (vm *VolumeManager) Volume(id int64) (VolumeMeta, error) {
 	defer vm.mu.Unlock()
 
 	return VolumeMeta{
-		Volume:      vol,
+		Volume:      vol.redacted(),
 		VolumeStats: vm.volumeStats(vol.ID),
 	}, nil
 }
 
-// AddVolume adds a new volume to the storage manager
-func (vm *VolumeManager) AddVolume(ctx context.Context, localPath string, maxSectors uint64, result chan<- error) (Volume, error) {
+// addVolume creates a new volume file and initializes it in the background.
+// If cacheTier is true, the volume will only store copies of frequently read
+// sectors.
+func (vm *VolumeManager) addVolume(ctx context.Context, localPath string, maxSectors uint64, cacheTier bool, result chan<- error) (Volume, error) {
 	if maxSectors == 0 {
 		return Volume{}, errors.New("max sectors must be greater than 0")
 	}
@@ -512,21 +604,63 @@ func (vm *VolumeManager) AddVolume(ctx context.Context, localPath string, maxSec
 	if err != nil {
 		return Volume{}, fmt.Errorf("failed to create volume file: %w", err)
 	}
+	var data volumeData = f
+	vm.mu.Lock()
+	directIO := vm.directIO
+	vm.mu.Unlock()
+	if directIO {
+		// reopen the new file for direct I/O
+		if err := f.Close(); err != nil {
+			return Volume{}, fmt.Errorf("failed to close volume file: %w", err)
+		} else if data, err = openVolumeFile(localPath, true); err != nil {
+			return Volume{}, fmt.Errorf("failed to open volume file: %w", err)
+		}
+	}
 
 	volumeID, err := vm.vs.AddVolume(localPath, false)
 	if err != nil {
 		return Volume{}, fmt.Errorf("failed to add volume to store: %w", err)
 	}
+	return vm.initVolume(ctx, volumeID, data, maxSectors, cacheTier, result)
+}
+
+// initVolume adds a new volume to the volume map and grows it to maxSectors
+// in the background.
+func (vm *VolumeManager) initVolume(ctx context.Context, volumeID int64, data volumeData, maxSectors uint64, cacheTier bool, result chan<- error) (Volume, error) {
+	if cacheTier {
+		// the flag must be set before the volume is available to prevent
+		// sectors from being stored in it
+		if err := vm.vs.SetCacheTier(volumeID, true); err != nil {
+			return Volume{}, fmt.Errorf("failed to set cache tier: %w", err)
+		}
+	}
 
-	// add the new volume to the volume map
 	vm.mu.Lock()
+	encrypt := vm.encryptVolumes
+	vm.mu.Unlock()
 	vol := &volume{
-		data: f,
+		data: data,
 		stats: VolumeStats{
 			Status: VolumeStatusCreating,
 		},
 	}
+	if encrypt {
+		salt := frand.Entropy256()
+		cipher, err := VolumeCipher(vm.vs.HostKey(), salt)
+		if err != nil {
+			return Volume{}, fmt.Errorf("failed to initialize cipher: %w", err)
+		} else if err := vm.vs.InitVolumeEncryption(volumeID, salt, false); err != nil {
+			return Volume{}, fmt.Errorf("failed to initialize volume encryption: %w", err)
+		}
+		vol.SetEncryption(cipher, math.MaxUint64, 0)
+	}
+
+	// add the new volume to the volume map
+	vm.mu.Lock()
 	vm.volumes[volumeID] = vol
+	if cacheTier {
+		vm.cacheVolumes[volumeID] = true
+	}
 	vm.mu.Unlock()
 
 	vm.vs.SetAvailable(volumeID, true)
@@ -555,6 +689,13 @@ func (vm *VolumeManager) AddVolume(ctx context.Context, localPath string, maxSec
 		} else {
 			alert.Message = "Volume initialized"
 			alert.Severity = alerts.SeverityInfo
+			if !cacheTier {
+				// move sectors to the new volume to spread out I/O. The
+				// volume must be ready before it is considered by the
+				// rebalancer.
+				vol.SetStatus(VolumeStatusReady)
+				vm.triggerRebalance()
+			}
 		}
 		vm.a.Register(alert)
 
@@ -563,7 +704,50 @@ func (vm *VolumeManager) AddVolume(ctx context.Context, localPath string, maxSec
 		default:
 		}
 	}()
-	return vm.vs.Volume(volumeID)
+	v, err := vm.vs.Volume(volumeID)
+	return v.redacted(), err
+}
+
+// AddVolume adds a new volume to the storage manager
+func (vm *VolumeManager) AddVolume(ctx context.Context, localPath string, maxSectors uint64, result chan<- error) (Volume, error) {
+	return vm.addVolume(ctx, localPath, maxSectors, false, result)
+}
+
+// AddCacheVolume adds a new cache tier volume to the storage manager. Cache
+// tier volumes do not add storage capacity. Frequently read sectors are
+// copied to them and served from them.
+func (vm *VolumeManager) AddCacheVolume(ctx context.Context, localPath string, maxSectors uint64, result chan<- error) (Volume, error) {
+	return vm.addVolume(ctx, localPath, maxSectors, true, result)
+}
+
+// AddS3Volume adds a new volume that stores its sector data in an
+// S3-compatible bucket. The bucket must exist and there must not be any
+// objects under the configured prefix.
+func (vm *VolumeManager) AddS3Volume(ctx context.Context, cfg S3Config, maxSectors uint64, result chan<- error) (Volume, error) {
+	if maxSectors == 0 {
+		return Volume{}, errors.New("max sectors must be greater than 0")
+	}
+
+	done, err := vm.tg.Add()
+	if err != nil {
+		return Volume{}, err
+	}
+	defer done()
+
+	data, err := openS3Volume(cfg)
+	if err != nil {
+		return Volume{}, fmt.Errorf("failed to open bucket: %w", err)
+	} else if empty, err := data.empty(); err != nil {
+		return Volume{}, fmt.Errorf("failed to list bucket objects: %w", err)
+	} else if !empty {
+		return Volume{}, fmt.Errorf("bucket prefix already contains objects: %s", cfg.Location())
+	}
+
+	volumeID, err := vm.vs.AddS3Volume(cfg, false)
+	if err != nil {
+		return Volume{}, fmt.Errorf("failed to add volume to store: %w", err)
+	}
+	return vm.initVolume(ctx, volumeID, data, maxSectors, false, result)
 }
 
 // SetReadOnly sets the read-only status of a volume.
@@ -622,7 +806,7 @@ func (vm *VolumeManager) RemoveVolume(ctx context.Context, id int64, force bool,
 		start := time.Now()
 		defer vol.SetStatus(VolumeStatusReady)
 
-		migrated, err := vm.migrateForRemoval(ctx, id, stat.LocalPath, force, log)
+		migrated, err := vm.migrateForRemoval(ctx, stat, force, log)
 		if err != nil {
 			log.Error("failed to migrate sectors", zap.Error(err))
 		}
@@ -723,6 +907,10 @@ func (vm *VolumeManager) ResizeVolume(ctx context.Context, id int64, maxSectors
 		case current < target:
 			// volume is growing
 			err = vm.growVolume(ctx, id, vol, stat.TotalSectors, maxSectors)
+			if err == nil && !stat.CacheTier {
+				vol.SetStatus(VolumeStatusReady)
+				vm.triggerRebalance()
+			}
 		}
 
 		alert := alerts.Alert{
@@ -768,6 +956,17 @@ func (vm *VolumeManager) RemoveSector(root types.Hash256) error {
 	}
 	defer release()
 
+	replicas, err := vm.vs.SectorReplicas(root)
+	if err != nil {
+		return fmt.Errorf("failed to get replicas of sector %v: %w", root, err)
+	}
+	locations := append([]SectorLocation{loc}, replicas...)
+	if cached, err := vm.vs.CachedSectorLocation(root); err == nil {
+		locations = append(locations, cached)
+	} else if !errors.Is(err, ErrSectorNotFound) {
+		return fmt.Errorf("failed to get cached copy of sector %v: %w", root, err)
+	}
+
 	// remove the sector from the volume store
 	if err := vm.vs.RemoveSector(root); err != nil {
 		return fmt.Errorf("failed to remove sector %v: %w", root, err)
@@ -776,22 +975,25 @@ func (vm *VolumeManager) RemoveSector(root types.Hash256) error {
 	vm.mu.Lock()
 	defer vm.mu.Unlock()
 
-	// get the volume from memory
-	vol, ok := vm.volumes[loc.Volume]
-	if !ok {
-		return fmt.Errorf("volume %v not found", loc.Volume)
-	}
-
-	// zero the sector and immediately sync the volume
+	// zero the sector and its copies and immediately sync the volumes
 	var zeroes [rhp2.SectorSize]byte
-	if err := vol.WriteSector(&zeroes, loc.Index); err != nil {
-		return fmt.Errorf("failed to zero sector %v: %w", root, err)
-	} else if err := vol.Sync(); err != nil {
-		return fmt.Errorf("failed to sync volume %v: %w", loc.Volume, err)
+	for _, loc := range locations {
+		// get the volume from memory
+		vol, ok := vm.volumes[loc.Volume]
+		if !ok {
+			return fmt.Errorf("volume %v not found", loc.Volume)
+		}
+
+		if err := vol.WriteSector(&zeroes, loc.Index); err != nil {
+			return fmt.Errorf("failed to zero sector %v: %w", root, err)
+		} else if err := vol.Sync(); err != nil {
+			return fmt.Errorf("failed to sync volume %v: %w", loc.Volume, err)
+		}
 	}
 
 	// eject the sector from the cache
 	vm.cache.Remove(root)
+	vm.readAhead.Remove(root)
 	return nil
 }
 
@@ -813,37 +1015,27 @@ func (vm *VolumeManager) CacheStats() (hits, misses uint64) {
 	return atomic.LoadUint64(&vm.cacheHits), atomic.LoadUint64(&vm.cacheMisses)
 }
 
-// Read reads the sector with the given root
-func (vm *VolumeManager) Read(root types.Hash256) (*[rhp2.SectorSize]byte, error) {
-	done, err := vm.tg.Add()
-	if err != nil {
-		return nil, err
-	}
-	defer done()
-
-	// Check the cache first
-	if sector, ok := vm.cache.Get(root); ok {
-		vm.recorder.AddCacheHit()
-		atomic.AddUint64(&vm.cacheHits, 1)
-		return sector, nil
-	}
-
-	// Cache miss, read from disk
+// readSector reads a sector from the cache tier or the volume storing it. If
+// the volume cannot be read, the sector is read from a replica.
+func (vm *VolumeManager) readSector(root types.Hash256) (*[rhp2.SectorSize]byte, error) {
 	loc, release, err := vm.vs.SectorLocation(root)
 	if err != nil {
 		return nil, fmt.Errorf("failed to locate sector: %w", err)
 	}
 	defer release()
 
+	// check the cache tier before reading from cold storage
+	if sector, ok := vm.readCacheTier(root); ok {
+		return sector, nil
+	}
+
 	vm.mu.Lock()
 	v, ok := vm.volumes[loc.Volume]
-	if !ok {
-		vm.mu.Unlock()
-		return nil, fmt.Errorf("volume %v not found", loc.Volume)
-	}
 	vm.mu.Unlock()
-	sector, err := v.ReadSector(loc.Index)
-	if err != nil {
+	var sector *[rhp2.SectorSize]byte
+	if !ok {
+		err = fmt.Errorf("volume %v not found", loc.Volume)
+	} else if sector, err = v.ReadSector(loc.Index, root); err != nil {
 		stats := v.Stats()
 		vm.a.Register(alerts.Alert{
 			ID:       v.alertID("read"),
@@ -858,7 +1050,52 @@ func (vm *VolumeManager) Read(root types.Hash256) (*[rhp2.SectorSize]byte, error
 			},
 			Timestamp: time.Now(),
 		})
-		return nil, fmt.Errorf("failed to read sector data: %w", err)
+		err = fmt.Errorf("failed to read sector data: %w", err)
+	}
+	if err != nil {
+		// fall back to a replica
+		replicas, rErr := vm.vs.SectorReplicas(root)
+		if rErr != nil || len(replicas) == 0 {
+			return nil, err
+		}
+		sector, rErr = vm.readCopy(root, replicas)
+		if rErr != nil {
+			return nil, err
+		}
+		vm.log.Warn("read sector from replica", zap.Stringer("root", root), zap.Error(err))
+	}
+	vm.recordAccess(root, sector)
+	return sector, nil
+}
+
+// Read reads the sector with the given root
+func (vm *VolumeManager) Read(root types.Hash256) (*[rhp2.SectorSize]byte, error) {
+	done, err := vm.tg.Add()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	// Check the cache first
+	if sector, ok := vm.cache.Get(root); ok {
+		vm.recorder.AddCacheHit()
+		atomic.AddUint64(&vm.cacheHits, 1)
+		return sector, nil
+	}
+
+	// Cache miss, use the prefetched sector or read from disk. If the sector
+	// is being prefetched, wait for it instead of reading it twice.
+	vm.mu.Lock()
+	prefetch, ok := vm.prefetching[root]
+	vm.mu.Unlock()
+	if ok {
+		<-prefetch
+	}
+	sector, ok := vm.readAhead.Get(root)
+	if ok {
+		vm.readAhead.Remove(root)
+	} else if sector, err = vm.readSector(root); err != nil {
+		return nil, err
 	}
 
 	// Add sector to cache
@@ -869,6 +1106,81 @@ func (vm *VolumeManager) Read(root types.Hash256) (*[rhp2.SectorSize]byte, error
 	return sector, nil
 }
 
+// Prefetch reads sectors in the background so that subsequent calls to Read
+// do not wait for disk I/O. It is used to read ahead when a renter reads
+// sequential sectors. Sectors that are cached or already being read are
+// skipped.
+func (vm *VolumeManager) Prefetch(roots ...types.Hash256) {
+	done, err := vm.tg.Add()
+	if err != nil {
+		return
+	}
+
+	defer done()
+
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	for _, root := range roots {
+		if _, ok := vm.prefetching[root]; ok || vm.cache.Contains(root) || vm.readAhead.Contains(root) {
+			continue
+		}
+		prefetchDone, err := vm.tg.Add()
+		if err != nil {
+			return
+		}
+		ch := make(chan struct{})
+		vm.prefetching[root] = ch
+
+		go func(root types.Hash256) {
+			defer prefetchDone()
+
+			if sector, err := vm.readSector(root); err != nil {
+				vm.log.Debug("failed to prefetch sector", zap.Stringer("root", root), zap.Error(err))
+			} else {
+				vm.readAhead.Add(root, sector)
+			}
+
+			vm.mu.Lock()
+			delete(vm.prefetching, root)
+			vm.mu.Unlock()
+			close(ch)
+		}(root)
+	}
+}
+
+// SetDirectIO sets whether local volume files bypass the page cache. Open
+// volumes are reopened. Direct I/O avoids evicting other data, such as the
+// database, from the page cache when reading large amounts of sector data.
+func (vm *VolumeManager) SetDirectIO(enabled bool) error {
+	done, err := vm.tg.Add()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	volumes, err := vm.vs.Volumes()
+	if err != nil {
+		return fmt.Errorf("failed to get volumes: %w", err)
+	}
+
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	if vm.directIO == enabled {
+		return nil
+	}
+	vm.directIO = enabled
+
+	for _, vol := range volumes {
+		v, ok := vm.volumes[vol.ID]
+		if !ok || vol.S3 != nil || v.Status() == VolumeStatusUnavailable {
+			continue
+		} else if err := v.OpenVolume(vol.LocalPath, enabled, true); err != nil {
+			return fmt.Errorf("failed to reopen volume %v: %w", vol.ID, err)
+		}
+	}
+	return nil
+}
+
 // Sync syncs the data files of changed volumes.
 func (vm *VolumeManager) Sync() error {
 	done, err := vm.tg.Add()
@@ -951,10 +1263,17 @@ func (vm *VolumeManager) Write(root types.Hash256, data *[rhp2.SectorSize]byte)
 		vm.mu.Unlock()
 		return nil
 	})
-	if err == nil {
-		vm.recorder.AddWrite()
+	if err != nil {
+		return nil, err
 	}
-	return release, err
+	vm.recorder.AddWrite()
+
+	if atomic.LoadUint64(&vm.replicationFactor) > 1 {
+		// the sector's replicas are written in the background so they do
+		// not add latency to the write
+		vm.queueReplication(root)
+	}
+	return release, nil
 }
 
 // AddTemporarySectors adds sectors to the temporary store. The sectors are not
@@ -973,6 +1292,37 @@ func (vm *VolumeManager) AddTemporarySectors(sectors []TempSector) error {
 	return vm.vs.AddTemporarySectors(sectors)
 }
 
+// TempSectors returns the sectors in temporary storage ordered by expiration
+// height.
+func (vm *VolumeManager) TempSectors(limit, offset int) ([]TempStorageSector, error) {
+	return vm.vs.TempSectors(limit, offset)
+}
+
+// TempStorageSummary returns the number of sectors in temporary storage, the
+// space they use, and the number expiring at each height.
+func (vm *VolumeManager) TempStorageSummary() (TempStorageSummary, error) {
+	return vm.vs.TempStorageSummary()
+}
+
+// RemoveTempSectors immediately expires the temporary storage references of
+// the given sectors. If roots is empty, all temporary sectors are expired.
+// Sectors that are not referenced by a contract are removed. The number of
+// references removed is returned.
+func (vm *VolumeManager) RemoveTempSectors(roots []types.Hash256) (int, error) {
+	done, err := vm.tg.Add()
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+
+	removed, err := vm.vs.RemoveTempSectors(roots)
+	if err != nil {
+		return removed, err
+	}
+	vm.log.Info("removed temp sectors", zap.Int("roots", len(roots)), zap.Int("removed", removed))
+	return removed, nil
+}
+
 // ResizeCache resizes the cache to the given size.
 func (vm *VolumeManager) ResizeCache(size uint32) {
 	// Resize the underlying cache data structure
@@ -1007,6 +1357,10 @@ func NewVolumeManager(vs VolumeStore, a Alerts, cm ChainManager, log *zap.Logger
 	// resize the cache, prevents an error in lru.New when initializing the
 	// cache to 0
 	cache.Resize(int(sectorCacheSize))
+	readAhead, err := lru.New[types.Hash256, *[rhp2.SectorSize]byte](readAheadSectors)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize read-ahead buffer: %w", err)
+	}
 
 	vm := &VolumeManager{
 		vs:  vs,
@@ -1020,8 +1374,19 @@ func NewVolumeManager(vs VolumeStore, a Alerts, cm ChainManager, log *zap.Logger
 
 		volumes:        make(map[int64]*volume),
 		changedVolumes: make(map[int64]bool),
+		cacheVolumes:   make(map[int64]bool),
+		accesses:       make(map[types.Hash256]int),
+		promoting:      make(map[types.Hash256]bool),
 		cache:          cache,
+		readAhead:      readAhead,
+		prefetching:    make(map[types.Hash256]chan struct{}),
 		tg:             threadgroup.New(),
+
+		replicationFactor: 1,
+		replicateCh:       make(chan struct{}, 1),
+		pendingReplicas:   make(map[types.Hash256]bool),
+		pendingReplicaCh:  make(chan struct{}, 1),
+		rebalanceCh:       make(chan struct{}, 1),
 	}
 	if err := vm.loadVolumes(); err != nil {
 		return nil, err
@@ -1029,5 +1394,10 @@ func NewVolumeManager(vs VolumeStore, a Alerts, cm ChainManager, log *zap.Logger
 		return nil, fmt.Errorf("failed to subscribe to consensus set: %w", err)
 	}
 	go vm.recorder.Run(vm.tg.Done())
+	go vm.runScrubber()
+	go vm.runReplicator()
+	go vm.runCacheTier()
+	go vm.runRebalancer()
+	go vm.resumeEncryption()
 	return vm, nil
 }
@@ -2,16 +2,26 @@ package storage_test
 
 import (
 	"context"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	rhp2 "go.sia.tech/core/rhp/v2"
 	"go.sia.tech/core/types"
 	"go.sia.tech/hostd/alerts"
+	"go.sia.tech/hostd/host/contracts"
+	"go.sia.tech/hostd/host/settings"
 	"go.sia.tech/hostd/host/storage"
 	"go.sia.tech/hostd/internal/chain"
 	"go.sia.tech/hostd/persist/sqlite"
@@ -1699,3 +1709,1542 @@ func BenchmarkVolumeRemove(b *testing.B) {
 		b.Fatal(err)
 	}
 }
+
+func TestVolumeScrub(t *testing.T) {
+	const sectors = 10
+	dir := t.TempDir()
+
+	// create the database
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(dir, "hostd.db"), log.Named("sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	g, err := gateway.New(":0", false, filepath.Join(dir, "gateway"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	cs, errCh := consensus.New(g, false, filepath.Join(dir, "consensus"))
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatal(err)
+		}
+	default:
+	}
+	cm, err := chain.NewManager(cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Close()
+
+	// initialize the storage manager
+	webhookReporter, err := webhooks.NewManager(db, log.Named("webhooks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	am := alerts.NewManager(webhookReporter, log.Named("alerts"))
+	vm, err := storage.NewVolumeManager(db, am, cm, log.Named("volumes"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+
+	volumePath := filepath.Join(t.TempDir(), "hostdata.dat")
+	result := make(chan error, 1)
+	volume, err := vm.AddVolume(context.Background(), volumePath, sectors, result)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+
+	roots := make([]types.Hash256, 0, sectors)
+	for i := 0; i < sectors; i++ {
+		var sector [rhp2.SectorSize]byte
+		frand.Read(sector[:256])
+		root := rhp2.SectorRoot(&sector)
+		release, err := vm.Write(root, &sector)
+		if err != nil {
+			t.Fatal(err)
+		} else if err := vm.AddTemporarySectors([]storage.TempSector{{Root: root, Expiration: 1}}); err != nil {
+			t.Fatal(err)
+		} else if err := release(); err != nil {
+			t.Fatal(err)
+		}
+		roots = append(roots, root)
+	}
+	if err := vm.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	// corrupt one of the sectors on disk
+	corrupted := roots[frand.Intn(len(roots))]
+	loc, release, err := db.SectorLocation(corrupted)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := release(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(volumePath, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := f.WriteAt(frand.Bytes(64), int64(loc.Index*rhp2.SectorSize)); err != nil {
+		t.Fatal(err)
+	} else if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// scrub a full pass of the volume
+	vm.SetScrubRate(60000)
+	var status storage.ScrubStatus
+	for i := 0; i < 100; i++ {
+		status, err = vm.ScrubStatus(volume.ID, 100, 0)
+		if err != nil {
+			t.Fatal(err)
+		} else if status.Passes > 0 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	vm.SetScrubRate(0)
+
+	switch {
+	case status.Passes == 0:
+		t.Fatal("scrub pass did not complete")
+	case status.Corrupt != 1 || status.Missing != 0:
+		t.Fatalf("expected 1 corrupt sector, got %v corrupt and %v missing", status.Corrupt, status.Missing)
+	case len(status.Errors) != 1:
+		t.Fatalf("expected 1 scrub error, got %v", len(status.Errors))
+	case status.Errors[0].Root != corrupted || status.Errors[0].Index != loc.Index:
+		t.Fatalf("expected sector %v at index %v, got %v at index %v", corrupted, loc.Index, status.Errors[0].Root, status.Errors[0].Index)
+	case status.Errors[0].Type != storage.ScrubErrorCorrupt:
+		t.Fatalf("expected corrupt sector, got %v", status.Errors[0].Type)
+	}
+
+	// check that an alert was registered
+	var found bool
+	for _, a := range am.Active() {
+		if a.Message == "Scrubber found bad sectors" {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Fatal("expected scrub alert")
+	}
+}
+
+func TestSectorReplication(t *testing.T) {
+	const sectors = 5
+	dir := t.TempDir()
+
+	// create the database
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(dir, "hostd.db"), log.Named("sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	g, err := gateway.New(":0", false, filepath.Join(dir, "gateway"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	cs, errCh := consensus.New(g, false, filepath.Join(dir, "consensus"))
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatal(err)
+		}
+	default:
+	}
+	cm, err := chain.NewManager(cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Close()
+
+	// initialize the storage manager
+	webhookReporter, err := webhooks.NewManager(db, log.Named("webhooks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	am := alerts.NewManager(webhookReporter, log.Named("alerts"))
+	vm, err := storage.NewVolumeManager(db, am, cm, log.Named("volumes"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+
+	volumePaths := make(map[int64]string)
+	for i := 0; i < 2; i++ {
+		path := filepath.Join(t.TempDir(), "hostdata.dat")
+		result := make(chan error, 1)
+		volume, err := vm.AddVolume(context.Background(), path, sectors*2, result)
+		if err != nil {
+			t.Fatal(err)
+		} else if err := <-result; err != nil {
+			t.Fatal(err)
+		}
+		volumePaths[volume.ID] = path
+	}
+
+	writeSector := func() types.Hash256 {
+		t.Helper()
+		var sector [rhp2.SectorSize]byte
+		frand.Read(sector[:256])
+		root := rhp2.SectorRoot(&sector)
+		release, err := vm.Write(root, &sector)
+		if err != nil {
+			t.Fatal(err)
+		} else if err := vm.AddTemporarySectors([]storage.TempSector{{Root: root, Expiration: 1}}); err != nil {
+			t.Fatal(err)
+		} else if err := release(); err != nil {
+			t.Fatal(err)
+		}
+		return root
+	}
+
+	checkUsage := func(expected uint64) {
+		t.Helper()
+		used, _, err := vm.Usage()
+		if err != nil {
+			t.Fatal(err)
+		} else if used != expected {
+			t.Fatalf("expected %v used sectors, got %v", expected, used)
+		}
+	}
+
+	// write sectors without mirroring
+	roots := make([]types.Hash256, 0, sectors)
+	for i := 0; i < sectors-1; i++ {
+		roots = append(roots, writeSector())
+	}
+	checkUsage(sectors - 1)
+
+	// enable mirroring and wait for the existing sectors to be replicated
+	vm.SetReplicationFactor(2)
+	for i := 0; i < 100; i++ {
+		under, err := db.UnderReplicatedSectors(types.Hash256{}, 2, 100)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(under) == 0 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	checkUsage(2 * (sectors - 1))
+
+	// new sectors should be replicated in the background after they are
+	// written
+	roots = append(roots, writeSector())
+	for i := 0; i < 100; i++ {
+		if replicas, err := db.SectorReplicas(roots[len(roots)-1]); err != nil {
+			t.Fatal(err)
+		} else if len(replicas) == 1 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	checkUsage(2 * sectors)
+	if err := vm.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	// check that each replica is in a different volume than the primary
+	for _, root := range roots {
+		loc, release, err := db.SectorLocation(root)
+		if err != nil {
+			t.Fatal(err)
+		} else if err := release(); err != nil {
+			t.Fatal(err)
+		}
+		replicas, err := db.SectorReplicas(root)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(replicas) != 1 {
+			t.Fatalf("expected 1 replica, got %v", len(replicas))
+		} else if replicas[0].Volume == loc.Volume {
+			t.Fatal("replica stored in the same volume as the primary")
+		}
+	}
+
+	// truncate the primary volume of a sector, reads should fall back to the
+	// replica
+	loc, release, err := db.SectorLocation(roots[0])
+	if err != nil {
+		t.Fatal(err)
+	} else if err := release(); err != nil {
+		t.Fatal(err)
+	} else if err := os.Truncate(volumePaths[loc.Volume], 0); err != nil {
+		t.Fatal(err)
+	}
+	sector, err := vm.Read(roots[0])
+	if err != nil {
+		t.Fatal(err)
+	} else if rhp2.SectorRoot(sector) != roots[0] {
+		t.Fatal("sector read from replica has wrong root")
+	}
+
+	// removing a sector should remove its replicas
+	if err := vm.RemoveSector(roots[1]); err != nil {
+		t.Fatal(err)
+	} else if replicas, err := db.SectorReplicas(roots[1]); err != nil {
+		t.Fatal(err)
+	} else if len(replicas) != 0 {
+		t.Fatalf("expected no replicas, got %v", len(replicas))
+	}
+	checkUsage(2 * (sectors - 1))
+}
+
+func TestCacheTier(t *testing.T) {
+	const sectors = 4
+	dir := t.TempDir()
+
+	// create the database
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(dir, "hostd.db"), log.Named("sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	g, err := gateway.New(":0", false, filepath.Join(dir, "gateway"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	cs, errCh := consensus.New(g, false, filepath.Join(dir, "consensus"))
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatal(err)
+		}
+	default:
+	}
+	cm, err := chain.NewManager(cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Close()
+
+	// initialize the storage manager
+	webhookReporter, err := webhooks.NewManager(db, log.Named("webhooks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	am := alerts.NewManager(webhookReporter, log.Named("alerts"))
+	// disable the memory cache so every read hits the disk
+	vm, err := storage.NewVolumeManager(db, am, cm, log.Named("volumes"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+
+	result := make(chan error, 1)
+	if _, err := vm.AddVolume(context.Background(), filepath.Join(t.TempDir(), "hostdata.dat"), sectors, result); err != nil {
+		t.Fatal(err)
+	} else if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+	cacheVolume, err := vm.AddCacheVolume(context.Background(), filepath.Join(t.TempDir(), "cache.dat"), 2, result)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := <-result; err != nil {
+		t.Fatal(err)
+	} else if !cacheVolume.CacheTier {
+		t.Fatal("expected cache tier volume")
+	}
+
+	// the cache tier should not add capacity
+	if _, total, err := vm.Usage(); err != nil {
+		t.Fatal(err)
+	} else if total != sectors {
+		t.Fatalf("expected %v total sectors, got %v", sectors, total)
+	}
+
+	roots := make([]types.Hash256, 0, 3)
+	for i := 0; i < 3; i++ {
+		var sector [rhp2.SectorSize]byte
+		frand.Read(sector[:256])
+		root := rhp2.SectorRoot(&sector)
+		release, err := vm.Write(root, &sector)
+		if err != nil {
+			t.Fatal(err)
+		} else if err := vm.AddTemporarySectors([]storage.TempSector{{Root: root, Expiration: 1}}); err != nil {
+			t.Fatal(err)
+		} else if err := release(); err != nil {
+			t.Fatal(err)
+		}
+
+		// sectors should never be stored in the cache tier
+		loc, release, err := db.SectorLocation(root)
+		if err != nil {
+			t.Fatal(err)
+		} else if err := release(); err != nil {
+			t.Fatal(err)
+		} else if loc.Volume == cacheVolume.ID {
+			t.Fatal("sector stored in cache tier volume")
+		}
+		roots = append(roots, root)
+	}
+
+	readSector := func(root types.Hash256) {
+		t.Helper()
+		sector, err := vm.Read(root)
+		if err != nil {
+			t.Fatal(err)
+		} else if rhp2.SectorRoot(sector) != root {
+			t.Fatal("sector has wrong root")
+		}
+	}
+
+	waitForCacheUsage := func(expected uint64) {
+		t.Helper()
+		var used uint64
+		for i := 0; i < 100; i++ {
+			vol, err := db.Volume(cacheVolume.ID)
+			if err != nil {
+				t.Fatal(err)
+			} else if used = vol.UsedSectors; used == expected {
+				return
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		t.Fatalf("expected %v cached sectors, got %v", expected, used)
+	}
+
+	// reading a sector repeatedly should promote it to the cache tier
+	readSector(roots[0])
+	readSector(roots[0])
+	waitForCacheUsage(1)
+
+	before := vm.TierStats()
+	readSector(roots[0])
+	if after := vm.TierStats(); after.Disk.Hits != before.Disk.Hits+1 {
+		t.Fatalf("expected %v cache tier hits, got %v", before.Disk.Hits+1, after.Disk.Hits)
+	}
+
+	// promoting more sectors than the cache tier can hold should evict the
+	// least recently read sector
+	for _, root := range roots[1:] {
+		readSector(root)
+		readSector(root)
+	}
+	for i := 0; i < 100; i++ {
+		if _, err := db.CachedSectorLocation(roots[2]); err == nil {
+			break
+		} else if !errors.Is(err, storage.ErrSectorNotFound) {
+			t.Fatal(err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	waitForCacheUsage(2)
+
+	// sectors that are no longer read should be evicted
+	waitForCacheUsage(0)
+	before = vm.TierStats()
+	readSector(roots[2])
+	if after := vm.TierStats(); after.Disk.Misses != before.Disk.Misses+1 {
+		t.Fatalf("expected %v cache tier misses, got %v", before.Disk.Misses+1, after.Disk.Misses)
+	}
+}
+
+func TestPlacementPolicy(t *testing.T) {
+	const sectors = 4
+	dir := t.TempDir()
+
+	// create the database
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(dir, "hostd.db"), log.Named("sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	g, err := gateway.New(":0", false, filepath.Join(dir, "gateway"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	cs, errCh := consensus.New(g, false, filepath.Join(dir, "consensus"))
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatal(err)
+		}
+	default:
+	}
+	cm, err := chain.NewManager(cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Close()
+
+	// initialize the storage manager
+	webhookReporter, err := webhooks.NewManager(db, log.Named("webhooks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	am := alerts.NewManager(webhookReporter, log.Named("alerts"))
+	vm, err := storage.NewVolumeManager(db, am, cm, log.Named("volumes"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+
+	var volumes []storage.Volume
+	for i := 0; i < 2; i++ {
+		result := make(chan error, 1)
+		vol, err := vm.AddVolume(context.Background(), filepath.Join(t.TempDir(), "hostdata.dat"), sectors, result)
+		if err != nil {
+			t.Fatal(err)
+		} else if err := <-result; err != nil {
+			t.Fatal(err)
+		}
+		volumes = append(volumes, vol)
+	}
+
+	setPolicy := func(policy string) {
+		t.Helper()
+		s := settings.DefaultSettings
+		s.PlacementPolicy = policy
+		if err := db.UpdateSettings(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// writeSector writes a sector and returns the ID of the volume it was
+	// stored in
+	writeSector := func() int64 {
+		t.Helper()
+		var sector [rhp2.SectorSize]byte
+		frand.Read(sector[:256])
+		root := rhp2.SectorRoot(&sector)
+		release, err := vm.Write(root, &sector)
+		if err != nil {
+			t.Fatal(err)
+		} else if err := vm.AddTemporarySectors([]storage.TempSector{{Root: root, Expiration: 1}}); err != nil {
+			t.Fatal(err)
+		} else if err := release(); err != nil {
+			t.Fatal(err)
+		}
+		loc, release, err := db.SectorLocation(root)
+		if err != nil {
+			t.Fatal(err)
+		} else if err := release(); err != nil {
+			t.Fatal(err)
+		}
+		return loc.Volume
+	}
+
+	// fill in order should write to the first volume until it is full
+	setPolicy(storage.PlacementFillInOrder)
+	for i := 0; i < sectors; i++ {
+		if id := writeSector(); id != volumes[0].ID {
+			t.Fatalf("expected sector %v in volume %v, got %v", i, volumes[0].ID, id)
+		}
+	}
+	if id := writeSector(); id != volumes[1].ID {
+		t.Fatalf("expected sector in volume %v, got %v", volumes[1].ID, id)
+	}
+
+	// priority should only write to volumes with a non-zero priority
+	setPolicy(storage.PlacementPriority)
+	if err := vm.SetPriority(volumes[0].ID, 0); err != nil {
+		t.Fatal(err)
+	} else if err := vm.SetPriority(volumes[1].ID, 5); err != nil {
+		t.Fatal(err)
+	} else if vol, err := vm.Volume(volumes[1].ID); err != nil {
+		t.Fatal(err)
+	} else if vol.Priority != 5 {
+		t.Fatalf("expected priority 5, got %v", vol.Priority)
+	}
+	if id := writeSector(); id != volumes[1].ID {
+		t.Fatalf("expected sector in volume %v, got %v", volumes[1].ID, id)
+	}
+
+	// unknown policies should be rejected
+	if err := storage.ValidatePlacementPolicy("random"); err == nil {
+		t.Fatal("expected unknown placement policy to be rejected")
+	}
+}
+
+func TestVolumeRebalance(t *testing.T) {
+	const sectors = 8
+	dir := t.TempDir()
+
+	// create the database
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(dir, "hostd.db"), log.Named("sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	g, err := gateway.New(":0", false, filepath.Join(dir, "gateway"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	cs, errCh := consensus.New(g, false, filepath.Join(dir, "consensus"))
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatal(err)
+		}
+	default:
+	}
+	cm, err := chain.NewManager(cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Close()
+
+	// initialize the storage manager
+	webhookReporter, err := webhooks.NewManager(db, log.Named("webhooks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	am := alerts.NewManager(webhookReporter, log.Named("alerts"))
+	vm, err := storage.NewVolumeManager(db, am, cm, log.Named("volumes"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+
+	result := make(chan error, 1)
+	vol1, err := vm.AddVolume(context.Background(), filepath.Join(t.TempDir(), "vol1.dat"), sectors, result)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+
+	roots := make([]types.Hash256, 0, 6)
+	for i := 0; i < 6; i++ {
+		var sector [rhp2.SectorSize]byte
+		frand.Read(sector[:256])
+		root := rhp2.SectorRoot(&sector)
+		release, err := vm.Write(root, &sector)
+		if err != nil {
+			t.Fatal(err)
+		} else if err := vm.AddTemporarySectors([]storage.TempSector{{Root: root, Expiration: 1}}); err != nil {
+			t.Fatal(err)
+		} else if err := release(); err != nil {
+			t.Fatal(err)
+		}
+		roots = append(roots, root)
+	}
+	if err := vm.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	// adding a volume should move half of the sectors to it
+	vol2, err := vm.AddVolume(context.Background(), filepath.Join(t.TempDir(), "vol2.dat"), sectors, result)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+
+	var used1, used2 uint64
+	for i := 0; i < 100; i++ {
+		v1, err := vm.Volume(vol1.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v2, err := vm.Volume(vol2.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		used1, used2 = v1.UsedSectors, v2.UsedSectors
+		if used1 == 3 && used2 == 3 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if used1 != 3 || used2 != 3 {
+		t.Fatalf("expected 3 sectors in each volume, got %v and %v", used1, used2)
+	}
+
+	// all sectors should still be readable
+	for _, root := range roots {
+		sector, err := vm.Read(root)
+		if err != nil {
+			t.Fatal(err)
+		} else if rhp2.SectorRoot(sector) != root {
+			t.Fatal("sector has wrong root")
+		}
+	}
+}
+
+func TestVolumeExportImport(t *testing.T) {
+	const sectors = 8
+	dir := t.TempDir()
+	log := zaptest.NewLogger(t)
+
+	g, err := gateway.New(":0", false, filepath.Join(dir, "gateway"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	cs, errCh := consensus.New(g, false, filepath.Join(dir, "consensus"))
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatal(err)
+		}
+	default:
+	}
+	cm, err := chain.NewManager(cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Close()
+
+	// newHost initializes a volume manager with a single volume
+	newHost := func(name string) (*storage.VolumeManager, *sqlite.Store) {
+		db, err := sqlite.OpenDatabase(filepath.Join(dir, name+".db"), log.Named(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		webhookReporter, err := webhooks.NewManager(db, log.Named("webhooks"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		am := alerts.NewManager(webhookReporter, log.Named("alerts"))
+		vm, err := storage.NewVolumeManager(db, am, cm, log.Named(name), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { vm.Close() })
+
+		result := make(chan error, 1)
+		if _, err := vm.AddVolume(context.Background(), filepath.Join(dir, name+".dat"), sectors, result); err != nil {
+			t.Fatal(err)
+		} else if err := <-result; err != nil {
+			t.Fatal(err)
+		}
+		return vm, db
+	}
+
+	src, srcDB := newHost("src")
+	dst, dstDB := newHost("dst")
+	volumes, err := src.Volumes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srcVolume := volumes[0]
+
+	// write sectors to the source host, only the first half are referenced
+	var roots []types.Hash256
+	for i := 0; i < sectors; i++ {
+		var sector [rhp2.SectorSize]byte
+		frand.Read(sector[:256])
+		root := rhp2.SectorRoot(&sector)
+		release, err := src.Write(root, &sector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i < sectors/2 {
+			if err := src.AddTemporarySectors([]storage.TempSector{{Root: root, Expiration: 100}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := release(); err != nil {
+			t.Fatal(err)
+		}
+		roots = append(roots, root)
+	}
+
+	newContract := func(hostKey types.PublicKey, filesize uint64) contracts.SignedRevision {
+		uc := types.UnlockConditions{
+			PublicKeys: []types.UnlockKey{
+				types.GeneratePrivateKey().PublicKey().UnlockKey(),
+				hostKey.UnlockKey(),
+			},
+			SignaturesRequired: 2,
+		}
+		return contracts.SignedRevision{
+			Revision: types.FileContractRevision{
+				ParentID:         frand.Entropy256(),
+				UnlockConditions: uc,
+				FileContract: types.FileContract{
+					UnlockHash:     types.Hash256(uc.UnlockHash()),
+					RevisionNumber: 1,
+					Filesize:       filesize,
+					WindowStart:    100,
+					WindowEnd:      200,
+				},
+			},
+		}
+	}
+
+	// add a contract formed with the destination host's key referencing two
+	// of the temp sectors and a contract formed with a different key
+	// referencing another
+	contract := newContract(dstDB.HostKey().PublicKey(), 2*rhp2.SectorSize)
+	foreign := newContract(types.GeneratePrivateKey().PublicKey(), rhp2.SectorSize)
+	if err := srcDB.AddContract(contract, nil, types.Siacoins(1), contracts.Usage{}, 0); err != nil {
+		t.Fatal(err)
+	} else if err := srcDB.ReviseContract(contract, nil, contracts.Usage{}, []contracts.SectorChange{
+		{Action: contracts.SectorActionAppend, Root: roots[1]},
+		{Action: contracts.SectorActionAppend, Root: roots[2]},
+	}); err != nil {
+		t.Fatal(err)
+	} else if err := srcDB.AddContract(foreign, nil, types.Siacoins(1), contracts.Usage{}, 0); err != nil {
+		t.Fatal(err)
+	} else if err := srcDB.ReviseContract(foreign, nil, contracts.Usage{}, []contracts.SectorChange{
+		{Action: contracts.SectorActionAppend, Root: roots[3]},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	exportDir := filepath.Join(dir, "export")
+	result := make(chan error, 1)
+	if err := src.ExportVolume(context.Background(), srcVolume.ID, exportDir, result); err != nil {
+		t.Fatal(err)
+	} else if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+
+	// exporting to the same directory should fail without overwriting the
+	// existing export
+	if err := src.ExportVolume(context.Background(), srcVolume.ID, exportDir, result); err != nil {
+		t.Fatal(err)
+	} else if err := <-result; err == nil {
+		t.Fatal("expected export to existing directory to fail")
+	}
+
+	// corrupt the first exported sector
+	dataPath := filepath.Join(exportDir, storage.ExportDataFile)
+	f, err := os.OpenFile(dataPath, os.O_RDWR, 0600)
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := f.WriteAt(frand.Bytes(64), 0); err != nil {
+		t.Fatal(err)
+	} else if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dst.ImportVolume(context.Background(), exportDir, result); err != nil {
+		t.Fatal(err)
+	} else if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+
+	// the corrupt and unreferenced sectors should not be imported
+	for i, root := range roots {
+		_, err := dst.Read(root)
+		switch {
+		case i == 0 || i >= sectors/2:
+			if !errors.Is(err, storage.ErrSectorNotFound) {
+				t.Fatalf("expected sector %v to not be imported, got %v", i, err)
+			}
+		case err != nil:
+			t.Fatalf("failed to read imported sector %v: %v", i, err)
+		default:
+			refs, err := dst.SectorReferences(root)
+			if err != nil {
+				t.Fatal(err)
+			} else if refs.TempStorage != 1 {
+				t.Fatalf("expected sector %v to be in temp storage, got %v", i, refs.TempStorage)
+			}
+
+			expectedContracts := 0
+			if i == 1 || i == 2 {
+				expectedContracts = 1
+			}
+			if len(refs.Contracts) != expectedContracts {
+				t.Fatalf("expected sector %v to have %v contract references, got %v", i, expectedContracts, len(refs.Contracts))
+			}
+		}
+	}
+
+	// the contract and its roots should have been added to the fresh
+	// database
+	if c, err := dstDB.Contract(contract.Revision.ParentID); err != nil {
+		t.Fatal(err)
+	} else if c.Revision.Filesize != contract.Revision.Filesize {
+		t.Fatalf("expected filesize %v, got %v", contract.Revision.Filesize, c.Revision.Filesize)
+	} else if !c.LockedCollateral.Equals(types.Siacoins(1)) {
+		t.Fatalf("expected locked collateral %v, got %v", types.Siacoins(1), c.LockedCollateral)
+	} else if contractRoots, err := dstDB.SectorRoots(contract.Revision.ParentID); err != nil {
+		t.Fatal(err)
+	} else if len(contractRoots) != 2 || contractRoots[0] != roots[1] || contractRoots[1] != roots[2] {
+		t.Fatalf("unexpected contract roots %v", contractRoots)
+	}
+
+	// the contract formed with a different host key should not be added
+	if _, err := dstDB.Contract(foreign.Revision.ParentID); !errors.Is(err, contracts.ErrNotFound) {
+		t.Fatalf("expected foreign contract to not be imported, got %v", err)
+	}
+
+	if used, _, err := dst.Usage(); err != nil {
+		t.Fatal(err)
+	} else if used != sectors/2-1 {
+		t.Fatalf("expected %v used sectors, got %v", sectors/2-1, used)
+	}
+}
+
+func TestVolumeEncryption(t *testing.T) {
+	const sectors = 8
+	dir := t.TempDir()
+
+	// create the database
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(dir, "hostd.db"), log.Named("sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	g, err := gateway.New(":0", false, filepath.Join(dir, "gateway"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	cs, errCh := consensus.New(g, false, filepath.Join(dir, "consensus"))
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatal(err)
+		}
+	default:
+	}
+	cm, err := chain.NewManager(cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Close()
+
+	// initialize the storage manager
+	webhookReporter, err := webhooks.NewManager(db, log.Named("webhooks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	am := alerts.NewManager(webhookReporter, log.Named("alerts"))
+	vm, err := storage.NewVolumeManager(db, am, cm, log.Named("volumes"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+
+	result := make(chan error, 1)
+	plainPath := filepath.Join(dir, "plain.dat")
+	plain, err := vm.AddVolume(context.Background(), plainPath, sectors, result)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+
+	roots := make(map[types.Hash256]bool)
+	writeSectors := func(n int) {
+		for i := 0; i < n; i++ {
+			var sector [rhp2.SectorSize]byte
+			frand.Read(sector[:256])
+			root := rhp2.SectorRoot(&sector)
+			release, err := vm.Write(root, &sector)
+			if err != nil {
+				t.Fatal(err)
+			} else if err := vm.AddTemporarySectors([]storage.TempSector{{Root: root, Expiration: 100}}); err != nil {
+				t.Fatal(err)
+			} else if err := release(); err != nil {
+				t.Fatal(err)
+			}
+			roots[root] = true
+		}
+	}
+
+	checkSectors := func(vm *storage.VolumeManager) {
+		t.Helper()
+		for root := range roots {
+			sector, err := vm.Read(root)
+			if err != nil {
+				t.Fatal(err)
+			} else if rhp2.SectorRoot(sector) != root {
+				t.Fatalf("sector %v data mismatch", root)
+			}
+		}
+	}
+
+	// checkEncrypted checks that no plaintext sectors are stored in the
+	// volume file
+	checkEncrypted := func(path string) {
+		t.Helper()
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		var buf [rhp2.SectorSize]byte
+		for i := 0; i < sectors; i++ {
+			if _, err := f.ReadAt(buf[:], int64(i)*rhp2.SectorSize); err != nil {
+				t.Fatal(err)
+			} else if roots[rhp2.SectorRoot(&buf)] {
+				t.Fatalf("sector at index %v of %v is not encrypted", i, path)
+			}
+		}
+	}
+
+	waitEncrypted := func(vm *storage.VolumeManager, id int64) {
+		t.Helper()
+		for i := 0; i < 100; i++ {
+			vol, err := vm.Volume(id)
+			if err != nil {
+				t.Fatal(err)
+			} else if vol.Encrypted && vol.EncryptionCursor == nil && vol.Status == storage.VolumeStatusReady {
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		t.Fatalf("volume %v was not encrypted", id)
+	}
+
+	// encrypt the existing volume in place
+	writeSectors(sectors / 2)
+	if err := vm.EncryptVolume(context.Background(), plain.ID, result); err != nil {
+		t.Fatal(err)
+	} else if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+	waitEncrypted(vm, plain.ID)
+	checkEncrypted(plainPath)
+	checkSectors(vm)
+
+	if err := vm.EncryptVolume(context.Background(), plain.ID, result); err == nil {
+		t.Fatal("expected encrypting an encrypted volume to fail")
+	}
+
+	// sectors written after the migration should also be encrypted
+	writeSectors(sectors / 2)
+	checkEncrypted(plainPath)
+	checkSectors(vm)
+
+	// new volumes should be encrypted when the setting is enabled
+	vm.SetEncryptVolumes(true)
+	encryptedPath := filepath.Join(dir, "encrypted.dat")
+	encrypted, err := vm.AddVolume(context.Background(), encryptedPath, sectors, result)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := <-result; err != nil {
+		t.Fatal(err)
+	} else if !encrypted.Encrypted {
+		t.Fatal("expected new volume to be encrypted")
+	} else if err := vm.SetReadOnly(plain.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	writeSectors(sectors / 2)
+	checkEncrypted(encryptedPath)
+	checkSectors(vm)
+
+	// rewind the encryption cursor to simulate a crash during the migration.
+	// The migration should resume without encrypting sectors twice.
+	if err := db.SetVolumeEncryptionCursor(plain.ID, 0); err != nil {
+		t.Fatal(err)
+	} else if err := vm.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	vm, err = storage.NewVolumeManager(db, am, cm, log.Named("volumes"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+
+	waitEncrypted(vm, plain.ID)
+	checkEncrypted(plainPath)
+	checkEncrypted(encryptedPath)
+	checkSectors(vm)
+}
+
+// fakeS3 is a minimal in-memory stand-in for an S3-compatible service such as
+// MinIO. It only supports path-style requests to a single bucket.
+type fakeS3 struct {
+	bucket string
+
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) keys(prefix string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var keys []string
+	for k := range f.objects {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	bucket, key, _ := strings.Cut(path, "/")
+	if bucket != f.bucket {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `<Error><Code>NoSuchBucket</Code></Error>`)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodHead && key == "":
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodGet && key == "":
+		type object struct {
+			Key  string
+			Size int
+		}
+		var resp struct {
+			XMLName     xml.Name `xml:"ListBucketResult"`
+			Name        string
+			KeyCount    int
+			IsTruncated bool
+			Contents    []object
+		}
+		q := r.URL.Query()
+		maxKeys, err := strconv.Atoi(q.Get("max-keys"))
+		if err != nil {
+			maxKeys = 1000
+		}
+		var keys []string
+		for k := range f.objects {
+			if strings.HasPrefix(k, q.Get("prefix")) && k > q.Get("start-after") {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		if len(keys) > maxKeys {
+			keys = keys[:maxKeys]
+		}
+		resp.Name = f.bucket
+		resp.KeyCount = len(keys)
+		for _, k := range keys {
+			resp.Contents = append(resp.Contents, object{Key: k, Size: len(f.objects[k])})
+		}
+		xml.NewEncoder(w).Encode(resp)
+	case r.Method == http.MethodPost && r.URL.Query().Has("delete"):
+		var req struct {
+			Object []struct {
+				Key string
+			}
+		}
+		if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, obj := range req.Object {
+			delete(f.objects, obj.Key)
+		}
+		fmt.Fprint(w, `<DeleteResult></DeleteResult>`)
+	case r.Method == http.MethodPut:
+		buf, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		f.objects[key] = buf
+	case r.Method == http.MethodGet:
+		obj, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<Error><Code>NoSuchKey</Code></Error>`)
+			return
+		}
+		var start, end int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err != nil || end >= len(obj) || start > end {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(obj[start : end+1])
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestS3Volume(t *testing.T) {
+	const sectors = 16
+	dir := t.TempDir()
+
+	fake := &fakeS3{bucket: "hostd", objects: make(map[string][]byte)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	cfg := storage.S3Config{
+		Endpoint:        srv.URL,
+		Bucket:          "hostd",
+		Prefix:          "volume",
+		AccessKeyID:     "minioadmin",
+		SecretAccessKey: "minioadmin",
+	}
+
+	// create the database
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(dir, "hostd.db"), log.Named("sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	g, err := gateway.New(":0", false, filepath.Join(dir, "gateway"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	cs, errCh := consensus.New(g, false, filepath.Join(dir, "consensus"))
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatal(err)
+		}
+	default:
+	}
+	cm, err := chain.NewManager(cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Close()
+
+	// initialize the storage manager
+	webhookReporter, err := webhooks.NewManager(db, log.Named("webhooks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	am := alerts.NewManager(webhookReporter, log.Named("alerts"))
+	vm, err := storage.NewVolumeManager(db, am, cm, log.Named("volumes"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+
+	result := make(chan error, 1)
+	vol, err := vm.AddS3Volume(context.Background(), cfg, sectors, result)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := <-result; err != nil {
+		t.Fatal(err)
+	} else if vol.S3 == nil || vol.S3.SecretAccessKey != "" {
+		t.Fatal("expected volume s3 config without credentials")
+	} else if len(fake.keys("")) != 0 {
+		t.Fatal("expected growing the volume to not create objects")
+	}
+
+	roots := make([]types.Hash256, 0, sectors/4)
+	for i := 0; i < sectors/4; i++ {
+		var sector [rhp2.SectorSize]byte
+		frand.Read(sector[:256])
+		root := rhp2.SectorRoot(&sector)
+		release, err := vm.Write(root, &sector)
+		if err != nil {
+			t.Fatal(err)
+		} else if err := vm.AddTemporarySectors([]storage.TempSector{{Root: root, Expiration: 100}}); err != nil {
+			t.Fatal(err)
+		} else if err := release(); err != nil {
+			t.Fatal(err)
+		}
+		roots = append(roots, root)
+	}
+
+	checkSectors := func(vm *storage.VolumeManager) {
+		t.Helper()
+		for _, root := range roots {
+			sector, err := vm.Read(root)
+			if err != nil {
+				t.Fatal(err)
+			} else if rhp2.SectorRoot(sector) != root {
+				t.Fatalf("sector %v data mismatch", root)
+			}
+		}
+	}
+
+	checkSectors(vm)
+	if n := len(fake.keys("volume/")); n != len(roots) {
+		t.Fatalf("expected %v objects, got %v", len(roots), n)
+	}
+
+	// a second volume cannot use the same prefix
+	if _, err := vm.AddS3Volume(context.Background(), cfg, sectors, result); err == nil {
+		t.Fatal("expected adding a volume with a used prefix to fail")
+	}
+
+	// shrink the volume, sectors should be moved to the front of the volume
+	// and the remaining objects removed
+	if err := vm.ResizeVolume(context.Background(), vol.ID, uint64(len(roots)), result); err != nil {
+		t.Fatal(err)
+	} else if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+	checkSectors(vm)
+	for _, key := range fake.keys("volume/") {
+		index, err := strconv.ParseUint(strings.TrimPrefix(key, "volume/"), 16, 64)
+		if err != nil {
+			t.Fatal(err)
+		} else if index >= uint64(len(roots)) {
+			t.Fatalf("expected object %q to be removed", key)
+		}
+	}
+
+	// reload the volume manager
+	if err := vm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	vm, err = storage.NewVolumeManager(db, am, cm, log.Named("volumes"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	checkSectors(vm)
+
+	// remove the volume, the sectors should be migrated to a local volume
+	// and the objects deleted
+	if _, err := vm.AddVolume(context.Background(), filepath.Join(dir, "local.dat"), sectors, result); err != nil {
+		t.Fatal(err)
+	} else if err := <-result; err != nil {
+		t.Fatal(err)
+	} else if err := vm.RemoveVolume(context.Background(), vol.ID, false, result); err != nil {
+		t.Fatal(err)
+	} else if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+	checkSectors(vm)
+	if n := len(fake.keys("volume/")); n != 0 {
+		t.Fatalf("expected all objects to be removed, got %v", n)
+	}
+}
+
+func TestVolumeDirectIO(t *testing.T) {
+	const sectors = 8
+	dir := t.TempDir()
+
+	// create the database
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(dir, "hostd.db"), log.Named("sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	g, err := gateway.New(":0", false, filepath.Join(dir, "gateway"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	cs, errCh := consensus.New(g, false, filepath.Join(dir, "consensus"))
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatal(err)
+		}
+	default:
+	}
+	cm, err := chain.NewManager(cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Close()
+
+	// initialize the storage manager
+	webhookReporter, err := webhooks.NewManager(db, log.Named("webhooks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	am := alerts.NewManager(webhookReporter, log.Named("alerts"))
+	vm, err := storage.NewVolumeManager(db, am, cm, log.Named("volumes"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+
+	if err := vm.SetDirectIO(true); err != nil {
+		t.Skip("direct I/O not supported:", err)
+	}
+
+	result := make(chan error, 1)
+	volumePath := filepath.Join(dir, "hostdata.dat")
+	if _, err := vm.AddVolume(context.Background(), volumePath, sectors, result); err != nil {
+		t.Fatal(err)
+	} else if err := <-result; err != nil {
+		t.Fatal(err)
+	} else if err := checkFileSize(volumePath, sectors*rhp2.SectorSize); err != nil {
+		t.Fatal(err)
+	}
+
+	var roots []types.Hash256
+	for i := 0; i < sectors; i++ {
+		var sector [rhp2.SectorSize]byte
+		frand.Read(sector[:256])
+		root := rhp2.SectorRoot(&sector)
+		release, err := vm.Write(root, &sector)
+		if err != nil {
+			t.Fatal(err)
+		} else if err := vm.AddTemporarySectors([]storage.TempSector{{Root: root, Expiration: 100}}); err != nil {
+			t.Fatal(err)
+		} else if err := release(); err != nil {
+			t.Fatal(err)
+		}
+		roots = append(roots, root)
+	}
+
+	checkSectors := func() {
+		t.Helper()
+		for _, root := range roots {
+			sector, err := vm.Read(root)
+			if err != nil {
+				t.Fatal(err)
+			} else if rhp2.SectorRoot(sector) != root {
+				t.Fatalf("sector %v data mismatch", root)
+			}
+		}
+	}
+
+	checkSectors()
+
+	// switching modes should reopen the volume
+	if err := vm.SetDirectIO(false); err != nil {
+		t.Fatal(err)
+	}
+	checkSectors()
+	if err := vm.SetDirectIO(true); err != nil {
+		t.Fatal(err)
+	}
+	checkSectors()
+
+	// prefetched sectors should be returned by Read
+	vm.Prefetch(roots...)
+	checkSectors()
+}
+
+func BenchmarkVolumeManagerSequentialRead(b *testing.B) {
+	const sectors = 64
+
+	benchmarkRead := func(b *testing.B, directIO, readAhead bool) {
+		dir := b.TempDir()
+
+		// create the database
+		log := zaptest.NewLogger(b)
+		db, err := sqlite.OpenDatabase(filepath.Join(dir, "hostd.db"), log.Named("sqlite"))
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer db.Close()
+
+		g, err := gateway.New(":0", false, filepath.Join(dir, "gateway"))
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer g.Close()
+
+		cs, errCh := consensus.New(g, false, filepath.Join(dir, "consensus"))
+		select {
+		case err := <-errCh:
+			b.Fatal(err)
+		default:
+		}
+		cm, err := chain.NewManager(cs)
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer cm.Close()
+
+		// initialize the storage manager
+		webhookReporter, err := webhooks.NewManager(db, log.Named("webhooks"))
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		am := alerts.NewManager(webhookReporter, log.Named("alerts"))
+		// disable the sector cache so every read goes to the volume
+		vm, err := storage.NewVolumeManager(db, am, cm, log.Named("volumes"), 0)
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer vm.Close()
+
+		if err := vm.SetDirectIO(directIO); err != nil {
+			b.Skip("direct I/O not supported:", err)
+		}
+
+		result := make(chan error, 1)
+		volumeFilePath := filepath.Join(b.TempDir(), "hostdata.dat")
+		_, err = vm.AddVolume(context.Background(), volumeFilePath, sectors, result)
+		if err != nil {
+			b.Fatal(err)
+		} else if err := <-result; err != nil {
+			b.Fatal(err)
+		}
+
+		roots := make([]types.Hash256, sectors)
+		for i := range roots {
+			var sector [rhp2.SectorSize]byte
+			frand.Read(sector[:256])
+			roots[i] = rhp2.SectorRoot(&sector)
+			release, err := vm.Write(roots[i], &sector)
+			if err != nil {
+				b.Fatal(err)
+			} else if err := vm.AddTemporarySectors([]storage.TempSector{{Root: roots[i], Expiration: 100}}); err != nil {
+				b.Fatal(err)
+			} else if err := release(); err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		b.ResetTimer()
+		b.ReportAllocs()
+		b.SetBytes(rhp2.SectorSize)
+
+		for i := 0; i < b.N; i++ {
+			if readAhead {
+				// read ahead the next sectors like a sequential RHP3
+				// program
+				next := make([]types.Hash256, 0, 4)
+				for j := 1; j <= 4; j++ {
+					next = append(next, roots[(i+j)%sectors])
+				}
+				vm.Prefetch(next...)
+			}
+			// build a proof like an RHP3 program would before the next
+			// read
+			sector, err := vm.Read(roots[i%sectors])
+			if err != nil {
+				b.Fatal(err)
+			}
+			rhp2.BuildProof(sector, 0, 1, nil)
+		}
+	}
+
+	b.Run("buffered", func(b *testing.B) { benchmarkRead(b, false, false) })
+	b.Run("direct", func(b *testing.B) { benchmarkRead(b, true, false) })
+	b.Run("direct read-ahead", func(b *testing.B) { benchmarkRead(b, true, true) })
+}
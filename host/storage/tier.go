@@ -0,0 +1,232 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	rhp2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+	"go.uber.org/zap"
+)
+
+type (
+	// CacheStats are the hit and miss counts of a cache tier.
+	CacheStats struct {
+		Hits   uint64 `json:"hits"`
+		Misses uint64 `json:"misses"`
+	}
+
+	// TierStats are the cache statistics of each storage tier. Memory is the
+	// in-memory sector cache, Disk is the cache tier volumes.
+	TierStats struct {
+		Memory CacheStats `json:"memory"`
+		Disk   CacheStats `json:"disk"`
+	}
+)
+
+// cacheTierEnabled returns true if any cache tier volumes have been added. A
+// lock must be held on the volume manager before this function is called.
+func (vm *VolumeManager) cacheTierEnabled() bool {
+	return len(vm.cacheVolumes) > 0
+}
+
+// readCacheTier reads a sector from the cache tier. If the sector is not
+// cached, or the cached copy cannot be read, false is returned.
+func (vm *VolumeManager) readCacheTier(root types.Hash256) (*[rhp2.SectorSize]byte, bool) {
+	vm.mu.Lock()
+	enabled := vm.cacheTierEnabled()
+	vm.mu.Unlock()
+	if !enabled {
+		return nil, false
+	}
+
+	loc, err := vm.vs.CachedSectorLocation(root)
+	if err != nil {
+		if !errors.Is(err, ErrSectorNotFound) {
+			vm.log.Debug("failed to locate cached sector", zap.Stringer("root", root), zap.Error(err))
+		}
+		atomic.AddUint64(&vm.tierMisses, 1)
+		return nil, false
+	}
+
+	vm.mu.Lock()
+	v, ok := vm.volumes[loc.Volume]
+	vm.mu.Unlock()
+	if !ok {
+		atomic.AddUint64(&vm.tierMisses, 1)
+		return nil, false
+	}
+
+	sector, err := v.ReadSector(loc.Index, root)
+	if err != nil {
+		// drop the cached copy, the sector will be read from cold storage
+		vm.log.Warn("failed to read cached sector", zap.Stringer("root", root), zap.Int64("volume", loc.Volume), zap.Uint64("index", loc.Index), zap.Error(err))
+		if err := vm.vs.RemoveCachedSector(root); err != nil {
+			vm.log.Error("failed to remove cached sector", zap.Stringer("root", root), zap.Error(err))
+		}
+		atomic.AddUint64(&vm.tierMisses, 1)
+		return nil, false
+	}
+	atomic.AddUint64(&vm.tierHits, 1)
+	return sector, true
+}
+
+// recordAccess increments the access count of a sector read from cold
+// storage. Once a sector has been read cachePromoteReads times, it is copied
+// to the cache tier in the background.
+func (vm *VolumeManager) recordAccess(root types.Hash256, sector *[rhp2.SectorSize]byte) {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	if !vm.cacheTierEnabled() || vm.promoting[root] {
+		return
+	} else if _, ok := vm.accesses[root]; !ok && len(vm.accesses) >= maxTrackedAccesses {
+		// too many sectors are being tracked, the counts will be pruned by
+		// the next decay
+		return
+	}
+
+	vm.accesses[root]++
+	if vm.accesses[root] < cachePromoteReads {
+		return
+	}
+	delete(vm.accesses, root)
+	vm.promoting[root] = true
+	go func() {
+		defer func() {
+			vm.mu.Lock()
+			delete(vm.promoting, root)
+			vm.mu.Unlock()
+		}()
+
+		if err := vm.promoteSector(root, sector); errors.Is(err, ErrNotEnoughStorage) {
+			vm.log.Debug("no cache tier space available", zap.Stringer("root", root))
+		} else if err != nil {
+			vm.log.Warn("failed to promote sector", zap.Stringer("root", root), zap.Error(err))
+		}
+	}()
+}
+
+// promoteSector copies a sector to the cache tier. The cache tier volume is
+// synced immediately so a cached copy is never served without its data.
+func (vm *VolumeManager) promoteSector(root types.Hash256, sector *[rhp2.SectorSize]byte) error {
+	done, err := vm.tg.Add()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	release, err := vm.vs.CacheSector(root, func(loc SectorLocation) error {
+		vm.mu.Lock()
+		vol, ok := vm.volumes[loc.Volume]
+		vm.mu.Unlock()
+		if !ok {
+			return fmt.Errorf("volume %v not found", loc.Volume)
+		} else if err := vol.WriteSector(sector, loc.Index); err != nil {
+			return fmt.Errorf("failed to write sector data: %w", err)
+		} else if err := vol.Sync(); err != nil {
+			return fmt.Errorf("failed to sync volume: %w", err)
+		}
+		vm.log.Debug("promoted sector", zap.Stringer("root", root), zap.Int64("volume", loc.Volume), zap.Uint64("index", loc.Index))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return release()
+}
+
+// decayAccesses halves the access count of each tracked sector so sectors
+// that stop being read are eventually forgotten.
+func (vm *VolumeManager) decayAccesses() {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	for root, n := range vm.accesses {
+		if n /= 2; n == 0 {
+			delete(vm.accesses, root)
+		} else {
+			vm.accesses[root] = n
+		}
+	}
+}
+
+// evictCachedSectors removes cached copies that have not been read within
+// cacheEvictAfter. The sectors remain in cold storage.
+func (vm *VolumeManager) evictCachedSectors(ctx context.Context, log *zap.Logger) error {
+	before := time.Now().Add(-cacheEvictAfter)
+	var evicted int
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := vm.vs.EvictCachedSectors(before, cacheEvictBatch)
+		if err != nil {
+			return fmt.Errorf("failed to evict cached sectors: %w", err)
+		}
+		evicted += n
+		if n < cacheEvictBatch {
+			break
+		}
+	}
+	if evicted > 0 {
+		log.Debug("evicted cached sectors", zap.Int("evicted", evicted))
+	}
+	return nil
+}
+
+// runCacheTier periodically decays sector access counts and evicts stale
+// sectors from the cache tier until the volume manager is closed.
+func (vm *VolumeManager) runCacheTier() {
+	ctx, cancel, err := vm.tg.AddContext(context.Background())
+	if err != nil {
+		return
+	}
+	defer cancel()
+
+	log := vm.log.Named("cacheTier")
+	decayTicker := time.NewTicker(cacheDecayInterval)
+	defer decayTicker.Stop()
+	evictTicker := time.NewTicker(cacheEvictInterval)
+	defer evictTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-decayTicker.C:
+			vm.decayAccesses()
+			continue
+		case <-evictTicker.C:
+		}
+
+		vm.mu.Lock()
+		enabled := vm.cacheTierEnabled()
+		vm.mu.Unlock()
+		if !enabled {
+			continue
+		}
+
+		if err := vm.evictCachedSectors(ctx, log); errors.Is(err, context.Canceled) {
+			return
+		} else if err != nil {
+			log.Error("failed to evict cached sectors", zap.Error(err))
+		}
+	}
+}
+
+// TierStats returns the hit and miss counts of the in-memory cache and the
+// cache tier volumes.
+func (vm *VolumeManager) TierStats() TierStats {
+	return TierStats{
+		Memory: CacheStats{
+			Hits:   atomic.LoadUint64(&vm.cacheHits),
+			Misses: atomic.LoadUint64(&vm.cacheMisses),
+		},
+		Disk: CacheStats{
+			Hits:   atomic.LoadUint64(&vm.tierHits),
+			Misses: atomic.LoadUint64(&vm.tierMisses),
+		},
+	}
+}
@@ -4,11 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os"
+	"math"
 	"sync"
 
 	rhp2 "go.sia.tech/core/rhp/v2"
 	"go.sia.tech/core/types"
+	"golang.org/x/crypto/xts"
 	"lukechampine.com/frand"
 )
 
@@ -34,6 +35,17 @@ type (
 		location string     // location is the path to the volume's file
 		data     volumeData // data is a flatfile that stores the volume's sector data
 		stats    VolumeStats
+
+		cipher *xts.Cipher // cipher is nil if the volume is not encrypted
+		// encryptedBelow is the index below which sectors are encrypted. It
+		// is only used while an existing volume is being encrypted,
+		// otherwise it is math.MaxUint64.
+		encryptedBelow uint64
+		// unverifiedBelow is the index below which sectors at or above
+		// encryptedBelow may have been encrypted before the encryption
+		// cursor was last persisted. Their roots are checked when they are
+		// read.
+		unverifiedBelow uint64
 	}
 
 	// VolumeStats contains statistics about a volume
@@ -54,6 +66,24 @@ type (
 		TotalSectors uint64 `json:"totalSectors"`
 		ReadOnly     bool   `json:"readOnly"`
 		Available    bool   `json:"available"`
+		// CacheTier is true if the volume only stores copies of frequently
+		// read sectors
+		CacheTier bool `json:"cacheTier"`
+		// Priority is the weight of the volume when using the priority
+		// placement policy
+		Priority uint64 `json:"priority"`
+		// Encrypted is true if the volume's sector data is encrypted at rest
+		Encrypted bool `json:"encrypted"`
+		// EncryptionCursor is the number of leading sectors that have been
+		// encrypted while an existing volume is being encrypted. It is nil
+		// once all sectors are encrypted.
+		EncryptionCursor *uint64 `json:"encryptionCursor,omitempty"`
+		// EncryptionSalt is combined with the host key to derive the
+		// volume's encryption key
+		EncryptionSalt types.Hash256 `json:"-"`
+		// S3 is the configuration of the bucket storing the volume's sector
+		// data. It is nil for volumes stored in a local file.
+		S3 *S3Config `json:"s3,omitempty"`
 	}
 
 	// VolumeMeta contains the metadata of a volume.
@@ -66,6 +96,16 @@ type (
 // ErrVolumeNotAvailable is returned when a volume is not available
 var ErrVolumeNotAvailable = errors.New("volume not available")
 
+// redacted returns a copy of the volume without its bucket credentials
+func (v Volume) redacted() Volume {
+	if v.S3 != nil {
+		cfg := *v.S3
+		cfg.SecretAccessKey = ""
+		v.S3 = &cfg
+	}
+	return v
+}
+
 func (v *volume) incrementReadStats(err error) {
 	v.mu.Lock()
 	defer v.mu.Unlock()
@@ -109,19 +149,46 @@ func (v *volume) alertID(context string) types.Hash256 {
 	return types.HashBytes([]byte(v.location + context))
 }
 
-// OpenVolume opens the volume at localPath
-func (v *volume) OpenVolume(localPath string, reload bool) error {
+// OpenVolume opens the volume at localPath. If directIO is true, the volume's
+// data bypasses the page cache. If reload is true, an open volume is reopened.
+func (v *volume) OpenVolume(localPath string, directIO, reload bool) error {
 	v.mu.Lock()
 	defer v.mu.Unlock()
 	if v.data != nil && !reload {
 		return nil
 	}
-	f, err := os.OpenFile(localPath, os.O_RDWR, 0700)
+	data, err := openVolumeFile(localPath, directIO)
 	if err != nil {
 		return err
 	}
+	if v.data != nil {
+		// sync and close the previous file before it is replaced
+		if err := v.data.Sync(); err != nil {
+			data.Close()
+			return fmt.Errorf("failed to sync volume: %w", err)
+		} else if err := v.data.Close(); err != nil {
+			data.Close()
+			return fmt.Errorf("failed to close volume: %w", err)
+		}
+	}
 	v.location = localPath
-	v.data = f
+	v.data = data
+	return nil
+}
+
+// OpenS3Volume opens a volume stored in an S3-compatible bucket
+func (v *volume) OpenS3Volume(cfg S3Config, reload bool) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.data != nil && !reload {
+		return nil
+	}
+	data, err := openS3Volume(cfg)
+	if err != nil {
+		return err
+	}
+	v.location = cfg.Location()
+	v.data = data
 	return nil
 }
 
@@ -141,7 +208,7 @@ func (v *volume) SetStatus(status string) error {
 		if v.stats.Status != VolumeStatusReady && v.stats.Status != VolumeStatusUnavailable {
 			return fmt.Errorf("volume is %v", v.stats.Status)
 		}
-	case VolumeStatusResizing:
+	case VolumeStatusResizing, VolumeStatusExporting, VolumeStatusEncrypting:
 		if v.stats.Status != VolumeStatusReady {
 			return fmt.Errorf("volume is %v", v.stats.Status)
 		}
@@ -159,8 +226,70 @@ func (v *volume) Status() string {
 	return v.stats.Status
 }
 
-// ReadSector reads the sector at index from the volume
-func (v *volume) ReadSector(index uint64) (*[rhp2.SectorSize]byte, error) {
+// SetEncryption sets the cipher used to encrypt the volume's sector data.
+// Sectors at or above encryptedBelow are not yet encrypted, except sectors
+// below unverifiedBelow, which may be in either state.
+func (v *volume) SetEncryption(cipher *xts.Cipher, encryptedBelow, unverifiedBelow uint64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.cipher = cipher
+	v.encryptedBelow = encryptedBelow
+	v.unverifiedBelow = unverifiedBelow
+}
+
+// encrypted returns true if the sector at index is encrypted. A lock must be
+// held on the volume before this function is called.
+func (v *volume) encrypted(index uint64) bool {
+	return v.cipher != nil && index < v.encryptedBelow
+}
+
+// EncryptSector encrypts the sector at index in place and advances the
+// volume's encryption cursor. If root is not nil, the sector is only
+// encrypted if its plaintext matches root so that a sector encrypted before
+// the cursor was last persisted is not encrypted twice.
+func (v *volume) EncryptSector(index uint64, root *types.Hash256) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.data == nil {
+		return ErrVolumeNotAvailable
+	} else if v.cipher == nil {
+		panic("volume cipher not set") // developer error
+	}
+
+	sector := new([rhp2.SectorSize]byte)
+	offset := int64(index * rhp2.SectorSize)
+	if _, err := v.data.ReadAt(sector[:], offset); err != nil {
+		return fmt.Errorf("failed to read sector at index %v: %w", index, err)
+	}
+	if root != nil && rhp2.SectorRoot(sector) != *root {
+		decrypted := new([rhp2.SectorSize]byte)
+		v.cipher.Decrypt(decrypted[:], sector[:], index)
+		if rhp2.SectorRoot(decrypted) == *root {
+			v.encryptedBelow = index + 1
+			return nil
+		}
+	}
+
+	v.cipher.Encrypt(sector[:], sector[:], index)
+	if _, err := v.data.WriteAt(sector[:], offset); err != nil {
+		return fmt.Errorf("failed to write sector to index %v: %w", index, err)
+	}
+	v.encryptedBelow = index + 1
+	return nil
+}
+
+// CompleteEncryption marks all of the volume's sectors as encrypted.
+func (v *volume) CompleteEncryption() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.encryptedBelow = math.MaxUint64
+}
+
+// ReadSector reads the sector at index from the volume. The sector's root is
+// used to decide whether a sector that may have been encrypted before a
+// restart must be decrypted.
+func (v *volume) ReadSector(index uint64, root types.Hash256) (*[rhp2.SectorSize]byte, error) {
 	v.mu.RLock()
 	defer v.mu.RUnlock()
 
@@ -173,6 +302,16 @@ func (v *volume) ReadSector(index uint64) (*[rhp2.SectorSize]byte, error) {
 
 	if err != nil {
 		err = fmt.Errorf("failed to read sector at index %v: %w", index, err)
+	} else if v.encrypted(index) {
+		v.cipher.Decrypt(sector[:], sector[:], index)
+	} else if v.cipher != nil && index < v.unverifiedBelow && rhp2.SectorRoot(&sector) != root {
+		// the sector may have been encrypted before the encryption cursor
+		// was persisted
+		var decrypted [rhp2.SectorSize]byte
+		v.cipher.Decrypt(decrypted[:], sector[:], index)
+		if rhp2.SectorRoot(&decrypted) == root {
+			sector = decrypted
+		}
 	}
 	go v.incrementReadStats(err)
 	return &sector, err
@@ -185,6 +324,11 @@ func (v *volume) WriteSector(data *[rhp2.SectorSize]byte, index uint64) error {
 
 	if v.data == nil {
 		panic("volume not open") // developer error
+	} else if v.encrypted(index) {
+		// encrypt a copy, the caller's buffer may be cached
+		buf := new([rhp2.SectorSize]byte)
+		v.cipher.Encrypt(buf[:], data[:], index)
+		data = buf
 	}
 	_, err := v.data.WriteAt(data[:], int64(index*rhp2.SectorSize))
 	if err != nil {
@@ -214,7 +358,15 @@ func (v *volume) Resize(oldSectors, newSectors uint64) error {
 		return ErrVolumeNotAvailable
 	}
 
-	if newSectors > oldSectors {
+	if _, ok := v.data.(sparseData); ok {
+		// sparse volumes only need to release the removed sectors
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		if newSectors < oldSectors {
+			return v.data.Truncate(int64(newSectors * rhp2.SectorSize))
+		}
+		return nil
+	} else if newSectors > oldSectors {
 		size := (newSectors - oldSectors) * rhp2.SectorSize // should never be more than 256 MiB
 		buf := make([]byte, size)
 		_, _ = frand.Read(buf) // frand will never return an error
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	rhp2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+	"lukechampine.com/frand"
+)
+
+func TestReadPartiallyEncryptedBatch(t *testing.T) {
+	const sectors = 4
+	f, err := os.Create(filepath.Join(t.TempDir(), "volume.dat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &volume{data: f}
+	defer v.Close()
+
+	cipher, err := VolumeCipher(types.GeneratePrivateKey(), frand.Entropy256())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := make([]types.Hash256, sectors)
+	for i := range roots {
+		var sector [rhp2.SectorSize]byte
+		frand.Read(sector[:256])
+		roots[i] = rhp2.SectorRoot(&sector)
+		if err := v.WriteSector(&sector, uint64(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// encrypt the first half of the batch, then simulate a restart with the
+	// cursor persisted before the batch
+	v.SetEncryption(cipher, 0, 0)
+	for i := 0; i < sectors/2; i++ {
+		if err := v.EncryptSector(uint64(i), &roots[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	v.SetEncryption(cipher, 0, sectors)
+
+	for i, root := range roots {
+		sector, err := v.ReadSector(uint64(i), root)
+		if err != nil {
+			t.Fatal(err)
+		} else if rhp2.SectorRoot(sector) != root {
+			t.Fatalf("sector %v was not read correctly", i)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the content type of the OpenMetrics text exposition format.
+const ContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// Metric types supported by the encoder.
+const (
+	TypeGauge   Type = "gauge"
+	TypeCounter Type = "counter"
+)
+
+type (
+	// Type is the type of a metric family.
+	Type string
+
+	// A Metric is a single sample of a metric family.
+	Metric struct {
+		Name   string
+		Type   Type
+		Help   string
+		Labels map[string]string
+		Value  float64
+	}
+
+	// A Marshaller can be converted to a slice of metrics.
+	Marshaller interface {
+		PrometheusMetric() []Metric
+	}
+
+	// An Encoder writes metrics in the OpenMetrics text format. Samples of the
+	// same family must be appended together.
+	Encoder struct {
+		w *bufio.Writer
+
+		families map[string]bool
+		err      error
+	}
+)
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func (e *Encoder) writeMetric(m Metric) error {
+	if m.Type != TypeGauge && m.Type != TypeCounter {
+		return fmt.Errorf("metric %q has unsupported type %q", m.Name, m.Type)
+	}
+
+	if !e.families[m.Name] {
+		e.families[m.Name] = true
+		if _, err := fmt.Fprintf(e.w, "# TYPE %s %s\n", m.Name, m.Type); err != nil {
+			return err
+		} else if len(m.Help) != 0 {
+			if _, err := fmt.Fprintf(e.w, "# HELP %s %s\n", m.Name, m.Help); err != nil {
+				return err
+			}
+		}
+	}
+
+	name := m.Name
+	if m.Type == TypeCounter {
+		// counter samples must have the _total suffix
+		name += "_total"
+	}
+	if _, err := e.w.WriteString(name); err != nil {
+		return err
+	}
+
+	if len(m.Labels) != 0 {
+		keys := make([]string, 0, len(m.Labels))
+		for k := range m.Labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		pairs := make([]string, 0, len(keys))
+		for _, k := range keys {
+			pairs = append(pairs, fmt.Sprintf(`%s="%s"`, k, labelEscaper.Replace(m.Labels[k])))
+		}
+		if _, err := fmt.Fprintf(e.w, "{%s}", strings.Join(pairs, ",")); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(e.w, " %s\n", formatValue(m.Value))
+	return err
+}
+
+// Append appends the metrics of m to the encoder.
+func (e *Encoder) Append(m Marshaller) error {
+	if e.err != nil {
+		return e.err
+	}
+	for _, metric := range m.PrometheusMetric() {
+		if err := e.writeMetric(metric); err != nil {
+			e.err = fmt.Errorf("failed to write metric %q: %w", metric.Name, err)
+			return e.err
+		}
+	}
+	return nil
+}
+
+// Close terminates the exposition and flushes any buffered data to the
+// underlying writer.
+func (e *Encoder) Close() error {
+	if e.err != nil {
+		return e.err
+	} else if _, err := e.w.WriteString("# EOF\n"); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+// NewEncoder returns a new Encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{
+		w:        bufio.NewWriter(w),
+		families: make(map[string]bool),
+	}
+}
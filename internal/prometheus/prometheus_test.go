@@ -0,0 +1,46 @@
+package prometheus
+
+import (
+	"bytes"
+	"testing"
+)
+
+type metricSlice []Metric
+
+func (ms metricSlice) PrometheusMetric() []Metric {
+	return ms
+}
+
+func TestEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+
+	err := enc.Append(metricSlice{
+		{Name: "hostd_sessions", Type: TypeGauge, Help: "active sessions", Labels: map[string]string{"protocol": "tcp", "version": "2"}, Value: 3},
+		{Name: "hostd_sessions", Type: TypeGauge, Help: "active sessions", Labels: map[string]string{"protocol": "websocket", "version": "3"}, Value: 1},
+		{Name: "hostd_reads", Type: TypeCounter, Labels: map[string]string{"path": `C:\"vol"`}, Value: 1.5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	const expected = `# TYPE hostd_sessions gauge
+# HELP hostd_sessions active sessions
+hostd_sessions{protocol="tcp",version="2"} 3
+hostd_sessions{protocol="websocket",version="3"} 1
+# TYPE hostd_reads counter
+hostd_reads_total{path="C:\\\"vol\""} 1.5
+# EOF
+`
+	if buf.String() != expected {
+		t.Fatalf("unexpected output:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+
+	// unsupported types should be rejected
+	enc = NewEncoder(&buf)
+	if err := enc.Append(metricSlice{{Name: "foo", Type: "summary"}}); err == nil {
+		t.Fatal("expected error for unsupported type")
+	}
+}
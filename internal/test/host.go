@@ -14,6 +14,7 @@ import (
 	"go.sia.tech/hostd/alerts"
 	"go.sia.tech/hostd/host/accounts"
 	"go.sia.tech/hostd/host/contracts"
+	"go.sia.tech/hostd/host/policy"
 	"go.sia.tech/hostd/host/registry"
 	"go.sia.tech/hostd/host/settings"
 	"go.sia.tech/hostd/host/storage"
@@ -46,6 +47,8 @@ type Host struct {
 	registry  *registry.Manager
 	accounts  *accounts.AccountManager
 	contracts *contracts.ContractManager
+	policies  *policy.Manager
+	renters   *rhp.RenterRecorder
 
 	rhp2   *rhp2.SessionHandler
 	rhp3   *rhp3.SessionHandler
@@ -81,6 +84,7 @@ func (h *Host) Close() error {
 	h.rhp3WS.Close()
 	h.rhp2.Close()
 	h.rhp3.Close()
+	h.renters.Close()
 	h.settings.Close()
 	h.wallet.Close()
 	h.contracts.Close()
@@ -160,6 +164,11 @@ func (h *Host) Accounts() *accounts.AccountManager {
 	return h.accounts
 }
 
+// Policies returns the host's policy manager
+func (h *Host) Policies() *policy.Manager {
+	return h.policies
+}
+
 // Store returns the host's database
 func (h *Host) Store() *sqlite.Store {
 	return h.store
@@ -193,17 +202,16 @@ func NewEmptyHost(privKey types.PrivateKey, dir string, node *Node, log *zap.Log
 		return nil, fmt.Errorf("failed to create sql store: %w", err)
 	}
 
-	wallet, err := wallet.NewSingleAddressWallet(privKey, node.cm, node.tp, db, log.Named("wallet"))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create wallet: %w", err)
-	}
-
 	wr, err := webhooks.NewManager(db, log.Named("webhooks"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create webhook reporter: %w", err)
 	}
 
 	am := alerts.NewManager(wr, log.Named("alerts"))
+	wallet, err := wallet.NewSingleAddressWallet(privKey, node.cm, node.tp, db, am, log.Named("wallet"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create wallet: %w", err)
+	}
 	storage, err := storage.NewVolumeManager(db, am, node.cm, log.Named("storage"), DefaultSettings.SectorCacheSize)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create storage manager: %w", err)
@@ -224,23 +232,30 @@ func NewEmptyHost(privKey types.PrivateKey, dir string, node *Node, log *zap.Log
 		return nil, fmt.Errorf("failed to create rhp2 listener: %w", err)
 	}
 
-	settings, err := settings.NewConfigManager(dir, privKey, rhp2Listener.Addr().String(), db, node.cm, node.tp, wallet, am, log.Named("settings"))
+	settings, err := settings.NewConfigManager(dir, privKey, rhp2Listener.Addr().String(), db, node.cm, node.tp, wallet, storage, am, nil, log.Named("settings"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create settings manager: %w", err)
 	}
 
 	registry := registry.NewManager(privKey, db, log.Named("registry"))
 	accounts := accounts.NewManager(db, settings)
+	policies := policy.NewManager(db, log.Named("policy"))
 
 	sessions := rhp.NewSessionReporter()
+	limiter := rhp.NewConnLimiter(rhp.ConnLimits{})
+	maintenance := rhp.NewMaintenanceManager(sessions, log.Named("maintenance"))
+	renters, err := rhp.NewRenterRecorder(db, log.Named("renters"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create renter recorder: %w", err)
+	}
 
-	rhp2, err := rhp2.NewSessionHandler(rhp2Listener, privKey, rhp3Listener.Addr().String(), node.cm, node.tp, wallet, contracts, settings, storage, stubDataMonitor{}, sessions, log.Named("rhp2"))
+	rhp2, err := rhp2.NewSessionHandler(rhp2Listener, privKey, rhp3Listener.Addr().String(), node.cm, node.tp, wallet, contracts, settings, storage, policies, stubDataMonitor{}, sessions, limiter, maintenance, renters, log.Named("rhp2"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create rhp2 session handler: %w", err)
 	}
 	go rhp2.Serve()
 
-	rhp3, err := rhp3.NewSessionHandler(rhp3Listener, privKey, node.cm, node.tp, wallet, accounts, contracts, registry, storage, settings, stubDataMonitor{}, sessions, log.Named("rhp3"))
+	rhp3, err := rhp3.NewSessionHandler(rhp3Listener, privKey, node.cm, node.tp, wallet, accounts, contracts, registry, storage, settings, policies, stubDataMonitor{}, sessions, limiter, maintenance, renters, log.Named("rhp3"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create rhp3 session handler: %w", err)
 	}
@@ -273,6 +288,8 @@ func NewEmptyHost(privKey types.PrivateKey, dir string, node *Node, log *zap.Log
 		registry:  registry,
 		accounts:  accounts,
 		contracts: contracts,
+		policies:  policies,
+		renters:   renters,
 
 		rhp2:   rhp2,
 		rhp3:   rhp3,
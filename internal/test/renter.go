@@ -9,10 +9,12 @@ import (
 
 	crhp2 "go.sia.tech/core/rhp/v2"
 	"go.sia.tech/core/types"
+	"go.sia.tech/hostd/alerts"
 	rhp2 "go.sia.tech/hostd/internal/test/rhp/v2"
 	rhp3 "go.sia.tech/hostd/internal/test/rhp/v3"
 	"go.sia.tech/hostd/persist/sqlite"
 	"go.sia.tech/hostd/wallet"
+	"go.sia.tech/hostd/webhooks"
 	"go.uber.org/zap"
 )
 
@@ -204,7 +206,12 @@ func NewRenter(privKey types.PrivateKey, dir string, node *Node, log *zap.Logger
 	if err != nil {
 		return nil, fmt.Errorf("failed to create sql store: %w", err)
 	}
-	wallet, err := wallet.NewSingleAddressWallet(privKey, node.ChainManager(), node.TPool(), db, log.Named("wallet"))
+	wr, err := webhooks.NewManager(db, log.Named("webhooks"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webhook reporter: %w", err)
+	}
+	am := alerts.NewManager(wr, log.Named("alerts"))
+	wallet, err := wallet.NewSingleAddressWallet(privKey, node.ChainManager(), node.TPool(), db, am, log.Named("wallet"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create wallet: %w", err)
 	}
@@ -40,7 +40,7 @@ type (
 	// A Wallet funds and signs transactions
 	Wallet interface {
 		Address() types.Address
-		FundTransaction(txn *types.Transaction, amount types.Currency) ([]types.Hash256, func(), error)
+		FundTransaction(txn *types.Transaction, amount types.Currency, outputs ...types.SiacoinOutputID) ([]types.Hash256, func(), error)
 		SignTransaction(cs consensus.State, txn *types.Transaction, toSign []types.Hash256, cf types.CoveredFields) error
 	}
 
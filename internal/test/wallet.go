@@ -5,8 +5,10 @@ import (
 	"path/filepath"
 
 	"go.sia.tech/core/types"
+	"go.sia.tech/hostd/alerts"
 	"go.sia.tech/hostd/persist/sqlite"
 	"go.sia.tech/hostd/wallet"
+	"go.sia.tech/hostd/webhooks"
 	"go.uber.org/zap"
 )
 
@@ -14,8 +16,9 @@ import (
 type Wallet struct {
 	*Node
 	*wallet.SingleAddressWallet
-	store *sqlite.Store
-	log   *zap.Logger
+	store  *sqlite.Store
+	alerts *alerts.Manager
+	log    *zap.Logger
 }
 
 // Close closes the wallet.
@@ -27,6 +30,11 @@ func (w *Wallet) Close() error {
 	return nil
 }
 
+// Alerts returns the wallet's alerts manager.
+func (w *Wallet) Alerts() *alerts.Manager {
+	return w.alerts
+}
+
 // Store returns the wallet's store.
 func (w *Wallet) Store() *sqlite.Store {
 	return w.store
@@ -63,7 +71,12 @@ func NewWallet(privKey types.PrivateKey, dir string, log *zap.Logger) (*Wallet,
 	if err != nil {
 		return nil, fmt.Errorf("failed to create sql store: %w", err)
 	}
-	wallet, err := wallet.NewSingleAddressWallet(privKey, node.cm, node.tp, db, log.Named("wallet"))
+	wr, err := webhooks.NewManager(db, log.Named("webhooks"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webhook reporter: %w", err)
+	}
+	am := alerts.NewManager(wr, log.Named("alerts"))
+	wallet, err := wallet.NewSingleAddressWallet(privKey, node.cm, node.tp, db, am, log.Named("wallet"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create wallet: %w", err)
 	}
@@ -72,5 +85,6 @@ func NewWallet(privKey types.PrivateKey, dir string, log *zap.Logger) (*Wallet,
 		SingleAddressWallet: wallet,
 		log:                 log,
 		store:               db,
+		alerts:              am,
 	}, nil
 }
@@ -0,0 +1,192 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// backupPagesPerStep is the number of pages copied in each step of a backup.
+// Copying in small steps releases the source database lock between steps so
+// other connections are not blocked for the duration of the backup.
+const backupPagesPerStep = 100
+
+// ErrBackupVersionMismatch is returned by Restore when the schema version of
+// the backup does not match the version expected by this build.
+var ErrBackupVersionMismatch = errors.New("backup database version does not match the expected version")
+
+// backupDB copies the main database of src to a new database at destPath
+// using SQLite's online backup API. If the backup fails, the destination
+// file is removed.
+func backupDB(ctx context.Context, src *sqlite3.SQLiteConn, destPath string) (err error) {
+	defer func() {
+		if err != nil {
+			// remove the partial backup
+			os.Remove(destPath)
+		}
+	}()
+
+	conn, err := (&sqlite3.SQLiteDriver{}).Open(destPath)
+	if err != nil {
+		return fmt.Errorf("failed to open destination database: %w", err)
+	}
+	dest := conn.(*sqlite3.SQLiteConn)
+	defer dest.Close()
+
+	backup, err := dest.Backup("main", src, "main")
+	if err != nil {
+		return fmt.Errorf("failed to initialize backup: %w", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			backup.Finish()
+			return ctx.Err()
+		default:
+		}
+
+		done, err := backup.Step(backupPagesPerStep)
+		if err != nil {
+			backup.Finish()
+			return fmt.Errorf("backup step failed: %w", err)
+		} else if done {
+			break
+		}
+	}
+
+	if err := backup.Finish(); err != nil {
+		return fmt.Errorf("failed to finish backup: %w", err)
+	}
+	return dest.Close()
+}
+
+// checkBackupDestination returns an error if a backup cannot be written to
+// destPath. Existing files are never overwritten.
+func checkBackupDestination(destPath string) error {
+	if destPath == "" {
+		return errors.New("destination path is required")
+	} else if _, err := os.Stat(destPath); err == nil {
+		return fmt.Errorf("destination file %q already exists", destPath)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to stat destination file: %w", err)
+	}
+	return nil
+}
+
+// Backup writes a consistent copy of the database to destPath. The backup is
+// taken with SQLite's online backup API, so the host does not need to be
+// stopped.
+func (s *Store) Backup(ctx context.Context, destPath string) error {
+	if err := checkBackupDestination(destPath); err != nil {
+		return err
+	}
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(dc any) error {
+		src, ok := dc.(*sqlite3.SQLiteConn)
+		if !ok {
+			return fmt.Errorf("unexpected driver connection type %T", dc)
+		}
+		return backupDB(ctx, src, destPath)
+	})
+}
+
+// Backup writes a consistent copy of the database at srcPath to destPath. It
+// is safe to call while another process has the source database open.
+func Backup(ctx context.Context, srcPath, destPath string) error {
+	if _, err := os.Stat(srcPath); err != nil {
+		return fmt.Errorf("failed to stat source database: %w", err)
+	} else if err := checkBackupDestination(destPath); err != nil {
+		return err
+	}
+
+	conn, err := (&sqlite3.SQLiteDriver{}).Open(sqliteFilepath(srcPath))
+	if err != nil {
+		return fmt.Errorf("failed to open source database: %w", err)
+	}
+	defer conn.Close()
+	return backupDB(ctx, conn.(*sqlite3.SQLiteConn), destPath)
+}
+
+// Restore replaces the database at destPath with the backup at backupPath.
+// The schema version of the backup must match the version expected by this
+// build. ErrDatabaseInUse is returned if the existing database is open in
+// another process, such as a running host.
+func Restore(ctx context.Context, backupPath, destPath string) error {
+	if _, err := os.Stat(backupPath); err != nil {
+		return fmt.Errorf("failed to stat backup: %w", err)
+	}
+
+	// check the schema version of the backup before touching the existing
+	// database
+	db, err := sql.Open("sqlite3", "file:"+backupPath+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	version := getDBVersion(db)
+	db.Close()
+	if expected := int64(len(migrations) + 1); version != expected {
+		return fmt.Errorf("backup has version %d, expected %d: %w", version, expected, ErrBackupVersionMismatch)
+	}
+
+	// refuse to replace a database that is in use. Closing the exclusive
+	// connection also checkpoints the existing write-ahead log.
+	if fi, err := os.Stat(destPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to stat database: %w", err)
+	} else if err == nil && fi.Mode().IsRegular() {
+		db, err := openExclusive(destPath)
+		if err != nil {
+			return err
+		}
+		db.Close()
+	}
+
+	// copy the backup next to the destination so the final swap is a rename
+	// on the same filesystem
+	tmpPath := destPath + ".restore"
+	if err := os.Remove(tmpPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove stale restore file: %w", err)
+	} else if err := Backup(ctx, backupPath, tmpPath); err != nil {
+		return fmt.Errorf("failed to copy backup: %w", err)
+	}
+
+	// the write-ahead log and shared memory files belong to the database being
+	// replaced and must not be applied to the restored database. Move them
+	// aside so they can be put back if the database cannot be replaced.
+	var moved []string
+	restoreMoved := func() {
+		for _, path := range moved {
+			os.Rename(path+".old", path)
+		}
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		path := destPath + suffix
+		if err := os.Rename(path, path+".old"); errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			restoreMoved()
+			os.Remove(tmpPath)
+			return fmt.Errorf("failed to move %q: %w", path, err)
+		}
+		moved = append(moved, path)
+	}
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		restoreMoved()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace database: %w", err)
+	}
+	for _, path := range moved {
+		os.Remove(path + ".old")
+	}
+	return nil
+}
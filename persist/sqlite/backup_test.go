@@ -0,0 +1,116 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.sia.tech/hostd/host/settings"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestBackupRestore(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	dir := t.TempDir()
+	db, err := OpenDatabase(filepath.Join(dir, "hostd.db"), log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	hostKey := db.HostKey()
+	s := settings.DefaultSettings
+	s.NetAddress = "foo.bar:9982"
+	if err := db.UpdateSettings(s); err != nil {
+		t.Fatal(err)
+	}
+
+	backupPath := filepath.Join(dir, "backup.db")
+	if err := db.Backup(context.Background(), backupPath); err != nil {
+		t.Fatal(err)
+	} else if err := db.Backup(context.Background(), backupPath); err == nil {
+		t.Fatal("expected error when overwriting backup")
+	}
+
+	// restore the backup to a new location
+	restorePath := filepath.Join(dir, "restored.db")
+	if err := Restore(context.Background(), backupPath, restorePath); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := OpenDatabase(restorePath, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+
+	if restored.HostKey().PublicKey() != hostKey.PublicKey() {
+		t.Fatal("host key mismatch")
+	}
+	rs, err := restored.Settings()
+	if err != nil {
+		t.Fatal(err)
+	} else if rs.NetAddress != s.NetAddress {
+		t.Fatalf("expected net address %q, got %q", s.NetAddress, rs.NetAddress)
+	}
+
+	// change the version of the backup and check that it is rejected
+	if _, err := db.exec(`UPDATE global_settings SET db_version=1`); err != nil {
+		t.Fatal(err)
+	}
+	oldBackupPath := filepath.Join(dir, "old.db")
+	if err := db.Backup(context.Background(), oldBackupPath); err != nil {
+		t.Fatal(err)
+	} else if err := Restore(context.Background(), oldBackupPath, restorePath); !errors.Is(err, ErrBackupVersionMismatch) {
+		t.Fatalf("expected version mismatch, got %v", err)
+	}
+	// the restored database is open and must not be replaced
+	if err := Restore(context.Background(), backupPath, restorePath); !errors.Is(err, ErrDatabaseInUse) {
+		t.Fatalf("expected database in use, got %v", err)
+	}
+	// the restored database should not have been modified
+	if restored.HostKey().PublicKey() != hostKey.PublicKey() {
+		t.Fatal("host key mismatch")
+	}
+}
+
+func TestRestoreKeepsWALOnFailure(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	dir := t.TempDir()
+	db, err := OpenDatabase(filepath.Join(dir, "hostd.db"), log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	backupPath := filepath.Join(dir, "backup.db")
+	if err := db.Backup(context.Background(), backupPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// a non-empty directory at the destination causes the final rename to
+	// fail
+	destPath := filepath.Join(dir, "dest.db")
+	if err := os.MkdirAll(filepath.Join(destPath, "child"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	walData := []byte("committed frames")
+	if err := os.WriteFile(destPath+"-wal", walData, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Restore(context.Background(), backupPath, destPath); err == nil {
+		t.Fatal("expected restore to fail")
+	}
+	// the write-ahead log of the existing database should be untouched
+	if buf, err := os.ReadFile(destPath + "-wal"); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(buf, walData) {
+		t.Fatal("write-ahead log was modified")
+	} else if _, err := os.Stat(destPath + ".restore"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal("expected temporary restore file to be removed")
+	}
+}
@@ -0,0 +1,313 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/hostd/host/storage"
+	"go.uber.org/zap"
+)
+
+// cacheAccessBatchSize is the number of cached sector accesses buffered in
+// memory before their last access times are written to the database.
+const cacheAccessBatchSize = 1000
+
+// SetCacheTier sets the cache tier flag on a volume. Cache tier volumes are
+// not used to store sectors, only copies of frequently read sectors.
+func (s *Store) SetCacheTier(volumeID int64, cacheTier bool) error {
+	const query = `UPDATE storage_volumes SET cache_tier=$1 WHERE id=$2;`
+	res, err := s.exec(query, cacheTier, volumeID)
+	if err != nil {
+		return err
+	} else if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	} else if n == 0 {
+		return storage.ErrVolumeNotFound
+	}
+	return nil
+}
+
+// CacheSector calls fn with a location in a cache tier volume for a copy of
+// the sector. If the cache tier is full, the least recently accessed cached
+// sector is evicted to make room. The sector data must be written to disk
+// within fn. If fn returns an error, the cached copy is removed. If there is
+// no cache tier space available, ErrNotEnoughStorage is returned. The sector
+// and location are locked until release is called.
+func (s *Store) CacheSector(root types.Hash256, fn func(loc storage.SectorLocation) error) (func() error, error) {
+	var sectorLockID, cacheID int64
+	var locationLocks []int64
+	var location storage.SectorLocation
+
+	err := s.transaction(func(tx txn) error {
+		sectorID, err := sectorDBID(tx, root)
+		if err != nil {
+			return fmt.Errorf("failed to get sector id: %w", err)
+		}
+
+		// lock the sector
+		sectorLockID, err = lockSector(tx, sectorID)
+		if err != nil {
+			return fmt.Errorf("failed to lock sector: %w", err)
+		}
+
+		location, err = emptyCacheLocation(tx)
+		if errors.Is(err, storage.ErrNotEnoughStorage) {
+			// the buffered access times must be written before the least
+			// recently accessed copy is chosen
+			if err := s.flushCacheAccesses(tx); err != nil {
+				return fmt.Errorf("failed to update last access: %w", err)
+			}
+			location, err = evictCacheLocation(tx)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get cache location: %w", err)
+		}
+		location.Root = root
+
+		// lock the location
+		locationLocks, err = lockLocations(tx, []storage.SectorLocation{location})
+		if err != nil {
+			return fmt.Errorf("failed to lock sector location: %w", err)
+		}
+
+		err = tx.QueryRow(`INSERT INTO cached_sectors (sector_id, volume_sector_id, last_access) VALUES ($1, $2, $3) RETURNING id`, sectorID, location.ID, sqlTime(time.Now())).Scan(&cacheID)
+		if err != nil {
+			return fmt.Errorf("failed to add cached sector: %w", err)
+		} else if err := incrementVolumeUsage(tx, location.Volume, 1); err != nil {
+			return fmt.Errorf("failed to update volume metadata: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := func() error {
+		return s.transaction(func(tx txn) error {
+			if err := unlockLocations(tx, locationLocks); err != nil {
+				return fmt.Errorf("failed to unlock sector location: %w", err)
+			} else if err := unlockSector(tx, sectorLockID); err != nil {
+				return fmt.Errorf("failed to unlock sector: %w", err)
+			}
+			return nil
+		})
+	}
+
+	if err := fn(location); err != nil {
+		rbErr := s.transaction(func(tx txn) error {
+			if _, err := tx.Exec(`DELETE FROM cached_sectors WHERE id=$1`, cacheID); err != nil {
+				return err
+			}
+			return incrementVolumeUsage(tx, location.Volume, -1)
+		})
+		if rbErr != nil {
+			s.log.Error("failed to remove cached sector", zap.Error(rbErr))
+		}
+		unlock()
+		return nil, fmt.Errorf("failed to cache sector: %w", err)
+	}
+	return unlock, nil
+}
+
+// CachedSectorLocation returns the location of the cached copy of a sector in
+// an available cache tier volume and records its last access time. If the
+// sector is not cached, ErrSectorNotFound is returned.
+func (s *Store) CachedSectorLocation(root types.Hash256) (loc storage.SectorLocation, err error) {
+	const query = `SELECT cs.id, vs.id, vs.volume_id, vs.volume_index
+FROM cached_sectors cs
+INNER JOIN volume_sectors vs ON (vs.id=cs.volume_sector_id)
+INNER JOIN storage_volumes v ON (v.id=vs.volume_id)
+INNER JOIN stored_sectors s ON (s.id=cs.sector_id)
+WHERE s.sector_root=$1 AND v.available=true`
+
+	var cacheID int64
+	err = s.queryRow(query, sqlHash256(root)).Scan(&cacheID, &loc.ID, &loc.Volume, &loc.Index)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.SectorLocation{}, storage.ErrSectorNotFound
+	} else if err != nil {
+		return storage.SectorLocation{}, fmt.Errorf("failed to get cached sector: %w", err)
+	}
+	loc.Root = root
+
+	// the last access time is buffered to avoid a write on every cache hit
+	if s.recordCacheAccess(cacheID) {
+		err := s.transaction(s.flushCacheAccesses)
+		if err != nil {
+			s.log.Warn("failed to update last access of cached sectors", zap.Error(err))
+		}
+	}
+	return loc, nil
+}
+
+// recordCacheAccess buffers the last access time of a cached sector. It
+// returns true if the buffer is full and should be flushed.
+func (s *Store) recordCacheAccess(cacheID int64) bool {
+	s.accessMu.Lock()
+	defer s.accessMu.Unlock()
+	if s.cacheAccess == nil {
+		s.cacheAccess = make(map[int64]time.Time)
+	}
+	s.cacheAccess[cacheID] = time.Now()
+	return len(s.cacheAccess) >= cacheAccessBatchSize
+}
+
+// flushCacheAccesses writes the buffered last access times of cached sectors.
+// Access times are only used to order evictions, so they are discarded if the
+// transaction fails.
+func (s *Store) flushCacheAccesses(tx txn) error {
+	s.accessMu.Lock()
+	accesses := s.cacheAccess
+	s.cacheAccess = nil
+	s.accessMu.Unlock()
+	if len(accesses) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.Prepare(`UPDATE cached_sectors SET last_access=$1 WHERE id=$2`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+	for id, timestamp := range accesses {
+		if _, err := stmt.Exec(sqlTime(timestamp), id); err != nil {
+			return fmt.Errorf("failed to update last access: %w", err)
+		}
+	}
+	return nil
+}
+
+// RemoveCachedSector removes the cached copy of a sector. If the sector is
+// not cached, nil is returned.
+func (s *Store) RemoveCachedSector(root types.Hash256) error {
+	return s.transaction(func(tx txn) error {
+		sectorID, err := sectorDBID(tx, root)
+		if errors.Is(err, storage.ErrSectorNotFound) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to get sector id: %w", err)
+		}
+		return removeSectorCachedCopy(tx, sectorID)
+	})
+}
+
+// EvictCachedSectors removes up to limit cached copies that have not been
+// accessed since before. Cached copies of locked sectors are skipped. The
+// number of evicted sectors is returned.
+func (s *Store) EvictCachedSectors(before time.Time, limit int) (evicted int, err error) {
+	const query = `SELECT cs.id, vs.volume_id FROM cached_sectors cs
+INNER JOIN volume_sectors vs ON (vs.id=cs.volume_sector_id)
+WHERE cs.last_access < $1 AND cs.sector_id NOT IN (SELECT sector_id FROM locked_sectors)
+ORDER BY cs.last_access ASC
+LIMIT $2`
+	err = s.transaction(func(tx txn) error {
+		if err := s.flushCacheAccesses(tx); err != nil {
+			return fmt.Errorf("failed to update last access: %w", err)
+		}
+		evicted, err = removeCachedSectors(tx, query, sqlTime(before), limit)
+		return err
+	})
+	return
+}
+
+// emptyCacheLocation returns an empty location in a writable cache tier
+// volume. If there is no space available, ErrNotEnoughStorage is returned.
+func emptyCacheLocation(tx txn) (storage.SectorLocation, error) {
+	const query = `SELECT id FROM storage_volumes
+WHERE available=true AND read_only=false AND cache_tier=true AND total_sectors-used_sectors > 0
+ORDER BY used_sectors ASC LIMIT 1;`
+	var volumeID int64
+	err := tx.QueryRow(query).Scan(&volumeID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.SectorLocation{}, storage.ErrNotEnoughStorage
+	} else if err != nil {
+		return storage.SectorLocation{}, fmt.Errorf("failed to get empty location: %w", err)
+	}
+	return emptyLocationInVolume(tx, volumeID)
+}
+
+// evictCacheLocation removes the least recently accessed cached copy in a
+// writable cache tier volume and returns its location. Cached copies of
+// locked sectors are skipped. If there are no cached copies to evict,
+// ErrNotEnoughStorage is returned.
+func evictCacheLocation(tx txn) (loc storage.SectorLocation, err error) {
+	const query = `SELECT cs.id, vs.id, vs.volume_id, vs.volume_index
+FROM cached_sectors cs
+INNER JOIN volume_sectors vs ON (vs.id=cs.volume_sector_id)
+INNER JOIN storage_volumes v ON (v.id=vs.volume_id)
+WHERE v.available=true AND v.read_only=false
+AND cs.sector_id NOT IN (SELECT sector_id FROM locked_sectors)
+AND vs.id NOT IN (SELECT volume_sector_id FROM locked_volume_sectors)
+ORDER BY cs.last_access ASC LIMIT 1`
+
+	var cacheID int64
+	err = tx.QueryRow(query).Scan(&cacheID, &loc.ID, &loc.Volume, &loc.Index)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.SectorLocation{}, storage.ErrNotEnoughStorage
+	} else if err != nil {
+		return storage.SectorLocation{}, fmt.Errorf("failed to get cached sector: %w", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM cached_sectors WHERE id=$1`, cacheID); err != nil {
+		return storage.SectorLocation{}, fmt.Errorf("failed to evict cached sector: %w", err)
+	} else if err := incrementVolumeUsage(tx, loc.Volume, -1); err != nil {
+		return storage.SectorLocation{}, fmt.Errorf("failed to update volume usage: %w", err)
+	}
+	return loc, nil
+}
+
+// removeCachedSectors removes the given cached copies and decrements the
+// usage of their volumes. The number of removed copies is returned.
+func removeCachedSectors(tx txn, query string, args ...any) (int, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query cached sectors: %w", err)
+	}
+	var ids []int64
+	usage := make(map[int64]int)
+	for rows.Next() {
+		var id, volumeID int64
+		if err := rows.Scan(&id, &volumeID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan cached sector: %w", err)
+		}
+		ids = append(ids, id)
+		usage[volumeID]--
+	}
+	if err := rows.Close(); err != nil {
+		return 0, fmt.Errorf("failed to close rows: %w", err)
+	} else if len(ids) == 0 {
+		return 0, nil
+	}
+
+	if _, err := tx.Exec(`DELETE FROM cached_sectors WHERE id IN (`+queryPlaceHolders(len(ids))+`)`, queryArgs(ids)...); err != nil {
+		return 0, fmt.Errorf("failed to delete cached sectors: %w", err)
+	}
+	for volumeID, delta := range usage {
+		if err := incrementVolumeUsage(tx, volumeID, delta); err != nil {
+			return 0, fmt.Errorf("failed to update volume usage: %w", err)
+		}
+	}
+	return len(ids), nil
+}
+
+// removeSectorCachedCopy removes the cached copy of a sector.
+func removeSectorCachedCopy(tx txn, sectorID int64) error {
+	const query = `SELECT cs.id, vs.volume_id FROM cached_sectors cs
+INNER JOIN volume_sectors vs ON (vs.id=cs.volume_sector_id)
+WHERE cs.sector_id=$1`
+	_, err := removeCachedSectors(tx, query, sectorID)
+	return err
+}
+
+// removeVolumeCachedSectors removes all cached copies stored in a volume at or
+// after minIndex.
+func removeVolumeCachedSectors(tx txn, volumeID int64, minIndex uint64) error {
+	const query = `SELECT cs.id, vs.volume_id FROM cached_sectors cs
+INNER JOIN volume_sectors vs ON (vs.id=cs.volume_sector_id)
+WHERE vs.volume_id=$1 AND vs.volume_index >= $2`
+	_, err := removeCachedSectors(tx, query, volumeID, minIndex)
+	return err
+}
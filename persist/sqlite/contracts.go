@@ -308,6 +308,26 @@ func (s *Store) ReviseContract(revision contracts.SignedRevision, oldRoots []typ
 	})
 }
 
+// ContractSectorAvailability returns the number of sectors in a contract and
+// the number of those sectors that do not have a copy, either the primary or a
+// replica, stored on an available, writable volume.
+func (s *Store) ContractSectorAvailability(contractID types.FileContractID) (sectors, missing uint64, err error) {
+	const query = `SELECT COUNT(csr.id), COALESCE(SUM(CASE WHEN EXISTS (
+		SELECT 1 FROM volume_sectors vs
+		INNER JOIN storage_volumes sv ON (vs.volume_id=sv.id)
+		WHERE vs.sector_id=csr.sector_id AND sv.available=true AND sv.read_only=false
+	) OR EXISTS (
+		SELECT 1 FROM sector_replicas sr
+		INNER JOIN volume_sectors vs ON (sr.volume_sector_id=vs.id)
+		INNER JOIN storage_volumes sv ON (vs.volume_id=sv.id)
+		WHERE sr.sector_id=csr.sector_id AND sv.available=true AND sv.read_only=false
+	) THEN 0 ELSE 1 END), 0) FROM contract_sector_roots csr
+INNER JOIN contracts c ON (csr.contract_id=c.id)
+WHERE c.contract_id=$1`
+	err = s.queryRow(query, sqlHash256(contractID)).Scan(&sectors, &missing)
+	return
+}
+
 // SectorRoots returns the sector roots for a contract. The contract must be
 // locked before calling.
 func (s *Store) SectorRoots(contractID types.FileContractID) (roots []types.Hash256, err error) {
@@ -535,8 +555,14 @@ func getContract(tx txn, contractID int64) (contracts.Contract, error) {
 }
 
 func appendSector(tx txn, contractID int64, root types.Hash256, index uint64) error {
-	var sectorID int64
-	err := tx.QueryRow(`INSERT INTO contract_sector_roots (contract_id, sector_id, root_index) SELECT $1, id, $2 FROM stored_sectors WHERE sector_root=$3 RETURNING sector_id`, contractID, index, sqlHash256(root)).Scan(&sectorID)
+	sectorID, err := sectorDBID(tx, root)
+	if err != nil {
+		return err
+	}
+	err = updateEphemeralSectors(tx, []int64{sectorID}, func() error {
+		_, err := tx.Exec(`INSERT INTO contract_sector_roots (contract_id, sector_id, root_index) VALUES ($1, $2, $3)`, contractID, sectorID, index)
+		return err
+	})
 	if err != nil {
 		return err
 	} else if err := incrementNumericStat(tx, metricContractSectors, 1, time.Now()); err != nil {
@@ -550,17 +576,15 @@ func updateSector(tx txn, contractID int64, root types.Hash256, index uint64) er
 	if err := tx.QueryRow(`SELECT sector_id FROM contract_sector_roots WHERE contract_id=$1 AND root_index=$2`, contractID, index).Scan(&oldSectorID); err != nil {
 		return fmt.Errorf("failed to get old sector id: %w", err)
 	}
+	newSectorID, err := sectorDBID(tx, root)
+	if err != nil {
+		return err
+	}
 
-	const query = `WITH sector AS (
-	SELECT id FROM stored_sectors WHERE sector_root=$1
-)
-UPDATE contract_sector_roots
-SET sector_id=sector.id
-FROM sector
-WHERE contract_id=$2 AND root_index=$3
-RETURNING sector_id;`
-	var newSectorID int64
-	err := tx.QueryRow(query, sqlHash256(root), contractID, index).Scan(&newSectorID)
+	err = updateEphemeralSectors(tx, []int64{oldSectorID, newSectorID}, func() error {
+		_, err := tx.Exec(`UPDATE contract_sector_roots SET sector_id=$1 WHERE contract_id=$2 AND root_index=$3`, newSectorID, contractID, index)
+		return err
+	})
 	if err != nil {
 		return err
 	} else if err := pruneSectorRef(tx, oldSectorID); err != nil {
@@ -641,20 +665,27 @@ func lastContractSectors(tx txn, contractID int64, n uint64) (roots []contractSe
 // deleteContractSectors deletes sector roots from a contract. Sectors that are
 // still referenced will not be removed. Returns the number of sectors deleted.
 func deleteContractSectors(tx txn, refs []contractSectorRootRef) (int, error) {
-	var rootIDs []int64
+	var rootIDs, sectorIDs []int64
 	for _, ref := range refs {
 		rootIDs = append(rootIDs, ref.dbID)
+		sectorIDs = append(sectorIDs, ref.sectorID)
 	}
 
 	// delete the sector roots
-	query := `DELETE FROM contract_sector_roots WHERE id IN (` + queryPlaceHolders(len(rootIDs)) + `);`
-	res, err := tx.Exec(query, queryArgs(rootIDs)...)
+	err := updateEphemeralSectors(tx, sectorIDs, func() error {
+		query := `DELETE FROM contract_sector_roots WHERE id IN (` + queryPlaceHolders(len(rootIDs)) + `);`
+		res, err := tx.Exec(query, queryArgs(rootIDs)...)
+		if err != nil {
+			return fmt.Errorf("failed to delete sectors: %w", err)
+		} else if rows, err := res.RowsAffected(); err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		} else if rows != int64(len(refs)) {
+			return fmt.Errorf("failed to delete all sectors: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return 0, fmt.Errorf("failed to delete sectors: %w", err)
-	} else if rows, err := res.RowsAffected(); err != nil {
-		return 0, fmt.Errorf("failed to get rows affected: %w", err)
-	} else if rows != int64(len(refs)) {
-		return 0, fmt.Errorf("failed to delete all sectors: %w", err)
+		return 0, err
 	}
 
 	// decrement the contract metrics
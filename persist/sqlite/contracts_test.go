@@ -393,3 +393,99 @@ func TestContracts(t *testing.T) {
 		t.Fatal("expected no contracts")
 	}
 }
+
+func TestContractSectorAvailability(t *testing.T) {
+	const sectors = 5
+	log := zaptest.NewLogger(t)
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "test.db"), log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	renterKey := types.NewPrivateKeyFromSeed(frand.Bytes(32))
+	hostKey := types.NewPrivateKeyFromSeed(frand.Bytes(32))
+
+	contractUnlockConditions := types.UnlockConditions{
+		PublicKeys: []types.UnlockKey{
+			renterKey.PublicKey().UnlockKey(),
+			hostKey.PublicKey().UnlockKey(),
+		},
+		SignaturesRequired: 2,
+	}
+	contract := contracts.SignedRevision{
+		Revision: types.FileContractRevision{
+			ParentID:         frand.Entropy256(),
+			UnlockConditions: contractUnlockConditions,
+			FileContract: types.FileContract{
+				UnlockHash:     types.Hash256(contractUnlockConditions.UnlockHash()),
+				RevisionNumber: 1,
+				WindowStart:    100,
+				WindowEnd:      200,
+			},
+		},
+	}
+	if err := db.AddContract(contract, []types.Transaction{}, types.ZeroCurrency, contracts.Usage{}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	volume1, err := addTestVolume(db, "test1", sectors*2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	volume2, err := addTestVolume(db, "test2", sectors*2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// store the contract's sectors with a replica of each
+	var changes []contracts.SectorChange
+	for i := 0; i < sectors; i++ {
+		root := frand.Entropy256()
+		release, err := db.StoreSector(root, func(loc storage.SectorLocation, exists bool) error { return nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer release()
+
+		releaseReplica, err := db.StoreSectorReplica(root, func(loc storage.SectorLocation) error { return nil })
+		if err != nil {
+			t.Fatal(err)
+		} else if err := releaseReplica(); err != nil {
+			t.Fatal(err)
+		}
+		changes = append(changes, contracts.SectorChange{Action: contracts.SectorActionAppend, Root: root})
+	}
+	if err := db.ReviseContract(contract, nil, contracts.Usage{}, changes); err != nil {
+		t.Fatal(err)
+	}
+
+	checkAvailability := func(expectedMissing uint64) {
+		t.Helper()
+		n, missing, err := db.ContractSectorAvailability(contract.Revision.ParentID)
+		if err != nil {
+			t.Fatal(err)
+		} else if n != sectors {
+			t.Fatalf("expected %v sectors, got %v", sectors, n)
+		} else if missing != expectedMissing {
+			t.Fatalf("expected %v missing sectors, got %v", expectedMissing, missing)
+		}
+	}
+
+	checkAvailability(0)
+	// every sector has a copy in the second volume
+	if err := db.SetAvailable(volume1.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	checkAvailability(0)
+	// no copies are available
+	if err := db.SetAvailable(volume2.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	checkAvailability(sectors)
+	// every sector has a copy in the first volume
+	if err := db.SetAvailable(volume1.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	checkAvailability(0)
+}
@@ -98,6 +98,16 @@ func (s *Store) VerifyContractSectors() error {
 			return fmt.Errorf("contract sector count mismatch: expected %v, got %v", metrics.Storage.ContractSectors, contractSectors)
 		}
 
+		// count sectors only referenced by temp storage
+		var ephemeralSectors uint64
+		const query = `SELECT COUNT(DISTINCT tsr.sector_id) FROM temp_storage_sector_roots tsr
+WHERE NOT EXISTS (SELECT 1 FROM contract_sector_roots csr WHERE csr.sector_id=tsr.sector_id)`
+		if err := tx.QueryRow(query).Scan(&ephemeralSectors); err != nil {
+			return fmt.Errorf("failed to count ephemeral sectors: %w", err)
+		} else if metrics.Storage.EphemeralSectors != ephemeralSectors {
+			return fmt.Errorf("ephemeral sector count mismatch: expected %v, got %v", ephemeralSectors, metrics.Storage.EphemeralSectors)
+		}
+
 		// count used sectors
 		volumeUsed, err := getVolumeUsedSectors(tx)
 		if err != nil {
@@ -0,0 +1,74 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/hostd/host/storage"
+)
+
+// InitVolumeEncryption sets the encryption salt of a volume. If migrate is
+// true, the volume's existing sectors are not yet encrypted and its
+// encryption cursor is set to 0.
+func (s *Store) InitVolumeEncryption(volumeID int64, salt types.Hash256, migrate bool) error {
+	var cursor *uint64
+	if migrate {
+		cursor = new(uint64)
+	}
+	const query = `UPDATE storage_volumes SET (encryption_salt, encryption_cursor)=($1, $2) WHERE id=$3 AND encryption_salt IS NULL`
+	res, err := s.exec(query, sqlHash256(salt), cursor, volumeID)
+	if err != nil {
+		return err
+	} else if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	} else if n == 0 {
+		return errors.New("volume not found or already encrypted")
+	}
+	return nil
+}
+
+// SetVolumeEncryptionCursor sets the number of leading sectors of a volume
+// that have been encrypted.
+func (s *Store) SetVolumeEncryptionCursor(volumeID int64, cursor uint64) error {
+	const query = `UPDATE storage_volumes SET encryption_cursor=$1 WHERE id=$2 AND encryption_salt IS NOT NULL`
+	_, err := s.exec(query, cursor, volumeID)
+	return err
+}
+
+// CompleteVolumeEncryption clears the encryption cursor of a volume after all
+// of its sectors have been encrypted.
+func (s *Store) CompleteVolumeEncryption(volumeID int64) error {
+	const query = `UPDATE storage_volumes SET encryption_cursor=NULL WHERE id=$1 AND encryption_salt IS NOT NULL`
+	_, err := s.exec(query, volumeID)
+	return err
+}
+
+// OccupiedSectors returns up to limit occupied sector locations in a volume,
+// including replicas and cached copies, starting at volume index min, ordered
+// by index.
+func (s *Store) OccupiedSectors(volumeID int64, min uint64, limit int) (locations []storage.SectorLocation, err error) {
+	const query = `SELECT vs.id, vs.volume_id, vs.volume_index, s.sector_root
+FROM volume_sectors vs
+LEFT JOIN sector_replicas sr ON (sr.volume_sector_id=vs.id)
+LEFT JOIN cached_sectors cs ON (cs.volume_sector_id=vs.id)
+INNER JOIN stored_sectors s ON (s.id=COALESCE(vs.sector_id, sr.sector_id, cs.sector_id))
+WHERE vs.volume_id=$1 AND vs.volume_index >= $2
+ORDER BY vs.volume_index ASC
+LIMIT $3`
+
+	rows, err := s.query(query, volumeID, min, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sectors: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var loc storage.SectorLocation
+		if err := rows.Scan(&loc.ID, &loc.Volume, &loc.Index, (*sqlHash256)(&loc.Root)); err != nil {
+			return nil, fmt.Errorf("failed to scan sector location: %w", err)
+		}
+		locations = append(locations, loc)
+	}
+	return locations, rows.Err()
+}
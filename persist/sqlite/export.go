@@ -0,0 +1,286 @@
+package sqlite
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	rhp2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+	"go.sia.tech/hostd/host/contracts"
+	"go.sia.tech/hostd/host/storage"
+)
+
+// ExportSectors returns up to limit sectors stored in a volume, including
+// replicas, with their contract and temp storage references, starting at
+// volume index min, ordered by index.
+func (s *Store) ExportSectors(volumeID int64, min uint64, limit int) (sectors []storage.ExportSector, err error) {
+	const query = `SELECT vs.volume_index, s.id, s.sector_root
+FROM volume_sectors vs
+LEFT JOIN sector_replicas sr ON (sr.volume_sector_id=vs.id)
+INNER JOIN stored_sectors s ON (s.id=COALESCE(vs.sector_id, sr.sector_id))
+WHERE vs.volume_id=$1 AND vs.volume_index >= $2 AND (vs.sector_id IS NOT NULL OR sr.sector_id IS NOT NULL)
+ORDER BY vs.volume_index ASC
+LIMIT $3`
+
+	err = s.transaction(func(tx txn) error {
+		rows, err := tx.Query(query, volumeID, min, limit)
+		if err != nil {
+			return fmt.Errorf("failed to query sectors: %w", err)
+		}
+		var sectorIDs []int64
+		for rows.Next() {
+			var id int64
+			var sector storage.ExportSector
+			if err := rows.Scan(&sector.Index, &id, (*sqlHash256)(&sector.Root)); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan sector: %w", err)
+			}
+			sectorIDs = append(sectorIDs, id)
+			sectors = append(sectors, sector)
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to query sectors: %w", err)
+		} else if err := rows.Close(); err != nil {
+			return fmt.Errorf("failed to close rows: %w", err)
+		}
+
+		contractStmt, err := tx.Prepare(`SELECT c.contract_id, csr.root_index, c.window_end FROM contract_sector_roots csr
+INNER JOIN contracts c ON (c.id=csr.contract_id)
+WHERE csr.sector_id=$1`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare contract query: %w", err)
+		}
+		defer contractStmt.Close()
+
+		tempStmt, err := tx.Prepare(`SELECT COALESCE(MAX(expiration_height), 0) FROM temp_storage_sector_roots WHERE sector_id=$1`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare temp query: %w", err)
+		}
+		defer tempStmt.Close()
+
+		for i, id := range sectorIDs {
+			sectors[i].Contracts, err = exportContractRefs(contractStmt, id)
+			if err != nil {
+				return fmt.Errorf("failed to get contract references: %w", err)
+			} else if err := tempStmt.QueryRow(id).Scan(&sectors[i].TempExpiration); err != nil {
+				return fmt.Errorf("failed to get temp storage expiration: %w", err)
+			}
+		}
+		return nil
+	})
+	return
+}
+
+func exportContractRefs(stmt *loggedStmt, sectorID int64) (refs []storage.ContractSectorRef, err error) {
+	rows, err := stmt.Query(sectorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ref storage.ContractSectorRef
+		if err := rows.Scan((*sqlHash256)(&ref.ContractID), &ref.RootIndex, &ref.WindowEnd); err != nil {
+			return nil, fmt.Errorf("failed to scan contract reference: %w", err)
+		}
+		refs = append(refs, ref)
+	}
+	return refs, rows.Err()
+}
+
+// ExportContract returns a contract referenced by exported sectors along with
+// its formation transaction set.
+func (s *Store) ExportContract(id types.FileContractID) (ec storage.ExportContract, err error) {
+	err = s.transaction(func(tx txn) error {
+		var dbID int64
+		var buf []byte
+		err := tx.QueryRow(`SELECT id, formation_txn_set FROM contracts WHERE contract_id=$1`, sqlHash256(id)).Scan(&dbID, &buf)
+		if errors.Is(err, sql.ErrNoRows) {
+			return contracts.ErrNotFound
+		} else if err != nil {
+			return fmt.Errorf("failed to get contract: %w", err)
+		} else if err := decodeTxnSet(buf, &ec.FormationSet); err != nil {
+			return fmt.Errorf("failed to decode formation txn set: %w", err)
+		}
+		contract, err := getContract(tx, dbID)
+		if err != nil {
+			return err
+		}
+		ec.Revision = contract.Revision
+		ec.HostSignature = contract.HostSignature
+		ec.RenterSignature = contract.RenterSignature
+		ec.Status = contract.Status.String()
+		ec.LockedCollateral = contract.LockedCollateral
+		ec.Usage = storage.ExportContractUsage(contract.Usage)
+		ec.NegotiationHeight = contract.NegotiationHeight
+		ec.FormationConfirmed = contract.FormationConfirmed
+		ec.RevisionConfirmed = contract.RevisionConfirmed
+		ec.ResolutionHeight = contract.ResolutionHeight
+		return nil
+	})
+	return
+}
+
+// ImportContract adds a contract from a volume export. The contract's status
+// and confirmation state are kept so the contract does not need to be
+// reconfirmed. If the contract already exists, it is not modified and false
+// is returned. Contracts formed with a different host key are rejected with
+// storage.ErrContractHostKeyMismatch.
+func (s *Store) ImportContract(ec storage.ExportContract) (imported bool, err error) {
+	hostKey := s.HostKey().PublicKey()
+	if uc := ec.Revision.UnlockConditions; len(uc.PublicKeys) != 2 || uc.PublicKeys[1].Algorithm != types.SpecifierEd25519 || !bytes.Equal(uc.PublicKeys[1].Key, hostKey[:]) {
+		return false, storage.ErrContractHostKeyMismatch
+	}
+
+	// the status is stored as a string in the export
+	var status contracts.ContractStatus
+	if err := status.UnmarshalJSON([]byte(ec.Status)); err != nil {
+		return false, fmt.Errorf("failed to parse contract status: %w", err)
+	}
+	usage := contracts.Usage(ec.Usage)
+	revision := contracts.SignedRevision{
+		Revision:        ec.Revision,
+		HostSignature:   ec.HostSignature,
+		RenterSignature: ec.RenterSignature,
+	}
+
+	err = s.transaction(func(tx txn) error {
+		var dbID int64
+		err := tx.QueryRow(`SELECT id FROM contracts WHERE contract_id=$1`, sqlHash256(ec.Revision.ParentID)).Scan(&dbID)
+		if err == nil {
+			return nil
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to check for existing contract: %w", err)
+		}
+
+		dbID, err = insertContract(tx, revision, ec.FormationSet, ec.LockedCollateral, usage, ec.NegotiationHeight)
+		if err != nil {
+			return fmt.Errorf("failed to insert contract: %w", err)
+		}
+
+		var confirmedRevision uint64
+		if ec.RevisionConfirmed {
+			confirmedRevision = ec.Revision.RevisionNumber
+		}
+		var resolutionHeight sql.NullInt64
+		if ec.ResolutionHeight != 0 {
+			resolutionHeight = sql.NullInt64{Int64: int64(ec.ResolutionHeight), Valid: true}
+		}
+		const query = `UPDATE contracts SET formation_confirmed=$1, confirmed_revision_number=$2, resolution_height=$3 WHERE id=$4 RETURNING id`
+		if err := tx.QueryRow(query, ec.FormationConfirmed, sqlUint64(confirmedRevision), resolutionHeight, dbID).Scan(&dbID); err != nil {
+			return fmt.Errorf("failed to update contract state: %w", err)
+		} else if err := setContractStatus(tx, ec.Revision.ParentID, status); err != nil {
+			return fmt.Errorf("failed to set contract status: %w", err)
+		}
+
+		switch status {
+		case contracts.ContractStatusPending, contracts.ContractStatusActive:
+		default:
+			// successful, failed and rejected contracts do not count towards
+			// the collateral and potential revenue metrics
+			if err := incrementCurrencyStat(tx, metricLockedCollateral, ec.LockedCollateral, true, time.Now()); err != nil {
+				return fmt.Errorf("failed to decrement locked collateral stat: %w", err)
+			} else if err := incrementCurrencyStat(tx, metricRiskedCollateral, usage.RiskedCollateral, true, time.Now()); err != nil {
+				return fmt.Errorf("failed to decrement risked collateral stat: %w", err)
+			} else if err := incrementPotentialRevenueMetrics(tx, usage, true); err != nil {
+				return fmt.Errorf("failed to decrement potential revenue: %w", err)
+			}
+
+			if status == contracts.ContractStatusSuccessful && ec.RevisionConfirmed {
+				if err := incrementEarnedRevenueMetrics(tx, usage, false); err != nil {
+					return fmt.Errorf("failed to increment earned revenue: %w", err)
+				}
+			}
+		}
+		imported = true
+		return nil
+	})
+	return
+}
+
+// importContractRoot adds a contract's reference to an imported sector. If
+// the root index is used by another sector or outside the contract's current
+// revision, false is returned. The contract must exist.
+func importContractRoot(tx txn, sectorID int64, ref storage.ContractSectorRef) (bool, error) {
+	var contractDBID int64
+	var buf []byte
+	err := tx.QueryRow(`SELECT id, raw_revision FROM contracts WHERE contract_id=$1`, sqlHash256(ref.ContractID)).Scan(&contractDBID, &buf)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, contracts.ErrNotFound
+	} else if err != nil {
+		return false, fmt.Errorf("failed to get contract: %w", err)
+	}
+
+	var revision types.FileContractRevision
+	if err := decodeRevision(buf, &revision); err != nil {
+		return false, fmt.Errorf("failed to decode revision: %w", err)
+	} else if ref.RootIndex >= revision.Filesize/rhp2.SectorSize {
+		return false, nil
+	}
+
+	var existingID int64
+	err = tx.QueryRow(`SELECT sector_id FROM contract_sector_roots WHERE contract_id=$1 AND root_index=$2`, contractDBID, ref.RootIndex).Scan(&existingID)
+	if err == nil {
+		// the root is already stored, only a different sector conflicts
+		return existingID == sectorID, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("failed to get contract root: %w", err)
+	}
+
+	err = updateEphemeralSectors(tx, []int64{sectorID}, func() error {
+		_, err := tx.Exec(`INSERT INTO contract_sector_roots (contract_id, sector_id, root_index) VALUES ($1, $2, $3)`, contractDBID, sectorID, ref.RootIndex)
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to add contract root: %w", err)
+	} else if err := incrementNumericStat(tx, metricContractSectors, 1, time.Now()); err != nil {
+		return false, fmt.Errorf("failed to update metric: %w", err)
+	}
+	return true, nil
+}
+
+// ImportSectorReferences adds the contract and temp storage references of an
+// imported sector. The referenced contracts must exist. A contract reference
+// is only added if the root index is empty and within the contract's current
+// revision. Other references keep the sector in temp storage until the
+// contract's proof window ends. The number of contract roots registered is
+// returned.
+func (s *Store) ImportSectorReferences(root types.Hash256, refs []storage.ContractSectorRef, tempExpiration uint64) (registered int, err error) {
+	err = s.transaction(func(tx txn) error {
+		registered = 0
+		sectorID, err := sectorDBID(tx, root)
+		if err != nil {
+			return fmt.Errorf("failed to get sector id: %w", err)
+		}
+
+		expiration := tempExpiration
+		for _, ref := range refs {
+			ok, err := importContractRoot(tx, sectorID, ref)
+			if err != nil {
+				return fmt.Errorf("failed to import contract %v root %v: %w", ref.ContractID, ref.RootIndex, err)
+			} else if ok {
+				registered++
+			} else if ref.WindowEnd > expiration {
+				expiration = ref.WindowEnd
+			}
+		}
+
+		if expiration == 0 {
+			return nil
+		}
+		err = updateEphemeralSectors(tx, []int64{sectorID}, func() error {
+			_, err := tx.Exec(`INSERT INTO temp_storage_sector_roots (sector_id, expiration_height) VALUES ($1, $2)`, sectorID, expiration)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to add temp sector root: %w", err)
+		} else if err := incrementNumericStat(tx, metricTempSectors, 1, time.Now()); err != nil {
+			return fmt.Errorf("failed to update metric: %w", err)
+		}
+		return nil
+	})
+	return
+}
@@ -0,0 +1,417 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"time"
+
+	rhp2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+	"go.sia.tech/hostd/host/storage"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/xts"
+)
+
+// fsckDataBatchSize is the number of sector locations loaded at a time when
+// checking volume data.
+const fsckDataBatchSize = 1000
+
+type (
+	// FsckVolumeCount is a volume counter that does not match the volume's
+	// sector metadata.
+	FsckVolumeCount struct {
+		VolumeID int64  `json:"volumeID"`
+		Stored   uint64 `json:"stored"`
+		Actual   uint64 `json:"actual"`
+	}
+
+	// FsckDanglingReference is a row that references a missing row in another
+	// table.
+	FsckDanglingReference struct {
+		Table    string `json:"table"`
+		RowID    int64  `json:"rowID"`
+		Parent   string `json:"parent"`
+		Repaired bool   `json:"repaired"`
+	}
+
+	// FsckCorruptSector is a sector whose data does not match its root.
+	FsckCorruptSector struct {
+		VolumeID int64         `json:"volumeID"`
+		Index    uint64        `json:"index"`
+		Root     types.Hash256 `json:"root"`
+		Error    string        `json:"error"`
+	}
+
+	// FsckUnreadableVolume is a volume whose data could not be checked.
+	FsckUnreadableVolume struct {
+		VolumeID int64  `json:"volumeID"`
+		Path     string `json:"path"`
+		Error    string `json:"error"`
+	}
+
+	// FsckOptions are the options for Fsck.
+	FsckOptions struct {
+		// Repair fixes the repairable issues.
+		Repair bool
+		// CheckData reads every stored sector and verifies its root. This
+		// can take a long time on large volumes.
+		CheckData bool
+	}
+
+	// An FsckReport is the result of checking the consistency of the
+	// database.
+	FsckReport struct {
+		// OrphanedSectors are sectors that are not referenced by a contract
+		// or temp storage.
+		OrphanedSectors []types.Hash256 `json:"orphanedSectors"`
+		// LostSectors are referenced sectors that are not stored in any
+		// volume. Their data cannot be recovered.
+		LostSectors []types.Hash256 `json:"lostSectors"`
+		// DanglingReferences are rows that reference missing rows.
+		DanglingReferences []FsckDanglingReference `json:"danglingReferences"`
+		// UsedSectors are volumes with an incorrect used sector count.
+		UsedSectors []FsckVolumeCount `json:"usedSectors"`
+		// TotalSectors are volumes with an incorrect total sector count.
+		TotalSectors []FsckVolumeCount `json:"totalSectors"`
+		// LockedSectors and LockedLocations are leftover lock rows. No
+		// locks should be held while the host is not running.
+		LockedSectors   uint64 `json:"lockedSectors"`
+		LockedLocations uint64 `json:"lockedLocations"`
+		// CorruptSectors and UnreadableVolumes are only checked if
+		// CheckData is set. Corrupt data cannot be repaired by fsck.
+		CorruptSectors    []FsckCorruptSector    `json:"corruptSectors,omitempty"`
+		UnreadableVolumes []FsckUnreadableVolume `json:"unreadableVolumes,omitempty"`
+
+		// Repaired is true if the repairable issues were fixed.
+		Repaired bool `json:"repaired"`
+	}
+)
+
+// Issues returns the number of issues found.
+func (r FsckReport) Issues() int {
+	n := len(r.OrphanedSectors) + len(r.LostSectors) + len(r.DanglingReferences) + len(r.UsedSectors) + len(r.TotalSectors) + len(r.CorruptSectors) + len(r.UnreadableVolumes)
+	if r.LockedSectors > 0 {
+		n++
+	}
+	if r.LockedLocations > 0 {
+		n++
+	}
+	return n
+}
+
+// Unrepaired returns the number of issues that were not fixed. Lost sectors,
+// corrupt data, and some dangling references cannot be repaired.
+func (r FsckReport) Unrepaired() int {
+	if !r.Repaired {
+		return r.Issues()
+	}
+	n := len(r.LostSectors) + len(r.CorruptSectors) + len(r.UnreadableVolumes)
+	for _, ref := range r.DanglingReferences {
+		if !ref.Repaired {
+			n++
+		}
+	}
+	return n
+}
+
+// repairDanglingQueries are the statements used to repair dangling references
+// in each table. Rows in other tables, such as contract sector roots, cannot
+// be repaired without losing data and are only reported.
+var repairDanglingQueries = map[string]string{
+	"locked_sectors":            `DELETE FROM locked_sectors WHERE rowid=$1`,
+	"locked_volume_sectors":     `DELETE FROM locked_volume_sectors WHERE rowid=$1`,
+	"sector_replicas":           `DELETE FROM sector_replicas WHERE rowid=$1`,
+	"cached_sectors":            `DELETE FROM cached_sectors WHERE rowid=$1`,
+	"temp_storage_sector_roots": `DELETE FROM temp_storage_sector_roots WHERE rowid=$1`,
+	"volume_scrub_errors":       `DELETE FROM volume_scrub_errors WHERE rowid=$1`,
+	"volume_sectors":            `UPDATE volume_sectors SET sector_id=NULL WHERE rowid=$1`,
+}
+
+func fsckSectorRoots(tx txn, query string) (roots []types.Hash256, err error) {
+	rows, err := tx.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var root types.Hash256
+		if err := rows.Scan((*sqlHash256)(&root)); err != nil {
+			return nil, fmt.Errorf("failed to scan sector root: %w", err)
+		}
+		roots = append(roots, root)
+	}
+	return roots, rows.Err()
+}
+
+// fsckOrphanedSectors returns the IDs and roots of sectors not referenced by
+// a contract or temp storage. Locks are ignored since no locks should be held
+// while the host is not running.
+func fsckOrphanedSectors(tx txn) (ids []int64, roots []types.Hash256, err error) {
+	const query = `SELECT s.id, s.sector_root FROM stored_sectors s
+WHERE NOT EXISTS (SELECT 1 FROM contract_sector_roots csr WHERE csr.sector_id=s.id)
+AND NOT EXISTS (SELECT 1 FROM temp_storage_sector_roots tsr WHERE tsr.sector_id=s.id)
+ORDER BY s.id ASC`
+	rows, err := tx.Query(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var root types.Hash256
+		if err := rows.Scan(&id, (*sqlHash256)(&root)); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan sector: %w", err)
+		}
+		ids = append(ids, id)
+		roots = append(roots, root)
+	}
+	return ids, roots, rows.Err()
+}
+
+// fsckLostSectors returns the roots of referenced sectors that are not stored
+// in any volume.
+func fsckLostSectors(tx txn) ([]types.Hash256, error) {
+	const query = `SELECT s.sector_root FROM stored_sectors s
+WHERE NOT EXISTS (SELECT 1 FROM volume_sectors vs WHERE vs.sector_id=s.id)
+AND (EXISTS (SELECT 1 FROM contract_sector_roots csr WHERE csr.sector_id=s.id)
+	OR EXISTS (SELECT 1 FROM temp_storage_sector_roots tsr WHERE tsr.sector_id=s.id))
+ORDER BY s.id ASC`
+	return fsckSectorRoots(tx, query)
+}
+
+// fsckDanglingReferences returns the rows that violate a foreign key
+// constraint.
+func fsckDanglingReferences(tx txn) (refs []FsckDanglingReference, err error) {
+	rows, err := tx.Query(`PRAGMA foreign_key_check`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ref FsckDanglingReference
+		var rowID sql.NullInt64
+		var fkID int64
+		if err := rows.Scan(&ref.Table, &rowID, &ref.Parent, &fkID); err != nil {
+			return nil, fmt.Errorf("failed to scan foreign key violation: %w", err)
+		}
+		ref.RowID = rowID.Int64
+		refs = append(refs, ref)
+	}
+	return refs, rows.Err()
+}
+
+// fsckVolumeCounts returns the volumes with used or total sector counts that
+// do not match their sector metadata. Replicas and cached copies count as
+// used sectors.
+func fsckVolumeCounts(tx txn) (used, total []FsckVolumeCount, err error) {
+	const query = `SELECT v.id, v.used_sectors, v.total_sectors,
+	(SELECT COUNT(*) FROM volume_sectors vs WHERE vs.volume_id=v.id AND vs.sector_id IS NOT NULL) +
+	(SELECT COUNT(*) FROM sector_replicas sr INNER JOIN volume_sectors vs ON (vs.id=sr.volume_sector_id) WHERE vs.volume_id=v.id) +
+	(SELECT COUNT(*) FROM cached_sectors cs INNER JOIN volume_sectors vs ON (vs.id=cs.volume_sector_id) WHERE vs.volume_id=v.id),
+	(SELECT COUNT(*) FROM volume_sectors vs WHERE vs.volume_id=v.id)
+FROM storage_volumes v
+ORDER BY v.id ASC`
+	rows, err := tx.Query(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var storedUsed, storedTotal, actualUsed, actualTotal uint64
+		if err := rows.Scan(&id, &storedUsed, &storedTotal, &actualUsed, &actualTotal); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan volume: %w", err)
+		}
+		if storedUsed != actualUsed {
+			used = append(used, FsckVolumeCount{VolumeID: id, Stored: storedUsed, Actual: actualUsed})
+		}
+		if storedTotal != actualTotal {
+			total = append(total, FsckVolumeCount{VolumeID: id, Stored: storedTotal, Actual: actualTotal})
+		}
+	}
+	return used, total, rows.Err()
+}
+
+// fsckRepair fixes the repairable issues in the report. Locks are cleared
+// first so orphaned sectors can be pruned, then volume counters are
+// recalculated.
+func fsckRepair(tx txn, report *FsckReport, orphanIDs []int64) error {
+	if _, err := tx.Exec(`DELETE FROM locked_volume_sectors`); err != nil {
+		return fmt.Errorf("failed to clear locked locations: %w", err)
+	} else if _, err := tx.Exec(`DELETE FROM locked_sectors`); err != nil {
+		return fmt.Errorf("failed to clear locked sectors: %w", err)
+	}
+
+	for i, ref := range report.DanglingReferences {
+		query, ok := repairDanglingQueries[ref.Table]
+		if !ok || (ref.Table == "volume_sectors" && ref.Parent != "stored_sectors") {
+			continue
+		} else if _, err := tx.Exec(query, ref.RowID); err != nil {
+			return fmt.Errorf("failed to repair %v row %v: %w", ref.Table, ref.RowID, err)
+		}
+		report.DanglingReferences[i].Repaired = true
+	}
+
+	for _, id := range orphanIDs {
+		if err := pruneSectorRef(tx, id); err != nil {
+			return fmt.Errorf("failed to prune sector %v: %w", id, err)
+		}
+	}
+
+	// recalculate the volume counters after the sectors have been pruned
+	used, total, err := fsckVolumeCounts(tx)
+	if err != nil {
+		return fmt.Errorf("failed to check volume counts: %w", err)
+	}
+	for _, c := range used {
+		if err := incrementVolumeUsage(tx, c.VolumeID, int(c.Actual)-int(c.Stored)); err != nil {
+			return fmt.Errorf("failed to update volume %v used sectors: %w", c.VolumeID, err)
+		}
+	}
+	for _, c := range total {
+		if _, err := tx.Exec(`UPDATE storage_volumes SET total_sectors=$1 WHERE id=$2`, c.Actual, c.VolumeID); err != nil {
+			return fmt.Errorf("failed to update volume %v total sectors: %w", c.VolumeID, err)
+		} else if err := incrementNumericStat(tx, metricTotalSectors, int(c.Actual)-int(c.Stored), time.Now()); err != nil {
+			return fmt.Errorf("failed to update total sectors metric: %w", err)
+		}
+	}
+	return nil
+}
+
+// fsckVolumeData reads each sector stored in the volume and compares it to
+// its root.
+func (s *Store) fsckVolumeData(ctx context.Context, vol storage.Volume, report *FsckReport) error {
+	f, err := storage.OpenVolumeData(vol)
+	if err != nil {
+		report.UnreadableVolumes = append(report.UnreadableVolumes, FsckUnreadableVolume{VolumeID: vol.ID, Path: vol.LocalPath, Error: err.Error()})
+		return nil
+	}
+	defer f.Close()
+
+	var cipher *xts.Cipher
+	if vol.Encrypted {
+		cipher, err = storage.VolumeCipher(s.HostKey(), vol.EncryptionSalt)
+		if err != nil {
+			return fmt.Errorf("failed to initialize volume %v cipher: %w", vol.ID, err)
+		}
+	}
+
+	var min uint64
+	buf := make([]byte, rhp2.SectorSize)
+	for {
+		locations, err := s.ScrubSectors(vol.ID, min, fsckDataBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to get volume %v sectors: %w", vol.ID, err)
+		} else if len(locations) == 0 {
+			return nil
+		}
+
+		for _, loc := range locations {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			corrupt := FsckCorruptSector{VolumeID: vol.ID, Index: loc.Index, Root: loc.Root}
+			if _, err := f.ReadAt(buf, int64(loc.Index)*rhp2.SectorSize); err != nil && err != io.EOF {
+				corrupt.Error = err.Error()
+				report.CorruptSectors = append(report.CorruptSectors, corrupt)
+				continue
+			}
+			encrypted := cipher != nil && (vol.EncryptionCursor == nil || loc.Index < *vol.EncryptionCursor)
+			if encrypted {
+				cipher.Decrypt(buf, buf, loc.Index)
+			}
+			root := rhp2.SectorRoot((*[rhp2.SectorSize]byte)(buf))
+			if root != loc.Root && cipher != nil && !encrypted {
+				// sectors above the cursor may have been encrypted before
+				// the cursor was persisted
+				cipher.Decrypt(buf, buf, loc.Index)
+				root = rhp2.SectorRoot((*[rhp2.SectorSize]byte)(buf))
+			}
+			if root != loc.Root {
+				corrupt.Error = fmt.Sprintf("root mismatch: expected %v, got %v", loc.Root, root)
+				report.CorruptSectors = append(report.CorruptSectors, corrupt)
+			}
+		}
+		min = locations[len(locations)-1].Index + 1
+	}
+}
+
+// Fsck checks the consistency of the sector metadata in the database at fp
+// and, optionally, the data stored in each volume. If opts.Repair is set,
+// orphaned sectors are pruned, leftover locks are cleared, repairable
+// dangling references are removed, and volume counters are recalculated. The
+// database is locked exclusively while it is checked. If it is in use,
+// ErrDatabaseInUse is returned. The database is never migrated, its schema
+// version must match the version expected by this build.
+func Fsck(ctx context.Context, fp string, opts FsckOptions, log *zap.Logger) (report FsckReport, err error) {
+	db, err := openExclusive(fp)
+	if err != nil {
+		return FsckReport{}, err
+	}
+	// the store is not opened with OpenDatabase since leftover locks would
+	// be cleared before they could be reported
+	s := &Store{
+		db:  db,
+		log: log,
+	}
+	defer s.Close()
+	if version, expected := getDBVersion(db), int64(len(migrations)+1); version != expected {
+		return FsckReport{}, fmt.Errorf("database has version %d, expected %d", version, expected)
+	}
+
+	if opts.CheckData {
+		volumes, err := s.Volumes()
+		if err != nil {
+			return FsckReport{}, fmt.Errorf("failed to get volumes: %w", err)
+		}
+		for _, vol := range volumes {
+			if err := s.fsckVolumeData(ctx, vol, &report); err != nil {
+				return FsckReport{}, err
+			}
+		}
+	}
+
+	err = s.transaction(func(tx txn) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM locked_sectors`).Scan(&report.LockedSectors); err != nil {
+			return fmt.Errorf("failed to count locked sectors: %w", err)
+		} else if err := tx.QueryRow(`SELECT COUNT(*) FROM locked_volume_sectors`).Scan(&report.LockedLocations); err != nil {
+			return fmt.Errorf("failed to count locked locations: %w", err)
+		}
+
+		orphanIDs, orphans, err := fsckOrphanedSectors(tx)
+		if err != nil {
+			return fmt.Errorf("failed to check orphaned sectors: %w", err)
+		}
+		report.OrphanedSectors = orphans
+
+		report.LostSectors, err = fsckLostSectors(tx)
+		if err != nil {
+			return fmt.Errorf("failed to check lost sectors: %w", err)
+		}
+		report.DanglingReferences, err = fsckDanglingReferences(tx)
+		if err != nil {
+			return fmt.Errorf("failed to check foreign keys: %w", err)
+		}
+		report.UsedSectors, report.TotalSectors, err = fsckVolumeCounts(tx)
+		if err != nil {
+			return fmt.Errorf("failed to check volume counts: %w", err)
+		}
+
+		if !opts.Repair || report.Issues() == 0 {
+			return nil
+		} else if err := ctx.Err(); err != nil {
+			return err
+		} else if err := fsckRepair(tx, &report, orphanIDs); err != nil {
+			return err
+		}
+		report.Repaired = true
+		return nil
+	})
+	return
+}
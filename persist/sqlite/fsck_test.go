@@ -0,0 +1,154 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	rhp2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/hostd/host/storage"
+	"go.uber.org/zap/zaptest"
+	"lukechampine.com/frand"
+)
+
+func TestFsck(t *testing.T) {
+	const sectors = 10
+	log := zaptest.NewLogger(t)
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "test.db")
+	db, err := OpenDatabase(dbPath, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	volumePath := filepath.Join(dir, "volume.dat")
+	f, err := os.Create(volumePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	volume, err := addTestVolume(db, volumePath, sectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// store sectors without releasing their locks, only half of them are
+	// referenced by temp storage
+	for i := 0; i < sectors; i++ {
+		var sector [rhp2.SectorSize]byte
+		frand.Read(sector[:256])
+		root := rhp2.SectorRoot(&sector)
+		_, err := db.StoreSector(root, func(loc storage.SectorLocation, exists bool) error {
+			_, err := f.WriteAt(sector[:], int64(loc.Index)*rhp2.SectorSize)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i%2 == 0 {
+			if err := db.AddTemporarySectors([]storage.TempSector{{Root: root, Expiration: 100}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// corrupt the first sector and the volume's usage counter
+	if _, err := f.WriteAt(frand.Bytes(64), 0); err != nil {
+		t.Fatal(err)
+	} else if _, err := db.exec(`UPDATE storage_volumes SET used_sectors=used_sectors+3 WHERE id=$1`, volume.ID); err != nil {
+		t.Fatal(err)
+	} else if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// check the database without repairing it
+	report, err := Fsck(context.Background(), dbPath, FsckOptions{CheckData: true}, log)
+	if err != nil {
+		t.Fatal(err)
+	} else if report.Repaired {
+		t.Fatal("expected report to not be repaired")
+	} else if report.LockedSectors != sectors || report.LockedLocations != sectors {
+		t.Fatalf("expected %v locked sectors and locations, got %v and %v", sectors, report.LockedSectors, report.LockedLocations)
+	} else if len(report.OrphanedSectors) != sectors/2 {
+		t.Fatalf("expected %v orphaned sectors, got %v", sectors/2, len(report.OrphanedSectors))
+	} else if len(report.UsedSectors) != 1 || report.UsedSectors[0].Stored != sectors+3 || report.UsedSectors[0].Actual != sectors {
+		t.Fatalf("expected used sector mismatch, got %+v", report.UsedSectors)
+	} else if len(report.CorruptSectors) != 1 || report.CorruptSectors[0].Index != 0 {
+		t.Fatalf("expected sector 0 to be corrupt, got %+v", report.CorruptSectors)
+	} else if len(report.LostSectors) != 0 || len(report.DanglingReferences) != 0 || len(report.TotalSectors) != 0 {
+		t.Fatalf("unexpected issues: %+v", report)
+	}
+
+	// a second check should find the same issues
+	if report2, err := Fsck(context.Background(), dbPath, FsckOptions{}, log); err != nil {
+		t.Fatal(err)
+	} else if report2.LockedSectors != sectors || len(report2.OrphanedSectors) != sectors/2 {
+		t.Fatal("expected check to not modify the database")
+	}
+
+	// repair the database
+	report, err = Fsck(context.Background(), dbPath, FsckOptions{Repair: true}, log)
+	if err != nil {
+		t.Fatal(err)
+	} else if !report.Repaired {
+		t.Fatal("expected report to be repaired")
+	} else if report.Unrepaired() != 0 {
+		t.Fatalf("expected all issues to be repaired, got %v", report.Unrepaired())
+	}
+
+	// the repaired database should be consistent
+	report, err = Fsck(context.Background(), dbPath, FsckOptions{}, log)
+	if err != nil {
+		t.Fatal(err)
+	} else if report.Issues() != 0 {
+		t.Fatalf("expected no issues, got %+v", report)
+	}
+
+	db, err = OpenDatabase(dbPath, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	volume, err = db.Volume(volume.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if volume.UsedSectors != sectors/2 {
+		t.Fatalf("expected %v used sectors, got %v", sectors/2, volume.UsedSectors)
+	}
+}
+
+func TestFsckPreconditions(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := OpenDatabase(dbPath, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the database must not be checked while it is in use
+	if _, err := Fsck(context.Background(), dbPath, FsckOptions{Repair: true}, log); !errors.Is(err, ErrDatabaseInUse) {
+		t.Fatalf("expected database in use, got %v", err)
+	}
+
+	// the database must not be migrated by the check
+	if _, err := db.exec(`UPDATE global_settings SET db_version=1`); err != nil {
+		t.Fatal(err)
+	} else if err := db.Close(); err != nil {
+		t.Fatal(err)
+	} else if _, err := Fsck(context.Background(), dbPath, FsckOptions{Repair: true}, log); err == nil || !strings.Contains(err.Error(), "database has version 1") {
+		t.Fatalf("expected version mismatch, got %v", err)
+	}
+
+	raw, err := sql.Open("sqlite3", sqliteFilepath(dbPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	if version := getDBVersion(raw); version != 1 {
+		t.Fatalf("expected version 1, got %v", version)
+	}
+}
@@ -9,6 +9,12 @@ CREATE TABLE wallet_utxos (
 	unlock_hash BLOB NOT NULL
 );
 
+CREATE TABLE wallet_retired_keys (
+	id INTEGER PRIMARY KEY,
+	address BLOB UNIQUE NOT NULL,
+	encrypted_key BLOB NOT NULL -- encrypted with a key derived from the current wallet key
+);
+
 CREATE TABLE wallet_transactions (
 	id INTEGER PRIMARY KEY,
 	transaction_id BLOB NOT NULL,
@@ -45,7 +51,12 @@ CREATE TABLE storage_volumes (
 	used_sectors INTEGER NOT NULL,
 	total_sectors INTEGER NOT NULL,
 	read_only BOOLEAN NOT NULL,
-	available BOOLEAN NOT NULL DEFAULT false
+	available BOOLEAN NOT NULL DEFAULT false,
+	cache_tier BOOLEAN NOT NULL DEFAULT false,
+	priority INTEGER NOT NULL DEFAULT 1,
+	encryption_salt BLOB, -- null if the volume is not encrypted
+	encryption_cursor INTEGER, -- the number of leading sectors encrypted while the volume is being migrated, null otherwise
+	s3_config TEXT -- JSON encoded object storage configuration, null for local volumes
 );
 CREATE INDEX storage_volumes_id_available_read_only ON storage_volumes(id, available, read_only);
 CREATE INDEX storage_volumes_read_only_available_used_sectors ON storage_volumes(available, read_only, used_sectors);
@@ -64,6 +75,44 @@ CREATE INDEX volume_sectors_volume_id ON volume_sectors(volume_id);
 CREATE INDEX volume_sectors_volume_index ON volume_sectors(volume_index ASC);
 CREATE INDEX volume_sectors_sector_id ON volume_sectors(sector_id);
 
+-- additional copies of sectors stored in other volumes
+CREATE TABLE sector_replicas (
+	id INTEGER PRIMARY KEY,
+	sector_id INTEGER NOT NULL REFERENCES stored_sectors (id),
+	volume_sector_id INTEGER UNIQUE NOT NULL REFERENCES volume_sectors (id)
+);
+CREATE INDEX sector_replicas_sector_id ON sector_replicas(sector_id);
+
+-- copies of frequently read sectors stored in cache tier volumes
+CREATE TABLE cached_sectors (
+	id INTEGER PRIMARY KEY,
+	sector_id INTEGER UNIQUE NOT NULL REFERENCES stored_sectors (id),
+	volume_sector_id INTEGER UNIQUE NOT NULL REFERENCES volume_sectors (id),
+	last_access INTEGER NOT NULL
+);
+CREATE INDEX cached_sectors_last_access ON cached_sectors(last_access);
+
+CREATE TABLE volume_scrubs (
+	volume_id INTEGER PRIMARY KEY REFERENCES storage_volumes (id),
+	next_index INTEGER NOT NULL, -- the next volume index to check
+	sectors_checked INTEGER NOT NULL, -- sectors checked in the current pass
+	passes INTEGER NOT NULL,
+	pass_started INTEGER NOT NULL,
+	last_pass_completed INTEGER
+);
+
+CREATE TABLE volume_scrub_errors (
+	id INTEGER PRIMARY KEY,
+	volume_id INTEGER NOT NULL REFERENCES storage_volumes (id),
+	volume_index INTEGER NOT NULL,
+	sector_root BLOB NOT NULL,
+	error_type TEXT NOT NULL,
+	error_message TEXT NOT NULL,
+	date_detected INTEGER NOT NULL,
+	UNIQUE (volume_id, volume_index)
+);
+CREATE INDEX volume_scrub_errors_volume_id_volume_index ON volume_scrub_errors(volume_id, volume_index);
+
 CREATE TABLE locked_volume_sectors ( -- should be cleared at startup. currently persisted for simplicity, but may be moved to memory
 	id INTEGER PRIMARY KEY,
 	volume_sector_id INTEGER REFERENCES volume_sectors(id) ON DELETE CASCADE
@@ -193,8 +242,42 @@ CREATE TABLE host_settings (
 	ddns_update_v6 BOOLEAN NOT NULL,
 	ddns_opts BLOB,
 	registry_limit INTEGER NOT NULL,
-	sector_cache_size INTEGER NOT NULL DEFAULT 0
+	sector_cache_size INTEGER NOT NULL DEFAULT 0,
+	auto_pricing BLOB,
+	utilization_pricing BLOB,
+	scrub_rate INTEGER NOT NULL DEFAULT 60,
+	replication_factor INTEGER NOT NULL DEFAULT 1,
+	placement_policy TEXT NOT NULL DEFAULT 'leastUsed',
+	encrypt_volumes BOOLEAN NOT NULL DEFAULT false,
+	bandwidth_schedule BLOB
+);
+
+CREATE TABLE contract_policy (
+	id INTEGER PRIMARY KEY NOT NULL DEFAULT 0 CHECK (id = 0), -- enforce a single row
+	allowlist_only BOOLEAN NOT NULL,
+	min_contract_duration INTEGER NOT NULL,
+	max_renter_data INTEGER NOT NULL,
+	max_renter_collateral BLOB NOT NULL,
+	renter_ingress_limit INTEGER NOT NULL DEFAULT 0,
+	renter_egress_limit INTEGER NOT NULL DEFAULT 0,
+	max_renter_daily_egress INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE renter_access_list (
+	id INTEGER PRIMARY KEY,
+	public_key BLOB UNIQUE NOT NULL,
+	allowed BOOLEAN NOT NULL,
+	date_created INTEGER NOT NULL
+);
+
+CREATE TABLE renter_bandwidth (
+	renter_key BLOB NOT NULL,
+	date_created INTEGER NOT NULL,
+	ingress INTEGER NOT NULL,
+	egress INTEGER NOT NULL,
+	PRIMARY KEY (renter_key, date_created)
 );
+CREATE INDEX renter_bandwidth_date_created ON renter_bandwidth(date_created);
 
 CREATE TABLE webhooks (
 	id INTEGER PRIMARY KEY,
@@ -26,14 +26,15 @@ const (
 	metricAccountBalance = "accountBalance"
 
 	// storage
-	metricTotalSectors    = "totalSectors"
-	metricPhysicalSectors = "physicalSectors"
-	metricContractSectors = "contractSectors"
-	metricTempSectors     = "tempSectors"
-	metricSectorReads     = "sectorReads"
-	metricSectorWrites    = "sectorWrites"
-	metricSectorCacheHit  = "sectorCacheHit"
-	metricSectorCacheMiss = "sectorCacheMiss"
+	metricTotalSectors     = "totalSectors"
+	metricPhysicalSectors  = "physicalSectors"
+	metricContractSectors  = "contractSectors"
+	metricTempSectors      = "tempSectors"
+	metricEphemeralSectors = "ephemeralSectors"
+	metricSectorReads      = "sectorReads"
+	metricSectorWrites     = "sectorWrites"
+	metricSectorCacheHit   = "sectorCacheHit"
+	metricSectorCacheMiss  = "sectorCacheMiss"
 
 	// registry
 	metricMaxRegistryEntries = "maxRegistryEntries"
@@ -66,6 +67,9 @@ const (
 	metricSectorAccessPrice    = "sectorAccessPrice"
 	metricStoragePrice         = "storagePrice"
 	metricCollateralMultiplier = "collateralMultiplier"
+	// metricStoragePriceMultiplier is the multiplier applied to the base
+	// storage price by the utilization pricing curve
+	metricStoragePriceMultiplier = "storagePriceMultiplier"
 
 	// wallet
 	metricWalletBalance = "walletBalance"
@@ -337,6 +341,9 @@ func mustParseMetricValue(stat string, buf []byte, m *metrics.Metrics) {
 	case metricCollateralMultiplier:
 		value := mustScanUint64(buf)
 		m.Pricing.CollateralMultiplier = math.Float64frombits(value)
+	case metricStoragePriceMultiplier:
+		value := mustScanUint64(buf)
+		m.Pricing.StoragePriceMultiplier = math.Float64frombits(value)
 	// contracts
 	case metricPendingContracts:
 		m.Contracts.Pending = mustScanUint64(buf)
@@ -366,6 +373,8 @@ func mustParseMetricValue(stat string, buf []byte, m *metrics.Metrics) {
 		m.Storage.ContractSectors = mustScanUint64(buf)
 	case metricTempSectors:
 		m.Storage.TempSectors = mustScanUint64(buf)
+	case metricEphemeralSectors:
+		m.Storage.EphemeralSectors = mustScanUint64(buf)
 	case metricSectorReads:
 		m.Storage.Reads = mustScanUint64(buf)
 	case metricSectorWrites:
@@ -10,6 +10,173 @@ import (
 	"go.uber.org/zap"
 )
 
+// migrateVersion37 adds the renter bandwidth limit columns to the
+// contract_policy table and the renter_bandwidth table
+func migrateVersion37(tx txn, _ *zap.Logger) error {
+	const query = `ALTER TABLE contract_policy ADD COLUMN renter_ingress_limit INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE contract_policy ADD COLUMN renter_egress_limit INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE contract_policy ADD COLUMN max_renter_daily_egress INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE renter_bandwidth (
+	renter_key BLOB NOT NULL,
+	date_created INTEGER NOT NULL,
+	ingress INTEGER NOT NULL,
+	egress INTEGER NOT NULL,
+	PRIMARY KEY (renter_key, date_created)
+);
+CREATE INDEX renter_bandwidth_date_created ON renter_bandwidth(date_created);`
+	_, err := tx.Exec(query)
+	return err
+}
+
+// migrateVersion36 adds the bandwidth_schedule column to the host_settings
+// table
+func migrateVersion36(tx txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`ALTER TABLE host_settings ADD COLUMN bandwidth_schedule BLOB;`)
+	return err
+}
+
+// migrateVersion35 initializes the ephemeral sectors metric, the number of
+// sectors only referenced by temp storage
+func migrateVersion35(tx txn, _ *zap.Logger) error {
+	const query = `SELECT COUNT(DISTINCT tsr.sector_id) FROM temp_storage_sector_roots tsr
+WHERE NOT EXISTS (SELECT 1 FROM contract_sector_roots csr WHERE csr.sector_id=tsr.sector_id)`
+	var count int64
+	if err := tx.QueryRow(query).Scan(&count); err != nil {
+		return fmt.Errorf("failed to count ephemeral sectors: %w", err)
+	}
+	return setNumericStat(tx, metricEphemeralSectors, uint64(count), time.Now().Truncate(statInterval))
+}
+
+// migrateVersion34 adds the s3_config column to the storage_volumes table
+func migrateVersion34(tx txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`ALTER TABLE storage_volumes ADD COLUMN s3_config TEXT;`)
+	return err
+}
+
+// migrateVersion33 adds the encrypt_volumes column to the host_settings table
+// and the encryption columns to the storage_volumes table
+func migrateVersion33(tx txn, _ *zap.Logger) error {
+	const query = `ALTER TABLE host_settings ADD COLUMN encrypt_volumes BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE storage_volumes ADD COLUMN encryption_salt BLOB;
+ALTER TABLE storage_volumes ADD COLUMN encryption_cursor INTEGER;`
+	_, err := tx.Exec(query)
+	return err
+}
+
+// migrateVersion32 adds the placement_policy column to the host_settings
+// table and the priority column to the storage_volumes table
+func migrateVersion32(tx txn, _ *zap.Logger) error {
+	const query = `ALTER TABLE host_settings ADD COLUMN placement_policy TEXT NOT NULL DEFAULT 'leastUsed';
+ALTER TABLE storage_volumes ADD COLUMN priority INTEGER NOT NULL DEFAULT 1;`
+	_, err := tx.Exec(query)
+	return err
+}
+
+// migrateVersion31 adds the cache_tier column to the storage_volumes table and
+// the cached_sectors table
+func migrateVersion31(tx txn, _ *zap.Logger) error {
+	const query = `ALTER TABLE storage_volumes ADD COLUMN cache_tier BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE cached_sectors (
+	id INTEGER PRIMARY KEY,
+	sector_id INTEGER UNIQUE NOT NULL REFERENCES stored_sectors (id),
+	volume_sector_id INTEGER UNIQUE NOT NULL REFERENCES volume_sectors (id),
+	last_access INTEGER NOT NULL
+);
+CREATE INDEX cached_sectors_last_access ON cached_sectors(last_access);`
+	_, err := tx.Exec(query)
+	return err
+}
+
+// migrateVersion30 adds the replication_factor column to the host_settings
+// table and the sector_replicas table
+func migrateVersion30(tx txn, _ *zap.Logger) error {
+	const query = `ALTER TABLE host_settings ADD COLUMN replication_factor INTEGER NOT NULL DEFAULT 1;
+
+CREATE TABLE sector_replicas (
+	id INTEGER PRIMARY KEY,
+	sector_id INTEGER NOT NULL REFERENCES stored_sectors (id),
+	volume_sector_id INTEGER UNIQUE NOT NULL REFERENCES volume_sectors (id)
+);
+CREATE INDEX sector_replicas_sector_id ON sector_replicas(sector_id);`
+	_, err := tx.Exec(query)
+	return err
+}
+
+// migrateVersion29 adds the scrub_rate column to the host_settings table and
+// the volume_scrubs and volume_scrub_errors tables
+func migrateVersion29(tx txn, _ *zap.Logger) error {
+	const query = `ALTER TABLE host_settings ADD COLUMN scrub_rate INTEGER NOT NULL DEFAULT 60;
+
+CREATE TABLE volume_scrubs (
+	volume_id INTEGER PRIMARY KEY REFERENCES storage_volumes (id),
+	next_index INTEGER NOT NULL,
+	sectors_checked INTEGER NOT NULL,
+	passes INTEGER NOT NULL,
+	pass_started INTEGER NOT NULL,
+	last_pass_completed INTEGER
+);
+
+CREATE TABLE volume_scrub_errors (
+	id INTEGER PRIMARY KEY,
+	volume_id INTEGER NOT NULL REFERENCES storage_volumes (id),
+	volume_index INTEGER NOT NULL,
+	sector_root BLOB NOT NULL,
+	error_type TEXT NOT NULL,
+	error_message TEXT NOT NULL,
+	date_detected INTEGER NOT NULL,
+	UNIQUE (volume_id, volume_index)
+);
+CREATE INDEX volume_scrub_errors_volume_id_volume_index ON volume_scrub_errors(volume_id, volume_index);`
+	_, err := tx.Exec(query)
+	return err
+}
+
+// migrateVersion28 adds the wallet_retired_keys table
+func migrateVersion28(tx txn, _ *zap.Logger) error {
+	const query = `CREATE TABLE wallet_retired_keys (
+	id INTEGER PRIMARY KEY,
+	address BLOB UNIQUE NOT NULL,
+	encrypted_key BLOB NOT NULL
+);`
+	_, err := tx.Exec(query)
+	return err
+}
+
+// migrateVersion27 adds the contract_policy and renter_access_list tables
+func migrateVersion27(tx txn, _ *zap.Logger) error {
+	const query = `CREATE TABLE contract_policy (
+	id INTEGER PRIMARY KEY NOT NULL DEFAULT 0 CHECK (id = 0), -- enforce a single row
+	allowlist_only BOOLEAN NOT NULL,
+	min_contract_duration INTEGER NOT NULL,
+	max_renter_data INTEGER NOT NULL,
+	max_renter_collateral BLOB NOT NULL
+);
+
+CREATE TABLE renter_access_list (
+	id INTEGER PRIMARY KEY,
+	public_key BLOB UNIQUE NOT NULL,
+	allowed BOOLEAN NOT NULL,
+	date_created INTEGER NOT NULL
+);`
+	_, err := tx.Exec(query)
+	return err
+}
+
+// migrateVersion26 adds the utilization_pricing column to the host_settings
+// table
+func migrateVersion26(tx txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`ALTER TABLE host_settings ADD COLUMN utilization_pricing BLOB;`)
+	return err
+}
+
+// migrateVersion25 adds the auto_pricing column to the host_settings table
+func migrateVersion25(tx txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`ALTER TABLE host_settings ADD COLUMN auto_pricing BLOB;`)
+	return err
+}
+
 // migrateVersion24 combines the rhp2 and rhp3 data metrics
 func migrateVersion24(tx txn, log *zap.Logger) error {
 	rows, err := tx.Query(`SELECT date_created, stat, stat_value FROM host_stats WHERE stat IN (?, ?, ?, ?) ORDER BY date_created ASC`, metricRHP2Ingress, metricRHP2Egress, metricRHP3Ingress, metricRHP3Egress)
@@ -690,4 +857,17 @@ var migrations = []func(tx txn, log *zap.Logger) error{
 	migrateVersion22,
 	migrateVersion23,
 	migrateVersion24,
+	migrateVersion25,
+	migrateVersion26,
+	migrateVersion27,
+	migrateVersion28,
+	migrateVersion29,
+	migrateVersion30,
+	migrateVersion31,
+	migrateVersion32,
+	migrateVersion33,
+	migrateVersion34,
+	migrateVersion35,
+	migrateVersion36,
+	migrateVersion37,
 }
@@ -0,0 +1,64 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"go.sia.tech/hostd/host/storage"
+)
+
+// placementStrategy returns the strategy for the host's sector placement
+// policy. The policy is loaded once and refreshed by UpdateSettings.
+func (s *Store) placementStrategy() (storage.PlacementStrategy, error) {
+	s.placementMu.Lock()
+	defer s.placementMu.Unlock()
+	if s.placement != nil {
+		return s.placement, nil
+	}
+
+	var policy string
+	err := s.queryRow(`SELECT placement_policy FROM host_settings`).Scan(&policy)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get placement policy: %w", err)
+	}
+	s.placement = storage.PlacementStrategyForPolicy(policy)
+	return s.placement, nil
+}
+
+// setPlacementPolicy updates the cached placement strategy.
+func (s *Store) setPlacementPolicy(policy string) {
+	s.placementMu.Lock()
+	s.placement = storage.PlacementStrategyForPolicy(policy)
+	s.placementMu.Unlock()
+}
+
+// placementVolume returns the ID of the volume a new sector should be written
+// to using the placement strategy. Only available, writable, non-cache
+// volumes with free space matching the additional filter are considered. If
+// there is no space available, ErrNotEnoughStorage is returned.
+func placementVolume(tx txn, strategy storage.PlacementStrategy, filter string, args ...any) (int64, error) {
+	query := `SELECT id, disk_path, read_only, available, cache_tier, priority, total_sectors, used_sectors, encryption_salt, encryption_cursor, s3_config FROM storage_volumes
+WHERE available=true AND read_only=false AND cache_tier=false AND total_sectors-used_sectors > 0 ` + filter + `
+ORDER BY id ASC`
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query volumes: %w", err)
+	}
+	defer rows.Close()
+
+	var volumes []storage.Volume
+	for rows.Next() {
+		vol, err := scanVolume(rows)
+		if err != nil {
+			return 0, fmt.Errorf("failed to scan volume: %w", err)
+		}
+		volumes = append(volumes, vol)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to query volumes: %w", err)
+	} else if len(volumes) == 0 {
+		return 0, storage.ErrNotEnoughStorage
+	}
+	return strategy(volumes).ID, nil
+}
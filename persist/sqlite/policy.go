@@ -0,0 +1,196 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	rhp2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+	"go.sia.tech/hostd/host/contracts"
+	"go.sia.tech/hostd/host/policy"
+)
+
+// ContractPolicy returns the host's contract policy.
+func (s *Store) ContractPolicy() (p policy.Policy, err error) {
+	const query = `SELECT allowlist_only, min_contract_duration, max_renter_data, max_renter_collateral, renter_ingress_limit, renter_egress_limit, max_renter_daily_egress FROM contract_policy WHERE id=0`
+	err = s.queryRow(query).Scan(&p.AllowlistOnly, &p.MinContractDuration, &p.MaxRenterData, (*sqlCurrency)(&p.MaxRenterCollateral), &p.RenterIngressLimit, &p.RenterEgressLimit, &p.MaxRenterDailyEgress)
+	if errors.Is(err, sql.ErrNoRows) {
+		return policy.Policy{}, nil
+	}
+	return
+}
+
+// UpdateContractPolicy updates the host's contract policy.
+func (s *Store) UpdateContractPolicy(p policy.Policy) error {
+	const query = `INSERT INTO contract_policy (id, allowlist_only, min_contract_duration, max_renter_data, max_renter_collateral, renter_ingress_limit, renter_egress_limit, max_renter_daily_egress) VALUES (0, $1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (id) DO UPDATE SET allowlist_only=EXCLUDED.allowlist_only, min_contract_duration=EXCLUDED.min_contract_duration,
+max_renter_data=EXCLUDED.max_renter_data, max_renter_collateral=EXCLUDED.max_renter_collateral, renter_ingress_limit=EXCLUDED.renter_ingress_limit,
+renter_egress_limit=EXCLUDED.renter_egress_limit, max_renter_daily_egress=EXCLUDED.max_renter_daily_egress`
+	_, err := s.exec(query, p.AllowlistOnly, p.MinContractDuration, p.MaxRenterData, sqlCurrency(p.MaxRenterCollateral), p.RenterIngressLimit, p.RenterEgressLimit, p.MaxRenterDailyEgress)
+	return err
+}
+
+// RenterAccessList returns the renters on the host's allow and block lists.
+func (s *Store) RenterAccessList() (list []policy.RenterAccess, err error) {
+	rows, err := s.query(`SELECT public_key, allowed, date_created FROM renter_access_list ORDER BY date_created ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query renter access list: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ra policy.RenterAccess
+		if err := rows.Scan((*sqlHash256)(&ra.PublicKey), &ra.Allowed, (*sqlTime)(&ra.Timestamp)); err != nil {
+			return nil, fmt.Errorf("failed to scan renter access: %w", err)
+		}
+		list = append(list, ra)
+	}
+	return list, rows.Err()
+}
+
+// RenterAccess returns the access list entry of a renter.
+func (s *Store) RenterAccess(renterKey types.PublicKey) (ra policy.RenterAccess, err error) {
+	err = s.queryRow(`SELECT public_key, allowed, date_created FROM renter_access_list WHERE public_key=$1`, sqlHash256(renterKey)).
+		Scan((*sqlHash256)(&ra.PublicKey), &ra.Allowed, (*sqlTime)(&ra.Timestamp))
+	if errors.Is(err, sql.ErrNoRows) {
+		return policy.RenterAccess{}, policy.ErrNotFound
+	}
+	return
+}
+
+// SetRenterAccess adds a renter to the allow or block list.
+func (s *Store) SetRenterAccess(renterKey types.PublicKey, allowed bool) error {
+	const query = `INSERT INTO renter_access_list (public_key, allowed, date_created) VALUES ($1, $2, $3)
+ON CONFLICT (public_key) DO UPDATE SET allowed=EXCLUDED.allowed, date_created=EXCLUDED.date_created`
+	_, err := s.exec(query, sqlHash256(renterKey), allowed, sqlTime(time.Now()))
+	return err
+}
+
+// RemoveRenterAccess removes a renter from the allow and block lists.
+func (s *Store) RemoveRenterAccess(renterKey types.PublicKey) error {
+	res, err := s.exec(`DELETE FROM renter_access_list WHERE public_key=$1`, sqlHash256(renterKey))
+	if err != nil {
+		return fmt.Errorf("failed to remove renter access: %w", err)
+	} else if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	} else if n == 0 {
+		return policy.ErrNotFound
+	}
+	return nil
+}
+
+// RenterUsage returns the data and collateral in a renter's pending and
+// active contracts, excluding the contract with the given ID.
+func (s *Store) RenterUsage(renterKey types.PublicKey, exclude types.FileContractID) (usage policy.RenterUsage, err error) {
+	err = s.transaction(func(tx txn) error {
+		const collateralQuery = `SELECT c.locked_collateral FROM contracts c
+INNER JOIN contract_renters r ON (c.renter_id=r.id)
+WHERE r.public_key=$1 AND c.contract_id<>$2 AND c.contract_status IN ($3, $4)`
+		rows, err := tx.Query(collateralQuery, sqlHash256(renterKey), sqlHash256(exclude), contracts.ContractStatusPending, contracts.ContractStatusActive)
+		if err != nil {
+			return fmt.Errorf("failed to query renter contracts: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var collateral types.Currency
+			if err := rows.Scan((*sqlCurrency)(&collateral)); err != nil {
+				return fmt.Errorf("failed to scan locked collateral: %w", err)
+			}
+			usage.Contracts++
+			usage.Collateral = usage.Collateral.Add(collateral)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		const dataQuery = `SELECT COUNT(csr.id) FROM contract_sector_roots csr
+INNER JOIN contracts c ON (csr.contract_id=c.id)
+INNER JOIN contract_renters r ON (c.renter_id=r.id)
+WHERE r.public_key=$1 AND c.contract_id<>$2 AND c.contract_status IN ($3, $4)`
+		var sectors uint64
+		if err := tx.QueryRow(dataQuery, sqlHash256(renterKey), sqlHash256(exclude), contracts.ContractStatusPending, contracts.ContractStatusActive).Scan(&sectors); err != nil {
+			return fmt.Errorf("failed to query renter sectors: %w", err)
+		}
+		usage.Data = sectors * rhp2.SectorSize
+		return nil
+	})
+	return
+}
+
+// IncrementRenterBandwidth adds the bandwidth usage to each renter's totals.
+func (s *Store) IncrementRenterBandwidth(usage []policy.RenterBandwidth) error {
+	return s.transaction(func(tx txn) error {
+		stmt, err := tx.Prepare(`INSERT INTO renter_bandwidth (renter_key, date_created, ingress, egress) VALUES ($1, $2, $3, $4)
+ON CONFLICT (renter_key, date_created) DO UPDATE SET ingress=ingress+EXCLUDED.ingress, egress=egress+EXCLUDED.egress`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer stmt.Close()
+
+		for _, u := range usage {
+			if _, err := stmt.Exec(sqlHash256(u.RenterKey), sqlTime(u.Period), u.Ingress, u.Egress); err != nil {
+				return fmt.Errorf("failed to increment bandwidth of renter %v: %w", u.RenterKey, err)
+			}
+		}
+		return nil
+	})
+}
+
+// RenterBandwidth returns the daily bandwidth usage of a renter between start
+// and end.
+func (s *Store) RenterBandwidth(renterKey types.PublicKey, start, end time.Time) (usage []policy.RenterBandwidth, err error) {
+	rows, err := s.query(`SELECT renter_key, date_created, ingress, egress FROM renter_bandwidth
+WHERE renter_key=$1 AND date_created >= $2 AND date_created < $3 ORDER BY date_created ASC`, sqlHash256(renterKey), sqlTime(start), sqlTime(end))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query renter bandwidth: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u policy.RenterBandwidth
+		if err := rows.Scan((*sqlHash256)(&u.RenterKey), (*sqlTime)(&u.Period), &u.Ingress, &u.Egress); err != nil {
+			return nil, fmt.Errorf("failed to scan renter bandwidth: %w", err)
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
+
+// RenterBandwidthTotals returns the total bandwidth usage of each renter
+// between start and end, ordered by egress.
+func (s *Store) RenterBandwidthTotals(start, end time.Time, limit, offset int) (usage []policy.RenterBandwidth, err error) {
+	rows, err := s.query(`SELECT renter_key, SUM(ingress), SUM(egress) FROM renter_bandwidth
+WHERE date_created >= $1 AND date_created < $2 GROUP BY renter_key ORDER BY SUM(egress) DESC, renter_key ASC LIMIT $3 OFFSET $4`, sqlTime(start), sqlTime(end), limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query renter bandwidth: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		u := policy.RenterBandwidth{Period: start}
+		if err := rows.Scan((*sqlHash256)(&u.RenterKey), &u.Ingress, &u.Egress); err != nil {
+			return nil, fmt.Errorf("failed to scan renter bandwidth: %w", err)
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
+
+// AccountRenterKey returns the public key of the renter whose contract most
+// recently funded the account. If the account has no remaining contract
+// funding, policy.ErrNotFound is returned.
+func (s *Store) AccountRenterKey(account types.PublicKey) (renterKey types.PublicKey, err error) {
+	const query = `SELECT r.public_key FROM contract_account_funding caf
+INNER JOIN accounts a ON (caf.account_id=a.id)
+INNER JOIN contracts c ON (caf.contract_id=c.id)
+INNER JOIN contract_renters r ON (c.renter_id=r.id)
+WHERE a.account_id=$1 ORDER BY caf.id DESC LIMIT 1`
+	err = s.queryRow(query, sqlHash256(account)).Scan((*sqlHash256)(&renterKey))
+	if errors.Is(err, sql.ErrNoRows) {
+		return types.PublicKey{}, policy.ErrNotFound
+	}
+	return
+}
@@ -0,0 +1,213 @@
+package sqlite
+
+import (
+	"fmt"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/hostd/host/storage"
+	"go.uber.org/zap"
+)
+
+// StoreSectorReplica calls fn with an empty location in a writable volume
+// that does not already contain a copy of the sector. The sector data must be
+// written to disk within fn. If fn returns an error, the replica is removed.
+// If no space is available, ErrNotEnoughStorage is returned. The sector and
+// location are locked until release is called.
+func (s *Store) StoreSectorReplica(root types.Hash256, fn func(loc storage.SectorLocation) error) (func() error, error) {
+	var sectorLockID, replicaID int64
+	var locationLocks []int64
+	var location storage.SectorLocation
+
+	strategy, err := s.placementStrategy()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.transaction(func(tx txn) error {
+		sectorID, err := sectorDBID(tx, root)
+		if err != nil {
+			return fmt.Errorf("failed to get sector id: %w", err)
+		}
+
+		// lock the sector
+		sectorLockID, err = lockSector(tx, sectorID)
+		if err != nil {
+			return fmt.Errorf("failed to lock sector: %w", err)
+		}
+
+		location, err = emptyLocationForReplica(tx, strategy, sectorID)
+		if err != nil {
+			return fmt.Errorf("failed to get empty location: %w", err)
+		}
+		location.Root = root
+
+		// lock the location
+		locationLocks, err = lockLocations(tx, []storage.SectorLocation{location})
+		if err != nil {
+			return fmt.Errorf("failed to lock sector location: %w", err)
+		}
+
+		err = tx.QueryRow(`INSERT INTO sector_replicas (sector_id, volume_sector_id) VALUES ($1, $2) RETURNING id`, sectorID, location.ID).Scan(&replicaID)
+		if err != nil {
+			return fmt.Errorf("failed to add replica: %w", err)
+		} else if err := incrementVolumeUsage(tx, location.Volume, 1); err != nil {
+			return fmt.Errorf("failed to update volume metadata: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := func() error {
+		return s.transaction(func(tx txn) error {
+			if err := unlockLocations(tx, locationLocks); err != nil {
+				return fmt.Errorf("failed to unlock sector location: %w", err)
+			} else if err := unlockSector(tx, sectorLockID); err != nil {
+				return fmt.Errorf("failed to unlock sector: %w", err)
+			}
+			return nil
+		})
+	}
+
+	if err := fn(location); err != nil {
+		rbErr := s.transaction(func(tx txn) error {
+			if _, err := tx.Exec(`DELETE FROM sector_replicas WHERE id=$1`, replicaID); err != nil {
+				return err
+			}
+			return incrementVolumeUsage(tx, location.Volume, -1)
+		})
+		if rbErr != nil {
+			s.log.Error("failed to remove replica", zap.Error(rbErr))
+		}
+		unlock()
+		return nil, fmt.Errorf("failed to store replica: %w", err)
+	}
+	return unlock, nil
+}
+
+// SectorReplicas returns the locations of the replicas of a sector. The
+// primary location is not included.
+func (s *Store) SectorReplicas(root types.Hash256) (locations []storage.SectorLocation, err error) {
+	const query = `SELECT vs.id, vs.volume_id, vs.volume_index
+FROM sector_replicas sr
+INNER JOIN volume_sectors vs ON (vs.id=sr.volume_sector_id)
+INNER JOIN stored_sectors s ON (s.id=sr.sector_id)
+WHERE s.sector_root=$1`
+
+	rows, err := s.query(query, sqlHash256(root))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query replicas: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		loc := storage.SectorLocation{Root: root}
+		if err := rows.Scan(&loc.ID, &loc.Volume, &loc.Index); err != nil {
+			return nil, fmt.Errorf("failed to scan replica location: %w", err)
+		}
+		locations = append(locations, loc)
+	}
+	return locations, rows.Err()
+}
+
+// UnderReplicatedSectors returns up to limit sectors, ordered by root, with
+// fewer than copies copies in available volumes. Only sectors with a root
+// greater than after are returned.
+func (s *Store) UnderReplicatedSectors(after types.Hash256, copies, limit int) (sectors []storage.UnderReplicatedSector, err error) {
+	// the primary location is unique per sector, so each group is a sector
+	// and its replicas. Grouping by root lets the sector_root index be walked
+	// from after until limit sectors are found.
+	const query = `SELECT s.sector_root, (v.available=true) + COUNT(rv.id) AS copies
+FROM stored_sectors s
+INNER JOIN volume_sectors vs ON (vs.sector_id=s.id)
+INNER JOIN storage_volumes v ON (v.id=vs.volume_id)
+LEFT JOIN sector_replicas sr ON (sr.sector_id=s.id)
+LEFT JOIN volume_sectors rvs ON (rvs.id=sr.volume_sector_id)
+LEFT JOIN storage_volumes rv ON (rv.id=rvs.volume_id AND rv.available=true)
+WHERE s.sector_root > $1
+GROUP BY s.sector_root
+HAVING copies < $2
+ORDER BY s.sector_root ASC
+LIMIT $3`
+
+	rows, err := s.query(query, sqlHash256(after), copies, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sectors: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sector storage.UnderReplicatedSector
+		if err := rows.Scan((*sqlHash256)(&sector.Root), &sector.Copies); err != nil {
+			return nil, fmt.Errorf("failed to scan sector: %w", err)
+		}
+		sectors = append(sectors, sector)
+	}
+	return sectors, rows.Err()
+}
+
+// emptyLocationForReplica returns an empty location in a writable volume that
+// does not contain a copy of the sector. If there is no space available,
+// ErrNotEnoughStorage is returned.
+func emptyLocationForReplica(tx txn, strategy storage.PlacementStrategy, sectorID int64) (storage.SectorLocation, error) {
+	const filter = `AND id NOT IN (SELECT volume_id FROM volume_sectors WHERE sector_id=$1)
+AND id NOT IN (SELECT vs.volume_id FROM sector_replicas sr INNER JOIN volume_sectors vs ON (vs.id=sr.volume_sector_id) WHERE sr.sector_id=$1)`
+	volumeID, err := placementVolume(tx, strategy, filter, sectorID)
+	if err != nil {
+		return storage.SectorLocation{}, err
+	}
+	return emptyLocationInVolume(tx, volumeID)
+}
+
+// removeReplicas removes the given replicas and decrements the usage of their
+// volumes.
+func removeReplicas(tx txn, query string, args ...any) error {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query replicas: %w", err)
+	}
+	var ids []int64
+	usage := make(map[int64]int)
+	for rows.Next() {
+		var id, volumeID int64
+		if err := rows.Scan(&id, &volumeID); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan replica: %w", err)
+		}
+		ids = append(ids, id)
+		usage[volumeID]--
+	}
+	if err := rows.Close(); err != nil {
+		return fmt.Errorf("failed to close rows: %w", err)
+	} else if len(ids) == 0 {
+		return nil
+	}
+
+	if _, err := tx.Exec(`DELETE FROM sector_replicas WHERE id IN (`+queryPlaceHolders(len(ids))+`)`, queryArgs(ids)...); err != nil {
+		return fmt.Errorf("failed to delete replicas: %w", err)
+	}
+	for volumeID, delta := range usage {
+		if err := incrementVolumeUsage(tx, volumeID, delta); err != nil {
+			return fmt.Errorf("failed to update volume usage: %w", err)
+		}
+	}
+	return nil
+}
+
+// removeSectorReplicas removes all replicas of a sector.
+func removeSectorReplicas(tx txn, sectorID int64) error {
+	const query = `SELECT sr.id, vs.volume_id FROM sector_replicas sr
+INNER JOIN volume_sectors vs ON (vs.id=sr.volume_sector_id)
+WHERE sr.sector_id=$1`
+	return removeReplicas(tx, query, sectorID)
+}
+
+// removeVolumeReplicas removes all replicas stored in a volume at or after
+// minIndex.
+func removeVolumeReplicas(tx txn, volumeID int64, minIndex uint64) error {
+	const query = `SELECT sr.id, vs.volume_id FROM sector_replicas sr
+INNER JOIN volume_sectors vs ON (vs.id=sr.volume_sector_id)
+WHERE vs.volume_id=$1 AND vs.volume_index >= $2`
+	return removeReplicas(tx, query, volumeID, minIndex)
+}
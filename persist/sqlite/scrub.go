@@ -0,0 +1,146 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.sia.tech/hostd/host/storage"
+)
+
+// ScrubSectors returns up to limit occupied sector locations in a volume,
+// including replicas, starting at volume index min, ordered by index.
+func (s *Store) ScrubSectors(volumeID int64, min uint64, limit int) (locations []storage.SectorLocation, err error) {
+	const query = `SELECT vs.id, vs.volume_id, vs.volume_index, s.sector_root
+FROM volume_sectors vs
+LEFT JOIN sector_replicas sr ON (sr.volume_sector_id=vs.id)
+INNER JOIN stored_sectors s ON (s.id=COALESCE(vs.sector_id, sr.sector_id))
+WHERE vs.volume_id=$1 AND vs.volume_index >= $2 AND (vs.sector_id IS NOT NULL OR sr.sector_id IS NOT NULL)
+ORDER BY vs.volume_index ASC
+LIMIT $3`
+
+	rows, err := s.query(query, volumeID, min, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sectors: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var loc storage.SectorLocation
+		if err := rows.Scan(&loc.ID, &loc.Volume, &loc.Index, (*sqlHash256)(&loc.Root)); err != nil {
+			return nil, fmt.Errorf("failed to scan sector location: %w", err)
+		}
+		locations = append(locations, loc)
+	}
+	return locations, rows.Err()
+}
+
+// RecordScrubBatch records the results of scrubbing the volume indices
+// between start and end, inclusive. Previous errors in the range are replaced
+// by bad and the volume's scrub cursor is moved to end + 1.
+func (s *Store) RecordScrubBatch(volumeID int64, start, end, checked uint64, bad []storage.ScrubError) error {
+	return s.transaction(func(tx txn) error {
+		if _, err := tx.Exec(`DELETE FROM volume_scrub_errors WHERE volume_id=$1 AND volume_index BETWEEN $2 AND $3`, volumeID, start, end); err != nil {
+			return fmt.Errorf("failed to clear scrub errors: %w", err)
+		}
+
+		if len(bad) > 0 {
+			stmt, err := tx.Prepare(`INSERT INTO volume_scrub_errors (volume_id, volume_index, sector_root, error_type, error_message, date_detected) VALUES ($1, $2, $3, $4, $5, $6)`)
+			if err != nil {
+				return fmt.Errorf("failed to prepare statement: %w", err)
+			}
+			defer stmt.Close()
+
+			for _, se := range bad {
+				if _, err := stmt.Exec(volumeID, se.Index, sqlHash256(se.Root), se.Type, se.Error, sqlTime(se.Timestamp)); err != nil {
+					return fmt.Errorf("failed to insert scrub error: %w", err)
+				}
+			}
+		}
+
+		const query = `INSERT INTO volume_scrubs (volume_id, next_index, sectors_checked, passes, pass_started, last_pass_completed) VALUES ($1, $2, $3, 0, $4, NULL)
+ON CONFLICT (volume_id) DO UPDATE SET next_index=EXCLUDED.next_index, sectors_checked=sectors_checked+EXCLUDED.sectors_checked`
+		if _, err := tx.Exec(query, volumeID, end+1, checked, sqlTime(time.Now())); err != nil {
+			return fmt.Errorf("failed to update scrub progress: %w", err)
+		}
+		return nil
+	})
+}
+
+// CompleteScrubPass marks the current scrub pass of a volume as complete.
+// Errors past the scrub cursor are removed since the sectors no longer exist
+// and the cursor is reset to the start of the volume.
+func (s *Store) CompleteScrubPass(volumeID int64) error {
+	return s.transaction(func(tx txn) error {
+		var nextIndex uint64
+		err := tx.QueryRow(`SELECT next_index FROM volume_scrubs WHERE volume_id=$1`, volumeID).Scan(&nextIndex)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to get scrub progress: %w", err)
+		}
+
+		if _, err := tx.Exec(`DELETE FROM volume_scrub_errors WHERE volume_id=$1 AND volume_index >= $2`, volumeID, nextIndex); err != nil {
+			return fmt.Errorf("failed to clear scrub errors: %w", err)
+		}
+
+		now := sqlTime(time.Now())
+		const query = `INSERT INTO volume_scrubs (volume_id, next_index, sectors_checked, passes, pass_started, last_pass_completed) VALUES ($1, 0, 0, 1, $2, $2)
+ON CONFLICT (volume_id) DO UPDATE SET next_index=0, sectors_checked=0, passes=passes+1, pass_started=EXCLUDED.pass_started, last_pass_completed=EXCLUDED.last_pass_completed`
+		if _, err := tx.Exec(query, volumeID, now); err != nil {
+			return fmt.Errorf("failed to update scrub progress: %w", err)
+		}
+		return nil
+	})
+}
+
+// ScrubProgress returns the scrub progress of a volume.
+func (s *Store) ScrubProgress(volumeID int64) (progress storage.ScrubProgress, err error) {
+	err = s.transaction(func(tx txn) error {
+		const query = `SELECT next_index, sectors_checked, passes, pass_started, last_pass_completed FROM volume_scrubs WHERE volume_id=$1`
+		err := tx.QueryRow(query, volumeID).Scan(&progress.NextIndex, &progress.Checked, &progress.Passes, (*sqlTime)(&progress.PassStarted), nullable((*sqlTime)(&progress.LastPassCompleted)))
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to get scrub progress: %w", err)
+		}
+
+		rows, err := tx.Query(`SELECT error_type, COUNT(*) FROM volume_scrub_errors WHERE volume_id=$1 GROUP BY error_type`, volumeID)
+		if err != nil {
+			return fmt.Errorf("failed to count scrub errors: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var errorType string
+			var count uint64
+			if err := rows.Scan(&errorType, &count); err != nil {
+				return fmt.Errorf("failed to scan scrub error count: %w", err)
+			}
+			switch errorType {
+			case storage.ScrubErrorCorrupt:
+				progress.Corrupt = count
+			case storage.ScrubErrorMissing:
+				progress.Missing = count
+			}
+		}
+		return rows.Err()
+	})
+	return
+}
+
+// ScrubErrors returns the bad sectors found in a volume, ordered by index.
+func (s *Store) ScrubErrors(volumeID int64, limit, offset int) (errs []storage.ScrubError, err error) {
+	const query = `SELECT volume_index, sector_root, error_type, error_message, date_detected FROM volume_scrub_errors WHERE volume_id=$1 ORDER BY volume_index ASC LIMIT $2 OFFSET $3`
+	rows, err := s.query(query, volumeID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scrub errors: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var se storage.ScrubError
+		if err := rows.Scan(&se.Index, (*sqlHash256)(&se.Root), &se.Type, &se.Error, (*sqlTime)(&se.Timestamp)); err != nil {
+			return nil, fmt.Errorf("failed to scan scrub error: %w", err)
+		}
+		errs = append(errs, se)
+	}
+	return errs, rows.Err()
+}
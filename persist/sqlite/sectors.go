@@ -4,8 +4,10 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"math"
 	"time"
 
+	rhp2 "go.sia.tech/core/rhp/v2"
 	"go.sia.tech/core/types"
 	"go.sia.tech/hostd/host/storage"
 	"go.uber.org/zap"
@@ -26,36 +28,45 @@ func (s *Store) batchExpireTempSectors(height uint64) (refs []tempSectorRef, rec
 		} else if len(refs) == 0 {
 			return nil
 		}
+		reclaimed, err = deleteTempSectors(tx, refs)
+		return err
+	})
+	return
+}
 
-		var tempIDs []int64
-		for _, ref := range refs {
-			tempIDs = append(tempIDs, ref.ID)
+func (s *Store) batchRemoveTempSectors(roots []types.Hash256) (removed int, err error) {
+	err = s.transaction(func(tx txn) error {
+		query := `SELECT ts.id, ts.sector_id FROM temp_storage_sector_roots ts
+INNER JOIN stored_sectors ss ON (ts.sector_id=ss.id)
+WHERE ss.sector_root IN (` + queryPlaceHolders(len(roots)) + `);`
+		args := make([]any, 0, len(roots))
+		for _, root := range roots {
+			args = append(args, sqlHash256(root))
 		}
-
-		// delete the sectors
-		query := `DELETE FROM temp_storage_sector_roots WHERE id IN (` + queryPlaceHolders(len(tempIDs)) + `);`
-		res, err := tx.Exec(query, queryArgs(tempIDs)...)
+		rows, err := tx.Query(query, args...)
 		if err != nil {
-			return fmt.Errorf("failed to delete sectors: %w", err)
-		} else if rows, err := res.RowsAffected(); err != nil {
-			return fmt.Errorf("failed to get rows affected: %w", err)
-		} else if rows != int64(len(tempIDs)) {
-			return fmt.Errorf("failed to delete all sectors: %w", err)
-		}
-		// decrement the temp sectors metric
-		if err := incrementNumericStat(tx, metricTempSectors, -len(refs), time.Now()); err != nil {
-			return fmt.Errorf("failed to update metric: %w", err)
+			return fmt.Errorf("failed to select sectors: %w", err)
 		}
+		defer rows.Close()
 
-		for _, ref := range refs {
-			err := pruneSectorRef(tx, ref.SectorID)
-			if errors.Is(err, errSectorHasRefs) {
-				continue
-			} else if err != nil {
-				return fmt.Errorf("failed to prune sector: %w", err)
+		var refs []tempSectorRef
+		for rows.Next() {
+			var ref tempSectorRef
+			if err := rows.Scan(&ref.ID, &ref.SectorID); err != nil {
+				return fmt.Errorf("failed to scan sector id: %w", err)
 			}
-			reclaimed++
+			refs = append(refs, ref)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to select sectors: %w", err)
+		} else if len(refs) == 0 {
+			return nil
+		}
+
+		if _, err := deleteTempSectors(tx, refs); err != nil {
+			return err
 		}
+		removed = len(refs)
 		return nil
 	})
 	return
@@ -78,6 +89,12 @@ func (s *Store) RemoveSector(root types.Hash256) (err error) {
 			return fmt.Errorf("failed to remove sector: %w", err)
 		}
 
+		if err := removeSectorReplicas(tx, sectorID); err != nil {
+			return fmt.Errorf("failed to remove sector replicas: %w", err)
+		} else if err := removeSectorCachedCopy(tx, sectorID); err != nil {
+			return fmt.Errorf("failed to remove cached sector: %w", err)
+		}
+
 		// decrement volume usage and metrics
 		if err = incrementVolumeUsage(tx, volumeID, -1); err != nil {
 			return fmt.Errorf("failed to update volume usage: %w", err)
@@ -124,19 +141,31 @@ func (s *Store) SectorLocation(root types.Hash256) (storage.SectorLocation, func
 // on the host. The sectors will be deleted after the expiration height.
 func (s *Store) AddTemporarySectors(sectors []storage.TempSector) error {
 	return s.transaction(func(tx txn) error {
-		stmt, err := tx.Prepare(`INSERT INTO temp_storage_sector_roots (sector_id, expiration_height) SELECT id, $1 FROM stored_sectors WHERE sector_root=$2 RETURNING id;`)
-		if err != nil {
-			return fmt.Errorf("failed to prepare query: %w", err)
-		}
-		defer stmt.Close()
+		sectorIDs := make([]int64, 0, len(sectors))
 		for _, sector := range sectors {
-			var dbID int64
-			err := stmt.QueryRow(sector.Expiration, sqlHash256(sector.Root)).Scan(&dbID)
+			sectorID, err := sectorDBID(tx, sector.Root)
 			if err != nil {
-				return fmt.Errorf("failed to add temp sector root: %w", err)
+				return fmt.Errorf("failed to get sector id: %w", err)
 			}
+			sectorIDs = append(sectorIDs, sectorID)
 		}
-		if err := incrementNumericStat(tx, metricTempSectors, len(sectors), time.Now()); err != nil {
+
+		err := updateEphemeralSectors(tx, sectorIDs, func() error {
+			stmt, err := tx.Prepare(`INSERT INTO temp_storage_sector_roots (sector_id, expiration_height) VALUES ($1, $2);`)
+			if err != nil {
+				return fmt.Errorf("failed to prepare query: %w", err)
+			}
+			defer stmt.Close()
+			for i, sector := range sectors {
+				if _, err := stmt.Exec(sectorIDs[i], sector.Expiration); err != nil {
+					return fmt.Errorf("failed to add temp sector root: %w", err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		} else if err := incrementNumericStat(tx, metricTempSectors, len(sectors), time.Now()); err != nil {
 			return fmt.Errorf("failed to update metric: %w", err)
 		}
 		return nil
@@ -166,6 +195,97 @@ func (s *Store) ExpireTempSectors(height uint64) error {
 	}
 }
 
+// RemoveTempSectors removes the temporary storage references of the given
+// sectors regardless of their expiration height. If roots is empty, all
+// temporary sectors are removed. Sectors that are no longer referenced are
+// pruned. The number of references removed is returned.
+func (s *Store) RemoveTempSectors(roots []types.Hash256) (removed int, err error) {
+	if len(roots) == 0 {
+		// delete in batches to avoid holding a lock on the table for too long
+		for {
+			expired, _, err := s.batchExpireTempSectors(math.MaxInt64)
+			if err != nil {
+				return removed, fmt.Errorf("failed to remove sectors: %w", err)
+			} else if len(expired) == 0 {
+				return removed, nil
+			}
+			removed += len(expired)
+			jitterSleep(time.Millisecond) // allow other transactions to run
+		}
+	}
+
+	for i := 0; i < len(roots); i += sqlSectorBatchSize {
+		end := i + sqlSectorBatchSize
+		if end > len(roots) {
+			end = len(roots)
+		}
+		n, err := s.batchRemoveTempSectors(roots[i:end])
+		if err != nil {
+			return removed, fmt.Errorf("failed to remove sectors: %w", err)
+		}
+		removed += n
+		jitterSleep(time.Millisecond) // allow other transactions to run
+	}
+	return removed, nil
+}
+
+// TempSectors returns the sectors in temporary storage ordered by expiration
+// height.
+func (s *Store) TempSectors(limit, offset int) (sectors []storage.TempStorageSector, err error) {
+	const query = `SELECT ss.sector_root, ts.expiration_height, (SELECT COUNT(*) FROM contract_sector_roots csr WHERE csr.sector_id=ts.sector_id)
+FROM temp_storage_sector_roots ts
+INNER JOIN stored_sectors ss ON (ts.sector_id=ss.id)
+ORDER BY ts.expiration_height ASC, ts.id ASC
+LIMIT $1 OFFSET $2;`
+	rows, err := s.query(query, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query temp sectors: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sector storage.TempStorageSector
+		if err := rows.Scan((*sqlHash256)(&sector.Root), &sector.Expiration, &sector.Contracts); err != nil {
+			return nil, fmt.Errorf("failed to scan temp sector: %w", err)
+		}
+		sectors = append(sectors, sector)
+	}
+	return sectors, rows.Err()
+}
+
+// TempStorageSummary returns the number of sectors in temporary storage, the
+// space used by sectors only referenced by temporary storage, and the number
+// of references expiring at each height.
+func (s *Store) TempStorageSummary() (summary storage.TempStorageSummary, err error) {
+	summary.Expirations = []storage.TempStorageExpiration{}
+	err = s.transaction(func(tx txn) error {
+		rows, err := tx.Query(`SELECT expiration_height, COUNT(*) FROM temp_storage_sector_roots GROUP BY expiration_height ORDER BY expiration_height ASC;`)
+		if err != nil {
+			return fmt.Errorf("failed to query expirations: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var exp storage.TempStorageExpiration
+			if err := rows.Scan(&exp.Height, &exp.Sectors); err != nil {
+				return fmt.Errorf("failed to scan expiration: %w", err)
+			}
+			summary.Sectors += exp.Sectors
+			summary.Expirations = append(summary.Expirations, exp)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to query expirations: %w", err)
+		}
+
+		const query = `SELECT COUNT(DISTINCT tsr.sector_id) FROM temp_storage_sector_roots tsr
+WHERE NOT EXISTS (SELECT 1 FROM contract_sector_roots csr WHERE csr.sector_id=tsr.sector_id)`
+		if err := tx.QueryRow(query).Scan(&summary.EphemeralSectors); err != nil {
+			return fmt.Errorf("failed to count ephemeral sectors: %w", err)
+		}
+		summary.Size = summary.EphemeralSectors * rhp2.SectorSize
+		return nil
+	})
+	return
+}
+
 // HasSector returns true if the sector is stored on the host.
 func (s *Store) HasSector(root types.Hash256) (bool, error) {
 	var dbID int64
@@ -209,7 +329,7 @@ func (s *Store) SectorReferences(root types.Hash256) (refs storage.SectorReferen
 }
 
 func contractSectorRefs(tx txn, sectorID int64) (contractIDs []types.FileContractID, err error) {
-	rows, err := tx.Query(`SELECT DISTINCT contract_id FROM contract_sector_roots WHERE sector_id=$1;`, sectorID)
+	rows, err := tx.Query(`SELECT DISTINCT c.contract_id FROM contract_sector_roots csr INNER JOIN contracts c ON (c.id=csr.contract_id) WHERE csr.sector_id=$1;`, sectorID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to select contracts: %w", err)
 	}
@@ -249,6 +369,12 @@ func incrementVolumeUsage(tx txn, volumeID int64, delta int) error {
 }
 
 func clearVolumeSector(tx txn, id int64) error {
+	if err := removeSectorReplicas(tx, id); err != nil {
+		return fmt.Errorf("failed to remove sector replicas: %w", err)
+	} else if err := removeSectorCachedCopy(tx, id); err != nil {
+		return fmt.Errorf("failed to remove cached sector: %w", err)
+	}
+
 	var volumeDBID int64
 	err := tx.QueryRow(`UPDATE volume_sectors SET sector_id=NULL WHERE sector_id=$1 RETURNING volume_id`, id).Scan(&volumeDBID)
 	if errors.Is(err, sql.ErrNoRows) {
@@ -318,6 +444,103 @@ WHERE expiration_height <= $1 LIMIT $2;`
 	return
 }
 
+// deleteTempSectors deletes temp storage references and prunes the sectors
+// that are no longer referenced. The number of sectors pruned is returned.
+func deleteTempSectors(tx txn, refs []tempSectorRef) (pruned int, err error) {
+	tempIDs := make([]int64, 0, len(refs))
+	sectorIDs := make([]int64, 0, len(refs))
+	for _, ref := range refs {
+		tempIDs = append(tempIDs, ref.ID)
+		sectorIDs = append(sectorIDs, ref.SectorID)
+	}
+
+	// delete the sectors
+	err = updateEphemeralSectors(tx, sectorIDs, func() error {
+		query := `DELETE FROM temp_storage_sector_roots WHERE id IN (` + queryPlaceHolders(len(tempIDs)) + `);`
+		res, err := tx.Exec(query, queryArgs(tempIDs)...)
+		if err != nil {
+			return fmt.Errorf("failed to delete sectors: %w", err)
+		} else if rows, err := res.RowsAffected(); err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		} else if rows != int64(len(tempIDs)) {
+			return fmt.Errorf("failed to delete all sectors: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	// decrement the temp sectors metric
+	if err := incrementNumericStat(tx, metricTempSectors, -len(refs), time.Now()); err != nil {
+		return 0, fmt.Errorf("failed to update metric: %w", err)
+	}
+
+	for _, ref := range refs {
+		err := pruneSectorRef(tx, ref.SectorID)
+		if errors.Is(err, errSectorHasRefs) {
+			continue
+		} else if err != nil {
+			return 0, fmt.Errorf("failed to prune sector: %w", err)
+		}
+		pruned++
+	}
+	return pruned, nil
+}
+
+// countEphemeralSectors returns the number of distinct sectors in sectorIDs
+// that are only referenced by temp storage.
+func countEphemeralSectors(tx txn, sectorIDs []int64) (n int, err error) {
+	// deduplicate the IDs so sectors are not counted twice across batches
+	seen := make(map[int64]bool, len(sectorIDs))
+	ids := make([]int64, 0, len(sectorIDs))
+	for _, id := range sectorIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	const batchSize = 500 // stay well below SQLite's variable limit
+	for i := 0; i < len(ids); i += batchSize {
+		end := i + batchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batch := ids[i:end]
+		query := `SELECT COUNT(*) FROM stored_sectors s WHERE s.id IN (` + queryPlaceHolders(len(batch)) + `)
+AND EXISTS (SELECT 1 FROM temp_storage_sector_roots tsr WHERE tsr.sector_id=s.id)
+AND NOT EXISTS (SELECT 1 FROM contract_sector_roots csr WHERE csr.sector_id=s.id);`
+		var count int
+		if err := tx.QueryRow(query, queryArgs(batch)...).Scan(&count); err != nil {
+			return 0, err
+		}
+		n += count
+	}
+	return n, nil
+}
+
+// updateEphemeralSectors calls fn and updates the ephemeral sectors metric by
+// the change in the number of sectorIDs only referenced by temp storage. fn
+// must not add or remove references to sectors outside of sectorIDs. Errors
+// returned by fn are returned unwrapped.
+func updateEphemeralSectors(tx txn, sectorIDs []int64, fn func() error) error {
+	before, err := countEphemeralSectors(tx, sectorIDs)
+	if err != nil {
+		return fmt.Errorf("failed to count ephemeral sectors: %w", err)
+	} else if err := fn(); err != nil {
+		return err
+	}
+	after, err := countEphemeralSectors(tx, sectorIDs)
+	if err != nil {
+		return fmt.Errorf("failed to count ephemeral sectors: %w", err)
+	} else if after == before {
+		return nil
+	} else if err := incrementNumericStat(tx, metricEphemeralSectors, after-before, time.Now()); err != nil {
+		return fmt.Errorf("failed to update metric: %w", err)
+	}
+	return nil
+}
+
 // lockSector locks a sector root. The lock must be released by calling
 // unlockSector. A sector must be locked when it is being read or written
 // to prevent it from being removed by prune sector.
@@ -16,12 +16,12 @@ import (
 
 // Settings returns the current host settings.
 func (s *Store) Settings() (config settings.Settings, err error) {
-	var dyndnsBuf []byte
+	var dyndnsBuf, autoPricingBuf, utilizationPricingBuf, bandwidthScheduleBuf []byte
 	const query = `SELECT settings_revision, accepting_contracts, net_address, 
 	contract_price, base_rpc_price, sector_access_price, collateral_multiplier, 
 	max_collateral, storage_price, egress_price, ingress_price, 
 	max_account_balance, max_account_age, price_table_validity, max_contract_duration, window_size, 
-	ingress_limit, egress_limit, registry_limit, ddns_provider, ddns_update_v4, ddns_update_v6, ddns_opts, sector_cache_size
+	ingress_limit, egress_limit, registry_limit, ddns_provider, ddns_update_v4, ddns_update_v6, ddns_opts, sector_cache_size, auto_pricing, utilization_pricing, scrub_rate, replication_factor, placement_policy, encrypt_volumes, bandwidth_schedule
 FROM host_settings;`
 	err = s.queryRow(query).Scan(&config.Revision, &config.AcceptingContracts,
 		&config.NetAddress, (*sqlCurrency)(&config.ContractPrice),
@@ -31,7 +31,7 @@ FROM host_settings;`
 		(*sqlCurrency)(&config.IngressPrice), (*sqlCurrency)(&config.MaxAccountBalance),
 		&config.AccountExpiry, &config.PriceTableValidity, &config.MaxContractDuration, &config.WindowSize,
 		&config.IngressLimit, &config.EgressLimit, &config.MaxRegistryEntries,
-		&config.DDNS.Provider, &config.DDNS.IPv4, &config.DDNS.IPv6, &dyndnsBuf, &config.SectorCacheSize)
+		&config.DDNS.Provider, &config.DDNS.IPv4, &config.DDNS.IPv6, &dyndnsBuf, &config.SectorCacheSize, &autoPricingBuf, &utilizationPricingBuf, &config.ScrubRate, &config.ReplicationFactor, &config.PlacementPolicy, &config.EncryptVolumes, &bandwidthScheduleBuf)
 	if errors.Is(err, sql.ErrNoRows) {
 		return settings.Settings{}, settings.ErrNoSettings
 	}
@@ -41,6 +41,24 @@ FROM host_settings;`
 			return settings.Settings{}, fmt.Errorf("failed to unmarshal ddns options: %w", err)
 		}
 	}
+	if autoPricingBuf != nil {
+		err = json.Unmarshal(autoPricingBuf, &config.AutoPricing)
+		if err != nil {
+			return settings.Settings{}, fmt.Errorf("failed to unmarshal auto pricing settings: %w", err)
+		}
+	}
+	if utilizationPricingBuf != nil {
+		err = json.Unmarshal(utilizationPricingBuf, &config.UtilizationPricing)
+		if err != nil {
+			return settings.Settings{}, fmt.Errorf("failed to unmarshal utilization pricing settings: %w", err)
+		}
+	}
+	if bandwidthScheduleBuf != nil {
+		err = json.Unmarshal(bandwidthScheduleBuf, &config.BandwidthSchedule)
+		if err != nil {
+			return settings.Settings{}, fmt.Errorf("failed to unmarshal bandwidth schedule: %w", err)
+		}
+	}
 	return
 }
 
@@ -51,21 +69,21 @@ func (s *Store) UpdateSettings(settings settings.Settings) error {
 		sector_access_price, collateral_multiplier, max_collateral, storage_price, 
 		egress_price, ingress_price, max_account_balance, 
 		max_account_age, price_table_validity, max_contract_duration, window_size, ingress_limit, 
-		egress_limit, registry_limit, ddns_provider, ddns_update_v4, ddns_update_v6, ddns_opts, sector_cache_size) 
-		VALUES (0, 0, $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23) 
+		egress_limit, registry_limit, ddns_provider, ddns_update_v4, ddns_update_v6, ddns_opts, sector_cache_size, auto_pricing, utilization_pricing, scrub_rate, replication_factor, placement_policy, encrypt_volumes, bandwidth_schedule) 
+		VALUES (0, 0, $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30) 
 ON CONFLICT (id) DO UPDATE SET (settings_revision, 
 	accepting_contracts, net_address, contract_price, base_rpc_price, 
 	sector_access_price, collateral_multiplier, max_collateral, storage_price, 
 	egress_price, ingress_price, max_account_balance, 
 	max_account_age, price_table_validity, max_contract_duration, window_size, ingress_limit, 
-	egress_limit, registry_limit, ddns_provider, ddns_update_v4, ddns_update_v6, ddns_opts, sector_cache_size) = (
+	egress_limit, registry_limit, ddns_provider, ddns_update_v4, ddns_update_v6, ddns_opts, sector_cache_size, auto_pricing, utilization_pricing, scrub_rate, replication_factor, placement_policy, encrypt_volumes, bandwidth_schedule) = (
 	settings_revision + 1, EXCLUDED.accepting_contracts, EXCLUDED.net_address,
 	EXCLUDED.contract_price, EXCLUDED.base_rpc_price, EXCLUDED.sector_access_price,
 	EXCLUDED.collateral_multiplier, EXCLUDED.max_collateral, EXCLUDED.storage_price,
 	EXCLUDED.egress_price, EXCLUDED.ingress_price, EXCLUDED.max_account_balance,
 	EXCLUDED.max_account_age, EXCLUDED.price_table_validity, EXCLUDED.max_contract_duration, EXCLUDED.window_size, 
 	EXCLUDED.ingress_limit, EXCLUDED.egress_limit, EXCLUDED.registry_limit, EXCLUDED.ddns_provider, 
-	EXCLUDED.ddns_update_v4, EXCLUDED.ddns_update_v6, EXCLUDED.ddns_opts, EXCLUDED.sector_cache_size);`
+	EXCLUDED.ddns_update_v4, EXCLUDED.ddns_update_v6, EXCLUDED.ddns_opts, EXCLUDED.sector_cache_size, EXCLUDED.auto_pricing, EXCLUDED.utilization_pricing, EXCLUDED.scrub_rate, EXCLUDED.replication_factor, EXCLUDED.placement_policy, EXCLUDED.encrypt_volumes, EXCLUDED.bandwidth_schedule);`
 	var dnsOptsBuf []byte
 	if len(settings.DDNS.Provider) > 0 {
 		var err error
@@ -75,7 +93,27 @@ ON CONFLICT (id) DO UPDATE SET (settings_revision,
 		}
 	}
 
-	return s.transaction(func(tx txn) error {
+	autoPricingBuf, err := json.Marshal(settings.AutoPricing)
+	if err != nil {
+		return fmt.Errorf("failed to marshal auto pricing settings: %w", err)
+	}
+
+	utilizationPricingBuf, err := json.Marshal(settings.UtilizationPricing)
+	if err != nil {
+		return fmt.Errorf("failed to marshal utilization pricing settings: %w", err)
+	}
+
+	bandwidthScheduleBuf, err := json.Marshal(settings.BandwidthSchedule)
+	if err != nil {
+		return fmt.Errorf("failed to marshal bandwidth schedule: %w", err)
+	}
+	// record the multiplier of the utilization pricing curve, 1 if disabled
+	priceMultiplier := 1.0
+	if settings.UtilizationPricing.Enabled {
+		priceMultiplier = settings.UtilizationPricing.Multiplier
+	}
+
+	err = s.transaction(func(tx txn) error {
 		_, err := tx.Exec(query, settings.AcceptingContracts,
 			settings.NetAddress, sqlCurrency(settings.ContractPrice),
 			sqlCurrency(settings.BaseRPCPrice), sqlCurrency(settings.SectorAccessPrice),
@@ -84,7 +122,7 @@ ON CONFLICT (id) DO UPDATE SET (settings_revision,
 			sqlCurrency(settings.IngressPrice), sqlCurrency(settings.MaxAccountBalance),
 			settings.AccountExpiry, settings.PriceTableValidity, settings.MaxContractDuration, settings.WindowSize,
 			settings.IngressLimit, settings.EgressLimit, settings.MaxRegistryEntries,
-			settings.DDNS.Provider, settings.DDNS.IPv4, settings.DDNS.IPv6, dnsOptsBuf, settings.SectorCacheSize)
+			settings.DDNS.Provider, settings.DDNS.IPv4, settings.DDNS.IPv6, dnsOptsBuf, settings.SectorCacheSize, autoPricingBuf, utilizationPricingBuf, settings.ScrubRate, settings.ReplicationFactor, settings.PlacementPolicy, settings.EncryptVolumes, bandwidthScheduleBuf)
 		if err != nil {
 			return fmt.Errorf("failed to update settings: %w", err)
 		}
@@ -107,9 +145,16 @@ ON CONFLICT (id) DO UPDATE SET (settings_revision,
 			return fmt.Errorf("failed to update max registry entries stat: %w", err)
 		} else if err := setFloat64Stat(tx, metricCollateralMultiplier, settings.CollateralMultiplier, timestamp); err != nil {
 			return fmt.Errorf("failed to update collateral stat: %w", err)
+		} else if err := setFloat64Stat(tx, metricStoragePriceMultiplier, priceMultiplier, timestamp); err != nil {
+			return fmt.Errorf("failed to update storage price multiplier stat: %w", err)
 		}
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+	s.setPlacementPolicy(settings.PlacementPolicy)
+	return nil
 }
 
 // HostKey returns the host's private key.
@@ -7,18 +7,33 @@ import (
 	"fmt"
 	"math"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/mattn/go-sqlite3"
+	"go.sia.tech/hostd/host/storage"
 	"go.uber.org/zap"
 	"lukechampine.com/frand"
 )
 
+// ErrDatabaseInUse is returned when a database that must not be open in any
+// other process, such as a running host, is locked.
+var ErrDatabaseInUse = errors.New("database is in use by another process")
+
 type (
 	// A Store is a persistent store that uses a SQL database as its backend.
 	Store struct {
 		db  *sql.DB
 		log *zap.Logger
+
+		accessMu sync.Mutex // protects cacheAccess
+		// cacheAccess buffers the last access time of cached sectors. The
+		// times are written in batches and before cached sectors are
+		// evicted.
+		cacheAccess map[int64]time.Time
+
+		placementMu sync.Mutex                // protects placement
+		placement   storage.PlacementStrategy // nil until first loaded
 	}
 )
 
@@ -111,8 +126,11 @@ func (s *Store) transaction(fn func(txn) error) error {
 	return fmt.Errorf("transaction failed (%d): %w", attempt, err)
 }
 
-// Close closes the underlying database.
+// Close writes any buffered access times and closes the underlying database.
 func (s *Store) Close() error {
+	if err := s.transaction(s.flushCacheAccesses); err != nil {
+		s.log.Warn("failed to update last access of cached sectors", zap.Error(err))
+	}
 	return s.db.Close()
 }
 
@@ -127,6 +145,34 @@ func sqliteFilepath(fp string) string {
 	return "file:" + fp + "?" + strings.Join(params, "&")
 }
 
+// openExclusive opens the database at fp and takes an exclusive lock on it.
+// The lock is held until the returned database is closed. ErrDatabaseInUse is
+// returned if another connection has the database open.
+func openExclusive(fp string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", sqliteFilepath(fp)+"&_locking_mode=EXCLUSIVE&_txlock=exclusive")
+	if err != nil {
+		return nil, err
+	}
+	// the lock belongs to a single connection, the pool must never open
+	// another one
+	db.SetMaxOpenConns(1)
+
+	// an exclusive transaction acquires the lock immediately. Since the
+	// locking mode is exclusive, it is not released when the transaction ends.
+	tx, err := db.Begin()
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		db.Close()
+		if strings.Contains(err.Error(), "database is locked") {
+			return nil, ErrDatabaseInUse
+		}
+		return nil, fmt.Errorf("failed to lock database: %w", err)
+	}
+	return db, nil
+}
+
 // doTransaction is a helper function to execute a function within a transaction. If fn returns
 // an error, the transaction is rolled back. Otherwise, the transaction is
 // committed.
@@ -161,13 +207,20 @@ func clearLockedSectors(tx txn) error {
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
 	var sectorIDs []int64
 	for rows.Next() {
 		var sectorID int64
 		if err := rows.Scan(&sectorID); err != nil {
+			rows.Close()
 			return fmt.Errorf("failed to scan sector id: %w", err)
 		}
+		sectorIDs = append(sectorIDs, sectorID)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return fmt.Errorf("failed to clear locked sectors: %w", err)
+	} else if err := rows.Close(); err != nil {
+		return fmt.Errorf("failed to close rows: %w", err)
 	}
 
 	for _, sectorID := range sectorIDs {
@@ -131,7 +131,7 @@ func TestClearLockedSectors(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	checkConsistency := func(locked, temp int) error {
+	checkConsistency := func(locked, temp, stored int) error {
 		// check that the sectors are locked
 		var count int
 		err = db.queryRow(`SELECT COUNT(*) FROM locked_volume_sectors`).Scan(&count)
@@ -155,6 +155,14 @@ func TestClearLockedSectors(t *testing.T) {
 		} else if m.Storage.TempSectors != uint64(temp) {
 			return fmt.Errorf("expected %v temp sector metrics, got %v", temp, m.Storage.TempSectors)
 		}
+
+		// check that the unreferenced sectors were pruned
+		err = db.queryRow(`SELECT COUNT(*) FROM stored_sectors`).Scan(&count)
+		if err != nil {
+			return fmt.Errorf("query stored sectors: %w", err)
+		} else if stored != count {
+			return fmt.Errorf("expected %v stored sectors, got %v", stored, count)
+		}
 		return nil
 	}
 
@@ -182,7 +190,7 @@ func TestClearLockedSectors(t *testing.T) {
 	}
 
 	// check that the sectors have been stored and locked
-	if err = checkConsistency(sectors, sectors/2); err != nil {
+	if err = checkConsistency(sectors, sectors/2, sectors); err != nil {
 		t.Fatal(err)
 	}
 
@@ -192,7 +200,7 @@ func TestClearLockedSectors(t *testing.T) {
 	}
 
 	// check that all the locks were removed and half the sectors deleted
-	if err = checkConsistency(0, sectors/2); err != nil {
+	if err = checkConsistency(0, sectors/2, sectors/2); err != nil {
 		t.Fatal(err)
 	}
 }
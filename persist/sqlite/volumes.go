@@ -2,6 +2,7 @@ package sqlite
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
@@ -18,16 +19,83 @@ type volumeSectorRef struct {
 
 var errNoSectorsToMigrate = errors.New("no sectors to migrate")
 
-func (s *Store) migrateSector(volumeID int64, startIndex uint64, migrateFn func(location storage.SectorLocation) error, log *zap.Logger) error {
+// A migrationPlan returns the current location of the next sector to migrate
+// and the empty location it should be moved to. If there are no sectors to
+// migrate, errNoSectorsToMigrate is returned.
+type migrationPlan func(tx txn) (oldLoc, newLoc storage.SectorLocation, err error)
+
+// migrateOutOfVolume returns a migrationPlan that moves the sectors of a volume
+// starting at startIndex to other volumes. If there is no space in other
+// volumes, sectors are moved below startIndex in the same volume. If there is
+// still no space, a replica of the sector in another volume is promoted to the
+// primary location.
+func migrateOutOfVolume(strategy storage.PlacementStrategy, volumeID int64, startIndex uint64) migrationPlan {
+	return func(tx txn) (oldLoc, newLoc storage.SectorLocation, err error) {
+		oldLoc, err = sectorForMigration(tx, volumeID, startIndex)
+		if err != nil {
+			return storage.SectorLocation{}, storage.SectorLocation{}, fmt.Errorf("failed to get sector for migration: %w", err)
+		}
+
+		sectorDBID, err := sectorDBID(tx, oldLoc.Root)
+		if err != nil {
+			return storage.SectorLocation{}, storage.SectorLocation{}, fmt.Errorf("failed to get sector id: %w", err)
+		}
+
+		newLoc, err = emptyLocationForMigration(tx, strategy, volumeID, sectorDBID)
+		if errors.Is(err, storage.ErrNotEnoughStorage) && startIndex > 0 {
+			// if there is no space in other volumes, try to migrate within the
+			// same volume
+			newLoc, err = locationWithinVolume(tx, volumeID, startIndex)
+		}
+		if errors.Is(err, storage.ErrNotEnoughStorage) {
+			// if there is no space for another copy, promote an existing
+			// replica instead. This allows a volume to be removed when
+			// every other volume already holds a copy of its sectors.
+			newLoc, err = replicaForPromotion(tx, volumeID, sectorDBID)
+		}
+		if err != nil {
+			return storage.SectorLocation{}, storage.SectorLocation{}, fmt.Errorf("failed to get empty location: %w", err)
+		}
+		return oldLoc, newLoc, nil
+	}
+}
+
+// rebalanceVolumes returns a migrationPlan that moves sectors from one volume
+// to another. Sectors with a replica in the destination volume are skipped.
+// If the destination volume is full, ErrNotEnoughStorage is returned.
+func rebalanceVolumes(fromVolumeID, toVolumeID int64) migrationPlan {
+	return func(tx txn) (oldLoc, newLoc storage.SectorLocation, err error) {
+		const query = `SELECT vs.id, vs.volume_id, vs.volume_index, s.sector_root
+FROM volume_sectors vs
+INNER JOIN stored_sectors s ON (s.id=vs.sector_id)
+WHERE vs.volume_id=$1 AND vs.id NOT IN (SELECT volume_sector_id FROM locked_volume_sectors)
+AND vs.sector_id NOT IN (SELECT sr.sector_id FROM sector_replicas sr INNER JOIN volume_sectors rvs ON (rvs.id=sr.volume_sector_id) WHERE rvs.volume_id=$2)
+LIMIT 1`
+		err = tx.QueryRow(query, fromVolumeID, toVolumeID).Scan(&oldLoc.ID, &oldLoc.Volume, &oldLoc.Index, (*sqlHash256)(&oldLoc.Root))
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.SectorLocation{}, storage.SectorLocation{}, errNoSectorsToMigrate
+		} else if err != nil {
+			return storage.SectorLocation{}, storage.SectorLocation{}, fmt.Errorf("failed to get sector for migration: %w", err)
+		}
+
+		newLoc, err = emptyLocationInVolume(tx, toVolumeID)
+		if err != nil {
+			return storage.SectorLocation{}, storage.SectorLocation{}, fmt.Errorf("failed to get empty location: %w", err)
+		}
+		return oldLoc, newLoc, nil
+	}
+}
+
+func (s *Store) migrateSector(plan migrationPlan, migrateFn func(location storage.SectorLocation) error, log *zap.Logger) error {
 	start := time.Now()
 
 	var locationLocks []int64
-	var sectorLock int64
+	var sectorLock, replicaID int64
 	var oldLoc, newLoc storage.SectorLocation
 	err := s.transaction(func(tx txn) (err error) {
-		oldLoc, err = sectorForMigration(tx, volumeID, startIndex)
+		oldLoc, newLoc, err = plan(tx)
 		if err != nil {
-			return fmt.Errorf("failed to get sector for migration: %w", err)
+			return err
 		}
 
 		sectorDBID, err := sectorDBID(tx, oldLoc.Root)
@@ -40,18 +108,6 @@ func (s *Store) migrateSector(volumeID int64, startIndex uint64, migrateFn func(
 			return fmt.Errorf("failed to lock sector: %w", err)
 		}
 
-		newLoc, err = emptyLocationForMigration(tx, volumeID)
-		if errors.Is(err, storage.ErrNotEnoughStorage) && startIndex > 0 {
-			// if there is no space in other volumes, try to migrate within the
-			// same volume
-			newLoc, err = locationWithinVolume(tx, volumeID, startIndex)
-			if err != nil {
-				return fmt.Errorf("failed to get empty location in volume: %w", err)
-			}
-		} else if err != nil {
-			return fmt.Errorf("failed to get empty location: %w", err)
-		}
-
 		newLoc.Root = oldLoc.Root
 
 		// lock the old and new locations
@@ -60,6 +116,11 @@ func (s *Store) migrateSector(volumeID int64, startIndex uint64, migrateFn func(
 			return fmt.Errorf("failed to lock sectors: %w", err)
 		}
 
+		// check if the new location is a replica of the sector
+		err = tx.QueryRow(`SELECT id FROM sector_replicas WHERE sector_id=$1 AND volume_sector_id=$2`, sectorDBID, newLoc.ID).Scan(&replicaID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to check for replica: %w", err)
+		}
 		return nil
 	})
 	if err != nil {
@@ -70,9 +131,11 @@ func (s *Store) migrateSector(volumeID int64, startIndex uint64, migrateFn func(
 	defer unlockSector(&dbTxn{s}, sectorLock)
 
 	// call the migrateFn with the new location, data should be copied to the
-	// new location and synced to disk
-	if err := migrateFn(newLoc); err != nil {
-		return fmt.Errorf("failed to migrate data: %w", err)
+	// new location and synced to disk. A promoted replica is already on disk.
+	if replicaID == 0 {
+		if err := migrateFn(newLoc); err != nil {
+			return fmt.Errorf("failed to migrate data: %w", err)
+		}
 	}
 
 	// update the sector location in a separate transaction
@@ -103,13 +166,22 @@ func (s *Store) migrateSector(volumeID int64, startIndex uint64, migrateFn func(
 			return fmt.Errorf("failed to update sector location: %w", err)
 		}
 
+		if replicaID != 0 {
+			// the replica is now the primary copy. The new volume's usage
+			// already includes the replica.
+			if _, err := tx.Exec(`DELETE FROM sector_replicas WHERE id=$1`, replicaID); err != nil {
+				return fmt.Errorf("failed to remove promoted replica: %w", err)
+			}
+			return nil
+		}
+
 		// update the new volume metadata
 		if err := incrementVolumeUsage(tx, newVolumeID, 1); err != nil {
 			return fmt.Errorf("failed to update new volume metadata: %w", err)
 		}
 		return nil
 	})
-	log.Debug("migrated sector", zap.Uint64("oldIndex", oldLoc.Index), zap.Stringer("root", newLoc.Root), zap.Int64("newVolume", newLoc.Volume), zap.Uint64("newIndex", newLoc.Index), zap.Duration("elapsed", time.Since(start)))
+	log.Debug("migrated sector", zap.Uint64("oldIndex", oldLoc.Index), zap.Stringer("root", newLoc.Root), zap.Int64("newVolume", newLoc.Volume), zap.Uint64("newIndex", newLoc.Index), zap.Bool("promoted", replicaID != 0), zap.Duration("elapsed", time.Since(start)))
 	return err
 }
 
@@ -157,18 +229,18 @@ func (s *Store) batchRemoveVolume(id int64) (bool, error) {
 }
 
 // StorageUsage returns the number of sectors stored and the total number of sectors
-// available in the storage pool.
+// available in the storage pool. Cache tier volumes are not included.
 func (s *Store) StorageUsage() (usedSectors, totalSectors uint64, err error) {
 	// nulls are not included in COUNT() -- counting sector roots is equivalent
 	// to counting used sectors.
-	const query = `SELECT COALESCE(SUM(total_sectors), 0) AS total_sectors, COALESCE(SUM(used_sectors), 0) AS used_sectors FROM storage_volumes`
+	const query = `SELECT COALESCE(SUM(total_sectors), 0) AS total_sectors, COALESCE(SUM(used_sectors), 0) AS used_sectors FROM storage_volumes WHERE cache_tier=false`
 	err = s.queryRow(query).Scan(&totalSectors, &usedSectors)
 	return
 }
 
 // Volumes returns a list of all volumes.
 func (s *Store) Volumes() ([]storage.Volume, error) {
-	const query = `SELECT v.id, v.disk_path, v.read_only, v.available, v.total_sectors, v.used_sectors
+	const query = `SELECT v.id, v.disk_path, v.read_only, v.available, v.cache_tier, v.priority, v.total_sectors, v.used_sectors, v.encryption_salt, v.encryption_cursor, v.s3_config
 FROM storage_volumes v
 ORDER BY v.id ASC`
 	rows, err := s.query(query)
@@ -190,7 +262,7 @@ ORDER BY v.id ASC`
 
 // Volume returns a volume by its ID.
 func (s *Store) Volume(id int64) (storage.Volume, error) {
-	const query = `SELECT v.id, v.disk_path, v.read_only, v.available, v.total_sectors, v.used_sectors
+	const query = `SELECT v.id, v.disk_path, v.read_only, v.available, v.cache_tier, v.priority, v.total_sectors, v.used_sectors, v.encryption_salt, v.encryption_cursor, v.s3_config
 FROM storage_volumes v
 WHERE v.id=$1`
 	row := s.queryRow(query, id)
@@ -218,7 +290,12 @@ func (s *Store) StoreSector(root types.Hash256, fn func(loc storage.SectorLocati
 	var location storage.SectorLocation
 	var exists bool
 
-	err := s.transaction(func(tx txn) error {
+	strategy, err := s.placementStrategy()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.transaction(func(tx txn) error {
 		sectorID, err := insertSectorDBID(tx, root)
 		if err != nil {
 			return fmt.Errorf("failed to get sector id: %w", err)
@@ -234,7 +311,7 @@ func (s *Store) StoreSector(root types.Hash256, fn func(loc storage.SectorLocati
 		location, err = sectorLocation(tx, sectorID, root)
 		exists = err == nil
 		if errors.Is(err, storage.ErrSectorNotFound) {
-			location, err = emptyLocation(tx)
+			location, err = emptyLocation(tx, strategy)
 			if err != nil {
 				return fmt.Errorf("failed to get empty location: %w", err)
 			}
@@ -292,11 +369,18 @@ func (s *Store) StoreSector(root types.Hash256, fn func(loc storage.SectorLocati
 
 // MigrateSectors migrates each occupied sector of a volume starting at
 // startIndex. The sector data should be copied to the new location and synced
-// to disk during migrateFn.
+// to disk during migrateFn. If there is no space for a sector, a replica of the
+// sector in another volume is promoted to the primary location without calling
+// migrateFn.
 func (s *Store) MigrateSectors(volumeID int64, startIndex uint64, migrateFn func(location storage.SectorLocation) error) error {
+	strategy, err := s.placementStrategy()
+	if err != nil {
+		return err
+	}
+
 	log := s.log.Named("migrate").With(zap.Int64("oldVolume", volumeID), zap.Uint64("startIndex", startIndex))
 	for i := 0; ; i++ {
-		if err := s.migrateSector(volumeID, startIndex, migrateFn, log); err != nil {
+		if err := s.migrateSector(migrateOutOfVolume(strategy, volumeID, startIndex), migrateFn, log); err != nil {
 			if errors.Is(err, errNoSectorsToMigrate) {
 				return nil
 			}
@@ -308,6 +392,27 @@ func (s *Store) MigrateSectors(volumeID int64, startIndex uint64, migrateFn func
 	}
 }
 
+// RebalanceSectors moves up to n sectors from one volume to another. The
+// sector data should be copied to the new location and synced to disk during
+// migrateFn. The number of sectors moved is returned. Moving stops early if
+// there are no more sectors that can be moved or the destination volume is
+// full.
+func (s *Store) RebalanceSectors(fromVolumeID, toVolumeID int64, n int, migrateFn func(location storage.SectorLocation) error) (moved int, err error) {
+	log := s.log.Named("rebalance").With(zap.Int64("oldVolume", fromVolumeID), zap.Int64("newVolume", toVolumeID))
+	for ; moved < n; moved++ {
+		err := s.migrateSector(rebalanceVolumes(fromVolumeID, toVolumeID), migrateFn, log)
+		if errors.Is(err, errNoSectorsToMigrate) || errors.Is(err, storage.ErrNotEnoughStorage) {
+			return moved, nil
+		} else if err != nil {
+			return moved, fmt.Errorf("failed to migrate sector: %w", err)
+		}
+		if (moved+1)%64 == 0 {
+			jitterSleep(time.Millisecond) // allow other transactions to run
+		}
+	}
+	return moved, nil
+}
+
 // AddVolume initializes a new storage volume and adds it to the volume
 // store. GrowVolume must be called afterwards to initialize the volume
 // to its desired size.
@@ -315,10 +420,44 @@ func (s *Store) AddVolume(localPath string, readOnly bool) (volumeID int64, err
 	return addVolume(&dbTxn{s}, localPath, readOnly)
 }
 
+// AddS3Volume initializes a new storage volume backed by an S3-compatible
+// bucket and adds it to the volume store. GrowVolume must be called
+// afterwards to initialize the volume to its desired size.
+func (s *Store) AddS3Volume(cfg storage.S3Config, readOnly bool) (volumeID int64, err error) {
+	buf, err := json.Marshal(cfg)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode s3 config: %w", err)
+	}
+	err = s.transaction(func(tx txn) error {
+		volumeID, err = addVolume(tx, cfg.Location(), readOnly)
+		if err != nil {
+			return fmt.Errorf("failed to add volume: %w", err)
+		} else if _, err := tx.Exec(`UPDATE storage_volumes SET s3_config=$1 WHERE id=$2`, string(buf), volumeID); err != nil {
+			return fmt.Errorf("failed to set s3 config: %w", err)
+		}
+		return nil
+	})
+	return
+}
+
 // RemoveVolume removes a storage volume from the volume store. If there
 // are used sectors in the volume, ErrVolumeNotEmpty is returned. If force is
 // true, the volume is removed regardless of whether it is empty.
 func (s *Store) RemoveVolume(id int64) error {
+	// replicas are not migrated, they will be recreated in another volume by
+	// the volume manager. Cached copies are discarded.
+	err := s.transaction(func(tx txn) error {
+		if err := removeVolumeReplicas(tx, id, 0); err != nil {
+			return fmt.Errorf("failed to remove replicas: %w", err)
+		} else if err := removeVolumeCachedSectors(tx, id, 0); err != nil {
+			return fmt.Errorf("failed to remove cached sectors: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
 	// remove the volume sectors in batches to avoid holding a transaction lock
 	// for too long
 	for {
@@ -330,10 +469,16 @@ func (s *Store) RemoveVolume(id int64) error {
 		}
 		jitterSleep(time.Millisecond)
 	}
-	if _, err := s.exec(`DELETE FROM storage_volumes WHERE id=?`, id); err != nil {
-		return fmt.Errorf("failed to remove volume: %w", err)
-	}
-	return nil
+	return s.transaction(func(tx txn) error {
+		if _, err := tx.Exec(`DELETE FROM volume_scrub_errors WHERE volume_id=$1`, id); err != nil {
+			return fmt.Errorf("failed to remove scrub errors: %w", err)
+		} else if _, err := tx.Exec(`DELETE FROM volume_scrubs WHERE volume_id=$1`, id); err != nil {
+			return fmt.Errorf("failed to remove scrub progress: %w", err)
+		} else if _, err := tx.Exec(`DELETE FROM storage_volumes WHERE id=$1`, id); err != nil {
+			return fmt.Errorf("failed to remove volume: %w", err)
+		}
+		return nil
+	})
 }
 
 // GrowVolume grows a storage volume's metadata by n sectors.
@@ -372,6 +517,12 @@ func (s *Store) ShrinkVolume(id int64, maxSectors uint64) error {
 		} else if maxSectors > totalSectors {
 			panic(fmt.Errorf("maxSectors must be less than totalSectors: %v < %v", maxSectors, totalSectors))
 		}
+		// remove any replicas and cached copies in the shrink range
+		if err := removeVolumeReplicas(tx, id, maxSectors); err != nil {
+			return fmt.Errorf("failed to remove replicas: %w", err)
+		} else if err := removeVolumeCachedSectors(tx, id, maxSectors); err != nil {
+			return fmt.Errorf("failed to remove cached sectors: %w", err)
+		}
 		// delete the empty sectors
 		_, err = tx.Exec(`DELETE FROM volume_sectors WHERE volume_id=$1 AND volume_index >= $2;`, id, maxSectors)
 		if err != nil {
@@ -395,6 +546,20 @@ func (s *Store) SetReadOnly(volumeID int64, readOnly bool) error {
 	return err
 }
 
+// SetPriority sets the placement priority of a volume.
+func (s *Store) SetPriority(volumeID int64, priority uint64) error {
+	const query = `UPDATE storage_volumes SET priority=$1 WHERE id=$2;`
+	res, err := s.exec(query, priority, volumeID)
+	if err != nil {
+		return err
+	} else if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	} else if n == 0 {
+		return storage.ErrVolumeNotFound
+	}
+	return nil
+}
+
 // SetAvailable sets the available flag on a volume.
 func (s *Store) SetAvailable(volumeID int64, available bool) error {
 	const query = `UPDATE storage_volumes SET available=$1 WHERE id=$2;`
@@ -482,7 +647,9 @@ func emptyLocationInVolume(tx txn, volumeID int64) (loc storage.SectorLocation,
 	const query = `SELECT vs.id, vs.volume_id, vs.volume_index 
 FROM volume_sectors vs INDEXED BY volume_sectors_volume_id_sector_id_volume_index_compound
 LEFT JOIN locked_volume_sectors lvs ON (lvs.volume_sector_id=vs.id)
-WHERE vs.sector_id IS NULL AND lvs.volume_sector_id IS NULL AND vs.volume_id=$1
+LEFT JOIN sector_replicas sr ON (sr.volume_sector_id=vs.id)
+LEFT JOIN cached_sectors cs ON (cs.volume_sector_id=vs.id)
+WHERE vs.sector_id IS NULL AND lvs.volume_sector_id IS NULL AND sr.volume_sector_id IS NULL AND cs.volume_sector_id IS NULL AND vs.volume_id=$1
 LIMIT 1;`
 	err = tx.QueryRow(query, volumeID).Scan(&loc.ID, &loc.Volume, &loc.Index)
 	if errors.Is(err, sql.ErrNoRows) {
@@ -491,19 +658,13 @@ LIMIT 1;`
 	return
 }
 
-// emptyLocation returns an empty location in a writable volume. If there is no
-// space available, ErrNotEnoughStorage is returned.
-func emptyLocation(tx txn) (storage.SectorLocation, error) {
-	const query = `SELECT id 
-FROM storage_volumes
-WHERE available=true AND read_only=false AND total_sectors-used_sectors > 0
-ORDER BY used_sectors ASC LIMIT 1;`
-	var volumeID int64
-	err := tx.QueryRow(query).Scan(&volumeID)
-	if errors.Is(err, sql.ErrNoRows) {
-		return storage.SectorLocation{}, storage.ErrNotEnoughStorage
-	} else if err != nil {
-		return storage.SectorLocation{}, fmt.Errorf("failed to get empty location: %w", err)
+// emptyLocation returns an empty location in a writable volume chosen by the
+// host's placement policy. If there is no space available, ErrNotEnoughStorage
+// is returned.
+func emptyLocation(tx txn, strategy storage.PlacementStrategy) (storage.SectorLocation, error) {
+	volumeID, err := placementVolume(tx, strategy, "")
+	if err != nil {
+		return storage.SectorLocation{}, err
 	}
 
 	// note: there is a slight race here where all sectors in a volume could be
@@ -514,18 +675,15 @@ ORDER BY used_sectors ASC LIMIT 1;`
 }
 
 // emptyLocationForMigration returns an empty location in a writable volume
-// other than the given volumeID. If there is no space available,
-// ErrNotEnoughStorage is returned.
-func emptyLocationForMigration(tx txn, oldVolumeID int64) (loc storage.SectorLocation, err error) {
-	const query = `SELECT id FROM storage_volumes
-WHERE available=true AND read_only=false AND total_sectors-used_sectors > 0 AND id<>$1
-ORDER BY used_sectors ASC LIMIT 1;`
-	var newVolumeID int64
-	err = tx.QueryRow(query, oldVolumeID).Scan(&newVolumeID)
-	if errors.Is(err, sql.ErrNoRows) {
-		return storage.SectorLocation{}, storage.ErrNotEnoughStorage
-	} else if err != nil {
-		return storage.SectorLocation{}, fmt.Errorf("failed to get empty location: %w", err)
+// other than the given volumeID chosen by the host's placement policy. Volumes that contain a replica of the sector
+// are skipped. If there is no space available, ErrNotEnoughStorage is
+// returned.
+func emptyLocationForMigration(tx txn, strategy storage.PlacementStrategy, oldVolumeID, sectorID int64) (loc storage.SectorLocation, err error) {
+	const filter = `AND id<>$1
+AND id NOT IN (SELECT vs.volume_id FROM sector_replicas sr INNER JOIN volume_sectors vs ON (vs.id=sr.volume_sector_id) WHERE sr.sector_id=$2)`
+	newVolumeID, err := placementVolume(tx, strategy, filter, oldVolumeID, sectorID)
+	if err != nil {
+		return storage.SectorLocation{}, err
 	}
 
 	// note: there is a slight race here where all sectors in a volume could be
@@ -552,6 +710,24 @@ func sectorForMigration(tx txn, volumeID int64, minIndex uint64) (loc storage.Se
 	return
 }
 
+// replicaForPromotion returns the location of a replica of the sector in an
+// available volume other than the given volumeID. If there is no replica,
+// ErrNotEnoughStorage is returned.
+func replicaForPromotion(tx txn, volumeID, sectorID int64) (loc storage.SectorLocation, err error) {
+	const query = `SELECT vs.id, vs.volume_id, vs.volume_index
+	FROM sector_replicas sr
+	INNER JOIN volume_sectors vs ON (vs.id=sr.volume_sector_id)
+	INNER JOIN storage_volumes v ON (v.id=vs.volume_id)
+	WHERE sr.sector_id=$1 AND vs.volume_id<>$2 AND v.available=true
+	LIMIT 1;`
+
+	err = tx.QueryRow(query, sectorID, volumeID).Scan(&loc.ID, &loc.Volume, &loc.Index)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.SectorLocation{}, storage.ErrNotEnoughStorage
+	}
+	return
+}
+
 // locationWithinVolume returns an empty location within the same volume as
 // the given volumeID. If there is no space in the volume, ErrNotEnoughStorage
 // is returned.
@@ -559,6 +735,8 @@ func locationWithinVolume(tx txn, volumeID int64, maxIndex uint64) (loc storage.
 	const query = `SELECT vs.id, vs.volume_id, vs.volume_index
 	FROM volume_sectors vs
 	WHERE vs.sector_id IS NULL AND vs.id NOT IN (SELECT volume_sector_id FROM locked_volume_sectors) 
+	AND vs.id NOT IN (SELECT volume_sector_id FROM sector_replicas)
+	AND vs.id NOT IN (SELECT volume_sector_id FROM cached_sectors)
 	AND vs.volume_id=$1 AND vs.volume_index<$2
 	LIMIT 1;`
 
@@ -587,6 +765,25 @@ func volumeSectorsForDeletion(tx txn, volumeID int64, batchSize int) (locs []vol
 }
 
 func scanVolume(s scanner) (volume storage.Volume, err error) {
-	err = s.Scan(&volume.ID, &volume.LocalPath, &volume.ReadOnly, &volume.Available, &volume.TotalSectors, &volume.UsedSectors)
+	var salt []byte
+	var cursor sql.NullInt64
+	var s3Config sql.NullString
+	err = s.Scan(&volume.ID, &volume.LocalPath, &volume.ReadOnly, &volume.Available, &volume.CacheTier, &volume.Priority, &volume.TotalSectors, &volume.UsedSectors, &salt, &cursor, &s3Config)
+	if err != nil {
+		return
+	} else if s3Config.Valid {
+		volume.S3 = new(storage.S3Config)
+		if err = json.Unmarshal([]byte(s3Config.String), volume.S3); err != nil {
+			return volume, fmt.Errorf("failed to decode s3 config: %w", err)
+		}
+	}
+	if len(salt) != 0 {
+		volume.Encrypted = true
+		copy(volume.EncryptionSalt[:], salt)
+		if cursor.Valid {
+			n := uint64(cursor.Int64)
+			volume.EncryptionCursor = &n
+		}
+	}
 	return
 }
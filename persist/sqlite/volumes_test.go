@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	rhp2 "go.sia.tech/core/rhp/v2"
 	"go.sia.tech/core/types"
 	"go.sia.tech/hostd/host/contracts"
 	"go.sia.tech/hostd/host/storage"
@@ -581,6 +582,83 @@ func TestMigrateSectors(t *testing.T) {
 	}
 }
 
+func TestMigrateReplicatedSectors(t *testing.T) {
+	const sectors = 8
+	log := zaptest.NewLogger(t)
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "test.db"), log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	volume1, err := addTestVolume(db, "test1", sectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	volume2, err := addTestVolume(db, "test2", sectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// store each sector with a replica. Both volumes are full afterwards.
+	roots := make([]types.Hash256, sectors)
+	for i := range roots {
+		roots[i] = frand.Entropy256()
+		release, err := db.StoreSector(roots[i], func(loc storage.SectorLocation, exists bool) error { return nil })
+		if err != nil {
+			t.Fatal(err)
+		} else if err := db.AddTemporarySectors([]storage.TempSector{{Root: roots[i], Expiration: 100}}); err != nil {
+			t.Fatal(err)
+		} else if err := release(); err != nil {
+			t.Fatal(err)
+		}
+
+		release, err = db.StoreSectorReplica(roots[i], func(loc storage.SectorLocation) error { return nil })
+		if err != nil {
+			t.Fatal(err)
+		} else if err := release(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// simulate a failed disk
+	if err := db.SetAvailable(volume1.ID, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// there is no space for another copy, the replicas in the second volume
+	// should be promoted without copying any data
+	err = db.MigrateSectors(volume1.ID, 0, func(loc storage.SectorLocation) error {
+		t.Fatalf("unexpected migration of sector %v", loc.Root)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if err := db.RemoveVolume(volume1.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, root := range roots {
+		if loc, release, err := db.SectorLocation(root); err != nil {
+			t.Fatal(err)
+		} else if loc.Volume != volume2.ID {
+			t.Fatalf("expected volume ID %v, got %v", volume2.ID, loc.Volume)
+		} else if err := release(); err != nil {
+			t.Fatal(err)
+		} else if replicas, err := db.SectorReplicas(root); err != nil {
+			t.Fatal(err)
+		} else if len(replicas) != 0 {
+			t.Fatalf("expected no replicas, got %v", len(replicas))
+		}
+	}
+
+	if v2, err := db.Volume(volume2.ID); err != nil {
+		t.Fatal(err)
+	} else if v2.UsedSectors != sectors {
+		t.Fatalf("expected %v used sectors, got %v", sectors, v2.UsedSectors)
+	}
+}
+
 func TestPrune(t *testing.T) {
 	const sectors = 100
 
@@ -795,6 +873,184 @@ func TestPrune(t *testing.T) {
 	}
 }
 
+func TestTempSectors(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "test.db"), log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := addTestVolume(db, "test", 20); err != nil {
+		t.Fatal(err)
+	}
+
+	roots := make([]types.Hash256, 10)
+	releaseFns := make([]func() error, 0, len(roots))
+	for i := range roots {
+		roots[i] = frand.Entropy256()
+		release, err := db.StoreSector(roots[i], func(loc storage.SectorLocation, exists bool) error { return nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		releaseFns = append(releaseFns, release)
+	}
+
+	renterKey := types.NewPrivateKeyFromSeed(frand.Bytes(32))
+	hostKey := types.NewPrivateKeyFromSeed(frand.Bytes(32))
+	contractUnlockConditions := types.UnlockConditions{
+		PublicKeys: []types.UnlockKey{
+			renterKey.PublicKey().UnlockKey(),
+			hostKey.PublicKey().UnlockKey(),
+		},
+		SignaturesRequired: 2,
+	}
+	c := contracts.SignedRevision{
+		Revision: types.FileContractRevision{
+			UnlockConditions: contractUnlockConditions,
+			ParentID:         types.FileContractID(frand.Entropy256()),
+			FileContract: types.FileContract{
+				UnlockHash:  types.Hash256(contractUnlockConditions.UnlockHash()),
+				WindowStart: 90,
+				WindowEnd:   100,
+			},
+		},
+	}
+	if err := db.AddContract(c, []types.Transaction{}, types.MaxCurrency, contracts.Usage{}, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	var contractRoots []types.Hash256
+	appendRoots := func(roots ...types.Hash256) {
+		t.Helper()
+		var changes []contracts.SectorChange
+		for _, root := range roots {
+			changes = append(changes, contracts.SectorChange{Root: root, Action: contracts.SectorActionAppend})
+		}
+		if err := db.ReviseContract(c, contractRoots, contracts.Usage{}, changes); err != nil {
+			t.Fatal(err)
+		}
+		contractRoots = append(contractRoots, roots...)
+	}
+
+	// the first sector is referenced by both the contract and temp storage
+	appendRoots(append([]types.Hash256{roots[0]}, roots[6:]...)...)
+	var temp []storage.TempSector
+	for i, root := range roots[:6] {
+		temp = append(temp, storage.TempSector{Root: root, Expiration: 10 + uint64(i/3)*10})
+	}
+	if err := db.AddTemporarySectors(temp); err != nil {
+		t.Fatal(err)
+	}
+
+	checkTempStorage := func(refs, ephemeral uint64, expirations []storage.TempStorageExpiration) {
+		t.Helper()
+		summary, err := db.TempStorageSummary()
+		if err != nil {
+			t.Fatal(err)
+		} else if summary.Sectors != refs {
+			t.Fatalf("expected %v temp sectors, got %v", refs, summary.Sectors)
+		} else if summary.EphemeralSectors != ephemeral {
+			t.Fatalf("expected %v ephemeral sectors, got %v", ephemeral, summary.EphemeralSectors)
+		} else if summary.Size != ephemeral*rhp2.SectorSize {
+			t.Fatalf("expected %v bytes, got %v", ephemeral*rhp2.SectorSize, summary.Size)
+		} else if !reflect.DeepEqual(summary.Expirations, expirations) {
+			t.Fatalf("expected expirations %v, got %v", expirations, summary.Expirations)
+		}
+
+		m, err := db.Metrics(time.Now())
+		if err != nil {
+			t.Fatal(err)
+		} else if m.Storage.TempSectors != refs {
+			t.Fatalf("expected %v temp sectors metric, got %v", refs, m.Storage.TempSectors)
+		} else if m.Storage.EphemeralSectors != ephemeral {
+			t.Fatalf("expected %v ephemeral sectors metric, got %v", ephemeral, m.Storage.EphemeralSectors)
+		}
+	}
+
+	checkTempStorage(6, 5, []storage.TempStorageExpiration{{Height: 10, Sectors: 3}, {Height: 20, Sectors: 3}})
+
+	// check pagination
+	page, err := db.TempSectors(4, 0)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(page) != 4 {
+		t.Fatalf("expected 4 sectors, got %v", len(page))
+	}
+	rest, err := db.TempSectors(4, 4)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(rest) != 2 {
+		t.Fatalf("expected 2 sectors, got %v", len(rest))
+	}
+	for i, sector := range append(page, rest...) {
+		switch {
+		case sector.Root != roots[i]:
+			t.Fatalf("expected sector %v to be %v, got %v", i, roots[i], sector.Root)
+		case sector.Expiration != temp[i].Expiration:
+			t.Fatalf("expected sector %v to expire at %v, got %v", i, temp[i].Expiration, sector.Expiration)
+		case i == 0 && sector.Contracts != 1:
+			t.Fatalf("expected sector 0 to be referenced by 1 contract, got %v", sector.Contracts)
+		case i != 0 && sector.Contracts != 0:
+			t.Fatalf("expected sector %v to have no contract references, got %v", i, sector.Contracts)
+		}
+	}
+
+	// a second reference to the same sector should not change the
+	// ephemeral count
+	if err := db.AddTemporarySectors([]storage.TempSector{{Root: roots[1], Expiration: 30}}); err != nil {
+		t.Fatal(err)
+	}
+	checkTempStorage(7, 5, []storage.TempStorageExpiration{{Height: 10, Sectors: 3}, {Height: 20, Sectors: 3}, {Height: 30, Sectors: 1}})
+
+	// release the initial locks so expired sectors can be pruned
+	for _, fn := range releaseFns {
+		if err := fn(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// expire selected sectors
+	if removed, err := db.RemoveTempSectors([]types.Hash256{roots[1], roots[3]}); err != nil {
+		t.Fatal(err)
+	} else if removed != 3 {
+		t.Fatalf("expected 3 references removed, got %v", removed)
+	}
+	checkTempStorage(4, 3, []storage.TempStorageExpiration{{Height: 10, Sectors: 2}, {Height: 20, Sectors: 2}})
+	for _, root := range []types.Hash256{roots[1], roots[3]} {
+		if _, _, err := db.SectorLocation(root); !errors.Is(err, storage.ErrSectorNotFound) {
+			t.Fatalf("expected ErrSectorNotFound, got %v", err)
+		}
+	}
+
+	// appending a temp sector to a contract makes it no longer ephemeral
+	appendRoots(roots[2])
+	checkTempStorage(4, 2, []storage.TempStorageExpiration{{Height: 10, Sectors: 2}, {Height: 20, Sectors: 2}})
+
+	// expire all sectors
+	if removed, err := db.RemoveTempSectors(nil); err != nil {
+		t.Fatal(err)
+	} else if removed != 4 {
+		t.Fatalf("expected 4 references removed, got %v", removed)
+	}
+	checkTempStorage(0, 0, []storage.TempStorageExpiration{})
+	for i, root := range roots {
+		_, release, err := db.SectorLocation(root)
+		switch i {
+		case 1, 3, 4, 5:
+			if !errors.Is(err, storage.ErrSectorNotFound) {
+				t.Fatalf("expected sector %v to be removed, got %v", i, err)
+			}
+		default:
+			if err != nil {
+				t.Fatalf("expected sector %v to be stored, got %v", i, err)
+			} else if err := release(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
 func BenchmarkVolumeGrow(b *testing.B) {
 	log := zaptest.NewLogger(b)
 	db, err := OpenDatabase(filepath.Join(b.TempDir(), "test.db"), log)
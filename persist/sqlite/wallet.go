@@ -181,6 +181,43 @@ func (s *Store) VerifyWalletKey(seedHash types.Hash256) error {
 	return nil
 }
 
+// RetiredWalletKeys returns the encrypted wallet keys that have been replaced
+// by a key rotation.
+func (s *Store) RetiredWalletKeys() (keys []wallet.RetiredKey, err error) {
+	rows, err := s.query(`SELECT address, encrypted_key FROM wallet_retired_keys ORDER BY id ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query retired wallet keys: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key wallet.RetiredKey
+		if err := rows.Scan((*sqlHash256)(&key.Address), &key.EncryptedKey); err != nil {
+			return nil, fmt.Errorf("failed to scan retired wallet key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// RotateWalletKey atomically replaces the wallet's retired keys and sets the
+// seed hash to the new key's.
+func (s *Store) RotateWalletKey(retired []wallet.RetiredKey, seedHash types.Hash256) error {
+	return s.transaction(func(tx txn) error {
+		if _, err := tx.Exec(`DELETE FROM wallet_retired_keys`); err != nil {
+			return fmt.Errorf("failed to clear retired wallet keys: %w", err)
+		}
+		for _, key := range retired {
+			if _, err := tx.Exec(`INSERT INTO wallet_retired_keys (address, encrypted_key) VALUES ($1, $2)`, sqlHash256(key.Address), key.EncryptedKey); err != nil {
+				return fmt.Errorf("failed to add retired wallet key: %w", err)
+			}
+		}
+		if _, err := tx.Exec(`UPDATE global_settings SET wallet_hash=$1`, sqlHash256(seedHash)); err != nil {
+			return fmt.Errorf("failed to update wallet seed hash: %w", err)
+		}
+		return nil
+	})
+}
+
 // ResetWallet resets the wallet to its initial state. This is used when a
 // consensus subscription error occurs.
 func (s *Store) ResetWallet(seedHash types.Hash256) error {
@@ -22,6 +22,10 @@ type (
 		r, w    uint64
 		monitor DataMonitor
 		rl, wl  *rate.Limiter
+
+		// renter is the renter the connection's bandwidth is attributed to,
+		// nil until the renter is known.
+		renter atomic.Pointer[renterBandwidth]
 	}
 )
 
@@ -37,6 +41,11 @@ func (c *Conn) Read(b []byte) (int, error) {
 	n, err := c.Conn.Read(b)
 	atomic.AddUint64(&c.r, uint64(n))
 	c.monitor.ReadBytes(n)
+	if rb := c.renter.Load(); rb != nil {
+		if err := rb.read(n); err != nil {
+			return n, err
+		}
+	}
 	if err := c.rl.WaitN(context.Background(), n); err != nil {
 		return n, err
 	}
@@ -48,12 +57,34 @@ func (c *Conn) Write(b []byte) (int, error) {
 	n, err := c.Conn.Write(b)
 	atomic.AddUint64(&c.w, uint64(n))
 	c.monitor.WriteBytes(n)
+	if rb := c.renter.Load(); rb != nil {
+		if err := rb.write(n); err != nil {
+			return n, err
+		}
+	}
 	if err := c.wl.WaitN(context.Background(), n); err != nil {
 		return n, err
 	}
 	return n, err
 }
 
+// Close closes the connection and detaches it from its renter.
+func (c *Conn) Close() error {
+	if rb := c.renter.Swap(nil); rb != nil {
+		rb.detach()
+	}
+	return c.Conn.Close()
+}
+
+// CheckEgressCap returns ErrEgressCapExceeded if the renter the connection is
+// attributed to has reached its daily egress cap.
+func (c *Conn) CheckEgressCap() error {
+	if rb := c.renter.Load(); rb != nil {
+		return rb.checkEgress()
+	}
+	return nil
+}
+
 // NewConn initializes a new RPC conn wrapper.
 func NewConn(c net.Conn, m DataMonitor, rl, wl *rate.Limiter) *Conn {
 	if c, ok := c.(*Conn); ok {
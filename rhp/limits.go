@@ -0,0 +1,279 @@
+package rhp
+
+import (
+	"errors"
+	"math"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// limitsCleanupInterval is the minimum interval between removing expired bans
+// and idle peers from a ConnLimiter.
+const limitsCleanupInterval = time.Minute
+
+var (
+	// ErrPeerBanned is returned when a connection is rejected because the
+	// peer is banned.
+	ErrPeerBanned = errors.New("peer is banned")
+	// ErrPeerNotBanned is returned when unbanning a peer that is not banned.
+	ErrPeerNotBanned = errors.New("peer is not banned")
+	// ErrTooManySessions is returned when a connection is rejected because
+	// the peer or its subnet has too many open sessions.
+	ErrTooManySessions = errors.New("too many sessions")
+	// ErrConnectionRateExceeded is returned when a connection is rejected
+	// because the peer is opening new connections too quickly.
+	ErrConnectionRateExceeded = errors.New("connection rate exceeded")
+)
+
+type (
+	// ConnLimits are the limits applied to connections from renters. A zero
+	// value disables the corresponding limit.
+	ConnLimits struct {
+		// MaxSessionsPerIP is the maximum number of concurrent sessions
+		// from a single IP address.
+		MaxSessionsPerIP int
+		// MaxSessionsPerSubnet is the maximum number of concurrent sessions
+		// from a single /24 IPv4 or /64 IPv6 subnet.
+		MaxSessionsPerSubnet int
+		// ConnectionsPerSecond is the maximum rate of new connections from a
+		// single IP address.
+		ConnectionsPerSecond float64
+		// HandshakeTimeout is the maximum duration of the transport
+		// handshake.
+		HandshakeTimeout time.Duration
+		// BanThreshold is the number of failed handshakes or unpaid RPCs
+		// after which a peer is banned. Failures are forgotten after
+		// BanDuration without another failure or after a paid RPC.
+		BanThreshold int
+		// BanDuration is the duration of a ban.
+		BanDuration time.Duration
+	}
+
+	// A Ban prevents a peer from connecting to the host until it expires.
+	Ban struct {
+		Address    string    `json:"address"`
+		Reason     string    `json:"reason"`
+		Expiration time.Time `json:"expiration"`
+	}
+
+	peerFailures struct {
+		count int
+		last  time.Time
+	}
+
+	// A ConnLimiter limits the number and rate of connections from each peer
+	// and temporarily bans peers that repeatedly misbehave.
+	ConnLimiter struct {
+		limits ConnLimits
+
+		mu          sync.Mutex // protects the fields below
+		lastCleanup time.Time
+		sessions    map[string]int // keyed by IP
+		subnets     map[string]int
+		rates       map[string]*rate.Limiter
+		failures    map[string]peerFailures
+		bans        map[string]Ban
+	}
+)
+
+// peerKeys returns the IP address and subnet of a remote address. Addresses
+// that cannot be parsed are used as is.
+func peerKeys(addr string) (ip, subnet string) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	parsed := net.ParseIP(host)
+	if parsed == nil {
+		return host, host
+	} else if v4 := parsed.To4(); v4 != nil {
+		return v4.String(), v4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+	}
+	return parsed.String(), parsed.Mask(net.CIDRMask(64, 128)).String() + "/64"
+}
+
+// cleanup removes expired bans and failures and the rate limiters of peers
+// without open sessions. It must be called with the mutex held.
+func (cl *ConnLimiter) cleanup() {
+	if time.Since(cl.lastCleanup) < limitsCleanupInterval {
+		return
+	}
+	cl.lastCleanup = time.Now()
+
+	for ip, ban := range cl.bans {
+		if time.Now().After(ban.Expiration) {
+			delete(cl.bans, ip)
+		}
+	}
+	for ip, f := range cl.failures {
+		if time.Since(f.last) > cl.limits.BanDuration {
+			delete(cl.failures, ip)
+		}
+	}
+	for ip, l := range cl.rates {
+		// a full bucket is equivalent to a new limiter
+		if cl.sessions[ip] == 0 && l.Tokens() >= float64(l.Burst()) {
+			delete(cl.rates, ip)
+		}
+	}
+}
+
+// AcceptConn checks whether a new connection from the remote address should
+// be accepted. If it is, release must be called when the connection is
+// closed.
+func (cl *ConnLimiter) AcceptConn(addr string) (release func(), err error) {
+	ip, subnet := peerKeys(addr)
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	cl.cleanup()
+
+	if ban, ok := cl.bans[ip]; ok {
+		if time.Now().Before(ban.Expiration) {
+			return nil, ErrPeerBanned
+		}
+		delete(cl.bans, ip)
+	}
+
+	if cl.limits.ConnectionsPerSecond > 0 {
+		l, ok := cl.rates[ip]
+		if !ok {
+			burst := int(math.Ceil(cl.limits.ConnectionsPerSecond))
+			l = rate.NewLimiter(rate.Limit(cl.limits.ConnectionsPerSecond), burst)
+			cl.rates[ip] = l
+		}
+		if !l.Allow() {
+			return nil, ErrConnectionRateExceeded
+		}
+	}
+
+	if cl.limits.MaxSessionsPerIP > 0 && cl.sessions[ip] >= cl.limits.MaxSessionsPerIP {
+		return nil, ErrTooManySessions
+	} else if cl.limits.MaxSessionsPerSubnet > 0 && cl.subnets[subnet] >= cl.limits.MaxSessionsPerSubnet {
+		return nil, ErrTooManySessions
+	}
+	cl.sessions[ip]++
+	cl.subnets[subnet]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cl.mu.Lock()
+			defer cl.mu.Unlock()
+
+			if cl.sessions[ip]--; cl.sessions[ip] <= 0 {
+				delete(cl.sessions, ip)
+			}
+			if cl.subnets[subnet]--; cl.subnets[subnet] <= 0 {
+				delete(cl.subnets, subnet)
+			}
+		})
+	}, nil
+}
+
+// HandshakeTimeout returns the maximum duration of the transport handshake.
+// If zero, the handshake does not time out.
+func (cl *ConnLimiter) HandshakeTimeout() time.Duration {
+	return cl.limits.HandshakeTimeout
+}
+
+// ReportFailure records a failed handshake or unpaid RPC from the remote
+// address. The peer is banned once the ban threshold is reached.
+func (cl *ConnLimiter) ReportFailure(addr string, reason string) {
+	if cl.limits.BanThreshold <= 0 {
+		return
+	}
+	ip, _ := peerKeys(addr)
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	f := cl.failures[ip]
+	if time.Since(f.last) > cl.limits.BanDuration {
+		f.count = 0
+	}
+	f.count++
+	f.last = time.Now()
+	if f.count < cl.limits.BanThreshold {
+		cl.failures[ip] = f
+		return
+	}
+	delete(cl.failures, ip)
+	cl.bans[ip] = Ban{
+		Address:    ip,
+		Reason:     reason,
+		Expiration: time.Now().Add(cl.limits.BanDuration),
+	}
+}
+
+// ReportSuccess forgets the recorded failures of the remote address. It is
+// called after a paid RPC so that peers are only banned for consecutive
+// failures.
+func (cl *ConnLimiter) ReportSuccess(addr string) {
+	ip, _ := peerKeys(addr)
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	delete(cl.failures, ip)
+}
+
+// Bans returns the active bans ordered by expiration.
+func (cl *ConnLimiter) Bans() []Ban {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	bans := make([]Ban, 0, len(cl.bans))
+	for _, ban := range cl.bans {
+		if time.Now().Before(ban.Expiration) {
+			bans = append(bans, ban)
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Expiration.Before(bans[j].Expiration)
+	})
+	return bans
+}
+
+// Unban removes the ban and recorded failures of a peer.
+func (cl *ConnLimiter) Unban(addr string) error {
+	ip, _ := peerKeys(addr)
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	delete(cl.failures, ip)
+	ban, ok := cl.bans[ip]
+	if !ok || time.Now().After(ban.Expiration) {
+		return ErrPeerNotBanned
+	}
+	delete(cl.bans, ip)
+	return nil
+}
+
+// ClearBans removes all bans and recorded failures.
+func (cl *ConnLimiter) ClearBans() {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	cl.bans = make(map[string]Ban)
+	cl.failures = make(map[string]peerFailures)
+}
+
+// NewConnLimiter returns a new ConnLimiter enforcing the given limits.
+func NewConnLimiter(limits ConnLimits) *ConnLimiter {
+	if limits.BanThreshold > 0 && limits.BanDuration <= 0 {
+		limits.BanDuration = time.Hour
+	}
+	return &ConnLimiter{
+		limits:   limits,
+		sessions: make(map[string]int),
+		subnets:  make(map[string]int),
+		rates:    make(map[string]*rate.Limiter),
+		failures: make(map[string]peerFailures),
+		bans:     make(map[string]Ban),
+	}
+}
@@ -0,0 +1,131 @@
+package rhp
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConnLimiterSessions(t *testing.T) {
+	cl := NewConnLimiter(ConnLimits{
+		MaxSessionsPerIP:     2,
+		MaxSessionsPerSubnet: 3,
+	})
+
+	accept := func(addr string, expected error) func() {
+		t.Helper()
+		release, err := cl.AcceptConn(addr)
+		if !errors.Is(err, expected) {
+			t.Fatalf("expected %v accepting %v, got %v", expected, addr, err)
+		}
+		return release
+	}
+
+	r1 := accept("192.0.2.1:1000", nil)
+	accept("192.0.2.1:1001", nil)
+	accept("192.0.2.1:1002", ErrTooManySessions)
+	// a different IP in the same subnet
+	accept("192.0.2.2:1000", nil)
+	accept("192.0.2.3:1000", ErrTooManySessions)
+	// a different subnet
+	accept("198.51.100.1:1000", nil)
+
+	// releasing a session frees a slot for the IP and subnet
+	r1()
+	r1() // releasing twice should not free another slot
+	accept("192.0.2.3:1000", nil)
+	accept("192.0.2.4:1000", ErrTooManySessions)
+
+	// IPv6 subnets are /64
+	cl = NewConnLimiter(ConnLimits{MaxSessionsPerSubnet: 1})
+	accept("[2001:db8::1]:1000", nil)
+	accept("[2001:db8::2]:1000", ErrTooManySessions)
+	accept("[2001:db8:0:1::1]:1000", nil)
+}
+
+func TestConnLimiterRate(t *testing.T) {
+	cl := NewConnLimiter(ConnLimits{ConnectionsPerSecond: 2})
+
+	for i := 0; i < 2; i++ {
+		release, err := cl.AcceptConn("192.0.2.1:1000")
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	if _, err := cl.AcceptConn("192.0.2.1:1000"); !errors.Is(err, ErrConnectionRateExceeded) {
+		t.Fatalf("expected ErrConnectionRateExceeded, got %v", err)
+	} else if _, err := cl.AcceptConn("192.0.2.2:1000"); err != nil {
+		t.Fatal("other peers should not be limited:", err)
+	}
+
+	time.Sleep(time.Second)
+	if _, err := cl.AcceptConn("192.0.2.1:1000"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnLimiterBans(t *testing.T) {
+	cl := NewConnLimiter(ConnLimits{
+		BanThreshold: 3,
+		BanDuration:  time.Hour,
+	})
+
+	const addr = "192.0.2.1:1000"
+	for i := 0; i < 2; i++ {
+		cl.ReportFailure(addr, "handshake failed")
+	}
+	if _, err := cl.AcceptConn(addr); err != nil {
+		t.Fatal("peer should not be banned before the threshold:", err)
+	} else if len(cl.Bans()) != 0 {
+		t.Fatal("expected no bans")
+	}
+
+	// a paid RPC resets the failure count
+	cl.ReportSuccess(addr)
+	for i := 0; i < 2; i++ {
+		cl.ReportFailure(addr, "closed RPC without payment")
+	}
+	if len(cl.Bans()) != 0 {
+		t.Fatal("expected failures to be reset by a paid RPC")
+	}
+
+	// failures are tracked by IP, not port
+	cl.ReportFailure("192.0.2.1:2000", "closed RPC without payment")
+	if _, err := cl.AcceptConn(addr); !errors.Is(err, ErrPeerBanned) {
+		t.Fatalf("expected ErrPeerBanned, got %v", err)
+	}
+
+	bans := cl.Bans()
+	if len(bans) != 1 {
+		t.Fatalf("expected 1 ban, got %v", len(bans))
+	} else if bans[0].Address != "192.0.2.1" {
+		t.Fatalf("expected ban for 192.0.2.1, got %v", bans[0].Address)
+	} else if bans[0].Reason != "closed RPC without payment" {
+		t.Fatalf("unexpected ban reason %q", bans[0].Reason)
+	}
+
+	if err := cl.Unban("192.0.2.1"); err != nil {
+		t.Fatal(err)
+	} else if err := cl.Unban("192.0.2.1"); !errors.Is(err, ErrPeerNotBanned) {
+		t.Fatalf("expected ErrPeerNotBanned, got %v", err)
+	} else if _, err := cl.AcceptConn(addr); err != nil {
+		t.Fatal(err)
+	}
+
+	// ban two peers and clear all bans
+	for _, peer := range []string{"192.0.2.1:1000", "[2001:db8::1]:1000"} {
+		for i := 0; i < 3; i++ {
+			cl.ReportFailure(peer, "handshake failed")
+		}
+	}
+	if len(cl.Bans()) != 2 {
+		t.Fatalf("expected 2 bans, got %v", len(cl.Bans()))
+	}
+	cl.ClearBans()
+	if len(cl.Bans()) != 0 {
+		t.Fatal("expected bans to be cleared")
+	} else if _, err := cl.AcceptConn("[2001:db8::1]:1000"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,174 @@
+package rhp
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// drainPollInterval is the interval between checks for in-flight RPCs while
+// draining.
+const drainPollInterval = time.Second
+
+// ErrMaintenance is returned when a new session or contract is rejected
+// because the host is in maintenance mode.
+var ErrMaintenance = errors.New("host is in maintenance mode")
+
+type (
+	// MaintenanceStatus is the current state of maintenance mode.
+	MaintenanceStatus struct {
+		Enabled bool `json:"enabled"`
+		// Drained is true once all in-flight RPCs have completed, or the
+		// deadline has passed, and the remaining sessions have been closed.
+		Drained  bool      `json:"drained"`
+		Started  time.Time `json:"started"`
+		Deadline time.Time `json:"deadline"`
+
+		ActiveSessions int `json:"activeSessions"`
+		ActiveRPCs     int `json:"activeRPCs"`
+	}
+
+	// A MaintenanceManager puts the RHP servers into maintenance mode. While
+	// enabled, new sessions and contract formations are rejected and
+	// existing sessions are drained.
+	MaintenanceManager struct {
+		sessions *SessionReporter
+		log      *zap.Logger
+
+		mu       sync.Mutex // protects the fields below
+		enabled  bool
+		started  time.Time
+		deadline time.Time
+		stop     chan struct{}
+		drained  chan struct{}
+	}
+)
+
+// drain waits for in-flight RPCs to complete or the deadline to pass, then
+// closes the remaining sessions.
+func (mm *MaintenanceManager) drain(deadline time.Time, stop, drained chan struct{}) {
+	t := time.NewTicker(drainPollInterval)
+	defer t.Stop()
+
+	for {
+		_, rpcs := mm.sessions.activeRPCs()
+		if rpcs == 0 {
+			break
+		} else if time.Now().After(deadline) {
+			mm.log.Warn("drain deadline passed, closing sessions with in-flight RPCs", zap.Int("rpcs", rpcs))
+			break
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+		}
+	}
+
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	// check that maintenance was not disabled while acquiring the lock
+	select {
+	case <-stop:
+		return
+	default:
+	}
+	closed := mm.sessions.closeAll()
+	close(drained)
+	mm.log.Info("RHP sessions drained", zap.Int("closed", closed))
+}
+
+// Enabled returns true if the host is in maintenance mode.
+func (mm *MaintenanceManager) Enabled() bool {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	return mm.enabled
+}
+
+// Enable puts the host into maintenance mode. New sessions and contract
+// formations are rejected immediately. In-flight RPCs are given until the
+// timeout to complete before all remaining sessions are closed. If the host
+// is already in maintenance mode, the deadline is updated.
+func (mm *MaintenanceManager) Enable(timeout time.Duration) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	if mm.enabled {
+		select {
+		case <-mm.drained:
+			// already drained, nothing to update
+			return
+		default:
+		}
+		close(mm.stop)
+	} else {
+		mm.enabled = true
+		mm.started = time.Now()
+		mm.drained = make(chan struct{})
+	}
+	mm.deadline = time.Now().Add(timeout)
+	mm.stop = make(chan struct{})
+	go mm.drain(mm.deadline, mm.stop, mm.drained)
+	mm.log.Info("maintenance mode enabled", zap.Time("deadline", mm.deadline))
+}
+
+// Disable takes the host out of maintenance mode and resumes accepting new
+// sessions.
+func (mm *MaintenanceManager) Disable() {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	if !mm.enabled {
+		return
+	}
+	close(mm.stop)
+	mm.enabled = false
+	mm.started, mm.deadline = time.Time{}, time.Time{}
+	mm.log.Info("maintenance mode disabled")
+}
+
+// Drained returns a channel that is closed when the host has finished
+// draining. If the host is not in maintenance mode, the channel is never
+// closed.
+func (mm *MaintenanceManager) Drained() <-chan struct{} {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	if !mm.enabled {
+		return make(chan struct{})
+	}
+	return mm.drained
+}
+
+// Status returns the current state of maintenance mode.
+func (mm *MaintenanceManager) Status() MaintenanceStatus {
+	mm.mu.Lock()
+	status := MaintenanceStatus{
+		Enabled:  mm.enabled,
+		Started:  mm.started,
+		Deadline: mm.deadline,
+	}
+	if mm.enabled {
+		select {
+		case <-mm.drained:
+			status.Drained = true
+		default:
+		}
+	}
+	mm.mu.Unlock()
+
+	status.ActiveSessions, status.ActiveRPCs = mm.sessions.activeRPCs()
+	return status
+}
+
+// NewMaintenanceManager returns a new MaintenanceManager that drains the
+// sessions tracked by the SessionReporter.
+func NewMaintenanceManager(sessions *SessionReporter, log *zap.Logger) *MaintenanceManager {
+	return &MaintenanceManager{
+		sessions: sessions,
+		log:      log,
+	}
+}
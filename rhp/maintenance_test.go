@@ -0,0 +1,80 @@
+package rhp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/hostd/host/contracts"
+	"go.uber.org/zap/zaptest"
+	"golang.org/x/time/rate"
+)
+
+type stubDataMonitor struct{}
+
+func (stubDataMonitor) ReadBytes(int)  {}
+func (stubDataMonitor) WriteBytes(int) {}
+
+func TestMaintenanceDrain(t *testing.T) {
+	sessions := NewSessionReporter()
+	mm := NewMaintenanceManager(sessions, zaptest.NewLogger(t))
+
+	startSession := func() net.Conn {
+		host, renter := net.Pipe()
+		t.Cleanup(func() { renter.Close() })
+		conn := NewConn(host, stubDataMonitor{}, rate.NewLimiter(rate.Inf, 0), rate.NewLimiter(rate.Inf, 0))
+		sessions.StartSession(conn, SessionProtocolTCP, 3)
+		return renter
+	}
+
+	renter := startSession()
+	sessionID := sessions.Active()[0].ID
+	_, endRPC := sessions.StartRPC(sessionID, types.NewSpecifier("Test"))
+
+	mm.Enable(time.Minute)
+	if !mm.Enabled() {
+		t.Fatal("expected maintenance mode to be enabled")
+	} else if status := mm.Status(); status.Drained {
+		t.Fatal("expected host to be draining")
+	} else if status.ActiveSessions != 1 || status.ActiveRPCs != 1 {
+		t.Fatalf("expected 1 session and 1 RPC, got %v and %v", status.ActiveSessions, status.ActiveRPCs)
+	} else if active := sessions.Active(); active[0].ActiveRPCs != 1 {
+		t.Fatalf("expected session to have 1 active RPC, got %v", active[0].ActiveRPCs)
+	}
+
+	// completing the RPC should close the session
+	endRPC(contracts.Usage{}, nil)
+	select {
+	case <-mm.Drained():
+	case <-time.After(5 * time.Second):
+		t.Fatal("host did not drain")
+	}
+	if !mm.Status().Drained {
+		t.Fatal("expected host to be drained")
+	} else if _, err := renter.Read(make([]byte, 1)); err == nil {
+		t.Fatal("expected session to be closed")
+	}
+
+	mm.Disable()
+	if mm.Enabled() {
+		t.Fatal("expected maintenance mode to be disabled")
+	}
+
+	// sessions with in-flight RPCs should be closed after the deadline
+	renter = startSession()
+	for _, sess := range sessions.Active() {
+		if sess.ActiveRPCs == 0 {
+			sessions.StartRPC(sess.ID, types.NewSpecifier("Test"))
+		}
+	}
+	mm.Enable(100 * time.Millisecond)
+	select {
+	case <-mm.Drained():
+	case <-time.After(5 * time.Second):
+		t.Fatal("host did not drain after the deadline")
+	}
+	if _, err := renter.Read(make([]byte, 1)); err == nil {
+		t.Fatal("expected session to be closed")
+	}
+}
@@ -0,0 +1,276 @@
+package rhp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// proxyHeaderTimeout is the maximum duration to wait for a trusted proxy
+	// to send the PROXY protocol header.
+	proxyHeaderTimeout = 10 * time.Second
+
+	// proxyV1MaxLength is the maximum length of a v1 header, including the
+	// trailing CRLF.
+	proxyV1MaxLength = 107
+)
+
+// proxyV2Signature is the signature that starts every v2 header.
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ErrNoClientAddress is returned when a trusted proxy sends a PROXY header
+// without a client address, such as a health check.
+var ErrNoClientAddress = errors.New("PROXY header does not contain a client address")
+
+type (
+	// A proxyListener wraps a net.Listener to parse PROXY protocol headers
+	// sent by trusted proxies.
+	proxyListener struct {
+		net.Listener
+		trusted []*net.IPNet
+	}
+
+	// A proxyConn is a connection that may start with a PROXY protocol
+	// header. The header is parsed on the first call to Read or RemoteAddr
+	// so that a slow proxy does not block Accept.
+	proxyConn struct {
+		net.Conn
+		trusted bool
+
+		once       sync.Once
+		r          *bufio.Reader
+		remoteAddr net.Addr
+		err        error
+	}
+)
+
+// Accept implements net.Listener
+func (pl *proxyListener) Accept() (net.Conn, error) {
+	conn, err := pl.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	var trusted bool
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		for _, n := range pl.trusted {
+			if n.Contains(addr.IP) {
+				trusted = true
+				break
+			}
+		}
+	}
+	return &proxyConn{
+		Conn:       conn,
+		trusted:    trusted,
+		r:          bufio.NewReader(conn),
+		remoteAddr: conn.RemoteAddr(),
+	}, nil
+}
+
+// init parses the PROXY protocol header, if the connection is from a trusted
+// proxy and starts with one.
+func (pc *proxyConn) init() {
+	pc.once.Do(func() {
+		if !pc.trusted {
+			return
+		}
+
+		pc.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+		defer pc.Conn.SetReadDeadline(time.Time{})
+
+		hasHeader, addr, err := readProxyHeader(pc.r)
+		if err != nil {
+			pc.err = fmt.Errorf("failed to read PROXY header: %w", err)
+		} else if hasHeader && addr == nil {
+			pc.err = ErrNoClientAddress
+		} else if addr != nil {
+			pc.remoteAddr = addr
+		}
+	})
+}
+
+// Read implements net.Conn
+func (pc *proxyConn) Read(b []byte) (int, error) {
+	pc.init()
+	if pc.err != nil {
+		return 0, pc.err
+	}
+	return pc.r.Read(b)
+}
+
+// RemoteAddr returns the address of the client. If the connection is from a
+// trusted proxy, the client address from the PROXY header is returned.
+func (pc *proxyConn) RemoteAddr() net.Addr {
+	pc.init()
+	return pc.remoteAddr
+}
+
+// ProxyHeaderError returns the error encountered while reading the PROXY
+// header of a connection accepted by a proxy listener. If the error is
+// non-nil, the connection's remote address is the proxy's and the connection
+// should be closed without applying connection limits or bans. For other
+// connections, nil is returned.
+func ProxyHeaderError(conn net.Conn) error {
+	pc, ok := conn.(*proxyConn)
+	if !ok {
+		return nil
+	}
+	pc.init()
+	return pc.err
+}
+
+// readProxyHeader reads a v1 or v2 PROXY protocol header from r and returns
+// the source address. If r does not start with a header, nothing is consumed
+// and hasHeader is false. A nil address is returned for headers that do not
+// contain a TCP source address, such as health checks.
+func readProxyHeader(r *bufio.Reader) (hasHeader bool, addr net.Addr, err error) {
+	// the v1 and v2 signatures differ in the first byte
+	first, err := r.Peek(1)
+	if err != nil {
+		return false, nil, err
+	}
+	switch first[0] {
+	case 'P':
+		if prefix, err := r.Peek(6); err != nil {
+			return false, nil, err
+		} else if string(prefix) != "PROXY " {
+			return false, nil, nil
+		}
+		addr, err = readProxyV1(r)
+		return true, addr, err
+	case proxyV2Signature[0]:
+		if sig, err := r.Peek(len(proxyV2Signature)); err != nil {
+			return false, nil, err
+		} else if !bytes.Equal(sig, proxyV2Signature) {
+			return false, nil, nil
+		}
+		addr, err = readProxyV2(r)
+		return true, addr, err
+	default:
+		return false, nil, nil
+	}
+}
+
+// readProxyV1 reads a human-readable v1 header, e.g.
+// "PROXY TCP4 192.0.2.1 198.51.100.1 56324 9982\r\n".
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= proxyV1MaxLength {
+			return nil, errors.New("v1 header too long")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	} else if len(fields) != 6 {
+		return nil, fmt.Errorf("invalid v1 header %q", line)
+	} else if fields[1] != "TCP4" && fields[1] != "TCP6" {
+		return nil, fmt.Errorf("unsupported v1 protocol %q", fields[1])
+	}
+
+	ip := net.ParseIP(fields[2])
+	if ip == nil {
+		return nil, fmt.Errorf("invalid v1 source address %q", fields[2])
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid v1 source port %q", fields[4])
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyV2 reads a binary v2 header.
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	verCmd, family := header[12], header[13]
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	if verCmd>>4 != 2 {
+		return nil, fmt.Errorf("unsupported v2 version %d", verCmd>>4)
+	}
+	switch verCmd & 0xf {
+	case 0x0:
+		// LOCAL command, sent by the proxy itself
+		return nil, nil
+	case 0x1:
+		// PROXY command
+	default:
+		return nil, fmt.Errorf("unsupported v2 command %d", verCmd&0xf)
+	}
+
+	switch family {
+	case 0x11: // TCP over IPv4
+		if len(payload) < 12 {
+			return nil, errors.New("v2 IPv4 address block too short")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[:4]), Port: int(binary.BigEndian.Uint16(payload[8:]))}, nil
+	case 0x21: // TCP over IPv6
+		if len(payload) < 36 {
+			return nil, errors.New("v2 IPv6 address block too short")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[:16]), Port: int(binary.BigEndian.Uint16(payload[32:]))}, nil
+	default:
+		// unspecified or non-TCP source
+		return nil, nil
+	}
+}
+
+// ParseTrustedProxies parses a list of CIDRs or IP addresses of trusted
+// proxies.
+func ParseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, s := range proxies {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid proxy address %q", s)
+			} else if v4 := ip.To4(); v4 != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy CIDR %q: %w", s, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// NewProxyListener wraps l to parse PROXY protocol v1 and v2 headers from
+// connections originating from a trusted proxy. The RemoteAddr of those
+// connections returns the client address from the header. If a header does
+// not contain a client address, reads from the connection fail and
+// ProxyHeaderError returns the error. Connections from other addresses are
+// not modified.
+func NewProxyListener(l net.Listener, trusted []*net.IPNet) net.Listener {
+	return &proxyListener{
+		Listener: l,
+		trusted:  trusted,
+	}
+}
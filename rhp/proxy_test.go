@@ -0,0 +1,141 @@
+package rhp
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestProxyListener(t *testing.T) {
+	v2Header := func(ip net.IP, port uint16) []byte {
+		buf := append([]byte(nil), proxyV2Signature...)
+		if v4 := ip.To4(); v4 != nil {
+			buf = append(buf, 0x21, 0x11, 0, 12)
+			buf = append(buf, v4...)
+			buf = append(buf, 127, 0, 0, 1)
+		} else {
+			buf = append(buf, 0x21, 0x21, 0, 36)
+			buf = append(buf, ip.To16()...)
+			buf = append(buf, net.IPv6loopback...)
+		}
+		buf = binary.BigEndian.AppendUint16(buf, port)
+		return binary.BigEndian.AppendUint16(buf, 9982)
+	}
+
+	tests := []struct {
+		name    string
+		trusted string
+		header  []byte
+		addr    string // expected remote address, empty for the dialer's
+		// headerErr is true if the header does not contain a client address
+		headerErr bool
+	}{
+		{"v1 IPv4", "127.0.0.0/8", []byte("PROXY TCP4 192.0.2.1 127.0.0.1 56324 9982\r\n"), "192.0.2.1:56324", false},
+		{"v1 IPv6", "127.0.0.1", []byte("PROXY TCP6 2001:db8::1 ::1 56324 9982\r\n"), "[2001:db8::1]:56324", false},
+		{"v1 unknown", "127.0.0.1", []byte("PROXY UNKNOWN\r\n"), "", true},
+		{"v1 invalid", "127.0.0.1", []byte("PROXY TCP4 192.0.2.1\r\n"), "", true},
+		{"v2 IPv4", "127.0.0.0/8", v2Header(net.ParseIP("192.0.2.1"), 1234), "192.0.2.1:1234", false},
+		{"v2 IPv6", "127.0.0.0/8", v2Header(net.ParseIP("2001:db8::1"), 1234), "[2001:db8::1]:1234", false},
+		{"v2 local", "127.0.0.0/8", append(append([]byte(nil), proxyV2Signature...), 0x20, 0x00, 0, 0), "", true},
+		{"no header", "127.0.0.0/8", nil, "", false},
+	}
+
+	const payload = "hello, world"
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			trusted, err := ParseTrustedProxies([]string{test.trusted})
+			if err != nil {
+				t.Fatal(err)
+			}
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			pl := NewProxyListener(l, trusted)
+			defer pl.Close()
+
+			client, err := net.Dial("tcp", pl.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+			if _, err := client.Write(append(test.header, payload...)); err != nil {
+				t.Fatal(err)
+			}
+
+			conn, err := pl.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			expected := test.addr
+			if expected == "" {
+				expected = client.LocalAddr().String()
+			}
+			if conn.RemoteAddr().String() != expected {
+				t.Fatalf("expected remote address %v, got %v", expected, conn.RemoteAddr())
+			}
+
+			// connections without a client address should be rejected
+			// before the proxy's address is used for limits or bans
+			if err := ProxyHeaderError(conn); test.headerErr {
+				if err == nil {
+					t.Fatal("expected header error")
+				} else if _, err := conn.Read(make([]byte, 1)); err == nil {
+					t.Fatal("expected read to fail")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			buf := make([]byte, len(payload))
+			if _, err := io.ReadFull(conn, buf); err != nil {
+				t.Fatal(err)
+			} else if string(buf) != payload {
+				t.Fatalf("expected payload %q, got %q", payload, buf)
+			}
+		})
+	}
+
+	// headers from untrusted addresses should not be parsed
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pl := NewProxyListener(l, trusted)
+	defer pl.Close()
+
+	client, err := net.Dial("tcp", pl.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	header := "PROXY TCP4 192.0.2.1 127.0.0.1 56324 9982\r\n"
+	if _, err := client.Write([]byte(header)); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := ProxyHeaderError(conn); err != nil {
+		t.Fatal(err)
+	} else if conn.RemoteAddr().String() != client.LocalAddr().String() {
+		t.Fatalf("expected remote address %v, got %v", client.LocalAddr(), conn.RemoteAddr())
+	}
+	buf := make([]byte, len(header))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	} else if string(buf) != header {
+		t.Fatalf("expected header to be passed through, got %q", buf)
+	}
+}
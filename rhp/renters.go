@@ -0,0 +1,384 @@
+package rhp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/hostd/host/policy"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// renterBurstSize allows large reads and writes on the per-renter
+	// limiters
+	renterBurstSize = 256 * (1 << 20) // 256 MiB
+
+	// maxCachedAccounts is the maximum number of account funders kept in
+	// memory
+	maxCachedAccounts = 1 << 16
+)
+
+// ErrEgressCapExceeded is returned when a renter has reached its daily egress
+// cap.
+var ErrEgressCapExceeded = errors.New("renter has reached its daily egress cap")
+
+type (
+	// A RenterRecorderStore persists the bandwidth usage of renters.
+	RenterRecorderStore interface {
+		ContractPolicy() (policy.Policy, error)
+		// AccountRenterKey returns the public key of the renter that funded
+		// the account.
+		AccountRenterKey(account types.PublicKey) (types.PublicKey, error)
+
+		RenterBandwidth(renterKey types.PublicKey, start, end time.Time) ([]policy.RenterBandwidth, error)
+		IncrementRenterBandwidth([]policy.RenterBandwidth) error
+	}
+
+	// renterBandwidth tracks the bandwidth usage and limits of a single
+	// renter across all of its connections.
+	renterBandwidth struct {
+		key    types.PublicKey
+		rl, wl *rate.Limiter
+		// conns is the number of connections attributed to the renter.
+		// It is only incremented while the recorder's lock is held.
+		conns atomic.Int32
+
+		mu          sync.Mutex // guards the fields below
+		maxEgress   uint64
+		period      time.Time // start of the current UTC day
+		egress      uint64    // egress in the current period
+		unpersisted []policy.RenterBandwidth
+	}
+
+	// A RenterRecorder attributes connection bandwidth to renters and
+	// enforces per-renter bandwidth limits.
+	RenterRecorder struct {
+		store RenterRecorderStore
+		log   *zap.Logger
+		t     *time.Timer
+
+		mu      sync.Mutex // guards the fields below
+		policy  policy.Policy
+		renters map[types.PublicKey]*renterBandwidth
+		// accounts caches the renter that funded each account. It is
+		// bounded by maxCachedAccounts.
+		accounts map[types.PublicKey]types.PublicKey
+	}
+)
+
+// currentPeriod returns the start of the current UTC day.
+func currentPeriod() time.Time {
+	return time.Now().UTC().Truncate(24 * time.Hour)
+}
+
+// rateLimit converts a bandwidth limit to a rate.Limit. 0 is unlimited.
+func rateLimit(limit uint64) rate.Limit {
+	if limit == 0 {
+		return rate.Inf
+	}
+	return rate.Limit(limit)
+}
+
+// record adds usage to the renter's current period.
+func (rb *renterBandwidth) record(ingress, egress uint64) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	period := currentPeriod()
+	if !period.Equal(rb.period) {
+		rb.period = period
+		rb.egress = 0
+	}
+	rb.egress += egress
+
+	n := len(rb.unpersisted)
+	if n == 0 || !rb.unpersisted[n-1].Period.Equal(period) {
+		rb.unpersisted = append(rb.unpersisted, policy.RenterBandwidth{
+			RenterKey: rb.key,
+			Period:    period,
+		})
+		n++
+	}
+	rb.unpersisted[n-1].Ingress += ingress
+	rb.unpersisted[n-1].Egress += egress
+}
+
+// requeue adds usage that failed to persist back to the renter's
+// unpersisted usage.
+func (rb *renterBandwidth) requeue(usage []policy.RenterBandwidth) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	// the failed usage is older than any usage recorded since
+	rb.unpersisted = append(usage, rb.unpersisted...)
+}
+
+// checkEgress returns ErrEgressCapExceeded if the renter has reached its
+// daily egress cap.
+func (rb *renterBandwidth) checkEgress() error {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	if rb.maxEgress == 0 || !rb.period.Equal(currentPeriod()) {
+		return nil
+	} else if rb.egress >= rb.maxEgress {
+		return ErrEgressCapExceeded
+	}
+	return nil
+}
+
+// waitN waits for n tokens from the limiter. WaitN fails if n exceeds the
+// limiter's burst, so the tokens are requested in chunks.
+func waitN(l *rate.Limiter, n int) error {
+	for n > 0 {
+		chunk := n
+		if chunk > renterBurstSize {
+			chunk = renterBurstSize
+		}
+		if err := l.WaitN(context.Background(), chunk); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+// read records n bytes received from the renter and waits for the renter's
+// ingress limiter.
+func (rb *renterBandwidth) read(n int) error {
+	rb.record(uint64(n), 0)
+	return waitN(rb.rl, n)
+}
+
+// write records n bytes sent to the renter and waits for the renter's egress
+// limiter.
+func (rb *renterBandwidth) write(n int) error {
+	rb.record(0, uint64(n))
+	return waitN(rb.wl, n)
+}
+
+// detach removes a connection from the renter.
+func (rb *renterBandwidth) detach() {
+	rb.conns.Add(-1)
+}
+
+// idle returns true if the renter has no connections, no unpersisted usage,
+// and no usage in the current period.
+func (rb *renterBandwidth) idle(period time.Time) bool {
+	if rb.conns.Load() > 0 {
+		return false
+	}
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	return rb.period.Before(period) && len(rb.unpersisted) == 0
+}
+
+// applyPolicy updates the renter's limits.
+func (rb *renterBandwidth) applyPolicy(p policy.Policy) {
+	rb.rl.SetLimit(rateLimit(p.RenterIngressLimit))
+	rb.wl.SetLimit(rateLimit(p.RenterEgressLimit))
+	rb.mu.Lock()
+	rb.maxEgress = p.MaxRenterDailyEgress
+	rb.mu.Unlock()
+}
+
+// attach returns the bandwidth tracker of a renter with a connection added,
+// loading the renter's usage in the current period if it is not already
+// tracked. The connection is added while the recorder's lock is held so the
+// renter cannot be evicted before the connection is attributed.
+func (rr *RenterRecorder) attach(renterKey types.PublicKey) (*renterBandwidth, error) {
+	rr.mu.Lock()
+	rb, ok := rr.renters[renterKey]
+	if ok {
+		rb.conns.Add(1)
+	}
+	rr.mu.Unlock()
+	if ok {
+		return rb, nil
+	}
+
+	period := currentPeriod()
+	usage, err := rr.store.RenterBandwidth(renterKey, period, period.Add(24*time.Hour))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get renter bandwidth: %w", err)
+	}
+	rb = &renterBandwidth{
+		key:    renterKey,
+		rl:     rate.NewLimiter(rate.Inf, renterBurstSize),
+		wl:     rate.NewLimiter(rate.Inf, renterBurstSize),
+		period: period,
+	}
+	for _, u := range usage {
+		rb.egress += u.Egress
+	}
+
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	// another connection may have added the renter while the usage was
+	// loaded
+	if existing, ok := rr.renters[renterKey]; ok {
+		existing.conns.Add(1)
+		return existing, nil
+	}
+	rb.applyPolicy(rr.policy)
+	rb.conns.Add(1)
+	rr.renters[renterKey] = rb
+	return rb, nil
+}
+
+// Attribute attributes the connection's bandwidth to the renter from now on
+// and applies the renter's bandwidth limits to the connection.
+func (rr *RenterRecorder) Attribute(c *Conn, renterKey types.PublicKey) error {
+	rb, err := rr.attach(renterKey)
+	if err != nil {
+		return err
+	}
+	if old := c.renter.Swap(rb); old != nil {
+		old.detach()
+	}
+	return nil
+}
+
+// AttributeAccount attributes the connection's bandwidth to the renter that
+// funded the ephemeral account. If the renter cannot be determined, the
+// bandwidth is not attributed.
+func (rr *RenterRecorder) AttributeAccount(c *Conn, account types.PublicKey) error {
+	rr.mu.Lock()
+	renterKey, ok := rr.accounts[account]
+	rr.mu.Unlock()
+	if !ok {
+		var err error
+		renterKey, err = rr.store.AccountRenterKey(account)
+		if errors.Is(err, policy.ErrNotFound) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to get account renter: %w", err)
+		}
+		rr.mu.Lock()
+		rr.cacheAccount(account, renterKey)
+		rr.mu.Unlock()
+	}
+	return rr.Attribute(c, renterKey)
+}
+
+// cacheAccount caches the renter that funded an account. If the cache is
+// full, an arbitrary account is evicted. The recorder's lock must be held.
+func (rr *RenterRecorder) cacheAccount(account, renterKey types.PublicKey) {
+	if _, ok := rr.accounts[account]; ok {
+		return
+	}
+	if len(rr.accounts) >= maxCachedAccounts {
+		for k := range rr.accounts {
+			delete(rr.accounts, k)
+			break
+		}
+	}
+	rr.accounts[account] = renterKey
+}
+
+// AddAccountFunding records that the ephemeral account was funded by the
+// renter. Only the first renter to fund an account is recorded so that a
+// renter cannot redirect another renter's usage by funding its account.
+func (rr *RenterRecorder) AddAccountFunding(account, renterKey types.PublicKey) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.cacheAccount(account, renterKey)
+}
+
+// persistUsage persists the usage recorded since the last call.
+func (rr *RenterRecorder) persistUsage() {
+	rr.mu.Lock()
+	renters := make([]*renterBandwidth, 0, len(rr.renters))
+	for _, rb := range rr.renters {
+		renters = append(renters, rb)
+	}
+	rr.mu.Unlock()
+
+	var usage []policy.RenterBandwidth
+	pending := make(map[*renterBandwidth][]policy.RenterBandwidth)
+	for _, rb := range renters {
+		rb.mu.Lock()
+		if len(rb.unpersisted) > 0 {
+			pending[rb] = rb.unpersisted
+			usage = append(usage, rb.unpersisted...)
+			rb.unpersisted = nil
+		}
+		rb.mu.Unlock()
+	}
+	// no need to persist if there is no change
+	if len(usage) == 0 {
+		return
+	}
+
+	if err := rr.store.IncrementRenterBandwidth(usage); err != nil {
+		rr.log.Error("failed to persist renter bandwidth", zap.Error(err))
+		// add the usage back so it is persisted on the next attempt
+		for rb, u := range pending {
+			rb.requeue(u)
+		}
+	}
+}
+
+// evictIdle removes renters that have no connections and no usage in the
+// current period. Their usage is loaded again when they reconnect.
+func (rr *RenterRecorder) evictIdle() {
+	period := currentPeriod()
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	for key, rb := range rr.renters {
+		if rb.idle(period) {
+			delete(rr.renters, key)
+		}
+	}
+}
+
+// refresh applies the current policy to all renters.
+func (rr *RenterRecorder) refresh() {
+	p, err := rr.store.ContractPolicy()
+	if err != nil {
+		rr.log.Error("failed to get contract policy", zap.Error(err))
+		return
+	}
+
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.policy = p
+	for _, rb := range rr.renters {
+		rb.applyPolicy(p)
+	}
+}
+
+// Close persists any remaining usage and returns nil
+func (rr *RenterRecorder) Close() error {
+	rr.t.Stop()
+	rr.persistUsage()
+	return nil
+}
+
+// NewRenterRecorder initializes a new RenterRecorder
+func NewRenterRecorder(store RenterRecorderStore, log *zap.Logger) (*RenterRecorder, error) {
+	p, err := store.ContractPolicy()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contract policy: %w", err)
+	}
+
+	recorder := &RenterRecorder{
+		store:    store,
+		log:      log,
+		policy:   p,
+		renters:  make(map[types.PublicKey]*renterBandwidth),
+		accounts: make(map[types.PublicKey]types.PublicKey),
+	}
+	recorder.t = time.AfterFunc(persistInterval, func() {
+		recorder.persistUsage()
+		recorder.evictIdle()
+		recorder.refresh()
+		recorder.t.Reset(persistInterval)
+	})
+	return recorder, nil
+}
@@ -0,0 +1,230 @@
+package rhp
+
+import (
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/hostd/host/policy"
+	"go.sia.tech/hostd/persist/sqlite"
+	"go.uber.org/zap/zaptest"
+	"golang.org/x/time/rate"
+	"lukechampine.com/frand"
+)
+
+type failingRenterStore struct {
+	RenterRecorderStore
+	fail bool
+}
+
+func (fs *failingRenterStore) IncrementRenterBandwidth(usage []policy.RenterBandwidth) error {
+	if fs.fail {
+		return errors.New("failed")
+	}
+	return fs.RenterRecorderStore.IncrementRenterBandwidth(usage)
+}
+
+func TestRenterRecorder(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "hostd.db"), log.Named("sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	const maxEgress = 100
+	if err := db.UpdateContractPolicy(policy.Policy{MaxRenterDailyEgress: maxEgress}); err != nil {
+		t.Fatal(err)
+	}
+
+	rr, err := NewRenterRecorder(db, log.Named("renters"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host, renter := net.Pipe()
+	defer renter.Close()
+	go io.Copy(io.Discard, renter)
+	conn := NewConn(host, stubDataMonitor{}, rate.NewLimiter(rate.Inf, 0), rate.NewLimiter(rate.Inf, 0))
+
+	// bandwidth is not attributed until the renter is known
+	if _, err := conn.Write(make([]byte, 2*maxEgress)); err != nil {
+		t.Fatal(err)
+	} else if err := conn.CheckEgressCap(); err != nil {
+		t.Fatal("expected no cap on unattributed conn, got", err)
+	}
+
+	// an unfunded account cannot be attributed
+	if err := rr.AttributeAccount(conn, types.GeneratePrivateKey().PublicKey()); err != nil {
+		t.Fatal(err)
+	} else if conn.renter.Load() != nil {
+		t.Fatal("expected conn to be unattributed")
+	}
+
+	renterKey := types.PublicKey(frand.Entropy256())
+	account := types.GeneratePrivateKey().PublicKey()
+	rr.AddAccountFunding(account, renterKey)
+	// funding another renter's account should not redirect its usage
+	rr.AddAccountFunding(account, types.PublicKey(frand.Entropy256()))
+	if err := rr.AttributeAccount(conn, account); err != nil {
+		t.Fatal(err)
+	} else if rb := conn.renter.Load(); rb == nil || rb.key != renterKey {
+		t.Fatal("expected conn to be attributed to the first funder")
+	}
+
+	if _, err := conn.Write(make([]byte, maxEgress/2)); err != nil {
+		t.Fatal(err)
+	} else if err := conn.CheckEgressCap(); err != nil {
+		t.Fatal("expected renter to be under the cap, got", err)
+	} else if _, err := conn.Write(make([]byte, maxEgress/2)); err != nil {
+		t.Fatal(err)
+	} else if err := conn.CheckEgressCap(); !errors.Is(err, ErrEgressCapExceeded) {
+		t.Fatalf("expected %v, got %v", ErrEgressCapExceeded, err)
+	}
+
+	// the usage should be persisted on close
+	if err := rr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	period := currentPeriod()
+	usage, err := db.RenterBandwidth(renterKey, period, period.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(usage) != 1 {
+		t.Fatalf("expected 1 period, got %v", len(usage))
+	} else if usage[0].Egress != maxEgress || !usage[0].Period.Equal(period) {
+		t.Fatalf("expected %v egress in %v, got %v in %v", maxEgress, period, usage[0].Egress, usage[0].Period)
+	}
+
+	// a new recorder should load the renter's usage and enforce the cap
+	rr, err = NewRenterRecorder(db, log.Named("renters"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Close()
+	if err := rr.Attribute(conn, renterKey); err != nil {
+		t.Fatal(err)
+	} else if err := conn.CheckEgressCap(); !errors.Is(err, ErrEgressCapExceeded) {
+		t.Fatalf("expected %v, got %v", ErrEgressCapExceeded, err)
+	}
+
+	totals, err := db.RenterBandwidthTotals(period, period.Add(24*time.Hour), 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(totals) != 1 || totals[0].RenterKey != renterKey || totals[0].Egress != maxEgress {
+		t.Fatalf("unexpected totals %+v", totals)
+	}
+}
+
+func TestRenterRecorderPersistFailure(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "hostd.db"), log.Named("sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	store := &failingRenterStore{RenterRecorderStore: db, fail: true}
+	rr, err := NewRenterRecorder(store, log.Named("renters"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Close()
+
+	host, renter := net.Pipe()
+	defer renter.Close()
+	go io.Copy(io.Discard, renter)
+	conn := NewConn(host, stubDataMonitor{}, rate.NewLimiter(rate.Inf, 0), rate.NewLimiter(rate.Inf, 0))
+
+	renterKey := types.PublicKey(frand.Entropy256())
+	if err := rr.Attribute(conn, renterKey); err != nil {
+		t.Fatal(err)
+	} else if _, err := conn.Write(make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the usage should be kept when the write fails
+	rr.persistUsage()
+	if _, err := conn.Write(make([]byte, 50)); err != nil {
+		t.Fatal(err)
+	}
+	store.fail = false
+	rr.persistUsage()
+
+	period := currentPeriod()
+	usage, err := db.RenterBandwidth(renterKey, period, period.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(usage) != 1 || usage[0].Egress != 150 {
+		t.Fatalf("expected 150 egress, got %+v", usage)
+	}
+}
+
+func TestRenterRecorderEviction(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "hostd.db"), log.Named("sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rr, err := NewRenterRecorder(db, log.Named("renters"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Close()
+
+	host, renter := net.Pipe()
+	defer renter.Close()
+	conn := NewConn(host, stubDataMonitor{}, rate.NewLimiter(rate.Inf, 0), rate.NewLimiter(rate.Inf, 0))
+
+	renterKey := types.PublicKey(frand.Entropy256())
+	if err := rr.Attribute(conn, renterKey); err != nil {
+		t.Fatal(err)
+	}
+	rb := conn.renter.Load()
+
+	// transfers larger than the burst should not fail
+	rb.rl.SetLimit(rate.Limit(1 << 40))
+	if err := rb.read(renterBurstSize + 1); err != nil {
+		t.Fatal(err)
+	}
+	rr.persistUsage()
+
+	tracked := func() bool {
+		rr.mu.Lock()
+		defer rr.mu.Unlock()
+		_, ok := rr.renters[renterKey]
+		return ok
+	}
+
+	// move the renter to the previous period
+	rb.mu.Lock()
+	rb.period = currentPeriod().Add(-24 * time.Hour)
+	rb.mu.Unlock()
+
+	// a renter with a connection should not be evicted
+	rr.evictIdle()
+	if !tracked() {
+		t.Fatal("expected renter with a connection to be tracked")
+	}
+
+	// reattributing the connection should not leak a connection
+	if err := rr.Attribute(conn, renterKey); err != nil {
+		t.Fatal(err)
+	} else if n := rb.conns.Load(); n != 1 {
+		t.Fatalf("expected 1 connection, got %v", n)
+	}
+
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	rr.evictIdle()
+	if tracked() {
+		t.Fatal("expected idle renter to be evicted")
+	}
+}
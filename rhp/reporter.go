@@ -39,6 +39,7 @@ type (
 		Ingress     uint64          `json:"ingress"`
 		Egress      uint64          `json:"egress"`
 		Usage       contracts.Usage `json:"usage"`
+		ActiveRPCs  int             `json:"activeRPCs"`
 
 		Timestamp time.Time `json:"timestamp"`
 	}
@@ -146,7 +147,7 @@ func (sr *SessionReporter) StartRPC(sessionID UID, rpc types.Specifier) (rpcID U
 	defer sr.mu.Unlock()
 
 	copy(rpcID[:], frand.Bytes(8))
-	_, ok := sr.sessions[sessionID]
+	sess, ok := sr.sessions[sessionID]
 	if !ok {
 		return rpcID, func(contracts.Usage, error) {}
 	}
@@ -157,6 +158,8 @@ func (sr *SessionReporter) StartRPC(sessionID UID, rpc types.Specifier) (rpcID U
 		RPC:       rpc,
 	}
 	rpcStart := time.Now()
+	sess.ActiveRPCs++
+	sr.sessions[sessionID] = sess
 	sr.updateSubscribers(sessionID, SessionEventTypeRPCStart, event)
 	return rpcID, func(usage contracts.Usage, err error) {
 		// update event
@@ -174,6 +177,7 @@ func (sr *SessionReporter) StartRPC(sessionID UID, rpc types.Specifier) (rpcID U
 
 		// update session
 		sess.Usage = sess.Usage.Add(usage)
+		sess.ActiveRPCs--
 		sr.sessions[sessionID] = sess
 		// update subscribers
 		sr.updateSubscribers(sessionID, SessionEventTypeRPCEnd, event)
@@ -196,6 +200,29 @@ func (sr *SessionReporter) Active() []Session {
 	return sessions
 }
 
+// activeRPCs returns the number of active sessions and in-flight RPCs.
+func (sr *SessionReporter) activeRPCs() (sessions, rpcs int) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	for _, sess := range sr.sessions {
+		rpcs += sess.ActiveRPCs
+	}
+	return len(sr.sessions), rpcs
+}
+
+// closeAll closes the connections of all active sessions and returns the
+// number of sessions closed.
+func (sr *SessionReporter) closeAll() int {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	for _, sess := range sr.sessions {
+		sess.conn.Close()
+	}
+	return len(sr.sessions)
+}
+
 // NewSessionReporter returns a new SessionReporter.
 func NewSessionReporter() *SessionReporter {
 	return &SessionReporter{
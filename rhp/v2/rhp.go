@@ -12,6 +12,7 @@ import (
 	rhp2 "go.sia.tech/core/rhp/v2"
 	"go.sia.tech/core/types"
 	"go.sia.tech/hostd/host/contracts"
+	"go.sia.tech/hostd/host/policy"
 	"go.sia.tech/hostd/host/settings"
 	"go.sia.tech/hostd/internal/threadgroup"
 	"go.sia.tech/hostd/rhp"
@@ -70,7 +71,7 @@ type (
 	// A Wallet manages funds and signs transactions
 	Wallet interface {
 		Address() types.Address
-		FundTransaction(txn *types.Transaction, amount types.Currency) ([]types.Hash256, func(), error)
+		FundTransaction(txn *types.Transaction, amount types.Currency, outputs ...types.SiacoinOutputID) ([]types.Hash256, func(), error)
 		SignTransaction(cs consensus.State, txn *types.Transaction, toSign []types.Hash256, cf types.CoveredFields) error
 	}
 
@@ -87,12 +88,44 @@ type (
 		BandwidthLimiters() (ingress, egress *rate.Limiter)
 	}
 
+	// A PolicyManager evaluates contract formations and renewals against the
+	// host's contract policy
+	PolicyManager interface {
+		EvaluateContract(policy.ContractRequest) error
+	}
+
 	// SessionReporter reports session metrics
 	SessionReporter interface {
 		StartSession(conn *rhp.Conn, proto string, version int) (sessionID rhp.UID, end func())
 		StartRPC(sessionID rhp.UID, rpc types.Specifier) (rpcID rhp.UID, end func(contracts.Usage, error))
 	}
 
+	// A ConnLimiter limits the connections accepted from each peer and bans
+	// peers that repeatedly fail the handshake.
+	ConnLimiter interface {
+		// AcceptConn returns an error if a new connection from the remote
+		// address should be rejected. Otherwise, release must be called
+		// when the connection is closed.
+		AcceptConn(addr string) (release func(), err error)
+		// HandshakeTimeout returns the maximum duration of the transport
+		// handshake. If zero, the handshake does not time out.
+		HandshakeTimeout() time.Duration
+		// ReportFailure records a failed handshake from the remote address.
+		ReportFailure(addr string, reason string)
+	}
+
+	// A MaintenanceManager reports whether the host is in maintenance mode.
+	// While enabled, new sessions and contract formations are rejected.
+	MaintenanceManager interface {
+		Enabled() bool
+	}
+
+	// A RenterRecorder attributes a connection's bandwidth to a renter and
+	// applies the renter's bandwidth limits.
+	RenterRecorder interface {
+		Attribute(c *rhp.Conn, renterKey types.PublicKey) error
+	}
+
 	// A SessionHandler handles the host side of the renter-host protocol and
 	// manages renter sessions
 	SessionHandler struct {
@@ -107,11 +140,15 @@ type (
 		tpool  TransactionPool
 		wallet Wallet
 
-		contracts ContractManager
-		sessions  SessionReporter
-		settings  SettingsReporter
-		storage   StorageManager
-		log       *zap.Logger
+		contracts   ContractManager
+		limiter     ConnLimiter
+		maintenance MaintenanceManager
+		policies    PolicyManager
+		renters     RenterRecorder
+		sessions    SessionReporter
+		settings    SettingsReporter
+		storage     StorageManager
+		log         *zap.Logger
 	}
 )
 
@@ -162,10 +199,16 @@ func (sh *SessionHandler) upgrade(conn net.Conn) error {
 	ingressLimiter, egressLimiter := sh.settings.BandwidthLimiters()
 	rhpConn := rhp.NewConn(conn, sh.monitor, ingressLimiter, egressLimiter)
 
+	if timeout := sh.limiter.HandshakeTimeout(); timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
 	t, err := rhp2.NewHostTransport(rhpConn, sh.privateKey)
 	if err != nil {
+		sh.limiter.ReportFailure(conn.RemoteAddr().String(), "handshake failed")
 		return err
 	}
+	// clear the handshake deadline
+	conn.SetDeadline(time.Time{})
 
 	sessionID, end := sh.sessions.StartSession(rhpConn, rhp.SessionProtocolTCP, 2)
 	defer end()
@@ -233,7 +276,7 @@ func (sh *SessionHandler) Settings() (rhp2.HostSettings, error) {
 		WindowSize:           settings.WindowSize,
 
 		// contract formation
-		AcceptingContracts: settings.AcceptingContracts,
+		AcceptingContracts: settings.AcceptingContracts && !sh.maintenance.Enabled(),
 		MaxDuration:        settings.MaxContractDuration,
 		ContractPrice:      settings.ContractPrice,
 
@@ -265,6 +308,26 @@ func (sh *SessionHandler) Serve() error {
 		}
 		go func() {
 			defer conn.Close()
+
+			// connections from a trusted proxy without a client address,
+			// such as health checks, must not count against the proxy
+			if err := rhp.ProxyHeaderError(conn); err != nil {
+				sh.log.Debug("closing proxied connection", zap.Error(err), zap.String("remoteAddr", conn.RemoteAddr().String()))
+				return
+			}
+
+			if sh.maintenance.Enabled() {
+				sh.log.Debug("rejected connection", zap.Error(rhp.ErrMaintenance), zap.String("remoteAddr", conn.RemoteAddr().String()))
+				return
+			}
+
+			release, err := sh.limiter.AcceptConn(conn.RemoteAddr().String())
+			if err != nil {
+				sh.log.Debug("rejected connection", zap.Error(err), zap.String("remoteAddr", conn.RemoteAddr().String()))
+				return
+			}
+			defer release()
+
 			if err := sh.upgrade(conn); err != nil {
 				if errors.Is(err, rhp2.ErrRenterClosed) || errors.Is(err, io.EOF) {
 					// skip logging graceful close and EOF errors
@@ -282,7 +345,7 @@ func (sh *SessionHandler) LocalAddr() string {
 }
 
 // NewSessionHandler creates a new RHP2 SessionHandler
-func NewSessionHandler(l net.Listener, hostKey types.PrivateKey, rhp3Addr string, cm ChainManager, tpool TransactionPool, wallet Wallet, contracts ContractManager, settings SettingsReporter, storage StorageManager, monitor rhp.DataMonitor, sessions SessionReporter, log *zap.Logger) (*SessionHandler, error) {
+func NewSessionHandler(l net.Listener, hostKey types.PrivateKey, rhp3Addr string, cm ChainManager, tpool TransactionPool, wallet Wallet, contracts ContractManager, settings SettingsReporter, storage StorageManager, policies PolicyManager, monitor rhp.DataMonitor, sessions SessionReporter, limiter ConnLimiter, maintenance MaintenanceManager, renters RenterRecorder, log *zap.Logger) (*SessionHandler, error) {
 	_, rhp3Port, err := net.SplitHostPort(rhp3Addr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse rhp3 addr: %w", err)
@@ -299,11 +362,15 @@ func NewSessionHandler(l net.Listener, hostKey types.PrivateKey, rhp3Addr string
 		tpool:    tpool,
 		wallet:   wallet,
 
-		contracts: contracts,
-		sessions:  sessions,
-		settings:  settings,
-		storage:   storage,
-		log:       log,
+		contracts:   contracts,
+		limiter:     limiter,
+		maintenance: maintenance,
+		policies:    policies,
+		renters:     renters,
+		sessions:    sessions,
+		settings:    settings,
+		storage:     storage,
+		log:         log,
 	}
 	return sh, nil
 }
@@ -12,6 +12,7 @@ import (
 	rhp2 "go.sia.tech/core/rhp/v2"
 	"go.sia.tech/core/types"
 	"go.sia.tech/hostd/host/contracts"
+	"go.sia.tech/hostd/host/policy"
 	"go.sia.tech/hostd/rhp"
 	"go.sia.tech/hostd/wallet"
 	"go.uber.org/zap"
@@ -85,6 +86,11 @@ func (sh *SessionHandler) rpcLock(s *session, log *zap.Logger) (contracts.Usage,
 		return contracts.Usage{}, err
 	}
 
+	// attribute the session's bandwidth to the renter
+	if err := sh.renters.Attribute(s.conn, contract.RenterKey()); err != nil {
+		log.Warn("failed to attribute bandwidth to renter", zap.Error(err))
+	}
+
 	// set the contract
 	s.contract = contract
 	lockResp := &rhp2.RPCLockResponse{
@@ -118,6 +124,9 @@ func (sh *SessionHandler) rpcFormContract(s *session, log *zap.Logger) (contract
 	if !sh.settings.Settings().AcceptingContracts {
 		s.t.WriteResponseErr(ErrNotAcceptingContracts)
 		return contracts.Usage{}, ErrNotAcceptingContracts
+	} else if sh.maintenance.Enabled() {
+		s.t.WriteResponseErr(rhp.ErrMaintenance)
+		return contracts.Usage{}, rhp.ErrMaintenance
 	}
 	var req rhp2.RPCFormContractRequest
 	if err := s.readRequest(&req, 10*minMessageSize, time.Minute); err != nil {
@@ -156,6 +165,19 @@ func (sh *SessionHandler) rpcFormContract(s *session, log *zap.Logger) (contract
 		return contracts.Usage{}, err
 	}
 
+	// check the contract against the host's policy
+	err = sh.policies.EvaluateContract(policy.ContractRequest{
+		RenterKey:  renterPub,
+		Duration:   formationTxn.FileContracts[0].WindowStart - currentHeight,
+		Filesize:   formationTxn.FileContracts[0].Filesize,
+		Collateral: hostCollateral,
+	})
+	if err != nil {
+		err := fmt.Errorf("contract rejected: %w", err)
+		s.t.WriteResponseErr(err)
+		return contracts.Usage{}, err
+	}
+
 	// calculate the host's collateral and add the inputs to the transaction
 	renterInputs, renterOutputs := len(formationTxn.SiacoinInputs), len(formationTxn.SiacoinOutputs)
 	toSign, discard, err := sh.wallet.FundTransaction(formationTxn, hostCollateral)
@@ -318,6 +340,20 @@ func (sh *SessionHandler) rpcRenewAndClearContract(s *session, log *zap.Logger)
 		s.t.WriteResponseErr(err)
 		return contracts.Usage{}, err
 	}
+
+	// check the renewal against the host's policy
+	err = sh.policies.EvaluateContract(policy.ContractRequest{
+		RenterKey:   renterKey,
+		Duration:    renewedContract.WindowStart - state.Index.Height,
+		Filesize:    renewedContract.Filesize,
+		Collateral:  lockedCollateral,
+		RenewedFrom: existingRevision.ParentID,
+	})
+	if err != nil {
+		err = fmt.Errorf("contract rejected: %w", err)
+		s.t.WriteResponseErr(err)
+		return contracts.Usage{}, err
+	}
 	renewalUsage := contracts.Usage{
 		RPCRevenue:       settings.ContractPrice,
 		RiskedCollateral: riskedCollateral,
@@ -725,6 +761,12 @@ func (sh *SessionHandler) rpcRead(s *session, log *zap.Logger) (contracts.Usage,
 		return contracts.Usage{}, fmt.Errorf("failed to read read request: %w", err)
 	}
 
+	// check that the renter has not reached its daily egress cap
+	if err := s.conn.CheckEgressCap(); err != nil {
+		s.t.WriteResponseErr(err)
+		return contracts.Usage{}, err
+	}
+
 	// validate the request sections and calculate the cost
 	costs, err := settings.RPCReadCost(req.Sections, req.MerkleProof)
 	if err != nil {
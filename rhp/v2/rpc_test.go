@@ -6,11 +6,13 @@ import (
 	"io"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	rhp2 "go.sia.tech/core/rhp/v2"
 	"go.sia.tech/core/types"
+	"go.sia.tech/hostd/host/policy"
 	"go.sia.tech/hostd/internal/test"
 	"go.sia.tech/renterd/wallet"
 	"go.uber.org/zap/zaptest"
@@ -577,3 +579,62 @@ func BenchmarkDownload(b *testing.B) {
 		}
 	}
 }
+
+func TestContractPolicy(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	renter, host, err := test.NewTestingPair(t.TempDir(), log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer renter.Close()
+	defer host.Close()
+
+	formContract := func() error {
+		_, err := renter.FormContract(context.Background(), host.RHP2Addr(), host.PublicKey(), types.Siacoins(10), types.Siacoins(20), 200)
+		return err
+	}
+
+	pm := host.Policies()
+	// blocked renters should be rejected
+	if err := pm.SetRenterAccess(renter.PublicKey(), false); err != nil {
+		t.Fatal(err)
+	} else if err := formContract(); err == nil || !strings.Contains(err.Error(), policy.ErrRenterBlocked.Error()) {
+		t.Fatalf("expected blocked error, got %v", err)
+	}
+
+	// renters not on the allow list should be rejected
+	if err := pm.RemoveRenterAccess(renter.PublicKey()); err != nil {
+		t.Fatal(err)
+	} else if err := pm.UpdatePolicy(policy.Policy{AllowlistOnly: true}); err != nil {
+		t.Fatal(err)
+	} else if err := formContract(); err == nil || !strings.Contains(err.Error(), policy.ErrRenterNotAllowed.Error()) {
+		t.Fatalf("expected not allowed error, got %v", err)
+	}
+
+	// contracts shorter than the minimum duration should be rejected
+	if err := pm.SetRenterAccess(renter.PublicKey(), true); err != nil {
+		t.Fatal(err)
+	} else if err := pm.UpdatePolicy(policy.Policy{AllowlistOnly: true, MinContractDuration: 1000}); err != nil {
+		t.Fatal(err)
+	} else if err := formContract(); err == nil || !strings.Contains(err.Error(), policy.ErrContractTooShort.Error()) {
+		t.Fatalf("expected duration error, got %v", err)
+	}
+
+	// contracts exceeding the collateral limit should be rejected
+	if err := pm.UpdatePolicy(policy.Policy{AllowlistOnly: true, MaxRenterCollateral: types.Siacoins(25)}); err != nil {
+		t.Fatal(err)
+	} else if err := formContract(); err != nil {
+		t.Fatal(err)
+	} else if err := formContract(); err == nil || !strings.Contains(err.Error(), policy.ErrMaxCollateralExceeded.Error()) {
+		t.Fatalf("expected collateral error, got %v", err)
+	}
+
+	usage, err := pm.RenterUsage(renter.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	} else if usage.Contracts != 1 {
+		t.Fatalf("expected 1 contract, got %v", usage.Contracts)
+	} else if usage.Collateral.IsZero() {
+		t.Fatal("expected collateral to be locked")
+	}
+}
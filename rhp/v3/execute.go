@@ -26,6 +26,10 @@ const (
 	readRegistryType   = 2
 )
 
+// readAheadSectors is the number of contract sectors prefetched when a
+// program reads sequential contract sectors.
+const readAheadSectors = 4
+
 type (
 	programData []byte
 
@@ -48,6 +52,14 @@ type (
 		finalize     bool
 		releaseFuncs []func() error
 
+		// lastRead is the contract sector index of the previous ReadOffset
+		// instruction. It is only valid if hasRead is true.
+		lastRead uint64
+		hasRead  bool
+		// prefetched is the index of the first contract sector that has not
+		// been prefetched
+		prefetched uint64
+
 		log       *zap.Logger
 		contracts ContractManager
 		storage   StorageManager
@@ -224,6 +236,7 @@ func (pe *programExecutor) executeReadOffset(instr *rhp3.InstrReadOffset, log *z
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get root: %w", err)
 	}
+	pe.readAhead(sectorIndex)
 
 	sector, err := pe.storage.Read(root)
 	if err != nil {
@@ -243,6 +256,37 @@ func (pe *programExecutor) executeReadOffset(instr *rhp3.InstrReadOffset, log *z
 	return sector[relOffset : relOffset+length], proof, nil
 }
 
+// readAhead prefetches the contract sectors following index if the program
+// is reading sequential contract sectors.
+func (pe *programExecutor) readAhead(index uint64) {
+	sequential := pe.hasRead && index == pe.lastRead+1
+	pe.lastRead, pe.hasRead = index, true
+	if !sequential {
+		return
+	}
+
+	start, end := index+1, index+1+readAheadSectors
+	if start < pe.prefetched {
+		start = pe.prefetched
+	}
+	if n := pe.updater.SectorCount(); end > n {
+		end = n
+	}
+	var roots []types.Hash256
+	for i := start; i < end; i++ {
+		root, err := pe.updater.SectorRoot(i)
+		if err != nil {
+			break
+		}
+		roots = append(roots, root)
+	}
+	if len(roots) == 0 {
+		return
+	}
+	pe.prefetched = start + uint64(len(roots))
+	pe.storage.Prefetch(roots...)
+}
+
 func (pe *programExecutor) executeReadSector(instr *rhp3.InstrReadSector, log *zap.Logger) ([]byte, []types.Hash256, error) {
 	root, err := pe.programData.Hash(instr.MerkleRootOffset)
 	if err != nil {
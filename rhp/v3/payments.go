@@ -58,6 +58,10 @@ func (sh *SessionHandler) processContractPayment(s *rhp3.Stream, height uint64)
 	if !contract.RenterKey().VerifyHash(sigHash, req.Signature) {
 		return rhp3.ZeroAccount, types.ZeroCurrency, ErrInvalidRenterSignature
 	}
+	// attribute the stream's bandwidth to the renter. The refund account
+	// is funded by the same renter.
+	sh.attributeRenter(s, contract.RenterKey())
+	sh.renters.AddAccountFunding(types.PublicKey(req.RefundAccount), contract.RenterKey())
 
 	settings := sh.settings.Settings()
 	if err != nil {
@@ -117,6 +121,7 @@ func (sh *SessionHandler) processAccountPayment(s *rhp3.Stream, height uint64) (
 	case !types.PublicKey(req.Account).VerifyHash(req.SigHash(), req.Signature):
 		return rhp3.ZeroAccount, types.ZeroCurrency, ErrInvalidRenterSignature
 	}
+	sh.attributeAccount(s, req.Account)
 	return req.Account, req.Amount, nil
 }
 
@@ -203,6 +208,8 @@ func (sh *SessionHandler) processFundAccountPayment(pt rhp3.HostPriceTable, s *r
 	if !contract.RenterKey().VerifyHash(sigHash, req.Signature) {
 		return types.ZeroCurrency, types.ZeroCurrency, ErrInvalidRenterSignature
 	}
+	sh.attributeRenter(s, contract.RenterKey())
+	sh.renters.AddAccountFunding(types.PublicKey(accountID), contract.RenterKey())
 
 	settings := sh.settings.Settings()
 	if err != nil {
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sync"
 	"time"
 
 	"go.sia.tech/core/consensus"
@@ -13,6 +14,7 @@ import (
 	"go.sia.tech/core/types"
 	"go.sia.tech/hostd/host/accounts"
 	"go.sia.tech/hostd/host/contracts"
+	"go.sia.tech/hostd/host/policy"
 	"go.sia.tech/hostd/host/settings"
 	"go.sia.tech/hostd/host/storage"
 	"go.sia.tech/hostd/internal/threadgroup"
@@ -67,6 +69,9 @@ type (
 		Write(root types.Hash256, data *[rhp2.SectorSize]byte) (release func() error, _ error)
 		// Read reads the sector with the given root from the manager.
 		Read(root types.Hash256) (*[rhp2.SectorSize]byte, error)
+		// Prefetch reads the sectors with the given roots in the background
+		// so that subsequent reads are faster.
+		Prefetch(roots ...types.Hash256)
 		// Sync syncs the data files of changed volumes.
 		Sync() error
 
@@ -91,7 +96,7 @@ type (
 	// A Wallet manages funds and signs transactions
 	Wallet interface {
 		Address() types.Address
-		FundTransaction(txn *types.Transaction, amount types.Currency) ([]types.Hash256, func(), error)
+		FundTransaction(txn *types.Transaction, amount types.Currency, outputs ...types.SiacoinOutputID) ([]types.Hash256, func(), error)
 		SignTransaction(cs consensus.State, txn *types.Transaction, toSign []types.Hash256, cf types.CoveredFields) error
 	}
 
@@ -107,12 +112,50 @@ type (
 		BandwidthLimiters() (ingress, egress *rate.Limiter)
 	}
 
+	// A PolicyManager evaluates contract renewals against the host's
+	// contract policy
+	PolicyManager interface {
+		EvaluateContract(policy.ContractRequest) error
+	}
+
 	// SessionReporter reports session metrics
 	SessionReporter interface {
 		StartSession(conn *rhp.Conn, proto string, version int) (sessionID rhp.UID, end func())
 		StartRPC(sessionID rhp.UID, rpc types.Specifier) (rpcID rhp.UID, end func(contracts.Usage, error))
 	}
 
+	// A ConnLimiter limits the connections accepted from each peer and bans
+	// peers that repeatedly fail the handshake or do not pay for RPCs.
+	ConnLimiter interface {
+		// AcceptConn returns an error if a new connection from the remote
+		// address should be rejected. Otherwise, release must be called
+		// when the connection is closed.
+		AcceptConn(addr string) (release func(), err error)
+		// HandshakeTimeout returns the maximum duration of the transport
+		// handshake. If zero, the handshake does not time out.
+		HandshakeTimeout() time.Duration
+		// ReportFailure records a failed handshake or unpaid RPC from the
+		// remote address.
+		ReportFailure(addr string, reason string)
+		// ReportSuccess forgets the recorded failures of the remote address
+		// after a paid RPC.
+		ReportSuccess(addr string)
+	}
+
+	// A MaintenanceManager reports whether the host is in maintenance mode.
+	// While enabled, new sessions are rejected.
+	MaintenanceManager interface {
+		Enabled() bool
+	}
+
+	// A RenterRecorder attributes a connection's bandwidth to a renter and
+	// applies the renter's bandwidth limits.
+	RenterRecorder interface {
+		Attribute(c *rhp.Conn, renterKey types.PublicKey) error
+		AttributeAccount(c *rhp.Conn, account types.PublicKey) error
+		AddAccountFunding(account, renterKey types.PublicKey)
+	}
+
 	// A SessionHandler handles the host side of the renter-host protocol and
 	// manages renter sessions
 	SessionHandler struct {
@@ -122,12 +165,16 @@ type (
 		monitor  rhp.DataMonitor
 		tg       *threadgroup.ThreadGroup
 
-		accounts  AccountManager
-		contracts ContractManager
-		sessions  SessionReporter
-		registry  RegistryManager
-		storage   StorageManager
-		log       *zap.Logger
+		accounts    AccountManager
+		contracts   ContractManager
+		limiter     ConnLimiter
+		maintenance MaintenanceManager
+		policies    PolicyManager
+		renters     RenterRecorder
+		sessions    SessionReporter
+		registry    RegistryManager
+		storage     StorageManager
+		log         *zap.Logger
 
 		chain    ChainManager
 		settings SettingsReporter
@@ -135,6 +182,9 @@ type (
 		wallet   Wallet
 
 		priceTables *priceTableManager
+
+		mu      sync.Mutex // guards streams
+		streams map[*rhp3.Stream]*rhp.Conn
 	}
 )
 
@@ -170,10 +220,58 @@ var (
 	ErrUpdateProofSize = errors.New("update section is not a multiple of the segment size")
 )
 
+// streamConn returns the connection the stream was accepted on.
+func (sh *SessionHandler) streamConn(s *rhp3.Stream) *rhp.Conn {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	return sh.streams[s]
+}
+
+// attributeRenter attributes the bandwidth of the stream's connection to the
+// renter.
+func (sh *SessionHandler) attributeRenter(s *rhp3.Stream, renterKey types.PublicKey) {
+	conn := sh.streamConn(s)
+	if conn == nil {
+		return
+	} else if err := sh.renters.Attribute(conn, renterKey); err != nil {
+		sh.log.Warn("failed to attribute bandwidth to renter", zap.Stringer("renterKey", renterKey), zap.Error(err))
+	}
+}
+
+// attributeAccount attributes the bandwidth of the stream's connection to the
+// renter that funded the account.
+func (sh *SessionHandler) attributeAccount(s *rhp3.Stream, account rhp3.Account) {
+	conn := sh.streamConn(s)
+	if conn == nil {
+		return
+	} else if err := sh.renters.AttributeAccount(conn, types.PublicKey(account)); err != nil {
+		sh.log.Warn("failed to attribute bandwidth to account", zap.Stringer("account", account), zap.Error(err))
+	}
+}
+
+// checkEgressCap returns an error if the renter the stream's connection is
+// attributed to has reached its daily egress cap.
+func (sh *SessionHandler) checkEgressCap(s *rhp3.Stream) error {
+	conn := sh.streamConn(s)
+	if conn == nil {
+		return nil
+	}
+	return conn.CheckEgressCap()
+}
+
 // handleHostStream handles streams routed to the "host" subscriber
-func (sh *SessionHandler) handleHostStream(s *rhp3.Stream, sessionID rhp.UID, log *zap.Logger) {
+func (sh *SessionHandler) handleHostStream(s *rhp3.Stream, conn *rhp.Conn, sessionID rhp.UID, peerAddr string, log *zap.Logger) {
 	defer s.Close() // close the stream when the RPC has completed
 
+	sh.mu.Lock()
+	sh.streams[s] = conn
+	sh.mu.Unlock()
+	defer func() {
+		sh.mu.Lock()
+		delete(sh.streams, s)
+		sh.mu.Unlock()
+	}()
+
 	done, err := sh.tg.Add() // add the RPC to the threadgroup
 	if err != nil {
 		return
@@ -206,10 +304,20 @@ func (sh *SessionHandler) handleHostStream(s *rhp3.Stream, sessionID rhp.UID, lo
 	rpcID, end := sh.sessions.StartRPC(sessionID, rpc)
 	log = log.Named(rpc.String()).With(zap.Stringer("rpcID", rpcID))
 	usage, err := rpcFn(s, log)
+	paid := err == nil
+	if errors.Is(err, errNoPayment) {
+		// payment is optional for the RPC, but peers that never pay are
+		// eventually banned
+		sh.limiter.ReportFailure(peerAddr, "closed RPC without payment")
+		err = nil
+	}
 	end(usage, err)
 	if err != nil {
 		log.Warn("RPC failed", zap.Error(err), zap.Duration("elapsed", time.Since(rpcStart)))
 		return
+	} else if paid {
+		// only consecutive unpaid RPCs should result in a ban
+		sh.limiter.ReportSuccess(peerAddr)
 	}
 	log.Info("RPC success", zap.Duration("elapsed", time.Since(rpcStart)))
 }
@@ -238,6 +346,25 @@ func (sh *SessionHandler) Serve() error {
 		go func() {
 			defer conn.Close()
 
+			peerAddr := conn.RemoteAddr().String()
+			// connections from a trusted proxy without a client address,
+			// such as health checks, must not count against the proxy
+			if err := rhp.ProxyHeaderError(conn); err != nil {
+				sh.log.Debug("closing proxied connection", zap.Error(err), zap.String("peerAddress", peerAddr))
+				return
+			}
+			if sh.maintenance.Enabled() {
+				sh.log.Debug("rejected connection", zap.Error(rhp.ErrMaintenance), zap.String("peerAddress", peerAddr))
+				return
+			}
+
+			release, err := sh.limiter.AcceptConn(peerAddr)
+			if err != nil {
+				sh.log.Debug("rejected connection", zap.Error(err), zap.String("peerAddress", peerAddr))
+				return
+			}
+			defer release()
+
 			// wrap the conn with the bandwidth limiters
 			ingress, egress := sh.settings.BandwidthLimiters()
 			rhpConn := rhp.NewConn(conn, sh.monitor, ingress, egress)
@@ -250,12 +377,18 @@ func (sh *SessionHandler) Serve() error {
 			log := sh.log.With(zap.Stringer("sessionID", sessionID), zap.String("peerAddress", conn.RemoteAddr().String()))
 
 			// upgrade the connection to RHP3
+			if timeout := sh.limiter.HandshakeTimeout(); timeout > 0 {
+				conn.SetDeadline(time.Now().Add(timeout))
+			}
 			t, err := rhp3.NewHostTransport(rhpConn, sh.privateKey)
 			if err != nil {
+				sh.limiter.ReportFailure(peerAddr, "handshake failed")
 				log.Debug("failed to upgrade conn", zap.Error(err))
 				return
 			}
 			defer t.Close()
+			// clear the handshake deadline
+			conn.SetDeadline(time.Time{})
 
 			for {
 				stream, err := t.AcceptStream()
@@ -266,7 +399,7 @@ func (sh *SessionHandler) Serve() error {
 					return
 				}
 
-				go sh.handleHostStream(stream, sessionID, log)
+				go sh.handleHostStream(stream, rhpConn, sessionID, peerAddr, log)
 			}
 		}()
 	}
@@ -278,7 +411,7 @@ func (sh *SessionHandler) LocalAddr() string {
 }
 
 // NewSessionHandler creates a new SessionHandler
-func NewSessionHandler(l net.Listener, hostKey types.PrivateKey, chain ChainManager, tpool TransactionPool, wallet Wallet, accounts AccountManager, contracts ContractManager, registry RegistryManager, storage StorageManager, settings SettingsReporter, monitor rhp.DataMonitor, sessions SessionReporter, log *zap.Logger) (*SessionHandler, error) {
+func NewSessionHandler(l net.Listener, hostKey types.PrivateKey, chain ChainManager, tpool TransactionPool, wallet Wallet, accounts AccountManager, contracts ContractManager, registry RegistryManager, storage StorageManager, settings SettingsReporter, policies PolicyManager, monitor rhp.DataMonitor, sessions SessionReporter, limiter ConnLimiter, maintenance MaintenanceManager, renters RenterRecorder, log *zap.Logger) (*SessionHandler, error) {
 	sh := &SessionHandler{
 		privateKey: hostKey,
 
@@ -290,15 +423,20 @@ func NewSessionHandler(l net.Listener, hostKey types.PrivateKey, chain ChainMana
 		tpool:  tpool,
 		wallet: wallet,
 
-		accounts:  accounts,
-		contracts: contracts,
-		sessions:  sessions,
-		registry:  registry,
-		settings:  settings,
-		storage:   storage,
-		log:       log,
+		accounts:    accounts,
+		contracts:   contracts,
+		limiter:     limiter,
+		maintenance: maintenance,
+		policies:    policies,
+		renters:     renters,
+		sessions:    sessions,
+		registry:    registry,
+		settings:    settings,
+		storage:     storage,
+		log:         log,
 
 		priceTables: newPriceTableManager(),
+		streams:     make(map[*rhp3.Stream]*rhp.Conn),
 	}
 	return sh, nil
 }
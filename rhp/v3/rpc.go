@@ -14,6 +14,7 @@ import (
 	"go.sia.tech/core/types"
 	"go.sia.tech/hostd/host/accounts"
 	"go.sia.tech/hostd/host/contracts"
+	"go.sia.tech/hostd/host/policy"
 	"go.sia.tech/hostd/rhp"
 	"go.sia.tech/hostd/wallet"
 	"go.uber.org/zap"
@@ -40,6 +41,10 @@ var (
 	// ErrNotAcceptingContracts is returned when the host is not accepting
 	// contracts.
 	ErrNotAcceptingContracts = errors.New("host is not accepting contracts")
+
+	// errNoPayment is returned by RPCs with optional payment when the renter
+	// closes the stream without paying. It is not reported as an RPC error.
+	errNoPayment = errors.New("renter did not pay for RPC")
 )
 
 // handleRPCPriceTable sends the host's price table to the renter.
@@ -66,7 +71,7 @@ func (sh *SessionHandler) handleRPCPriceTable(s *rhp3.Stream, log *zap.Logger) (
 	// likely did not intend to pay
 	budget, err := sh.processPayment(s, &pt)
 	if isNonPaymentErr(err) {
-		return contracts.Usage{}, nil
+		return contracts.Usage{}, errNoPayment
 	} else if err != nil {
 		err = fmt.Errorf("failed to process payment: %w", err)
 		s.WriteResponseErr(err)
@@ -208,7 +213,7 @@ func (sh *SessionHandler) handleRPCLatestRevision(s *rhp3.Stream, log *zap.Logge
 
 	pt, err := sh.readPriceTable(s)
 	if isNonPaymentErr(err) {
-		return contracts.Usage{}, nil
+		return contracts.Usage{}, errNoPayment
 	} else if err != nil {
 		err = fmt.Errorf("failed to read price table: %w", err)
 		s.WriteResponseErr(err)
@@ -217,7 +222,7 @@ func (sh *SessionHandler) handleRPCLatestRevision(s *rhp3.Stream, log *zap.Logge
 
 	budget, err := sh.processPayment(s, &pt)
 	if isNonPaymentErr(err) {
-		return contracts.Usage{}, nil
+		return contracts.Usage{}, errNoPayment
 	} else if err != nil {
 		err = fmt.Errorf("failed to process payment: %w", err)
 		s.WriteResponseErr(err)
@@ -312,6 +317,9 @@ func (sh *SessionHandler) handleRPCRenew(s *rhp3.Stream, log *zap.Logger) (contr
 		s.WriteResponseErr(err)
 		return contracts.Usage{}, err
 	}
+	// only attribute the stream's bandwidth once the renter has proven
+	// ownership of the existing contract
+	sh.attributeRenter(s, existing.RenterKey())
 	// sign the clearing revision
 	signedClearingRevision := contracts.SignedRevision{
 		Revision:        clearingRevision,
@@ -336,6 +344,20 @@ func (sh *SessionHandler) handleRPCRenew(s *rhp3.Stream, log *zap.Logger) (contr
 		s.WriteResponseErr(err)
 		return contracts.Usage{}, err
 	}
+
+	// check the renewal against the host's policy
+	err = sh.policies.EvaluateContract(policy.ContractRequest{
+		RenterKey:   renterKey,
+		Duration:    renewal.WindowStart - pt.HostBlockHeight,
+		Filesize:    renewal.Filesize,
+		Collateral:  lockedCollateral,
+		RenewedFrom: existing.Revision.ParentID,
+	})
+	if err != nil {
+		err := fmt.Errorf("contract rejected: %w", err)
+		s.WriteResponseErr(err)
+		return contracts.Usage{}, err
+	}
 	renterInputs, renterOutputs := len(renewalTxn.SiacoinInputs), len(renewalTxn.SiacoinOutputs)
 	toSign, release, err := sh.wallet.FundTransaction(&renewalTxn, lockedCollateral)
 	if err != nil {
@@ -479,10 +501,22 @@ func (sh *SessionHandler) handleRPCExecute(s *rhp3.Stream, log *zap.Logger) (con
 		return contracts.Usage{}, err
 	}
 
-	var requiresContract, requiresFinalization bool
+	var requiresContract, requiresFinalization, readsData bool
 	for _, instr := range instructions {
 		requiresContract = requiresContract || instr.RequiresContract()
 		requiresFinalization = requiresFinalization || instr.RequiresFinalization()
+		switch instr.(type) {
+		case *rhp3.InstrReadOffset, *rhp3.InstrReadSector:
+			readsData = true
+		}
+	}
+
+	// check that the renter has not reached its daily egress cap
+	if readsData {
+		if err := sh.checkEgressCap(s); err != nil {
+			s.WriteResponseErr(err)
+			return contracts.Usage{}, err
+		}
 	}
 	log = log.Named("mdm")
 	// if the program requires a contract, lock it
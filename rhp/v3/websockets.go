@@ -2,7 +2,9 @@ package rhp
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"time"
 
 	rhp3 "go.sia.tech/core/rhp/v3"
 	"go.sia.tech/hostd/rhp"
@@ -13,6 +15,22 @@ import (
 // handleWebSockets handles websocket connections to the host.
 func (sh *SessionHandler) handleWebSockets(w http.ResponseWriter, r *http.Request) {
 	log := sh.log.Named("websockets").With(zap.String("peerAddr", r.RemoteAddr))
+
+	if sh.maintenance.Enabled() {
+		http.Error(w, rhp.ErrMaintenance.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	release, err := sh.limiter.AcceptConn(r.RemoteAddr)
+	if errors.Is(err, rhp.ErrPeerBanned) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	defer release()
+
 	wsConn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
 		OriginPatterns: []string{"*"},
 	})
@@ -38,12 +56,18 @@ func (sh *SessionHandler) handleWebSockets(w http.ResponseWriter, r *http.Reques
 	log = log.With(zap.String("sessionID", sessionID.String()))
 
 	// upgrade the connection
+	if timeout := sh.limiter.HandshakeTimeout(); timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
 	t, err := rhp3.NewHostTransport(rhpConn, sh.privateKey)
 	if err != nil {
+		sh.limiter.ReportFailure(r.RemoteAddr, "handshake failed")
 		sh.log.Debug("failed to upgrade conn", zap.Error(err), zap.String("remoteAddress", conn.RemoteAddr().String()))
 		return
 	}
 	defer t.Close()
+	// clear the handshake deadline
+	conn.SetDeadline(time.Time{})
 
 	for {
 		stream, err := t.AcceptStream()
@@ -52,7 +76,7 @@ func (sh *SessionHandler) handleWebSockets(w http.ResponseWriter, r *http.Reques
 			return
 		}
 
-		go sh.handleHostStream(stream, sessionID, log)
+		go sh.handleHostStream(stream, rhpConn, sessionID, r.RemoteAddr, log)
 	}
 }
 
@@ -0,0 +1,223 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.uber.org/zap"
+)
+
+const (
+	// consolidationInterval is the interval at which the wallet checks
+	// whether its outputs should be consolidated.
+	consolidationInterval = time.Hour
+	// consolidationThreshold is the number of spendable outputs at which the
+	// wallet will automatically consolidate its outputs.
+	consolidationThreshold = 100
+	// maxConsolidationInputs is the maximum number of inputs in a single
+	// consolidation transaction.
+	maxConsolidationInputs = 100
+)
+
+// consolidationMaxFee is the highest recommended fee per byte at which the
+// wallet will automatically consolidate its outputs. It is three times the
+// transaction pool's minimum fee estimate.
+var consolidationMaxFee = types.Siacoins(1).Div64(100).Div64(1e3).Mul64(3)
+
+// ErrNothingToConsolidate is returned by Consolidate when the wallet does not
+// have enough spendable outputs worth more than the fee to spend them.
+var ErrNothingToConsolidate = errors.New("not enough outputs to consolidate")
+
+// An UnspentOutput is a confirmed siacoin output owned by the wallet.
+type UnspentOutput struct {
+	ID      types.SiacoinOutputID `json:"id"`
+	Address types.Address         `json:"address"`
+	Value   types.Currency        `json:"value"`
+	// Locked is true if the output has been reserved by FundTransaction
+	// and not yet released or broadcast.
+	Locked bool `json:"locked"`
+	// Pending is true if the output is spent by an unconfirmed transaction.
+	Pending bool `json:"pending"`
+}
+
+// mergeTransaction creates an unsigned transaction sending the value of the
+// elements, less the miner fee, to a single output. If the elements are not
+// worth more than the fee, ok is false.
+func (sw *SingleAddressWallet) mergeTransaction(elements []SiacoinElement, addr types.Address, feePerByte types.Currency) (txn types.Transaction, toSign []types.Hash256, ok bool) {
+	var inputSum types.Currency
+	txn.SiacoinInputs = make([]types.SiacoinInput, 0, len(elements))
+	toSign = make([]types.Hash256, 0, len(elements))
+	sw.mu.Lock()
+	for _, sce := range elements {
+		key, retired := sw.retired[sce.Address]
+		if !retired {
+			key = sw.priv
+		}
+		txn.SiacoinInputs = append(txn.SiacoinInputs, types.SiacoinInput{
+			ParentID:         sce.ID,
+			UnlockConditions: types.StandardUnlockConditions(key.PublicKey()),
+		})
+		toSign = append(toSign, types.Hash256(sce.ID))
+		inputSum = inputSum.Add(sce.Value)
+	}
+	sw.mu.Unlock()
+
+	fee := feePerByte.Mul64(mergeTxnOverhead + signedInputSize*uint64(len(elements)))
+	if inputSum.Cmp(fee) <= 0 {
+		return types.Transaction{}, nil, false
+	}
+	txn.MinerFees = []types.Currency{fee}
+	txn.SiacoinOutputs = []types.SiacoinOutput{{Address: addr, Value: inputSum.Sub(fee)}}
+	return txn, toSign, true
+}
+
+// UnspentOutputs returns the wallet's confirmed unspent outputs, including
+// outputs sent to retired addresses, ordered by value descending.
+func (sw *SingleAddressWallet) UnspentOutputs() ([]UnspentOutput, error) {
+	done, err := sw.tg.Add()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	utxos, err := sw.store.UnspentSiacoinElements()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unspent outputs: %w", err)
+	}
+
+	outputs := make([]UnspentOutput, 0, len(utxos))
+	sw.mu.Lock()
+	for _, sce := range utxos {
+		outputs = append(outputs, UnspentOutput{
+			ID:      sce.ID,
+			Address: sce.Address,
+			Value:   sce.Value,
+			Locked:  sw.locked[sce.ID],
+			Pending: sw.tpoolSpent[sce.ID],
+		})
+	}
+	sw.mu.Unlock()
+
+	sort.Slice(outputs, func(i, j int) bool {
+		return outputs[i].Value.Cmp(outputs[j].Value) > 0
+	})
+	return outputs, nil
+}
+
+// Consolidate merges up to maxInputs of the wallet's smallest spendable
+// outputs into a single output sent to the wallet's address. Outputs worth
+// less than the fee to spend them are skipped. The transaction is signed and
+// broadcast before it is returned.
+func (sw *SingleAddressWallet) Consolidate(maxInputs int, feePerByte types.Currency) (types.Transaction, error) {
+	done, err := sw.tg.Add()
+	if err != nil {
+		return types.Transaction{}, err
+	}
+	defer done()
+
+	if maxInputs <= 0 || maxInputs > maxConsolidationInputs {
+		maxInputs = maxConsolidationInputs
+	}
+
+	utxos, err := sw.store.UnspentSiacoinElements()
+	if err != nil {
+		return types.Transaction{}, fmt.Errorf("failed to get unspent outputs: %w", err)
+	}
+
+	// sort by value, ascending
+	sort.Slice(utxos, func(i, j int) bool {
+		return utxos[i].Value.Cmp(utxos[j].Value) < 0
+	})
+
+	inputFee := feePerByte.Mul64(signedInputSize)
+	sw.mu.Lock()
+	addr := sw.addr
+	var selected []SiacoinElement
+	for _, sce := range utxos {
+		if len(selected) >= maxInputs {
+			break
+		} else if sce.Address != addr || sw.locked[sce.ID] || sw.tpoolSpent[sce.ID] || sw.consensusLocked[sce.ID] {
+			continue
+		} else if sce.Value.Cmp(inputFee) <= 0 {
+			continue
+		}
+		selected = append(selected, sce)
+	}
+	if len(selected) < 2 {
+		sw.mu.Unlock()
+		return types.Transaction{}, ErrNothingToConsolidate
+	}
+	for _, sce := range selected {
+		sw.locked[sce.ID] = true
+	}
+	sw.mu.Unlock()
+
+	// the inputs are released after broadcasting since the transaction pool
+	// marks them as spent
+	defer sw.releaseFunc(selected)()
+
+	txn, toSign, ok := sw.mergeTransaction(selected, addr, feePerByte)
+	if !ok {
+		return types.Transaction{}, ErrNothingToConsolidate
+	} else if err := sw.SignTransaction(sw.cm.TipState(), &txn, toSign, types.CoveredFields{WholeTransaction: true}); err != nil {
+		return types.Transaction{}, fmt.Errorf("failed to sign consolidation transaction: %w", err)
+	} else if err := sw.tp.AcceptTransactionSet([]types.Transaction{txn}); err != nil {
+		return types.Transaction{}, fmt.Errorf("failed to broadcast consolidation transaction: %w", err)
+	}
+	return txn, nil
+}
+
+// runConsolidator periodically consolidates the wallet's outputs when it has
+// accumulated many small outputs and fees are low.
+func (sw *SingleAddressWallet) runConsolidator() {
+	ctx, cancel, err := sw.tg.AddContext(context.Background())
+	if err != nil {
+		return
+	}
+	defer cancel()
+
+	t := time.NewTicker(consolidationInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		feePerByte := sw.tp.RecommendedFee()
+		if feePerByte.Cmp(consolidationMaxFee) > 0 {
+			continue
+		}
+
+		utxos, err := sw.store.UnspentSiacoinElements()
+		if err != nil {
+			sw.log.Warn("failed to get unspent outputs", zap.Error(err))
+			continue
+		}
+		sw.mu.Lock()
+		var spendable int
+		for _, sce := range utxos {
+			if sce.Address == sw.addr && !sw.locked[sce.ID] && !sw.tpoolSpent[sce.ID] {
+				spendable++
+			}
+		}
+		sw.mu.Unlock()
+		if spendable < consolidationThreshold {
+			continue
+		}
+
+		txn, err := sw.Consolidate(maxConsolidationInputs, feePerByte)
+		if errors.Is(err, ErrNothingToConsolidate) {
+			continue
+		} else if err != nil {
+			sw.log.Warn("failed to consolidate outputs", zap.Error(err))
+			continue
+		}
+		sw.log.Info("consolidated outputs", zap.Stringer("txnID", txn.ID()), zap.Int("inputs", len(txn.SiacoinInputs)), zap.Stringer("fee", txn.MinerFees[0]))
+	}
+}
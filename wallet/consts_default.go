@@ -0,0 +1,9 @@
+//go:build !testing
+
+package wallet
+
+import "time"
+
+// sweepInterval is the interval at which the outputs of retired keys are
+// swept to the wallet's current address.
+const sweepInterval = 10 * time.Minute
@@ -42,5 +42,11 @@ type (
 		// hash. This detects if the user's recovery phrase has changed and the
 		// wallet needs to rescan.
 		VerifyWalletKey(seedHash types.Hash256) error
+		// RetiredWalletKeys returns the encrypted wallet keys that have been
+		// replaced by a key rotation.
+		RetiredWalletKeys() ([]RetiredKey, error)
+		// RotateWalletKey atomically replaces the wallet's retired keys and
+		// sets the seed hash to the new key's.
+		RotateWalletKey(retired []RetiredKey, seedHash types.Hash256) error
 	}
 )
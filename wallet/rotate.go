@@ -0,0 +1,292 @@
+package wallet
+
+import (
+	"context"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/hostd/alerts"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/chacha20poly1305"
+	"lukechampine.com/frand"
+)
+
+const (
+	// maxSweepInputs is the maximum number of inputs in a single sweep
+	// transaction.
+	maxSweepInputs = 50
+
+	// retiredKeySpecifier distinguishes the key that encrypts the wallet's
+	// retired keys from other keys derived from the wallet key.
+	retiredKeySpecifier = "hostd/wallet-retired-keys"
+)
+
+var (
+	alertRotationID   = frand.Entropy256()
+	alertStuckSweepID = frand.Entropy256()
+)
+
+// ErrKeyInUse is returned when RotateKey is called with the wallet's current
+// key or a key that has already been retired.
+var ErrKeyInUse = errors.New("key is already used by the wallet")
+
+// A RetiredKey is a wallet key that has been replaced by a key rotation. The
+// private key is encrypted with a key derived from the wallet's current key,
+// so it is re-encrypted every time the wallet key is rotated.
+type RetiredKey struct {
+	Address      types.Address
+	EncryptedKey []byte
+}
+
+// retiredKeyCipher returns the cipher that encrypts the wallet's retired keys.
+func retiredKeyCipher(walletKey types.PrivateKey) cipher.AEAD {
+	buf := make([]byte, 0, len(retiredKeySpecifier)+len(walletKey))
+	buf = append(buf, retiredKeySpecifier...)
+	buf = append(buf, walletKey...)
+	key := types.HashBytes(buf)
+	aead, err := chacha20poly1305.NewX(key[:])
+	if err != nil {
+		panic(err) // should never happen
+	}
+	return aead
+}
+
+// sealRetiredKeys encrypts the retired keys with the wallet key.
+func sealRetiredKeys(walletKey types.PrivateKey, retired map[types.Address]types.PrivateKey) []RetiredKey {
+	aead := retiredKeyCipher(walletKey)
+	sealed := make([]RetiredKey, 0, len(retired))
+	for addr, key := range retired {
+		nonce := frand.Bytes(aead.NonceSize())
+		sealed = append(sealed, RetiredKey{
+			Address:      addr,
+			EncryptedKey: aead.Seal(nonce, nonce, key, addr[:]),
+		})
+	}
+	return sealed
+}
+
+// openRetiredKey decrypts a retired key with the wallet key.
+func openRetiredKey(walletKey types.PrivateKey, rk RetiredKey) (types.PrivateKey, error) {
+	aead := retiredKeyCipher(walletKey)
+	if len(rk.EncryptedKey) < aead.NonceSize() {
+		return nil, errors.New("encrypted key is too short")
+	}
+	nonce, ciphertext := rk.EncryptedKey[:aead.NonceSize()], rk.EncryptedKey[aead.NonceSize():]
+	key, err := aead.Open(nil, nonce, ciphertext, rk.Address[:])
+	if err != nil {
+		return nil, err
+	} else if len(key) != 64 || types.StandardUnlockHash(types.PrivateKey(key).PublicKey()) != rk.Address {
+		return nil, errors.New("decrypted key does not match address")
+	}
+	return types.PrivateKey(key), nil
+}
+
+// A SweepResult is the result of sweeping the outputs of the wallet's retired
+// keys to its current address.
+type SweepResult struct {
+	Transactions []types.TransactionID `json:"transactions"`
+	Swept        types.Currency        `json:"swept"`
+	// Pending is the number of retired outputs spent by unconfirmed sweep
+	// transactions.
+	Pending int `json:"pending"`
+	// Stuck is the set of retired outputs that could not be swept, either
+	// because they are worth less than the fee required to spend them or
+	// because the sweep transaction was rejected.
+	Stuck []SiacoinElement `json:"stuck"`
+}
+
+// sweepRetired sends the spendable outputs of the wallet's retired keys to the
+// current address.
+func (sw *SingleAddressWallet) sweepRetired() (result SweepResult, err error) {
+	utxos, err := sw.store.UnspentSiacoinElements()
+	if err != nil {
+		return SweepResult{}, fmt.Errorf("failed to get unspent outputs: %w", err)
+	}
+	feePerByte := sw.tp.RecommendedFee()
+	inputFee := feePerByte.Mul64(signedInputSize)
+
+	sw.mu.Lock()
+	addr := sw.addr
+	var spendable []SiacoinElement
+	for _, sce := range utxos {
+		if _, ok := sw.retired[sce.Address]; !ok || sw.locked[sce.ID] || sw.consensusLocked[sce.ID] {
+			continue
+		} else if sw.tpoolSpent[sce.ID] {
+			result.Pending++
+			continue
+		} else if sce.Value.Cmp(inputFee) <= 0 {
+			result.Stuck = append(result.Stuck, sce)
+			continue
+		}
+		sw.locked[sce.ID] = true
+		spendable = append(spendable, sce)
+	}
+	sw.mu.Unlock()
+
+	// the inputs are released after broadcasting since the transaction pool
+	// marks them as spent
+	defer func() {
+		sw.mu.Lock()
+		defer sw.mu.Unlock()
+		for _, sce := range spendable {
+			delete(sw.locked, sce.ID)
+		}
+	}()
+
+	var errs []error
+	for i := 0; i < len(spendable); i += maxSweepInputs {
+		batch := spendable[i:]
+		if len(batch) > maxSweepInputs {
+			batch = batch[:maxSweepInputs]
+		}
+
+		txn, toSign, ok := sw.mergeTransaction(batch, addr, feePerByte)
+		if !ok {
+			result.Stuck = append(result.Stuck, batch...)
+			continue
+		}
+		if err := sw.SignTransaction(sw.cm.TipState(), &txn, toSign, types.CoveredFields{WholeTransaction: true}); err != nil {
+			return SweepResult{}, fmt.Errorf("failed to sign sweep transaction: %w", err)
+		} else if err := sw.tp.AcceptTransactionSet([]types.Transaction{txn}); err != nil {
+			result.Stuck = append(result.Stuck, batch...)
+			errs = append(errs, fmt.Errorf("failed to broadcast sweep transaction %v: %w", txn.ID(), err))
+			continue
+		}
+		result.Transactions = append(result.Transactions, txn.ID())
+		result.Swept = result.Swept.Add(txn.SiacoinOutputs[0].Value)
+		result.Pending += len(batch)
+	}
+	return result, errors.Join(errs...)
+}
+
+// updateSweepAlerts registers or dismisses the key rotation alerts based on
+// the result of a sweep.
+func (sw *SingleAddressWallet) updateSweepAlerts(result SweepResult, sweepErr error) {
+	if result.Pending == 0 && len(result.Stuck) == 0 {
+		sw.alerts.Dismiss(alertRotationID, alertStuckSweepID)
+		return
+	}
+
+	if result.Pending > 0 {
+		sw.alerts.Register(alerts.Alert{
+			ID:       alertRotationID,
+			Severity: alerts.SeverityInfo,
+			Message:  "Sweeping outputs of retired wallet keys",
+			Data: map[string]any{
+				"address":      sw.Address(),
+				"pending":      result.Pending,
+				"swept":        result.Swept,
+				"transactions": result.Transactions,
+			},
+			Timestamp: time.Now(),
+		})
+	} else {
+		sw.alerts.Dismiss(alertRotationID)
+	}
+
+	if len(result.Stuck) == 0 {
+		sw.alerts.Dismiss(alertStuckSweepID)
+		return
+	}
+	var value types.Currency
+	ids := make([]types.SiacoinOutputID, 0, len(result.Stuck))
+	for _, sce := range result.Stuck {
+		ids = append(ids, sce.ID)
+		value = value.Add(sce.Value)
+	}
+	data := map[string]any{
+		"outputs": ids,
+		"value":   value,
+	}
+	if sweepErr != nil {
+		data["error"] = sweepErr.Error()
+	}
+	sw.alerts.Register(alerts.Alert{
+		ID:        alertStuckSweepID,
+		Severity:  alerts.SeverityWarning,
+		Message:   "Outputs of retired wallet keys could not be swept",
+		Data:      data,
+		Timestamp: time.Now(),
+	})
+}
+
+// RotateKey replaces the wallet's key and sweeps the spendable outputs of the
+// previous key to the new address. The previous key is retained to sign for
+// outputs it receives after the rotation, such as the payouts of contracts
+// formed before the rotation, which are swept as they become spendable.
+func (sw *SingleAddressWallet) RotateKey(newKey types.PrivateKey) (SweepResult, error) {
+	done, err := sw.tg.Add()
+	if err != nil {
+		return SweepResult{}, err
+	}
+	defer done()
+
+	sw.mu.Lock()
+	newAddr := types.StandardUnlockHash(newKey.PublicKey())
+	if _, ok := sw.retired[newAddr]; ok || newAddr == sw.addr {
+		sw.mu.Unlock()
+		return SweepResult{}, ErrKeyInUse
+	}
+	// the retired keys, including the current key, are re-encrypted with the
+	// new key
+	retired := make(map[types.Address]types.PrivateKey, len(sw.retired)+1)
+	for addr, key := range sw.retired {
+		retired[addr] = key
+	}
+	oldAddr := sw.addr
+	retired[oldAddr] = sw.priv
+	if err := sw.store.RotateWalletKey(sealRetiredKeys(newKey, retired), types.HashBytes(newKey[:])); err != nil {
+		sw.mu.Unlock()
+		return SweepResult{}, fmt.Errorf("failed to rotate wallet key: %w", err)
+	}
+	sw.retired = retired
+	sw.priv, sw.addr = newKey, newAddr
+	sw.mu.Unlock()
+	sw.log.Info("rotated wallet key", zap.Stringer("oldAddress", oldAddr), zap.Stringer("newAddress", newAddr))
+
+	result, err := sw.sweepRetired()
+	sw.updateSweepAlerts(result, err)
+	if err != nil {
+		return result, fmt.Errorf("failed to sweep retired outputs: %w", err)
+	}
+	sw.log.Info("swept retired outputs", zap.Int("transactions", len(result.Transactions)), zap.Stringer("value", result.Swept), zap.Int("stuck", len(result.Stuck)))
+	return result, nil
+}
+
+// runSweeper periodically sweeps the outputs of the wallet's retired keys
+// until the wallet is closed.
+func (sw *SingleAddressWallet) runSweeper() {
+	ctx, cancel, err := sw.tg.AddContext(context.Background())
+	if err != nil {
+		return
+	}
+	defer cancel()
+
+	t := time.NewTicker(sweepInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		sw.mu.Lock()
+		retired := len(sw.retired)
+		sw.mu.Unlock()
+		if retired == 0 {
+			continue
+		}
+
+		result, err := sw.sweepRetired()
+		if err != nil {
+			sw.log.Warn("failed to sweep retired outputs", zap.Error(err))
+		} else if len(result.Transactions) > 0 {
+			sw.log.Info("swept retired outputs", zap.Int("transactions", len(result.Transactions)), zap.Stringer("value", result.Swept))
+		}
+		sw.updateSweepAlerts(result, err)
+	}
+}
@@ -0,0 +1,40 @@
+package wallet
+
+import (
+	"testing"
+
+	"go.sia.tech/core/types"
+)
+
+func TestRetiredKeyEncryption(t *testing.T) {
+	walletKey := types.GeneratePrivateKey()
+	retired := make(map[types.Address]types.PrivateKey)
+	for i := 0; i < 3; i++ {
+		key := types.GeneratePrivateKey()
+		retired[types.StandardUnlockHash(key.PublicKey())] = key
+	}
+
+	sealed := sealRetiredKeys(walletKey, retired)
+	if len(sealed) != len(retired) {
+		t.Fatalf("expected %v sealed keys, got %v", len(retired), len(sealed))
+	}
+	for _, rk := range sealed {
+		key, err := openRetiredKey(walletKey, rk)
+		if err != nil {
+			t.Fatal(err)
+		} else if string(key) != string(retired[rk.Address]) {
+			t.Fatalf("key mismatch for %v", rk.Address)
+		}
+
+		// a different wallet key should not be able to decrypt the key
+		if _, err := openRetiredKey(types.GeneratePrivateKey(), rk); err == nil {
+			t.Fatal("expected decryption with a different wallet key to fail")
+		}
+
+		// the key should not be usable for a different address
+		rk.Address = types.Address{1}
+		if _, err := openRetiredKey(walletKey, rk); err == nil {
+			t.Fatal("expected decryption with a different address to fail")
+		}
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"gitlab.com/NebulousLabs/encoding"
 	"go.sia.tech/core/consensus"
 	"go.sia.tech/core/types"
+	"go.sia.tech/hostd/alerts"
 	"go.sia.tech/hostd/internal/chain"
 	"go.sia.tech/hostd/internal/threadgroup"
 	"go.sia.tech/siad/modules"
@@ -30,6 +31,12 @@ const (
 	// maxDefragUTXOs is the maximum number of utxos that will be added to a
 	// transaction when defragging
 	maxDefragUTXOs = 10
+
+	// signedInputSize is the estimated size of a signed siacoin input.
+	signedInputSize = 320
+	// mergeTxnOverhead is the estimated size of a transaction merging
+	// inputs into a single output, without its inputs.
+	mergeTxnOverhead = 250
 )
 
 // transaction sources indicate the source of a transaction. Transactions can
@@ -47,6 +54,10 @@ var (
 	// ErrNotEnoughFunds is returned when there are not enough unspent outputs
 	// to fund a transaction.
 	ErrNotEnoughFunds = errors.New("not enough funds")
+	// ErrOutputUnavailable is returned when an output passed to
+	// FundTransaction is not a spendable output of the wallet's current
+	// address.
+	ErrOutputUnavailable = errors.New("output is not spendable")
 )
 
 type (
@@ -62,9 +73,17 @@ type (
 
 	// A TransactionPool manages unconfirmed transactions.
 	TransactionPool interface {
+		AcceptTransactionSet([]types.Transaction) error
+		RecommendedFee() types.Currency
 		Subscribe(subscriber modules.TransactionPoolSubscriber)
 	}
 
+	// Alerts registers and dismisses global alerts.
+	Alerts interface {
+		Register(alerts.Alert)
+		Dismiss(...types.Hash256)
+	}
+
 	// A SiacoinElement is a SiacoinOutput along with its ID.
 	SiacoinElement struct {
 		types.SiacoinOutput
@@ -88,15 +107,21 @@ type (
 	SingleAddressWallet struct {
 		scanHeight uint64 // ensure 64-bit alignment on 32-bit systems
 
-		priv types.PrivateKey
-		addr types.Address
-
-		cm    ChainManager
-		store SingleAddressStore
-		log   *zap.Logger
-		tg    *threadgroup.ThreadGroup
+		cm     ChainManager
+		tp     TransactionPool
+		store  SingleAddressStore
+		alerts Alerts
+		log    *zap.Logger
+		tg     *threadgroup.ThreadGroup
 
 		mu sync.Mutex // protects the following fields
+		// priv and addr are the wallet's current key and address. They are
+		// changed by RotateKey.
+		priv types.PrivateKey
+		addr types.Address
+		// retired maps the addresses of rotated keys to their private keys.
+		// Outputs sent to a retired address are swept to the current address.
+		retired map[types.Address]types.PrivateKey
 		// tpoolTxns maps a transaction set ID to the transactions in that set
 		tpoolTxns map[modules.TransactionSetID][]Transaction
 		// tpoolUtxos maps a siacoin output ID to its corresponding siacoin
@@ -121,6 +146,10 @@ type (
 // NewSingleAddressWallet than was used to initialize the wallet
 var ErrDifferentSeed = errors.New("seed differs from wallet seed")
 
+// ErrKeyRetired is returned when the key provided to NewSingleAddressWallet
+// has been replaced by RotateKey.
+var ErrKeyRetired = errors.New("wallet key has been rotated, use the new recovery phrase")
+
 // EncodeTo implements types.EncoderTo.
 func (txn Transaction) EncodeTo(e *types.Encoder) {
 	txn.ID.EncodeTo(e)
@@ -143,50 +172,50 @@ func (txn *Transaction) DecodeFrom(d *types.Decoder) {
 	txn.Timestamp = d.ReadTime()
 }
 
-func transactionIsRelevant(txn types.Transaction, addr types.Address) bool {
+func transactionIsRelevant(txn types.Transaction, owned map[types.Address]bool) bool {
 	for i := range txn.SiacoinInputs {
-		if txn.SiacoinInputs[i].UnlockConditions.UnlockHash() == addr {
+		if owned[txn.SiacoinInputs[i].UnlockConditions.UnlockHash()] {
 			return true
 		}
 	}
 	for i := range txn.SiacoinOutputs {
-		if txn.SiacoinOutputs[i].Address == addr {
+		if owned[txn.SiacoinOutputs[i].Address] {
 			return true
 		}
 	}
 	for i := range txn.SiafundInputs {
-		if txn.SiafundInputs[i].UnlockConditions.UnlockHash() == addr {
+		if owned[txn.SiafundInputs[i].UnlockConditions.UnlockHash()] {
 			return true
 		}
-		if txn.SiafundInputs[i].ClaimAddress == addr {
+		if owned[txn.SiafundInputs[i].ClaimAddress] {
 			return true
 		}
 	}
 	for i := range txn.SiafundOutputs {
-		if txn.SiafundOutputs[i].Address == addr {
+		if owned[txn.SiafundOutputs[i].Address] {
 			return true
 		}
 	}
 	for i := range txn.FileContracts {
 		for _, sco := range txn.FileContracts[i].ValidProofOutputs {
-			if sco.Address == addr {
+			if owned[sco.Address] {
 				return true
 			}
 		}
 		for _, sco := range txn.FileContracts[i].MissedProofOutputs {
-			if sco.Address == addr {
+			if owned[sco.Address] {
 				return true
 			}
 		}
 	}
 	for i := range txn.FileContractRevisions {
 		for _, sco := range txn.FileContractRevisions[i].ValidProofOutputs {
-			if sco.Address == addr {
+			if owned[sco.Address] {
 				return true
 			}
 		}
 		for _, sco := range txn.FileContractRevisions[i].MissedProofOutputs {
-			if sco.Address == addr {
+			if owned[sco.Address] {
 				return true
 			}
 		}
@@ -194,6 +223,28 @@ func transactionIsRelevant(txn types.Transaction, addr types.Address) bool {
 	return false
 }
 
+// ownsAddress returns true if the address belongs to the wallet's current or
+// retired keys. sw.mu must be held.
+func (sw *SingleAddressWallet) ownsAddress(addr types.Address) bool {
+	if addr == sw.addr {
+		return true
+	}
+	_, ok := sw.retired[addr]
+	return ok
+}
+
+// ownedAddresses returns the set of addresses belonging to the wallet's
+// current and retired keys.
+func (sw *SingleAddressWallet) ownedAddresses() map[types.Address]bool {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	owned := map[types.Address]bool{sw.addr: true}
+	for addr := range sw.retired {
+		owned[addr] = true
+	}
+	return owned
+}
+
 // Close closes the wallet
 func (sw *SingleAddressWallet) Close() error {
 	sw.tg.Stop()
@@ -202,14 +253,31 @@ func (sw *SingleAddressWallet) Close() error {
 
 // Address returns the address of the wallet.
 func (sw *SingleAddressWallet) Address() types.Address {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
 	return sw.addr
 }
 
 // UnlockConditions returns the unlock conditions of the wallet.
 func (sw *SingleAddressWallet) UnlockConditions() types.UnlockConditions {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
 	return types.StandardUnlockConditions(sw.priv.PublicKey())
 }
 
+// AddressUnlockConditions returns the unlock conditions of an address
+// belonging to the wallet's current or retired keys.
+func (sw *SingleAddressWallet) AddressUnlockConditions(addr types.Address) (types.UnlockConditions, bool) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if addr == sw.addr {
+		return types.StandardUnlockConditions(sw.priv.PublicKey()), true
+	} else if key, ok := sw.retired[addr]; ok {
+		return types.StandardUnlockConditions(key.PublicKey()), true
+	}
+	return types.UnlockConditions{}, false
+}
+
 // Balance returns the balance of the wallet.
 func (sw *SingleAddressWallet) Balance() (spendable, confirmed, unconfirmed types.Currency, err error) {
 	done, err := sw.tg.Add()
@@ -226,7 +294,8 @@ func (sw *SingleAddressWallet) Balance() (spendable, confirmed, unconfirmed type
 	defer sw.mu.Unlock()
 	for _, sco := range outputs {
 		confirmed = confirmed.Add(sco.Value)
-		if !sw.locked[sco.ID] && !sw.tpoolSpent[sco.ID] {
+		// outputs sent to retired addresses are only spent by sweeps
+		if sco.Address == sw.addr && !sw.locked[sco.ID] && !sw.tpoolSpent[sco.ID] {
 			spendable = spendable.Add(sco.Value)
 		}
 	}
@@ -262,8 +331,9 @@ func (sw *SingleAddressWallet) TransactionCount() (uint64, error) {
 // FundTransaction adds siacoin inputs worth at least amount to the provided
 // transaction. If necessary, a change output will also be added. The inputs
 // will not be available to future calls to FundTransaction unless ReleaseInputs
-// is called.
-func (sw *SingleAddressWallet) FundTransaction(txn *types.Transaction, amount types.Currency) ([]types.Hash256, func(), error) {
+// is called. If outputs are specified, only those outputs will be used to fund
+// the transaction.
+func (sw *SingleAddressWallet) FundTransaction(txn *types.Transaction, amount types.Currency, outputs ...types.SiacoinOutputID) ([]types.Hash256, func(), error) {
 	done, err := sw.tg.Add()
 	if err != nil {
 		return nil, nil, err
@@ -282,23 +352,44 @@ func (sw *SingleAddressWallet) FundTransaction(txn *types.Transaction, amount ty
 		return nil, nil, err
 	}
 
-	// remove locked and spent outputs
+	// remove locked and spent outputs and outputs sent to retired addresses
 	usableUTXOs := utxos[:0]
 	for _, sce := range utxos {
-		if sw.locked[sce.ID] || sw.tpoolSpent[sce.ID] || sw.consensusLocked[sce.ID] {
+		if sce.Address != sw.addr || sw.locked[sce.ID] || sw.tpoolSpent[sce.ID] || sw.consensusLocked[sce.ID] {
 			continue
 		}
 		usableUTXOs = append(usableUTXOs, sce)
 	}
 
+	var selected []SiacoinElement
+	var inputSum types.Currency
+	if len(outputs) > 0 {
+		// use only the outputs chosen by the caller
+		usable := make(map[types.SiacoinOutputID]SiacoinElement, len(usableUTXOs))
+		for _, sce := range usableUTXOs {
+			usable[sce.ID] = sce
+		}
+		for _, id := range outputs {
+			sce, ok := usable[id]
+			if !ok {
+				return nil, nil, fmt.Errorf("output %v: %w", id, ErrOutputUnavailable)
+			}
+			delete(usable, id) // prevent duplicates
+			selected = append(selected, sce)
+			inputSum = inputSum.Add(sce.Value)
+		}
+		if inputSum.Cmp(amount) < 0 {
+			return nil, nil, ErrNotEnoughFunds
+		}
+		return sw.addFundingInputs(txn, amount, selected, inputSum), sw.releaseFunc(selected), nil
+	}
+
 	// sort by value, descending
 	sort.Slice(usableUTXOs, func(i, j int) bool {
 		return usableUTXOs[i].Value.Cmp(usableUTXOs[j].Value) > 0
 	})
 
 	// fund the transaction using the largest utxos first
-	var selected []SiacoinElement
-	var inputSum types.Currency
 	for i, sce := range usableUTXOs {
 		if inputSum.Cmp(amount) >= 0 {
 			usableUTXOs = usableUTXOs[i:]
@@ -333,6 +424,13 @@ func (sw *SingleAddressWallet) FundTransaction(txn *types.Transaction, amount ty
 		}
 	}
 
+	return sw.addFundingInputs(txn, amount, selected, inputSum), sw.releaseFunc(selected), nil
+}
+
+// addFundingInputs adds the selected outputs and a change output, if
+// necessary, to the transaction and locks the selected outputs. sw.mu must be
+// held.
+func (sw *SingleAddressWallet) addFundingInputs(txn *types.Transaction, amount types.Currency, selected []SiacoinElement, inputSum types.Currency) []types.Hash256 {
 	// add a change output if necessary
 	if inputSum.Cmp(amount) > 0 {
 		txn.SiacoinOutputs = append(txn.SiacoinOutputs, types.SiacoinOutput{
@@ -350,15 +448,18 @@ func (sw *SingleAddressWallet) FundTransaction(txn *types.Transaction, amount ty
 		toSign[i] = types.Hash256(sce.ID)
 		sw.locked[sce.ID] = true
 	}
+	return toSign
+}
 
-	release := func() {
+// releaseFunc returns a function that unlocks the selected outputs.
+func (sw *SingleAddressWallet) releaseFunc(selected []SiacoinElement) func() {
+	return func() {
 		sw.mu.Lock()
 		defer sw.mu.Unlock()
-		for _, id := range toSign {
-			delete(sw.locked, types.SiacoinOutputID(id))
+		for _, sce := range selected {
+			delete(sw.locked, sce.ID)
 		}
 	}
-	return toSign, release, nil
 }
 
 // SignTransaction adds a signature to each of the specified inputs.
@@ -369,6 +470,8 @@ func (sw *SingleAddressWallet) SignTransaction(cs consensus.State, txn *types.Tr
 	}
 	defer done()
 
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
 	for _, id := range toSign {
 		var h types.Hash256
 		if cf.WholeTransaction {
@@ -376,7 +479,7 @@ func (sw *SingleAddressWallet) SignTransaction(cs consensus.State, txn *types.Tr
 		} else {
 			h = cs.PartialSigHash(*txn, cf)
 		}
-		sig := sw.priv.SignHash(h)
+		sig := sw.signingKey(*txn, id).SignHash(h)
 		txn.Signatures = append(txn.Signatures, types.TransactionSignature{
 			ParentID:       id,
 			CoveredFields:  cf,
@@ -387,6 +490,21 @@ func (sw *SingleAddressWallet) SignTransaction(cs consensus.State, txn *types.Tr
 	return nil
 }
 
+// signingKey returns the key that should sign the input with the given parent
+// ID. Inputs spending outputs of a retired address are signed with the retired
+// key. sw.mu must be held.
+func (sw *SingleAddressWallet) signingKey(txn types.Transaction, id types.Hash256) types.PrivateKey {
+	for _, sci := range txn.SiacoinInputs {
+		if types.Hash256(sci.ParentID) != id {
+			continue
+		} else if key, ok := sw.retired[sci.UnlockConditions.UnlockHash()]; ok {
+			return key
+		}
+		break
+	}
+	return sw.priv
+}
+
 // ScanHeight returns the block height the wallet has scanned to.
 func (sw *SingleAddressWallet) ScanHeight() uint64 {
 	return atomic.LoadUint64(&sw.scanHeight)
@@ -452,7 +570,7 @@ func (sw *SingleAddressWallet) ReceiveUpdatedUnconfirmedTransactions(diff *modul
 				Timestamp:   time.Now(),
 			}
 			for _, sci := range txn.SiacoinInputs {
-				if sci.UnlockConditions.UnlockHash() != sw.addr {
+				if !sw.ownsAddress(sci.UnlockConditions.UnlockHash()) {
 					continue
 				}
 				relevant = true
@@ -469,7 +587,7 @@ func (sw *SingleAddressWallet) ReceiveUpdatedUnconfirmedTransactions(diff *modul
 			}
 
 			for i, sco := range txn.SiacoinOutputs {
-				if sco.Address != sw.addr {
+				if !sw.ownsAddress(sco.Address) {
 					continue
 				}
 				relevant = true
@@ -515,6 +633,7 @@ func (sw *SingleAddressWallet) ProcessConsensusChange(cc modules.ConsensusChange
 
 	sw.log.Debug("processing consensus change", zap.Int("applied", len(cc.AppliedBlocks)), zap.Int("reverted", len(cc.RevertedBlocks)))
 	start := time.Now()
+	owned := sw.ownedAddresses()
 
 	// create payout transactions for each matured siacoin output. Each diff
 	// should correspond to an applied block. This is done outside of the
@@ -557,7 +676,7 @@ func (sw *SingleAddressWallet) ProcessConsensusChange(cc modules.ConsensusChange
 		for _, dsco := range diff.DelayedSiacoinOutputDiffs {
 			// if a delayed output is reverted in an applied diff, the
 			// output has matured -- add a payout transaction.
-			if types.Address(dsco.SiacoinOutput.UnlockHash) != sw.addr || dsco.Direction != modules.DiffRevert {
+			if !owned[types.Address(dsco.SiacoinOutput.UnlockHash)] || dsco.Direction != modules.DiffRevert {
 				continue
 			}
 			// contract payouts are harder to identify, any unknown output
@@ -602,7 +721,7 @@ func (sw *SingleAddressWallet) ProcessConsensusChange(cc modules.ConsensusChange
 	err = sw.store.UpdateWallet(cc.ID, uint64(cc.BlockHeight), func(tx UpdateTransaction) error {
 		// add new siacoin outputs and remove spent or reverted siacoin outputs
 		for _, diff := range cc.SiacoinOutputDiffs {
-			if types.Address(diff.SiacoinOutput.UnlockHash) != sw.addr {
+			if !owned[types.Address(diff.SiacoinOutput.UnlockHash)] {
 				continue
 			}
 			if diff.Direction == modules.DiffApply {
@@ -638,7 +757,7 @@ func (sw *SingleAddressWallet) ProcessConsensusChange(cc modules.ConsensusChange
 			for _, sco := range diff.SiacoinOutputDiffs {
 				var addr types.Address
 				copy(addr[:], sco.SiacoinOutput.UnlockHash[:])
-				if addr != sw.addr {
+				if !owned[addr] {
 					continue
 				}
 
@@ -662,7 +781,7 @@ func (sw *SingleAddressWallet) ProcessConsensusChange(cc modules.ConsensusChange
 			for _, sco := range diff.SiacoinOutputDiffs {
 				var addr types.Address
 				copy(addr[:], sco.SiacoinOutput.UnlockHash[:])
-				if addr != sw.addr {
+				if !owned[addr] {
 					continue
 				}
 
@@ -696,17 +815,17 @@ func (sw *SingleAddressWallet) ProcessConsensusChange(cc modules.ConsensusChange
 			// apply actual transactions -- only relevant transactions should be
 			// added to the database
 			for _, txn := range block.Transactions {
-				if !transactionIsRelevant(txn, sw.addr) {
+				if !transactionIsRelevant(txn, owned) {
 					continue
 				}
 				var inflow, outflow types.Currency
 				for _, out := range txn.SiacoinOutputs {
-					if out.Address == sw.addr {
+					if owned[out.Address] {
 						inflow = inflow.Add(out.Value)
 					}
 				}
 				for _, in := range txn.SiacoinInputs {
-					if in.UnlockConditions.UnlockHash() == sw.addr {
+					if owned[in.UnlockConditions.UnlockHash()] {
 						so, ok := spentOutputs[in.ParentID]
 						if !ok {
 							panic("spent output not found")
@@ -756,7 +875,7 @@ func (sw *SingleAddressWallet) ProcessConsensusChange(cc modules.ConsensusChange
 	sw.mu.Unlock()
 
 	atomic.StoreUint64(&sw.scanHeight, uint64(cc.BlockHeight))
-	sw.log.Debug("applied consensus change", zap.String("changeID", cc.ID.String()), zap.Int("applied", len(cc.AppliedBlocks)), zap.Int("reverted", len(cc.RevertedBlocks)), zap.Uint64("height", uint64(cc.BlockHeight)), zap.Duration("elapsed", time.Since(start)), zap.String("address", sw.addr.String()))
+	sw.log.Debug("applied consensus change", zap.String("changeID", cc.ID.String()), zap.Int("applied", len(cc.AppliedBlocks)), zap.Int("reverted", len(cc.RevertedBlocks)), zap.Uint64("height", uint64(cc.BlockHeight)), zap.Duration("elapsed", time.Since(start)), zap.String("address", sw.Address().String()))
 }
 
 // payoutTransaction wraps a delayed siacoin output in a transaction for display
@@ -786,12 +905,33 @@ func convertToCore(siad encoding.SiaMarshaler, core types.DecoderFrom) {
 }
 
 // NewSingleAddressWallet returns a new SingleAddressWallet using the provided private key and store.
-func NewSingleAddressWallet(priv types.PrivateKey, cm ChainManager, tp TransactionPool, store SingleAddressStore, log *zap.Logger) (*SingleAddressWallet, error) {
+func NewSingleAddressWallet(priv types.PrivateKey, cm ChainManager, tp TransactionPool, store SingleAddressStore, a Alerts, log *zap.Logger) (*SingleAddressWallet, error) {
 	changeID, scanHeight, err := store.LastWalletChange()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get last wallet change: %w", err)
 	}
 
+	retiredKeys, err := store.RetiredWalletKeys()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get retired wallet keys: %w", err)
+	}
+	addr := types.StandardUnlockHash(priv.PublicKey())
+	retired := make(map[types.Address]types.PrivateKey)
+	for _, rk := range retiredKeys {
+		if rk.Address == addr {
+			return nil, ErrKeyRetired
+		}
+		// the retired keys can only be decrypted with the key they were
+		// rotated to. If the recovery phrase was replaced without a
+		// rotation, they are no longer usable.
+		key, err := openRetiredKey(priv, rk)
+		if err != nil {
+			log.Warn("failed to decrypt retired wallet key", zap.Stringer("address", rk.Address), zap.Error(err))
+			continue
+		}
+		retired[rk.Address] = key
+	}
+
 	seedHash := types.HashBytes(priv[:])
 	if err := store.VerifyWalletKey(seedHash); errors.Is(err, ErrDifferentSeed) {
 		changeID = modules.ConsensusChangeBeginning
@@ -805,15 +945,18 @@ func NewSingleAddressWallet(priv types.PrivateKey, cm ChainManager, tp Transacti
 	}
 
 	sw := &SingleAddressWallet{
-		priv:       priv,
 		scanHeight: scanHeight,
 
-		store: store,
-		cm:    cm,
-		log:   log,
-		tg:    threadgroup.New(),
+		store:  store,
+		cm:     cm,
+		tp:     tp,
+		alerts: a,
+		log:    log,
+		tg:     threadgroup.New(),
 
-		addr: types.StandardUnlockHash(priv.PublicKey()),
+		priv:    priv,
+		addr:    addr,
+		retired: retired,
 
 		locked:          make(map[types.SiacoinOutputID]bool),
 		consensusLocked: make(map[types.SiacoinOutputID]bool),
@@ -839,5 +982,7 @@ func NewSingleAddressWallet(priv types.PrivateKey, cm ChainManager, tp Transacti
 		}
 	}()
 	tp.Subscribe(sw)
+	go sw.runSweeper()
+	go sw.runConsolidator()
 	return sw, nil
 }
@@ -1,7 +1,9 @@
 package wallet_test
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"sort"
 	"testing"
 	"time"
@@ -405,3 +407,215 @@ func TestWalletUTXOSelection(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestRotateKey(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	oldKey := types.GeneratePrivateKey()
+	w, err := test.NewWallet(oldKey, t.TempDir(), log.Named("wallet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	oldAddr := w.Address()
+	initialState := w.TipState()
+	// mine a block to fund the wallet and wait for the payout to mature
+	if err := w.MineBlocks(oldAddr, 1); err != nil {
+		t.Fatal(err)
+	} else if err := w.MineBlocks(types.VoidAddress, int(stypes.MaturityDelay)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond) // sleep for consensus sync
+
+	// rotating to the current key should fail
+	if _, err := w.RotateKey(oldKey); !errors.Is(err, wallet.ErrKeyInUse) {
+		t.Fatalf("expected ErrKeyInUse, got %v", err)
+	}
+
+	newKey := types.GeneratePrivateKey()
+	newAddr := types.StandardUnlockHash(newKey.PublicKey())
+	result, err := w.RotateKey(newKey)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(result.Transactions) != 1 {
+		t.Fatalf("expected 1 sweep transaction, got %v", len(result.Transactions))
+	} else if result.Swept.Cmp(initialState.BlockReward()) >= 0 || result.Swept.IsZero() {
+		t.Fatalf("expected swept value less than %v, got %v", initialState.BlockReward(), result.Swept)
+	} else if w.Address() != newAddr {
+		t.Fatalf("expected address %v, got %v", newAddr, w.Address())
+	} else if len(w.Alerts().Active()) != 1 {
+		t.Fatalf("expected 1 rotation alert, got %v", len(w.Alerts().Active()))
+	}
+
+	// the sweep should be confirmed to the new address
+	if err := w.MineBlocks(types.VoidAddress, 1); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	checkBalance := func(expected types.Currency) {
+		t.Helper()
+		spendable, _, _, err := w.Balance()
+		if err != nil {
+			t.Fatal(err)
+		} else if !spendable.Equals(expected) {
+			t.Fatalf("expected spendable balance %v, got %v", expected, spendable)
+		}
+		utxos, err := w.Store().UnspentSiacoinElements()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, sce := range utxos {
+			if sce.Address != newAddr {
+				t.Fatalf("expected output %v to be sent to %v, got %v", sce.ID, newAddr, sce.Address)
+			}
+		}
+	}
+	checkBalance(result.Swept)
+	if len(w.Alerts().Active()) != 0 {
+		t.Fatalf("expected rotation alert to be dismissed, got %v", w.Alerts().Active())
+	}
+
+	// outputs sent to the retired address should be swept automatically
+	state := w.TipState()
+	if err := w.MineBlocks(oldAddr, 1); err != nil {
+		t.Fatal(err)
+	} else if err := w.MineBlocks(types.VoidAddress, int(stypes.MaturityDelay)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second) // sleep for consensus sync and the sweeper
+	if err := w.MineBlocks(types.VoidAddress, 1); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	_, balance, _, err := w.Balance()
+	if err != nil {
+		t.Fatal(err)
+	} else if balance.Cmp(result.Swept) <= 0 || balance.Cmp(result.Swept.Add(state.BlockReward())) >= 0 {
+		t.Fatalf("expected the second payout to be swept, got balance %v", balance)
+	}
+	checkBalance(balance)
+
+	// the retired key should only be stored encrypted
+	retiredKeys, err := w.Store().RetiredWalletKeys()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(retiredKeys) != 1 || retiredKeys[0].Address != oldAddr {
+		t.Fatalf("expected retired key for %v, got %v", oldAddr, retiredKeys)
+	} else if bytes.Contains(retiredKeys[0].EncryptedKey, oldKey[:32]) {
+		t.Fatal("retired key stored in plaintext")
+	}
+
+	// the retired key should not be usable to open the wallet
+	_, err = wallet.NewSingleAddressWallet(oldKey, w.ChainManager(), w.TPool(), w.Store(), w.Alerts(), log.Named("retired"))
+	if !errors.Is(err, wallet.ErrKeyRetired) {
+		t.Fatalf("expected ErrKeyRetired, got %v", err)
+	}
+}
+
+func TestConsolidate(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	w, err := test.NewWallet(types.GeneratePrivateKey(), t.TempDir(), log.Named("wallet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// mine until the wallet has 20 mature outputs
+	if err := w.MineBlocks(w.Address(), 20+int(stypes.MaturityDelay)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second) // sleep for consensus sync
+
+	outputs, err := w.UnspentOutputs()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(outputs) != 20 {
+		t.Fatalf("expected 20 outputs, got %v", len(outputs))
+	}
+
+	// fund a transaction using a specific output
+	smallest := outputs[len(outputs)-1]
+	txn := types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{Address: types.VoidAddress, Value: types.Siacoins(1)}},
+	}
+	if _, _, err := w.FundTransaction(&txn, types.Siacoins(1), types.SiacoinOutputID{1}); !errors.Is(err, wallet.ErrOutputUnavailable) {
+		t.Fatalf("expected ErrOutputUnavailable, got %v", err)
+	} else if _, _, err := w.FundTransaction(&txn, smallest.Value.Add(types.NewCurrency64(1)), smallest.ID); !errors.Is(err, wallet.ErrNotEnoughFunds) {
+		t.Fatalf("expected ErrNotEnoughFunds, got %v", err)
+	}
+	_, release, err := w.FundTransaction(&txn, types.Siacoins(1), smallest.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(txn.SiacoinInputs) != 1 || txn.SiacoinInputs[0].ParentID != smallest.ID {
+		t.Fatalf("expected transaction to spend %v, got %v", smallest.ID, txn.SiacoinInputs)
+	}
+
+	outputs, err = w.UnspentOutputs()
+	if err != nil {
+		t.Fatal(err)
+	} else if !outputs[len(outputs)-1].Locked {
+		t.Fatal("expected funded output to be locked")
+	}
+	release()
+
+	// consolidate the smallest outputs
+	ctxn, err := w.Consolidate(10, w.TPool().RecommendedFee())
+	if err != nil {
+		t.Fatal(err)
+	} else if len(ctxn.SiacoinInputs) != 10 {
+		t.Fatalf("expected 10 inputs, got %v", len(ctxn.SiacoinInputs))
+	} else if len(ctxn.SiacoinOutputs) != 1 || ctxn.SiacoinOutputs[0].Address != w.Address() {
+		t.Fatalf("expected a single output to the wallet, got %v", ctxn.SiacoinOutputs)
+	}
+	// outputs are ordered by value descending, so the last 10 should be
+	// consolidated
+	values := make(map[types.SiacoinOutputID]types.Currency)
+	for _, o := range outputs {
+		values[o.ID] = o.Value
+	}
+	maxValue := outputs[len(outputs)-10].Value
+	for _, sci := range ctxn.SiacoinInputs {
+		if values[sci.ParentID].Cmp(maxValue) > 0 {
+			t.Fatalf("expected only the smallest outputs to be consolidated, got %v", values[sci.ParentID])
+		}
+	}
+
+	outputs, err = w.UnspentOutputs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pending int
+	for _, o := range outputs {
+		if o.Pending {
+			pending++
+		}
+	}
+	if pending != 10 {
+		t.Fatalf("expected 10 pending outputs, got %v", pending)
+	}
+
+	// confirm the consolidation
+	if err := w.MineBlocks(types.VoidAddress, 1); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	outputs, err = w.UnspentOutputs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unspent := make(map[types.SiacoinOutputID]bool)
+	for _, o := range outputs {
+		unspent[o.ID] = true
+	}
+	if !unspent[ctxn.SiacoinOutputID(0)] {
+		t.Fatal("expected consolidated output to be unspent")
+	}
+	for _, sci := range ctxn.SiacoinInputs {
+		if unspent[sci.ParentID] {
+			t.Fatalf("expected output %v to be spent", sci.ParentID)
+		}
+	}
+}